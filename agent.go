@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+
+	"github.com/Ptechgithub/CloudflareScanner/task"
+)
+
+// Runs the latency probes of controllers scanning with -agent, e.g. on a measurement box
+func agentCommand(args []string) error {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	listen := fs.String("listen", ":7890", "Address controllers connect to")
+	token := fs.String("token", "", "Shared secret controllers must present")
+	routines := fs.Int("n", 200, "Connections at once")
+	fs.Float64Var(&task.PoliteRate, "polite-rate", 2, "Connections per second to one IP")
+	impolite := fs.Bool("i-know-what-im-doing", false, "Probe any IP without a rate cap")
+	_ = fs.Parse(args)
+	if *token == "" {
+		return errors.New("usage: agent -token secret [-listen :7890] [-n 200] [-polite-rate 2] [-i-know-what-im-doing]")
+	}
+	if *routines < 1 {
+		return errors.New("n must be at least 1")
+	}
+	// Controllers choose the IPs, so the agent is polite unless told otherwise
+	task.Polite = !*impolite
+	if err := task.CheckPolite(); err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[Info] Agent listening on %s\n", l.Addr())
+	return task.ServeAgent(l, *token, *routines)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const archiveTimeFormat = "20060102T150405Z"
+
+var archiveNameRegexp = regexp.MustCompile(`^result-\d{8}T\d{6}Z\.csv\.gz$`)
+
+// Retention of the results archived after each serve run or daemon cycle
+type archivePolicy struct {
+	enabled  bool
+	keep     time.Duration // 0 keeps archives forever
+	maxFiles int           // 0 is unlimited
+}
+
+// Defines the -archive, -archive-keep and -archive-max flags on fs, returning the policy they set once fs is parsed
+func archiveFlags(fs *flag.FlagSet) func() (archivePolicy, error) {
+	archive := fs.Bool("archive", false, "Keep a gzip-compressed, timestamped copy of every result")
+	keep := fs.String("archive-keep", "", "Drop archived results older than this, e.g. 30d")
+	maxFiles := fs.Int("archive-max", 0, "Archived results kept, 0 is unlimited")
+	return func() (archivePolicy, error) {
+		p := archivePolicy{enabled: *archive, maxFiles: *maxFiles}
+		if *maxFiles < 0 {
+			return p, errors.New("archive-max can't be negative")
+		}
+		if *keep != "" {
+			var err error
+			if p.keep, err = utils.ParseAge(*keep); err != nil {
+				return p, err
+			}
+		}
+		return p, nil
+	}
+}
+
+// Stores a gzip-compressed, timestamped copy of a result file in dir, then drops the archives the policy no longer keeps
+func (p archivePolicy) store(result, dir string, now time.Time) error {
+	if !p.enabled {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	in, err := os.Open(result)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	name := filepath.Join(dir, "result-"+now.UTC().Format(archiveTimeFormat)+".csv.gz")
+	out, err := os.Create(name + ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), name)
+	}
+	if err != nil {
+		return err
+	}
+	return p.rotate(dir, now)
+}
+
+// Drops the archives in dir beyond maxFiles or older than keep
+func (p archivePolicy) rotate(dir string, now time.Time) error {
+	names, err := listArchives(dir)
+	if err != nil {
+		return err
+	}
+	for i, name := range names {
+		created, err := time.Parse(archiveTimeFormat, name[len("result-"):len("result-")+len(archiveTimeFormat)])
+		expired := err == nil && p.keep > 0 && now.Sub(created) > p.keep
+		if p.maxFiles > 0 && i >= p.maxFiles || expired {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Archived result files in dir, newest first
+func listArchives(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, e := range entries {
+		if archiveNameRegexp.MatchString(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	// The timestamp format sorts by name
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
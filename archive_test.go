@@ -0,0 +1,130 @@
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestArchiveStore(t *testing.T) {
+	dir := t.TempDir()
+	result := filepath.Join(dir, "result.csv")
+	rows := "IP Address,Sent,Received,Loss Rate,Average Delay (ms),Download Speed (MB/s)\n1.1.1.1,4,4,0.00,100.00,5.00\n"
+	if err := os.WriteFile(result, []byte(rows), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(dir, "archive")
+	now := time.Date(2026, 10, 16, 12, 30, 5, 0, time.FixedZone("IRST", 3*3600+1800))
+	if err := (archivePolicy{}).store(result, archive, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Error("archived with archiving disabled")
+	}
+
+	if err := (archivePolicy{enabled: true}).store(result, archive, now); err != nil {
+		t.Fatal(err)
+	}
+	names, err := listArchives(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Named by the time in UTC, without leftovers of the write
+	if want := []string{"result-20261016T090005Z.csv.gz"}; !slices.Equal(names, want) {
+		t.Fatalf("archives = %v, want %v", names, want)
+	}
+	if entries, _ := os.ReadDir(archive); len(entries) != 1 {
+		t.Errorf("%d files in the archive directory, want 1", len(entries))
+	}
+	f, err := os.Open(filepath.Join(archive, names[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(zr); err != nil || string(data) != rows {
+		t.Errorf("archived %q, %v, want the result file", data, err)
+	}
+
+	if err := (archivePolicy{enabled: true}).store(filepath.Join(dir, "missing.csv"), archive, now.Add(time.Hour)); err == nil {
+		t.Error("archived a missing result file")
+	}
+}
+
+func TestArchiveRotate(t *testing.T) {
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		policy archivePolicy
+		want   []string
+	}{
+		{"unlimited", archivePolicy{enabled: true}, []string{"20261016T000000Z", "20261015T000000Z", "20261010T000000Z", "20260916T000000Z"}},
+		{"max", archivePolicy{enabled: true, maxFiles: 2}, []string{"20261016T000000Z", "20261015T000000Z"}},
+		{"keep", archivePolicy{enabled: true, keep: 7 * 24 * time.Hour}, []string{"20261016T000000Z", "20261015T000000Z", "20261010T000000Z"}},
+		{"both", archivePolicy{enabled: true, keep: 2 * 24 * time.Hour, maxFiles: 3}, []string{"20261016T000000Z", "20261015T000000Z"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range []string{"result-20261015T000000Z.csv.gz", "result-20261010T000000Z.csv.gz", "result-20260916T000000Z.csv.gz", "notes.txt"} {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			result := filepath.Join(t.TempDir(), "result.csv")
+			if err := os.WriteFile(result, []byte("IP Address\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.policy.store(result, dir, now); err != nil {
+				t.Fatal(err)
+			}
+			names, err := listArchives(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []string
+			for _, ts := range tt.want {
+				want = append(want, "result-"+ts+".csv.gz")
+			}
+			if !slices.Equal(names, want) {
+				t.Errorf("archives = %v, want %v", names, want)
+			}
+			// Other files are left alone
+			if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestArchiveFlags(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    archivePolicy
+		wantErr bool
+	}{
+		{nil, archivePolicy{}, false},
+		{[]string{"-archive", "-archive-keep", "30d", "-archive-max", "100"}, archivePolicy{enabled: true, keep: 30 * 24 * time.Hour, maxFiles: 100}, false},
+		{[]string{"-archive", "-archive-keep", "soon"}, archivePolicy{}, true},
+		{[]string{"-archive", "-archive-max", "-1"}, archivePolicy{}, true},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		archive := archiveFlags(fs)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		policy, err := archive()
+		if (err != nil) != tt.wantErr || err == nil && policy != tt.want {
+			t.Errorf("%v: policy = %+v, %v, want %+v", tt.args, policy, err, tt.want)
+		}
+	}
+}
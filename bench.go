@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/task"
+)
+
+// Measures the local overhead of the scan, so weak hardware can pick settings its own CPU keeps up with
+func benchCommand(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	n := fs.Int("n", 50, "Handshakes per fingerprint")
+	fragments := fs.Int("fragment-n", 3, "Handshakes per fragment preset, the delayed presets take seconds each")
+	fs.StringVar(&task.ClientHelloID, "fingerprint", "chrome", "TLS fingerprint of the fragment bench")
+	window := fs.Duration("time", time.Second, "Duration of each step of the concurrency bench")
+	_ = fs.Parse(args)
+	if *n < 1 || *fragments < 1 || *window <= 0 {
+		return errors.New("usage: bench [-n 50] [-fragment-n 3] [-fingerprint chrome] [-time 1s]")
+	}
+	fmt.Printf("[Info] Benchmarking on %d CPUs against a local edge, handshake times include its side\n\n", runtime.GOMAXPROCS(0))
+
+	hellos := task.BenchHandshakes(*n)
+	fmt.Printf("%-14s%-18s%s\n", "Fingerprint", "Handshake (ms)", "Handshakes/s per CPU")
+	for _, r := range hellos {
+		if r.Err != nil {
+			fmt.Printf("%-14sfailed: %v\n", r.Name, r.Err)
+			continue
+		}
+		fmt.Printf("%-14s%-18.2f%.0f\n", r.Name, ms(r.Mean), float64(time.Second)/float64(r.Mean))
+	}
+
+	presets, err := task.BenchFragments(*fragments)
+	if err != nil {
+		return fmt.Errorf("fragment bench: %v", err)
+	}
+	fmt.Printf("\n%-18s%-18s%-14s%s\n", "Fragment", "Handshake (ms)", "Delays (ms)", "Overhead (ms)")
+	base := presets[0].Mean
+	for _, r := range presets {
+		if r.Err != nil {
+			fmt.Printf("%-18sfailed: %v\n", r.Name, r.Err)
+			continue
+		}
+		// What the fragmenter costs beyond its deliberate delays
+		fmt.Printf("%-18s%-18.2f%-14.2f%.2f\n", r.Name, ms(r.Mean), ms(r.Delay), ms(max(r.Mean-r.Delay-base, 0)))
+	}
+
+	steps, err := task.BenchConcurrency(*window)
+	if err != nil {
+		return fmt.Errorf("concurrency bench: %v", err)
+	}
+	fmt.Printf("\n%-10s%-16s%s\n", "Threads", "Connections/s", "Failed")
+	for _, r := range steps {
+		fmt.Printf("%-10d%-16.0f%d\n", r.Threads, r.Rate, r.Failed)
+	}
+	threads, rate := task.SaturatingThreads(steps)
+	auto := task.AutoRoutines(runtime.GOMAXPROCS(0), 0)
+	fmt.Printf("\n[Info] This machine opens up to %.0f connections/s, reached with %d threads; the default [-n] here is %d.\n", rate, threads, auto)
+	fastest := hellos[0]
+	if i := slices.IndexFunc(hellos, func(r task.HandshakeBench) bool { return r.Name == task.ClientHelloID }); i >= 0 && fastest.Err == nil && hellos[i].Err == nil && hellos[i].Mean > 2*fastest.Mean {
+		fmt.Printf("[Tip] [-fingerprint %s] costs %.1fx the CPU of %s, consider it for [-httping] on slow devices.\n", task.ClientHelloID, float64(hellos[i].Mean)/float64(fastest.Mean), fastest.Name)
+	}
+	return nil
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
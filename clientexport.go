@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/clientconf"
+	"github.com/Ptechgithub/CloudflareScanner/task"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const clientExportUsage = "usage: client-export -format surge|quantumult|shadowrocket -template server.txt [-n 5] [-group CF] [-recheck [-tp 443]] [-o file] [result.csv]"
+
+// Writes the best results as iOS client servers from a server template, e.g.
+// "client-export -format surge -template server.txt", with server.txt holding "CF-{n} = trojan, {ip}, 443, password=..., sni=a.com"
+func clientExportCommand(args []string) error {
+	fs := flag.NewFlagSet("client-export", flag.ExitOnError)
+	format := fs.String("format", "", "Client: surge, quantumult (Quantumult X) or shadowrocket (subscription of share links)")
+	templateFile := fs.String("template", "", "File of the server line, with {ip}, {n}, {delay} and {speed} placeholders")
+	count := fs.Int("n", 5, "Best results written")
+	group := fs.String("group", "CF", "Policy group of the servers choosing the fastest, empty for none")
+	recheck := fs.Bool("recheck", false, "Connect to the IPs on -tp first, replacing dead ones with the next results")
+	fs.IntVar(&task.TCPPort, "tp", 443, "Port of the recheck, the -tp of the scan")
+	output := fs.String("o", "", "Output file, stdout by default")
+	_ = fs.Parse(args)
+	if *format == "" || *templateFile == "" || *count < 1 || fs.NArg() > 1 {
+		return errors.New(clientExportUsage)
+	}
+	path := "result.csv"
+	if fs.NArg() == 1 {
+		path = fs.Arg(0)
+	}
+	data, err := os.ReadFile(*templateFile)
+	if err != nil {
+		return err
+	}
+	template, err := clientconf.Template(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", *templateFile, err)
+	}
+	results, err := utils.ReadResults(path)
+	if err != nil {
+		return err
+	}
+	if *recheck {
+		if results, err = recheckResults(results, *count, task.TCPPort); err != nil {
+			return err
+		}
+	}
+	servers := make([]clientconf.Server, 0, min(*count, len(results)))
+	for _, r := range results[:min(*count, len(results))] {
+		servers = append(servers, clientconf.Server{IP: r.IP, Delay: r.Delay, Speed: r.Speed})
+	}
+	config, err := clientconf.Render(*format, template, *group, servers)
+	if err != nil {
+		return err
+	}
+	if *output == "" || *output == "-" {
+		_, err = os.Stdout.Write(config)
+		return err
+	}
+	if err := os.WriteFile(*output, config, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("[Info] Wrote %d servers to %s.\n", len(servers), *output)
+	return nil
+}
+
+// Results in the order to export them, the first n connecting to port first and the ones that don't last, so an IP
+// that died since the scan isn't published; an error when none connects
+func recheckResults(results []utils.Result, n, port int) ([]utils.Result, error) {
+	task.TCPPort = port
+	utils.Log = os.Stderr // Standard output may carry the export
+	ips := make([]*net.IPAddr, len(results))
+	for i, r := range results {
+		ips[i] = &net.IPAddr{IP: r.IP.AsSlice()}
+	}
+	order, errs := task.RecheckIPs(ips, n, task.HealthTCP)
+	if len(order) > 0 && errs[order[0]] != nil {
+		return nil, fmt.Errorf("none of the %d IPs passed the recheck", len(order))
+	}
+	rechecked := make([]utils.Result, len(order))
+	for j, i := range order {
+		rechecked[j] = results[i]
+	}
+	return rechecked, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/cidr"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+// Subcommands run instead of a scan, e.g. "CloudflareScanner reputation top". Their errors exit with 1, or with the code of
+// an exitError.
+var commands = map[string]func(args []string) error{
+	"agent":           agentCommand,
+	"bench":           benchCommand,
+	"cache":           cacheCommand,
+	"cidr":            cidrCommand,
+	"client-export":   clientExportCommand,
+	"consensus":       consensusCommand,
+	"daemon":          daemonCommand,
+	"deep-dive":       deepDiveCommand,
+	"export-profile":  exportProfileCommand,
+	"explain":         explainCommand,
+	"forward":         forwardCommand,
+	"fragment-tune":   fragmentTuneCommand,
+	"grafana-export":  grafanaExportCommand,
+	"healthcheck":     healthCheckCommand,
+	"matrix":          matrixCommand,
+	"monitor":         monitorCommand,
+	"reputation":      reputationCommand,
+	"self-update":     selfUpdateCommand,
+	"serve":           serveCommand,
+	"serve-dns":       serveDNSCommand,
+	"silence":         silenceCommand,
+	"try":             tryCommand,
+	"upstream-export": upstreamExportCommand,
+	"version":         versionCommand,
+}
+
+// Error of a subcommand exiting with a code other than 1, e.g. for the health checkers calling healthcheck. err is printed
+// to standard error as it is, without it nothing is.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit code %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// Returns the subcommand named by the first argument and its arguments, nil when scanning
+func subcommand() (func(args []string) error, []string) {
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		return nil, nil
+	}
+	return commands[os.Args[1]], os.Args[2:]
+}
+
+func reputationCommand(args []string) error {
+	if len(args) == 0 || args[0] != "top" {
+		return fmt.Errorf("usage: reputation top [-n 20] [-f reputation.db|reputation.json|postgres://...]")
+	}
+	fs := flag.NewFlagSet("reputation top", flag.ExitOnError)
+	n := fs.Int("n", 20, "Number of IPs to display")
+	file := fs.String("f", "reputation.db", "Reputation SQLite database, JSON file or Postgres URL")
+	_ = fs.Parse(args[1:])
+
+	store, err := utils.LoadReputation(*file, 0)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	top := store.Top(*n)
+	if len(top) == 0 {
+		fmt.Printf("[Info] No reputation history in %s.\n", *file)
+		return nil
+	}
+	fmt.Printf("%-40s%-12s%-8s%s\n", "IP Address", "Reputation", "Tests", "Last Tested")
+	for _, r := range top {
+		fmt.Printf("%-40s%-12.2f%-8d%s\n", r.IP, r.Value(), r.Tests, r.Updated.Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+func cacheCommand(args []string) error {
+	if len(args) == 0 || args[0] != "clear" {
+		return errors.New("usage: cache clear [-dir path]")
+	}
+	fs := flag.NewFlagSet("cache clear", flag.ExitOnError)
+	dir := fs.String("dir", utils.DefaultCacheDir(), "Disk cache directory")
+	_ = fs.Parse(args[1:])
+	if err := utils.ClearCache(*dir); err != nil {
+		return err
+	}
+	fmt.Printf("[Info] Cleared the disk cache in %s.\n", *dir)
+	return nil
+}
+
+const cidrUsage = "usage: cidr aggregate|count|expand|subtract [-f file] [-x ranges] [-xf file] [range ...]"
+
+// Set arithmetic on IP ranges, read from arguments, -f files or standard input
+func cidrCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(cidrUsage)
+	}
+	op := args[0]
+	fs := flag.NewFlagSet("cidr "+op, flag.ExitOnError)
+	var files, excludeFiles stringList
+	fs.Var(&files, "f", "File of ranges to read, repeatable")
+	exclude := fs.String("x", "", "Ranges to subtract, separated by commas")
+	fs.Var(&excludeFiles, "xf", "File of ranges to subtract, repeatable")
+	_ = fs.Parse(args[1:])
+
+	prefixes, err := readRanges(files, fs.Args(), true)
+	if err != nil {
+		return err
+	}
+	switch op {
+	case "aggregate":
+		printPrefixes(cidr.Aggregate(prefixes))
+	case "count":
+		fmt.Println(cidr.Count(prefixes))
+	case "expand":
+		w := bufio.NewWriter(os.Stdout)
+		defer w.Flush()
+		cidr.Expand(prefixes, func(a netip.Addr) bool {
+			_, err := fmt.Fprintln(w, a)
+			return err == nil
+		})
+	case "subtract":
+		var excluded []netip.Prefix
+		if excluded, err = readRanges(excludeFiles, strings.Split(*exclude, ","), false); err != nil {
+			return err
+		}
+		printPrefixes(cidr.Subtract(prefixes, excluded))
+	default:
+		return errors.New(cidrUsage)
+	}
+	return nil
+}
+
+// Ranges from files and arguments, standard input when there are neither and stdin is allowed
+func readRanges(files, ranges []string, stdin bool) ([]netip.Prefix, error) {
+	text := strings.Join(ranges, "\n")
+	if len(files) == 0 && strings.TrimSpace(text) == "" && stdin {
+		return cidr.ParseList(os.Stdin)
+	}
+	prefixes, err := cidr.ParseList(strings.NewReader(text))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		list, err := cidr.ParseList(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		prefixes = append(prefixes, list...)
+	}
+	return prefixes, nil
+}
+
+func printPrefixes(prefixes []netip.Prefix) {
+	for _, p := range prefixes {
+		fmt.Println(p)
+	}
+}
+
+// Repeatable string flag
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
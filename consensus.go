@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const consensusUsage = "usage: consensus [-o consensus.csv] [-p 10] [-min 1] [name=]result.csv [name=]result.csv ..."
+
+// Merges the result files of several machines or agents into one ranking, e.g. "consensus home=a.csv office=b.csv"
+func consensusCommand(args []string) error {
+	fs := flag.NewFlagSet("consensus", flag.ExitOnError)
+	output := fs.String("o", "consensus.csv", "Consensus result file")
+	printNum := fs.Int("p", 10, "Number of IPs to display")
+	minSeen := fs.Int("min", 1, "Vantages an IP must pass")
+	_ = fs.Parse(args)
+	if fs.NArg() < 2 {
+		return errors.New(consensusUsage)
+	}
+
+	vantages := make([]utils.Vantage, fs.NArg())
+	for i, arg := range fs.Args() {
+		name, path, named := strings.Cut(arg, "=")
+		if !named {
+			path = arg
+			name = strings.TrimSuffix(filepath.Base(arg), filepath.Ext(arg))
+		}
+		results, err := utils.ReadResults(path)
+		if err != nil {
+			return err
+		}
+		vantages[i] = utils.Vantage{Name: name, Results: results}
+	}
+	var consensus []utils.ConsensusResult
+	for _, c := range utils.Consensus(vantages) {
+		if c.Seen >= *minSeen {
+			consensus = append(consensus, c)
+		}
+	}
+
+	fmt.Printf("%-20s%-8s%-40s%s\n", "Vantage", "IPs", "Best IP", "Delay (ms)")
+	for _, v := range vantages {
+		if len(v.Results) == 0 {
+			fmt.Printf("%-20s%-8d%-40s%s\n", v.Name, 0, "-", "-")
+			continue
+		}
+		fmt.Printf("%-20s%-8d%-40s%s\n", v.Name, len(v.Results), v.Results[0].IP, consensusDelay(v.Results[0].Delay))
+	}
+	fmt.Println()
+	if len(consensus) == 0 {
+		fmt.Printf("[Info] No IP passed the tests of %d vantages.\n", *minSeen)
+		return nil
+	}
+	fmt.Printf("%-40s%-10s%-13s%-12s%s\n", "IP Address", "Vantages", "Worst Delay", "Mean Delay", "Mean Loss")
+	for i, c := range consensus {
+		if i == *printNum {
+			break
+		}
+		seen := fmt.Sprintf("%d/%d", c.Seen, len(vantages))
+		fmt.Printf("%-40s%-10s%-13s%-12s%.2f\n", c.IP, seen, consensusDelay(c.WorstDelay), consensusDelay(c.MeanDelay), c.MeanLoss)
+	}
+
+	if err := writeConsensus(*output, vantages, consensus); err != nil {
+		return err
+	}
+	fmt.Printf("\n[Info] Wrote %d IPs with the delay from each vantage to %s.\n", len(consensus), *output)
+	return nil
+}
+
+// Delay in ms, "-" for a vantage the IP didn't pass
+func consensusDelay(d time.Duration) string {
+	if d < 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 2, 64)
+}
+
+func writeConsensus(path string, vantages []utils.Vantage, consensus []utils.ConsensusResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	header := []string{"IP Address", "Vantages", "Worst Delay", "Mean Delay", "Mean Loss Rate", "Min Download Speed (MB/s)"}
+	for _, v := range vantages {
+		header = append(header, v.Name+" Delay")
+	}
+	_ = w.Write(header)
+	for _, c := range consensus {
+		row := []string{
+			c.IP.String(),
+			strconv.Itoa(c.Seen),
+			consensusDelay(c.WorstDelay),
+			consensusDelay(c.MeanDelay),
+			strconv.FormatFloat(c.MeanLoss, 'f', 2, 64),
+			strconv.FormatFloat(c.MinSpeed/1024/1024, 'f', 2, 64),
+		}
+		for _, d := range c.Delays {
+			row = append(row, consensusDelay(d))
+		}
+		_ = w.Write(row)
+	}
+	w.Flush()
+	return w.Error()
+}
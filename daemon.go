@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const daemonUsage = "usage: daemon [-every 1h] [-ttl 6h] [-degrade 1.5] [-n 10] [-o result.csv] [-heartbeat file] [-archive [-archive-keep 30d] [-archive-max 100]] [-- scan options]"
+
+// A kept result of the daemon, as written by its latest full test
+type daemonEntry struct {
+	result utils.Result
+	row    []string
+	tested time.Time
+}
+
+// Keeps a result file fresh at a fraction of the bandwidth of full rescans, e.g. "daemon -every 30m -ttl 6h -- -tl 200":
+// every cycle pings all kept results without downloading and fully re-tests only the aged or degraded ones
+func daemonCommand(args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	every := fs.Duration("every", time.Hour, "Interval of the cycles")
+	ttl := fs.Duration("ttl", 6*time.Hour, "Fully re-test results older than this")
+	degrade := fs.Float64("degrade", 1.5, "Fully re-test results whose ping delay grew this many times")
+	count := fs.Int("n", 10, "Results kept, a full scan refills them when fewer pass")
+	output := fs.String("o", "result.csv", "Result file kept up to date")
+	heartbeat := fs.String("heartbeat", "", "Heartbeat file, rewritten while the daemon waits or its scans make progress")
+	archive := archiveFlags(fs)
+	_ = fs.Parse(args)
+	if *every <= 0 || *ttl <= 0 || *degrade <= 1 || *count < 1 {
+		return errors.New(daemonUsage)
+	}
+	policy, err := archive()
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	// The archive sits next to the result file
+	archiveDir := filepath.Join(filepath.Dir(*output), "archive")
+	run := func(args ...string) ([]byte, error) {
+		return exec.Command(exe, args...).CombinedOutput()
+	}
+	dir, err := os.MkdirTemp("", "cfscan-daemon")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	d := &scanDaemon{
+		args:      fs.Args(),
+		result:    filepath.Join(dir, "result.csv"),
+		heartbeat: filepath.Join(dir, "heartbeat"),
+		entries:   make(map[netip.Addr]*daemonEntry),
+		run:       run,
+	}
+	// The scans only beat while they make progress, so a wedged one stops the daemon's heartbeat as well
+	defer utils.StartBeating(*heartbeat, d.status)()
+	fmt.Printf("[Info] Keeping %d results in %s, cycle every %v, full re-test after %v\n", *count, *output, *every, *ttl)
+	for {
+		now := time.Now()
+		if err := d.cycle(now, *ttl, *degrade, *count); err != nil {
+			fmt.Println("[!] Cycle failed, retrying at the next interval:", err)
+		} else if err := d.write(*output); err != nil {
+			fmt.Println("[!] Writing the results failed:", err)
+		} else if d.header != nil {
+			if err := policy.store(*output, archiveDir, now); err != nil {
+				fmt.Println("[!] Archiving the results failed:", err)
+			}
+		}
+		time.Sleep(time.Until(now.Add(*every)))
+	}
+}
+
+type scanDaemon struct {
+	args      []string // Scan options
+	result    string   // Result file of the child scans
+	heartbeat string   // Heartbeat file of the child scans
+	header    []string
+	entries   map[netip.Addr]*daemonEntry
+	scanned   time.Time // Of the last full scan
+	// Runs a scan with the options, returning its output
+	run func(args ...string) ([]byte, error)
+	// Start of the running scan in Unix nanoseconds, 0 between scans; read by the heartbeat
+	scanStart atomic.Int64
+}
+
+// Status of the daemon for its heartbeat: the progress of the running scan, not ok once it beat last over
+// utils.HeartbeatStall ago, or "waiting" between scans, including the sleep between cycles
+func (d *scanDaemon) status() (string, bool) {
+	start := d.scanStart.Load()
+	if start == 0 {
+		return "waiting", true
+	}
+	// A scan that just started hasn't beaten yet
+	last := time.Unix(0, start)
+	if info, err := os.Stat(d.heartbeat); err == nil && info.ModTime().After(last) {
+		last = info.ModTime()
+	}
+	return fmt.Sprintf("%.0f%%", readProgress(d.heartbeat)), time.Since(last) < utils.HeartbeatStall
+}
+
+// Pings the kept results, re-tests the aged and degraded ones and refills them with a full scan when too few remain
+func (d *scanDaemon) cycle(now time.Time, ttl time.Duration, degrade float64, count int) error {
+	ips := d.ips()
+	var aged, degraded []netip.Addr
+	if len(ips) > 0 {
+		pinged, _, err := d.scan(ips, "-dd")
+		if err != nil {
+			return err
+		}
+		for _, ip := range ips {
+			e, p := d.entries[ip], pinged[ip]
+			switch {
+			case now.Sub(e.tested) >= ttl:
+				aged = append(aged, ip)
+			case p == nil || p.result.LossRate > e.result.LossRate || float64(p.result.Delay) > degrade*float64(e.result.Delay):
+				degraded = append(degraded, ip)
+			}
+		}
+	}
+	retest := append(aged, degraded...)
+	dropped := 0
+	if len(retest) > 0 {
+		tested, header, err := d.scan(retest, "-dn", strconv.Itoa(len(retest)))
+		if err != nil {
+			return err
+		}
+		d.take(tested, header, now)
+		for _, ip := range retest {
+			if tested[ip] == nil {
+				delete(d.entries, ip)
+				dropped++
+			}
+		}
+	}
+	// When the ranges have fewer results, refilling waits for a drop or the TTL, unless there are none
+	discovered := 0
+	if len(d.entries) < count && (len(d.entries) == 0 || dropped > 0 || now.Sub(d.scanned) >= ttl) {
+		found, header, err := d.scan(nil, "-dn", strconv.Itoa(count))
+		if err != nil {
+			return err
+		}
+		d.scanned = now
+		for ip := range found {
+			if d.entries[ip] == nil {
+				discovered++
+			}
+		}
+		d.take(found, header, now)
+	}
+	// Only the results written are kept pinging
+	for _, ip := range d.ips()[min(count, len(d.entries)):] {
+		delete(d.entries, ip)
+	}
+	fmt.Printf("[Info] %s pinged %d, re-tested %d (%d aged, %d degraded), dropped %d, discovered %d\n",
+		now.Format("15:04:05"), len(ips), len(retest), len(aged), len(degraded), dropped, discovered)
+	return nil
+}
+
+// Keeps the results of a full test
+func (d *scanDaemon) take(entries map[netip.Addr]*daemonEntry, header []string, now time.Time) {
+	if len(entries) == 0 {
+		return
+	}
+	d.header = header
+	for ip, e := range entries {
+		e.tested = now
+		d.entries[ip] = e
+	}
+}
+
+// Kept IPs, fastest first
+func (d *scanDaemon) ips() []netip.Addr {
+	ips := make([]netip.Addr, 0, len(d.entries))
+	for ip := range d.entries {
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		a, b := d.entries[ips[i]].result, d.entries[ips[j]].result
+		if a.Speed != b.Speed {
+			return a.Speed > b.Speed
+		}
+		return a.Delay < b.Delay
+	})
+	return ips
+}
+
+// Runs a scan of ips (the scan options' IPs when nil) with extra options, returning its results by IP and the header of its
+// rows. When it downloads, results whose download failed with no speed are left out, even where the scan keeps them for
+// lack of better ones.
+func (d *scanDaemon) scan(ips []netip.Addr, extra ...string) (map[netip.Addr]*daemonEntry, []string, error) {
+	// Later flags win, so the scan options can't change the tested IPs or the output; only -i-know-what-im-doing turns -polite off
+	args := append(append([]string{}, d.args...), extra...)
+	if ips != nil {
+		list := make([]string, len(ips))
+		for i, ip := range ips {
+			list[i] = ip.String()
+		}
+		args = append(args, "-ip", strings.Join(list, ","))
+	}
+	args = append(args, "-o", d.result, "-p", "0", "-yes", "-polite", "-heartbeat", d.heartbeat)
+	_ = os.Remove(d.result)
+	_ = os.Remove(d.heartbeat)
+	d.scanStart.Store(time.Now().UnixNano())
+	output, err := d.run(args...)
+	d.scanStart.Store(0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	entries := make(map[netip.Addr]*daemonEntry)
+	list, err := utils.ReadResults(d.result)
+	if errors.Is(err, os.ErrNotExist) { // Nothing passed
+		return entries, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	records, err := readCSV(d.result)
+	if err != nil {
+		return nil, nil, err
+	}
+	downloads := !slices.Contains(extra, "-dd") && !d.latencyOnly()
+	for i, r := range list {
+		if downloads && r.Speed == 0 {
+			continue
+		}
+		entries[r.IP] = &daemonEntry{result: r, row: records[i+1]}
+	}
+	return entries, records[0], nil
+}
+
+// Whether the scan options disable the download test, ranking the results by latency
+func (d *scanDaemon) latencyOnly() bool {
+	for _, arg := range d.args {
+		if name, value, _ := strings.Cut(strings.TrimLeft(arg, "-"), "="); name == "dd" && value != "false" && strings.HasPrefix(arg, "-") {
+			return true
+		}
+	}
+	return false
+}
+
+// Writes the kept results, replacing the file at once so readers such as forward never see it half written
+func (d *scanDaemon) write(path string) error {
+	if d.header == nil {
+		return nil
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	_ = w.Write(d.header)
+	for _, ip := range d.ips() {
+		_ = w.Write(d.entries[ip].row)
+	}
+	w.Flush()
+	if err := errors.Join(w.Error(), f.Close()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readCSV(path string) ([][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	return r.ReadAll()
+}
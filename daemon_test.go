@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Daemon whose scans write a result file of the given IPs, with the speed of each in MB/s when they download
+func testDaemon(t *testing.T, args []string, speeds map[string]float64) *scanDaemon {
+	d := &scanDaemon{args: args, result: filepath.Join(t.TempDir(), "result.csv"), entries: make(map[netip.Addr]*daemonEntry)}
+	d.run = func(args ...string) ([]byte, error) {
+		ips := []string{"1.1.1.1", "1.1.1.2"}
+		if i := slices.Index(args, "-ip"); i >= 0 {
+			ips = strings.Split(args[i+1], ",")
+		}
+		rows := "IP Address,Sent,Received,Loss Rate,Average Delay (ms),Download Speed (MB/s)\n"
+		for _, ip := range ips {
+			speed := speeds[ip]
+			if slices.Contains(args, "-dd") {
+				speed = 0
+			}
+			rows += fmt.Sprintf("%s,4,4,0.00,100.00,%.2f\n", ip, speed)
+		}
+		return nil, os.WriteFile(d.result, []byte(rows), 0o644)
+	}
+	return d
+}
+
+func TestDaemonDownloadsFail(t *testing.T) {
+	// The scan keeps results whose download failed when none has a speed, the daemon doesn't
+	d := testDaemon(t, nil, nil)
+	now := time.Now()
+	if err := d.cycle(now, time.Hour, 1.5, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.entries) != 0 {
+		t.Errorf("kept %v after every download failed, want none", d.ips())
+	}
+	output := filepath.Join(t.TempDir(), "best.csv")
+	if err := d.write(output); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("wrote %s without results", output)
+	}
+
+	// Without results the next cycle scans again rather than waiting for the TTL
+	d2 := testDaemon(t, nil, map[string]float64{"1.1.1.2": 5})
+	d2.entries, d2.scanned = d.entries, now
+	if err := d2.cycle(now.Add(time.Minute), time.Hour, 1.5, 10); err != nil {
+		t.Fatal(err)
+	}
+	if ips := d2.ips(); len(ips) != 1 || ips[0].String() != "1.1.1.2" {
+		t.Errorf("kept %v, want only the IP that downloaded", ips)
+	}
+
+	// Latency-only scans have no speeds to fail
+	d3 := testDaemon(t, []string{"-dd"}, nil)
+	if err := d3.cycle(now, time.Hour, 1.5, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(d3.entries) != 2 {
+		t.Errorf("kept %v with -dd, want both IPs", d3.ips())
+	}
+}
+
+func TestDaemonHeartbeat(t *testing.T) {
+	d := testDaemon(t, nil, map[string]float64{"1.1.1.1": 5, "1.1.1.2": 3})
+	d.heartbeat = filepath.Join(t.TempDir(), "heartbeat")
+	if status, ok := d.status(); !ok || status != "waiting" {
+		t.Errorf("status between scans = %q, %v, want waiting", status, ok)
+	}
+
+	run := d.run
+	d.run = func(args ...string) ([]byte, error) {
+		if i := slices.Index(args, "-heartbeat"); i < 0 || args[i+1] != d.heartbeat {
+			t.Errorf("scan options %q lack -heartbeat %s", args, d.heartbeat)
+		}
+		// The scan hasn't beaten yet
+		if _, ok := d.status(); !ok {
+			t.Error("no beat at the start of a scan")
+		}
+		if err := os.WriteFile(d.heartbeat, []byte("2024-01-02T15:04:05Z 42%\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if status, ok := d.status(); !ok || status != "42%" {
+			t.Errorf("status of a beating scan = %q, %v, want 42%%", status, ok)
+		}
+		// A wedged scan stops beating
+		stale := time.Now().Add(-3 * time.Minute)
+		d.scanStart.Store(stale.UnixNano())
+		if err := os.Chtimes(d.heartbeat, stale, stale); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := d.status(); ok {
+			t.Error("beat for a scan without progress for 3 minutes")
+		}
+		return run(args...)
+	}
+	if err := d.cycle(time.Now(), time.Hour, 1.5, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.entries) != 2 {
+		t.Errorf("kept %v, want both IPs", d.ips())
+	}
+	if status, ok := d.status(); !ok || status != "waiting" {
+		t.Errorf("status after the cycle = %q, %v, want waiting", status, ok)
+	}
+}
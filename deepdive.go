@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/task"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const deepDiveUsage = "usage: deep-dive <ip> [-url https://...] [-tp 443] [-t 4] [-fingerprint chrome] [-keepalive 5] [-warmup 6] [-quic] [-ul-size 10MB] [-dt 10s] [-dd]"
+
+// Runs every probe against one IP and prints a diagnostic report, e.g. to find out why a good IP went bad
+func deepDiveCommand(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return errors.New(deepDiveUsage)
+	}
+	ip, err := net.ResolveIPAddr("ip", args[0])
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("deep-dive", flag.ExitOnError)
+	fs.StringVar(&task.URL, "url", "https://speed.cloudflare.com/__down?bytes=52428800", "Test address")
+	fs.IntVar(&task.TCPPort, "tp", 443, "Test port")
+	fs.IntVar(&task.PingTimes, "t", 4, "Connections and requests of the latency probes")
+	fs.StringVar(&task.ClientHelloID, "fingerprint", "chrome", "TLS fingerprint")
+	fs.IntVar(&task.KeepAliveRequests, "keepalive", 5, "Requests over one connection, 0 skips the probe")
+	fs.IntVar(&task.WarmUpConns, "warmup", 6, "Parallel connections, 0 skips the probe")
+	fs.BoolVar(&task.QUIC, "quic", true, "QUIC version negotiation and HTTP/3 download on UDP at the test port, false skips them")
+	fs.StringVar(&task.UploadURL, "ul-url", task.UploadURL, "Upload test address")
+	uploadSize := fs.String("ul-size", "10MB", "Upload test size, 0 skips the test")
+	fs.DurationVar(&task.Timeout, "dt", 10*time.Second, "Download test time")
+	fs.BoolVar(&task.Disable, "dd", false, "Skip the download tests")
+	_ = fs.Parse(args[1:])
+	if err := task.CheckPorts(); err != nil {
+		return err
+	}
+	if task.UploadSize, err = utils.ParseSize(*uploadSize); err != nil {
+		return err
+	}
+	task.Upload = task.UploadSize > 0
+	task.TCPFingerprint = true
+	task.CacheStatus = true
+
+	fmt.Printf("[Info] Deep dive into %s through %s\n\n", ip, task.URL)
+	steps := task.DeepDive(ip)
+	fmt.Printf("%-14s%-8s%-12s%s\n", "Probe", "Result", "Time", "Detail")
+	failed := 0
+	for _, s := range steps {
+		result := "ok"
+		if !s.OK {
+			result = "FAIL"
+			failed++
+		}
+		fmt.Printf("%-14s%-8s%-12v%s\n", s.Probe, result, s.Took.Round(time.Millisecond), s.Detail)
+	}
+	fmt.Printf("\n[Info] %d of %d probes failed.\n", failed, len(steps))
+	return nil
+}
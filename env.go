@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const envPrefix = "CFSCAN_"
+
+// Sets flags from CFSCAN_* environment variables, e.g. CFSCAN_TL=200 for -tl and CFSCAN_RAW_BYTES=true for -raw-bytes,
+// call before parsing so that command-line flags take precedence
+func applyEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envName(f.Name)
+		if value, ok := os.LookupEnv(name); ok && err == nil {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid %s=%q: %v", name, value, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// Parses the options of a profile under the CFSCAN_* variables and args, the command line, so that the precedence is
+// command line, then environment, then profile
+func applyProfile(fs *flag.FlagSet, args, profile []string) error {
+	if err := fs.Parse(profile); err != nil {
+		return err
+	}
+	if err := applyEnv(fs); err != nil {
+		return err
+	}
+	return fs.Parse(args)
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+// Flag set with a few options of each kind, as the scanner defines them
+func testFlags() (*flag.FlagSet, *int, *bool, *string) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	tl := fs.Int("tl", 9999, "Average delay upper limit")
+	rawBytes := fs.Bool("raw-bytes", false, "Raw bytes")
+	ip := fs.String("ip", "", "IP ranges")
+	return fs, tl, rawBytes, ip
+}
+
+func TestEnvName(t *testing.T) {
+	for flagName, want := range map[string]string{"tl": "CFSCAN_TL", "raw-bytes": "CFSCAN_RAW_BYTES", "dt-threads": "CFSCAN_DT_THREADS"} {
+		if name := envName(flagName); name != want {
+			t.Errorf("envName(%q) = %q, want %q", flagName, name, want)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("CFSCAN_TL", "200")
+	t.Setenv("CFSCAN_RAW_BYTES", "true")
+	t.Setenv("CFSCAN_UNKNOWN", "1")
+
+	// Environment values fill the flags not on the command line
+	fs, tl, rawBytes, ip := testFlags()
+	if err := applyEnv(fs); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if *tl != 200 || !*rawBytes || *ip != "" {
+		t.Errorf("-tl %d -raw-bytes %v -ip %q, want 200, true and the default", *tl, *rawBytes, *ip)
+	}
+
+	// Explicit flags win
+	fs, tl, rawBytes, _ = testFlags()
+	if err := applyEnv(fs); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Parse([]string{"-tl", "300", "-raw-bytes=false"}); err != nil {
+		t.Fatal(err)
+	}
+	if *tl != 300 || *rawBytes {
+		t.Errorf("-tl %d -raw-bytes %v, want the command line's 300 and false", *tl, *rawBytes)
+	}
+}
+
+func TestApplyEnvInvalid(t *testing.T) {
+	for name, value := range map[string]string{"CFSCAN_TL": "fast", "CFSCAN_RAW_BYTES": "maybe"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			fs, _, _, _ := testFlags()
+			if err := applyEnv(fs); err == nil {
+				t.Errorf("%s=%s: want an error", name, value)
+			}
+		})
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	t.Setenv("CFSCAN_TL", "200")
+	fs, tl, rawBytes, ip := testFlags()
+	if err := applyEnv(fs); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-ip", "1.1.1.1"}
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	// The command line wins over the environment, and the environment over the profile
+	if err := applyProfile(fs, args, []string{"-tl", "500", "-raw-bytes", "-ip", "1.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if *tl != 200 || !*rawBytes || *ip != "1.1.1.1" {
+		t.Errorf("-tl %d -raw-bytes %v -ip %q, want 200 from the environment, true from the profile and 1.1.1.1", *tl, *rawBytes, *ip)
+	}
+}
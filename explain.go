@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const explainUsage = "usage: explain <ip> [-f result.csv] [-reputation reputation.db] [-reputation-halflife 7] [-tl 9999] [-tll 0] [-tlr 1] [-sl 0] [-min-reputation 0] [-show-filter conditions]"
+
+// Shows which measurements put an IP where it is in the result file and which conditions or reputation reject it
+func explainCommand(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return errors.New(explainUsage)
+	}
+	ip, err := netip.ParseAddr(args[0])
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	file := fs.String("f", "result.csv", "Result file")
+	reputationFile := fs.String("reputation", "", "Reputation file, SQLite database or Postgres URL")
+	halfLife := fs.Float64("reputation-halflife", 7, "Reputation half-life in days")
+	maxDelay := fs.Int("tl", 9999, "Maximum average latency")
+	minDelay := fs.Int("tll", 0, "Minimum average latency")
+	maxLossRate := fs.Float64("tlr", 1, "Maximum loss rate")
+	minSpeed := fs.Float64("sl", 0, "Minimum download speed (MB/s)")
+	minReputation := fs.Float64("min-reputation", 0, "Minimum reputation")
+	showFilter := fs.String("show-filter", "", "Display filter")
+	_ = fs.Parse(args[1:])
+
+	limits := utils.ExplainLimits{
+		MinDelay:      time.Duration(*minDelay) * time.Millisecond,
+		MaxLossRate:   *maxLossRate,
+		MinSpeed:      *minSpeed * 1024 * 1024,
+		MinReputation: *minReputation,
+		HalfLife:      time.Duration(*halfLife * 24 * float64(time.Hour)),
+	}
+	if *maxDelay < 9999 { // As in the scan, the default and anything above it don't filter
+		limits.MaxDelay = time.Duration(*maxDelay) * time.Millisecond
+	}
+	if limits.Filter, err = utils.ParseFilter(*showFilter); err != nil {
+		return err
+	}
+	var store *utils.ReputationStore
+	if *reputationFile != "" {
+		if store, err = utils.LoadReputation(*reputationFile, limits.HalfLife); err != nil {
+			return err
+		}
+		defer store.Close()
+	}
+
+	e, err := utils.Explain(ip, *file, limits, store)
+	if err != nil {
+		return err
+	}
+	if e.Position > 0 {
+		fmt.Printf("%s is #%d of %d in %s, ranked by %s\n", e.IP, e.Position, e.Total, *file, strings.Join(e.Keys, ", then "))
+		r := e.Result
+		fmt.Printf("    Loss rate %.2f, average delay %.2f ms, download speed %.2f MB/s\n",
+			r.LossRate, float64(r.Delay)/float64(time.Millisecond), r.Speed/1024/1024)
+		if e.Above != "" {
+			fmt.Println("    Below", e.Above)
+		}
+		if e.Below != "" {
+			fmt.Println("    Above", e.Below)
+		}
+		if e.Pinned {
+			fmt.Println("    Pinned with [-pin], every condition keeps it")
+		}
+	} else {
+		fmt.Printf("%s is not in %s: it was not tested, failed every probe, or a condition or [-dn] of that scan left it out\n", e.IP, *file)
+	}
+
+	if store != nil {
+		if r := e.Reputation; r != nil {
+			fmt.Printf("Reputation %.2f = score %.2f / weight %.2f over %d tests, last tested %s\n",
+				r.Value(), r.Score, r.Weight, r.Tests, r.Updated.Format("2006-01-02 15:04"))
+			fmt.Printf("    With a half-life of %v days the history counts as %.2f tests in the next run\n", *halfLife, e.DecayedWeight)
+		} else {
+			fmt.Printf("No reputation history in %s\n", *reputationFile)
+		}
+	}
+
+	for _, reason := range e.Rejected {
+		fmt.Println("[Rejected]", reason)
+	}
+	for _, c := range e.Hidden {
+		fmt.Printf("[Hidden] [-show-filter] condition %s doesn't match, the IP stays in the result file\n", c)
+	}
+	if e.Position > 0 && len(e.Rejected) == 0 && len(e.Hidden) == 0 {
+		fmt.Println("[Info] The IP passes every condition given.")
+	}
+	return nil
+}
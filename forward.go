@@ -0,0 +1,283 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/alert"
+)
+
+const (
+	forwardDialTimeout = 5 * time.Second
+	forwardDialTries   = 3
+	forwardBadFor      = 5 * time.Minute // IPs failing a connection or check are skipped this long
+	forwardUDPIdle     = time.Minute
+)
+
+// Forwards a local port to the best IP of the result file, switching IPs when the current one fails
+func forwardCommand(args []string) error {
+	fs := flag.NewFlagSet("forward", flag.ExitOnError)
+	listen := fs.String("listen", ":8443", "Local address to forward")
+	toBest := fs.Bool("to-best", false, "Forward to the best IP of the result file")
+	file := fs.String("f", "result.csv", "Result file, reloaded when it changes")
+	port := fs.Int("port", 443, "Port of the IP forwarded to")
+	udp := fs.Bool("udp", false, "Forward UDP too")
+	check := fs.Duration("check", 30*time.Second, "Interval of the connection check of the current IP, 0 disables")
+	maintenance := fs.String("maintenance", "", "Maintenance windows without switching IPs, e.g. Sun 02:00-04:00,12:00-12:15")
+	silenceFile := fs.String("silence-file", "silence.json", "File of the silence command, empty disables")
+	_ = fs.Parse(args)
+	if !*toBest {
+		return errors.New("usage: forward -listen :8443 -to-best [-f result.csv] [-port 443] [-udp] [-check 30s] [-maintenance windows] [-silence-file silence.json]")
+	}
+	if *port < 1 || *port > 65535 {
+		return fmt.Errorf("invalid port %d", *port)
+	}
+	windows, err := alert.ParseWindows(*maintenance)
+	if err != nil {
+		return err
+	}
+
+	f := newForwarder(*file, *port, alert.Silence{Windows: windows, File: *silenceFile})
+	if _, err := f.target(); err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	if *udp {
+		pc, err := net.ListenPacket("udp", *listen)
+		if err != nil {
+			return err
+		}
+		go f.serveUDP(pc)
+	}
+	if *check > 0 {
+		go f.monitor(*check)
+	}
+	fmt.Printf("[Info] Forwarding %s to port %d of the best IP of %s\n", l.Addr(), *port, *file)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go f.serveTCP(conn)
+	}
+}
+
+type forwarder struct {
+	results *resultWatcher
+	port    int
+	silence alert.Silence // Keeps the current IP through planned outages
+
+	m         sync.Mutex
+	bad       map[netip.Addr]time.Time // Until when an IP is skipped
+	current   netip.Addr
+	upstreams map[io.Closer]netip.Addr // Open upstream connections and UDP sessions by their IP
+}
+
+func newForwarder(file string, port int, silence alert.Silence) *forwarder {
+	return &forwarder{
+		results:   &resultWatcher{path: file},
+		port:      port,
+		silence:   silence,
+		bad:       make(map[netip.Addr]time.Time),
+		upstreams: make(map[io.Closer]netip.Addr),
+	}
+}
+
+// The best IP not marked bad, all marked ones are forgiven when none is left
+func (f *forwarder) target() (netip.Addr, error) {
+	ips, err := f.results.current()
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if len(ips) == 0 {
+		return netip.Addr{}, errors.New("no IPs in the result file")
+	}
+	f.m.Lock()
+	defer f.m.Unlock()
+	target := ips[0]
+	for _, ip := range ips {
+		if time.Now().After(f.bad[ip]) {
+			target = ip
+			break
+		}
+	}
+	if target != f.current {
+		if f.current.IsValid() {
+			fmt.Printf("[Info] Switching from %s to %s\n", f.current, target)
+		}
+		f.current = target
+	}
+	return target, nil
+}
+
+// Skips ip for forwardBadFor, false when silenced
+func (f *forwarder) markBad(ip netip.Addr, err error) bool {
+	if silenced, reason := f.silence.Active(time.Now()); silenced {
+		fmt.Printf("[Info] %s failed (%v), not switching IPs (%s)\n", ip, err, reason)
+		return false
+	}
+	f.m.Lock()
+	defer f.m.Unlock()
+	if time.Now().After(f.bad[ip]) {
+		fmt.Printf("[Warning] %s failed (%v), skipping it for %v\n", ip, err, forwardBadFor)
+	}
+	f.bad[ip] = time.Now().Add(forwardBadFor)
+	return true
+}
+
+// Keeps an upstream connection to ip until the returned func is called, so a failed check of ip can close it
+func (f *forwarder) track(upstream io.Closer, ip netip.Addr) (untrack func()) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.upstreams[upstream] = ip
+	return func() {
+		f.m.Lock()
+		defer f.m.Unlock()
+		delete(f.upstreams, upstream)
+	}
+}
+
+// Closes the open upstream connections to ip, returning how many
+func (f *forwarder) closeUpstreams(ip netip.Addr) int {
+	f.m.Lock()
+	defer f.m.Unlock()
+	closed := 0
+	for upstream, to := range f.upstreams {
+		if to == ip {
+			_ = upstream.Close()
+			delete(f.upstreams, upstream)
+			closed++
+		}
+	}
+	return closed
+}
+
+func (f *forwarder) address(ip netip.Addr) string {
+	return net.JoinHostPort(ip.String(), strconv.Itoa(f.port))
+}
+
+// Dials the best IP, moving on to the next ones when it fails
+func (f *forwarder) dial() (net.Conn, netip.Addr, error) {
+	var err error
+	for range forwardDialTries {
+		var ip netip.Addr
+		if ip, err = f.target(); err != nil {
+			return nil, ip, err
+		}
+		var conn net.Conn
+		if conn, err = net.DialTimeout("tcp", f.address(ip), forwardDialTimeout); err == nil {
+			return conn, ip, nil
+		}
+		f.markBad(ip, err)
+	}
+	return nil, netip.Addr{}, err
+}
+
+func (f *forwarder) serveTCP(client net.Conn) {
+	defer client.Close()
+	upstream, ip, err := f.dial()
+	if err != nil {
+		fmt.Println("[!] Forwarding a connection failed:", err)
+		return
+	}
+	defer upstream.Close()
+	defer f.track(upstream, ip)()
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(upstream, client)
+		// Half-close, so the upstream sees the end of the request
+		if tcp, ok := upstream.(*net.TCPConn); ok {
+			_ = tcp.CloseWrite()
+		}
+		close(done)
+	}()
+	_, _ = io.Copy(client, upstream)
+	_ = client.Close()
+	<-done
+}
+
+// Relays datagrams of each client through its own upstream socket, closed after forwardUDPIdle without traffic
+// or when the check of its IP fails, the next datagram of the client then opens one to the new IP
+func (f *forwarder) serveUDP(pc net.PacketConn) {
+	var m sync.Mutex
+	sessions := make(map[string]net.Conn)
+	buf := make([]byte, 64*1024)
+	for {
+		n, client, err := pc.ReadFrom(buf)
+		if err != nil {
+			fmt.Println("[!] Forwarding UDP stopped:", err)
+			return
+		}
+		m.Lock()
+		upstream, ok := sessions[client.String()]
+		if !ok {
+			ip, err := f.target()
+			if err == nil {
+				upstream, err = net.Dial("udp", f.address(ip))
+			}
+			if err != nil {
+				m.Unlock()
+				continue
+			}
+			sessions[client.String()] = upstream
+			untrack := f.track(upstream, ip)
+			go func() {
+				defer untrack()
+				reply := make([]byte, 64*1024)
+				for {
+					_ = upstream.SetReadDeadline(time.Now().Add(forwardUDPIdle))
+					n, err := upstream.Read(reply)
+					if err != nil {
+						break
+					}
+					_, _ = pc.WriteTo(reply[:n], client)
+				}
+				m.Lock()
+				delete(sessions, client.String())
+				m.Unlock()
+				upstream.Close()
+			}()
+		}
+		m.Unlock()
+		_, _ = upstream.Write(buf[:n])
+	}
+}
+
+// Checks the current IP every interval
+func (f *forwarder) monitor(interval time.Duration) {
+	for range time.Tick(interval) {
+		f.check()
+	}
+}
+
+// Checks the current IP with a TCP connection; when it fails the next connections go elsewhere and the open ones
+// to it are closed, so their clients reconnect to the new IP at once instead of waiting on a dead one
+func (f *forwarder) check() {
+	ip, err := f.target()
+	if err != nil {
+		return
+	}
+	conn, err := net.DialTimeout("tcp", f.address(ip), forwardDialTimeout)
+	if err == nil {
+		conn.Close()
+		return
+	}
+	if !f.markBad(ip, err) {
+		return
+	}
+	if next, err := f.target(); err == nil && next != ip {
+		if closed := f.closeUpstreams(ip); closed > 0 {
+			fmt.Printf("[Info] Closed %d connections to %s, their clients reconnect to %s\n", closed, ip, next)
+		}
+	}
+}
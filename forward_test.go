@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/alert"
+)
+
+// Edge at ip:port answering every TCP line and UDP datagram with its IP and the line
+type echoEdge struct {
+	tcp net.Listener
+	udp net.PacketConn
+}
+
+func startEchoEdge(t *testing.T, ip string, port int) *echoEdge {
+	t.Helper()
+	address := net.JoinHostPort(ip, strconv.Itoa(port))
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Skip("no loopback address", address, err)
+	}
+	pc, err := net.ListenPacket("udp", l.Addr().String())
+	if err != nil {
+		l.Close()
+		t.Skip("no loopback address", address, err)
+	}
+	e := &echoEdge{tcp: l, udp: pc}
+	t.Cleanup(e.close)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				lines := bufio.NewScanner(conn)
+				for lines.Scan() {
+					_, _ = io.WriteString(conn, ip+" "+lines.Text()+"\n")
+				}
+			}()
+		}
+	}()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = pc.WriteTo(append([]byte(ip+" "), buf[:n]...), addr)
+		}
+	}()
+	return e
+}
+
+func (e *echoEdge) close() {
+	_ = e.tcp.Close()
+	_ = e.udp.Close()
+}
+
+// Forwarder to the edges at 127.0.0.1 and 127.0.0.2, in this order in its result file, listening on TCP and UDP
+func testForwarder(t *testing.T) (f *forwarder, edges []*echoEdge, tcp net.Listener, udp net.PacketConn) {
+	edges = append(edges, startEchoEdge(t, "127.0.0.1", 0))
+	port := edges[0].tcp.Addr().(*net.TCPAddr).Port
+	edges = append(edges, startEchoEdge(t, "127.0.0.2", port))
+	file := filepath.Join(t.TempDir(), "result.csv")
+	if err := os.WriteFile(file, []byte("IP Address,Sent\n127.0.0.1,4\n127.0.0.2,4\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f = newForwarder(file, port, alert.Silence{})
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	udp, err = net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tcp.Close(); udp.Close() })
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			go f.serveTCP(conn)
+		}
+	}()
+	go f.serveUDP(udp)
+	return f, edges, tcp, udp
+}
+
+// Sends a line over conn and returns the answer
+func echoLine(t *testing.T, conn net.Conn, lines *bufio.Reader, line string) (string, error) {
+	t.Helper()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(conn, line+"\n"); err != nil {
+		return "", err
+	}
+	answer, err := lines.ReadString('\n')
+	return strings.TrimSuffix(answer, "\n"), err
+}
+
+func TestForwardTCP(t *testing.T) {
+	_, _, tcp, _ := testForwarder(t)
+	conn, err := net.Dial("tcp", tcp.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	lines := bufio.NewReader(conn)
+	for _, line := range []string{"hello", "again"} {
+		if answer, err := echoLine(t, conn, lines, line); err != nil || answer != "127.0.0.1 "+line {
+			t.Errorf("answer = %q, %v, want it from the best IP", answer, err)
+		}
+	}
+	// The client's half-close reaches the edge, which ends the connection
+	_ = conn.(*net.TCPConn).CloseWrite()
+	if _, err := lines.ReadString('\n'); err != io.EOF {
+		t.Errorf("after the half-close: %v, want EOF", err)
+	}
+}
+
+func TestForwardSwap(t *testing.T) {
+	f, edges, tcp, udp := testForwarder(t)
+	conn, err := net.Dial("tcp", tcp.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	lines := bufio.NewReader(conn)
+	if answer, err := echoLine(t, conn, lines, "hello"); err != nil || answer != "127.0.0.1 hello" {
+		t.Fatalf("answer = %q, %v, want it from the best IP", answer, err)
+	}
+	client, err := net.Dial("udp", udp.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	datagram := func() string {
+		buf := make([]byte, 1500)
+		_ = client.SetDeadline(time.Now().Add(200 * time.Millisecond))
+		if _, err := client.Write([]byte("ping")); err != nil {
+			return ""
+		}
+		n, _ := client.Read(buf)
+		return string(buf[:n])
+	}
+	if answer := datagram(); answer != "127.0.0.1 ping" {
+		t.Fatalf("UDP answer = %q, want it from the best IP", answer)
+	}
+
+	// A passing check keeps everything in place
+	f.check()
+	if answer, err := echoLine(t, conn, lines, "still"); err != nil || answer != "127.0.0.1 still" {
+		t.Fatalf("answer after a passing check = %q, %v", answer, err)
+	}
+
+	// The edge stops taking connections while the open ones hang on
+	_ = edges[0].tcp.Close()
+	f.check()
+	if _, err := echoLine(t, conn, lines, "gone"); err == nil {
+		t.Error("the connection to the failed IP stayed open")
+	}
+	conn2, err := net.Dial("tcp", tcp.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	if answer, err := echoLine(t, conn2, bufio.NewReader(conn2), "hello"); err != nil || answer != "127.0.0.2 hello" {
+		t.Errorf("answer of a new connection = %q, %v, want it from the next IP", answer, err)
+	}
+	// The UDP session moves with its next datagrams, the first may go to the closed socket
+	var answer string
+	for deadline := time.Now().Add(5 * time.Second); answer != "127.0.0.2 ping" && time.Now().Before(deadline); {
+		answer = datagram()
+	}
+	if answer != "127.0.0.2 ping" {
+		t.Errorf("UDP answer after the failed check = %q, want it from the next IP", answer)
+	}
+}
+
+func TestForwardSilenced(t *testing.T) {
+	f, edges, tcp, _ := testForwarder(t)
+	f.silence.Windows = []alert.Window{{EveryDay: true, End: 24 * time.Hour}}
+	conn, err := net.Dial("tcp", tcp.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	lines := bufio.NewReader(conn)
+	if answer, err := echoLine(t, conn, lines, "hello"); err != nil || answer != "127.0.0.1 hello" {
+		t.Fatalf("answer = %q, %v, want it from the best IP", answer, err)
+	}
+	// Planned maintenance keeps the IP and its connections
+	_ = edges[0].tcp.Close()
+	f.check()
+	if answer, err := echoLine(t, conn, lines, "still"); err != nil || answer != "127.0.0.1 still" {
+		t.Errorf("answer after a silenced failure = %q, %v, want the connection kept", answer, err)
+	}
+	if ip, err := f.target(); err != nil || ip.String() != "127.0.0.1" {
+		t.Errorf("target = %v, %v, want the silenced IP kept", ip, err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Ptechgithub/CloudflareScanner/task"
+)
+
+// Searches the fragment options with the least overhead that get through the local DPI and saves them as a preset
+func fragmentTuneCommand(args []string) error {
+	fs := flag.NewFlagSet("fragment-tune", flag.ExitOnError)
+	ips := fs.String("ip", "", "Reference IPs, separated by commas")
+	fs.StringVar(&task.URL, "url", "https://speed.cloudflare.com/__down?bytes=52428800", "Test address, its host is the SNI the DPI sees")
+	fs.IntVar(&task.TCPPort, "tp", 443, "Test port")
+	fs.StringVar(&task.ClientHelloID, "fingerprint", "chrome", "TLS fingerprint")
+	tries := fs.Int("tries", 2, "Handshakes per IP a setting must pass")
+	fs.StringVar(&task.FragmentPresetsFile, "presets", "fragments.json", "Fragment presets file to save to")
+	name := fs.String("name", "tuned", "Name of the saved preset")
+	_ = fs.Parse(args)
+
+	var refs []*net.IPAddr
+	for _, s := range strings.Split(*ips, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		ip, err := net.ResolveIPAddr("ip", s)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, ip)
+	}
+	if len(refs) == 0 {
+		return errors.New("usage: fragment-tune -ip 1.1.1.1,1.0.0.1 [-url https://...] [-tries 2] [-presets fragments.json] [-name tuned]")
+	}
+	if *tries < 1 {
+		*tries = 1
+	}
+	if err := task.CheckPorts(); err != nil {
+		return err
+	}
+
+	fmt.Printf("[Info] Tuning fragment options against %d IPs...\n", len(refs))
+	config, err := task.TuneFragment(refs, *tries)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		fmt.Println("[Info] The handshake gets through unfragmented, no fragmentation needed.")
+		return nil
+	}
+	if err := task.SaveFragmentPreset(*name, config); err != nil {
+		return err
+	}
+	fmt.Printf("[Info] Saved %s as preset %q to %s, use it with [-fragment-presets %s -fragment preset:%s]\n",
+		task.FormatFragmentOptions(config), *name, task.FragmentPresetsFile, task.FragmentPresetsFile, *name)
+	return nil
+}
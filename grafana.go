@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/tsdb"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const grafanaUsage = "usage: grafana-export [-format influx|remote-write] [-o file | -url http://...] [-auth header] [-measurement cfscan] [-dashboard dashboard.json] [result.csv ...]"
+
+// Writes result files as time series for an existing observability stack, e.g. "grafana-export -url http://influx:8086/write?db=cfscan result.csv"
+func grafanaExportCommand(args []string) error {
+	fs := flag.NewFlagSet("grafana-export", flag.ExitOnError)
+	format := fs.String("format", "influx", "Output format: influx (line protocol) or remote-write (Prometheus)")
+	output := fs.String("o", "", "Output file, - for stdout")
+	target := fs.String("url", "", "Address to POST to instead of writing a file, e.g. an InfluxDB write endpoint or a Prometheus remote-write receiver")
+	auth := fs.String("auth", "", `Authorization header of the POST, e.g. "Token abc" for InfluxDB 2`)
+	measurement := fs.String("measurement", "cfscan", "InfluxDB measurement, and the prefix of the Prometheus metrics")
+	dashboard := fs.String("dashboard", "", "Also write a Grafana dashboard charting the series to this file")
+	_ = fs.Parse(args)
+	if *format != "influx" && *format != "remote-write" {
+		return errors.New(grafanaUsage)
+	}
+	if *format == "remote-write" && *target == "" && *output == "" {
+		return fmt.Errorf("remote-write needs [-url] or [-o], the request is binary\n%s", grafanaUsage)
+	}
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"result.csv"}
+	}
+
+	// A result file has no scan time, its modification time stands for it
+	var points []tsdb.Point
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		results, err := utils.ReadResults(path)
+		if err != nil {
+			return err
+		}
+		for _, r := range results {
+			points = append(points, tsdb.Point{Time: info.ModTime(), IP: r.IP.String(), LossRate: r.LossRate, Delay: r.Delay, Speed: r.Speed})
+		}
+	}
+	tsdb.SortPoints(points)
+
+	var body []byte
+	contentType := "text/plain; charset=utf-8"
+	if *format == "remote-write" {
+		body = tsdb.RemoteWrite(*measurement+"_", points)
+		contentType = "application/x-protobuf"
+	} else {
+		var buf bytes.Buffer
+		if err := tsdb.WriteInflux(&buf, *measurement, points); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	switch {
+	case *target != "":
+		if err := grafanaPost(*target, *auth, contentType, *format == "remote-write", body); err != nil {
+			return err
+		}
+		fmt.Printf("[Info] Sent %d results to %s.\n", len(points), *target)
+	case *output == "" || *output == "-":
+		if _, err := os.Stdout.Write(body); err != nil {
+			return err
+		}
+	default:
+		if err := os.WriteFile(*output, body, 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("[Info] Wrote %d results to %s.\n", len(points), *output)
+	}
+
+	if *dashboard != "" {
+		influxMeasurement := *measurement
+		if *format == "remote-write" {
+			influxMeasurement = ""
+		}
+		data, err := tsdb.Dashboard(influxMeasurement, *measurement+"_")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*dashboard, data, 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "[Info] Wrote the Grafana dashboard to %s, import it and pick the datasource.\n", *dashboard)
+	}
+	return nil
+}
+
+// POSTs the series to target, a remote-write body with the headers Prometheus receivers require
+func grafanaPost(target, auth, contentType string, remoteWrite bool, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "CloudflareScanner/"+currentVersion())
+	if remoteWrite {
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s %s", target, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/task"
+)
+
+const healthCheckUsage = "usage: healthcheck <ip> [-mode tcp|tls|http] [-budget 800ms] [-max-delay 0] [-url https://...] [-tp 443] [-sni name] [-fingerprint chrome] [-fragment none] [-httping-code 200] [-q]"
+
+// Exit codes of healthcheck, for keepalived track scripts and other health checkers
+const (
+	healthOK     = 0 // The probe passed within the budget
+	healthFailed = 1 // The probe failed or ran out of the budget
+	healthUsage  = 2 // Invalid arguments, as the flag package exits with
+	healthSlow   = 3 // The probe passed, but slower than [-max-delay]
+)
+
+// Probes one IP once within a strict time budget and exits with a code telling how it went, e.g. as the track script
+// "CloudflareScanner healthcheck 1.1.1.1 -mode tls -budget 500ms -q" of keepalived. Failures are exitErrors carrying the code.
+func healthCheckCommand(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return &exitError{code: healthUsage, err: errors.New(healthCheckUsage)}
+	}
+	ip, err := net.ResolveIPAddr("ip", args[0])
+	if err != nil {
+		return &exitError{code: healthUsage, err: fmt.Errorf("[!] %v", err)}
+	}
+	fs := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	mode := fs.String("mode", task.HealthTLS, "Probe: tcp (connect), tls (handshake) or http (HEAD request of -url)")
+	budget := fs.Duration("budget", 800*time.Millisecond, "Time the probe has, including connecting")
+	maxDelay := fs.Duration("max-delay", 0, "Slower probes exit with 3, 0 for no limit")
+	fs.StringVar(&task.URL, "url", "https://speed.cloudflare.com/__down?bytes=52428800", "Test address, the host is the SNI")
+	fs.IntVar(&task.TCPPort, "tp", 443, "Test port")
+	fs.StringVar(&task.SNI, "sni", "", "TLS server name instead of the -url host")
+	fs.StringVar(&task.ClientHelloID, "fingerprint", "chrome", "TLS fingerprint")
+	fragmentOptions := fs.String("fragment", "none", "Fragment settings or preset:<name>, as for a scan")
+	fs.IntVar(&task.HttpingStatusCode, "httping-code", 0, "Valid status code of http, default 200, 301 and 302")
+	quiet := fs.Bool("q", false, "Print nothing, only exit with the code")
+	_ = fs.Parse(args[1:])
+
+	fail := func(code int, format string, a ...any) error {
+		if *quiet {
+			return &exitError{code: code}
+		}
+		return &exitError{code: code, err: fmt.Errorf(format, a...)}
+	}
+	if *mode != task.HealthTCP && *mode != task.HealthTLS && *mode != task.HealthHTTP {
+		return fail(healthUsage, "[!] unknown mode %q, use tcp, tls or http", *mode)
+	}
+	if *budget <= 0 {
+		return fail(healthUsage, "[!] the budget must be positive")
+	}
+	if err := task.CheckPorts(); err != nil {
+		return fail(healthUsage, "[!] %v", err)
+	}
+	if task.FragmentOptions, err = task.ParseFragmentOptions(*fragmentOptions); err != nil {
+		return fail(healthUsage, "[!] %v", err)
+	}
+	task.FragmentEnabled = task.FragmentOptions != nil
+	task.FragmentProbes, _ = task.ParseFragmentProbes("all")
+	task.HandshakeTimeout = *budget
+
+	ctx, cancel := context.WithTimeout(context.Background(), *budget)
+	took, err := task.HealthCheck(ctx, ip, *mode)
+	cancel()
+	switch {
+	case err != nil:
+		return fail(healthFailed, "FAIL %s %s: %v", ip, *mode, err)
+	case *maxDelay > 0 && took > *maxDelay:
+		return fail(healthSlow, "SLOW %s %s %.2f ms, over %v", ip, *mode, float64(took)/float64(time.Millisecond), *maxDelay)
+	}
+	if !*quiet {
+		fmt.Printf("OK %s %s %.2f ms\n", ip, *mode, float64(took)/float64(time.Millisecond))
+	}
+	return nil
+}
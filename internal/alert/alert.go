@@ -0,0 +1,177 @@
+// Package alert raises alerts on the delay and speed samples of an IP, with hysteresis against flapping.
+package alert
+
+import (
+	"fmt"
+	"time"
+)
+
+// Sample is one measurement of an IP, OK is false when it failed the tests
+type Sample struct {
+	Time  time.Time
+	OK    bool
+	Delay time.Duration
+	Speed float64 // Bytes per second, 0 when not measured
+}
+
+// Rules of the alerts, the zero value of a threshold disables its rule
+type Rules struct {
+	// MaxDelay alerts on delays above it
+	MaxDelay time.Duration
+	// Rise alerts on delays this many times the lowest delay of the last RiseWindow, e.g. 2 within 10m
+	Rise       float64
+	RiseWindow time.Duration
+	// Drop alerts on speeds this fraction below the mean speed of the last Baseline, e.g. 0.5 against 24h
+	Drop     float64
+	Baseline time.Duration
+	// Down alerts on IPs failing the tests
+	Down bool
+	// Confirm is the number of samples in a row needed to raise or clear an alert
+	Confirm int
+}
+
+// Names of the rules
+const (
+	RuleDown     = "down"
+	RuleMaxDelay = "max-delay"
+	RuleRise     = "latency-rise"
+	RuleDrop     = "speed-drop"
+)
+
+// Event is an alert raised or cleared
+type Event struct {
+	Rule    string    `json:"rule"`
+	Firing  bool      `json:"firing"` // false when cleared
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// Tracker follows the samples of one IP
+type Tracker struct {
+	rules   Rules
+	history []Sample
+	states  map[string]*ruleState
+}
+
+type ruleState struct {
+	firing    bool
+	streak    int     // Samples in a row against the current state
+	reference float64 // Delay or speed compared to, kept while the alert fires
+}
+
+// NewTracker returns a tracker applying rules
+func NewTracker(rules Rules) *Tracker {
+	rules.Confirm = max(rules.Confirm, 1)
+	return &Tracker{rules: rules, states: make(map[string]*ruleState)}
+}
+
+// Add records a sample and returns the alerts it raised or cleared
+func (t *Tracker) Add(s Sample) []Event {
+	var events []Event
+	check := func(rule string, breached, recovered bool, reference float64, message string) {
+		if e, ok := t.step(rule, breached, recovered, reference); ok {
+			e.Time = s.Time
+			e.Message = message
+			events = append(events, e)
+		}
+	}
+	r := t.rules
+	if r.Down {
+		check(RuleDown, !s.OK, s.OK, 0, "failed the tests")
+	}
+	if s.OK && r.MaxDelay > 0 {
+		check(RuleMaxDelay, s.Delay > r.MaxDelay, s.Delay <= r.MaxDelay*9/10, 0,
+			fmt.Sprintf("delay %s, limit %s", ms(s.Delay), ms(r.MaxDelay)))
+	}
+	if s.OK && r.Rise > 1 && r.RiseWindow > 0 {
+		if lowest, ok := t.lowestDelay(s.Time.Add(-r.RiseWindow)); ok {
+			ref := t.reference(RuleRise, float64(lowest))
+			// Cleared once the delay is back below half the rise
+			check(RuleRise, float64(s.Delay) >= r.Rise*ref, float64(s.Delay) < (1+(r.Rise-1)/2)*ref, float64(lowest),
+				fmt.Sprintf("delay %s, %.1fx the lowest %s of the last %v", ms(s.Delay), float64(s.Delay)/ref, ms(time.Duration(ref)), r.RiseWindow))
+		}
+	}
+	if s.OK && s.Speed > 0 && r.Drop > 0 && r.Baseline > 0 {
+		if mean, ok := t.meanSpeed(s.Time.Add(-r.Baseline)); ok {
+			ref := t.reference(RuleDrop, mean)
+			check(RuleDrop, s.Speed <= (1-r.Drop)*ref, s.Speed > (1-r.Drop/2)*ref, mean,
+				fmt.Sprintf("speed %.2f MB/s, %.0f%% below the %v mean of %.2f MB/s", s.Speed/1024/1024, (1-s.Speed/ref)*100, r.Baseline, ref/1024/1024))
+		}
+	}
+	t.history = append(t.history, s)
+	t.trim(s.Time)
+	return events
+}
+
+// Moves the state of rule one sample on, returning an event when it flips
+func (t *Tracker) step(rule string, breached, recovered bool, reference float64) (Event, bool) {
+	st := t.states[rule]
+	if st == nil {
+		st = &ruleState{}
+		t.states[rule] = st
+	}
+	if !st.firing {
+		st.reference = reference
+	}
+	against := breached
+	if st.firing {
+		against = recovered
+	}
+	if !against {
+		st.streak = 0
+		return Event{}, false
+	}
+	if st.streak++; st.streak < t.rules.Confirm {
+		return Event{}, false
+	}
+	st.firing, st.streak = !st.firing, 0
+	return Event{Rule: rule, Firing: st.firing}, true
+}
+
+// The reference of a firing rule stays where it was when the alert was raised, so the new level doesn't become normal
+func (t *Tracker) reference(rule string, current float64) float64 {
+	if st := t.states[rule]; st != nil && st.firing {
+		return st.reference
+	}
+	return current
+}
+
+func (t *Tracker) lowestDelay(since time.Time) (time.Duration, bool) {
+	var lowest time.Duration
+	found := false
+	for _, s := range t.history {
+		if s.OK && !s.Time.Before(since) && (!found || s.Delay < lowest) {
+			lowest, found = s.Delay, true
+		}
+	}
+	return lowest, found
+}
+
+func (t *Tracker) meanSpeed(since time.Time) (float64, bool) {
+	var sum float64
+	var n int
+	for _, s := range t.history {
+		if s.OK && s.Speed > 0 && !s.Time.Before(since) {
+			sum += s.Speed
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
+
+// Drops the samples older than every window
+func (t *Tracker) trim(now time.Time) {
+	since := now.Add(-max(t.rules.RiseWindow, t.rules.Baseline))
+	i := 0
+	for i < len(t.history) && t.history[i].Time.Before(since) {
+		i++
+	}
+	t.history = t.history[i:]
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.2f ms", float64(d)/float64(time.Millisecond))
+}
@@ -0,0 +1,55 @@
+package alert
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRise(t *testing.T) {
+	tr := NewTracker(Rules{Rise: 2, RiseWindow: 10 * time.Minute, Confirm: 2})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ms := time.Millisecond
+	delays := []time.Duration{50 * ms, 55 * ms, 110 * ms, 120 * ms, 130 * ms, 80 * ms, 70 * ms, 60 * ms}
+	var got []string
+	for i, d := range delays {
+		for _, e := range tr.Add(Sample{Time: start.Add(time.Duration(i) * time.Minute), OK: true, Delay: d}) {
+			if e.Rule != RuleRise {
+				t.Errorf("unexpected rule %s", e.Rule)
+			}
+			got = append(got, e.Time.Format("04")+map[bool]string{true: " firing", false: " resolved"}[e.Firing])
+		}
+	}
+	// Raised at the second slow sample, 80 ms is still above the halfway mark of 75 ms
+	want := []string{"03 firing", "07 resolved"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("events %v, want %v", got, want)
+	}
+}
+
+func TestDropAgainstBaseline(t *testing.T) {
+	tr := NewTracker(Rules{Drop: 0.5, Baseline: 24 * time.Hour, Confirm: 1})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	speeds := []float64{10, 10, 10, 4, 4, 4, 4, 8}
+	var firing []bool
+	for i, speed := range speeds {
+		for _, e := range tr.Add(Sample{Time: start.Add(time.Duration(i) * time.Hour), OK: true, Speed: speed}) {
+			firing = append(firing, e.Firing)
+		}
+	}
+	// The baseline stays at 10 while the alert fires, so the slow samples don't become normal
+	if len(firing) != 2 || !firing[0] || firing[1] {
+		t.Errorf("events %v, want a raise and a clear", firing)
+	}
+}
+
+func TestDown(t *testing.T) {
+	tr := NewTracker(Rules{Down: true, Confirm: 2})
+	var events []Event
+	for _, ok := range []bool{true, false, true, false, false, true, true} {
+		events = append(events, tr.Add(Sample{Time: time.Now(), OK: ok, Delay: time.Millisecond})...)
+	}
+	// A single failure doesn't flap the alert
+	if len(events) != 2 || !events[0].Firing || events[1].Firing {
+		t.Errorf("events %+v, want a raise and a clear", events)
+	}
+}
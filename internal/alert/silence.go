@@ -0,0 +1,122 @@
+package alert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Window is a daily maintenance window, e.g. "02:00-04:00", or a weekly one, e.g. "Sun 23:00-01:00"; it may cross midnight
+type Window struct {
+	Weekday    time.Weekday
+	EveryDay   bool
+	Start, End time.Duration // Since midnight
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseWindows reads maintenance windows separated by commas, e.g. "Sun 02:00-04:00,12:00-12:15"
+func ParseWindows(s string) ([]Window, error) {
+	var windows []Window
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		w := Window{EveryDay: true}
+		if day, span, ok := strings.Cut(part, " "); ok {
+			wd, ok := weekdays[strings.ToLower(day)[:min(3, len(day))]]
+			if !ok {
+				return nil, fmt.Errorf("invalid maintenance window %q: unknown day %q", part, day)
+			}
+			w.Weekday, w.EveryDay, part = wd, false, strings.TrimSpace(span)
+		}
+		start, end, ok := strings.Cut(part, "-")
+		var err error
+		if ok {
+			if w.Start, err = clock(start); err == nil {
+				w.End, err = clock(end)
+			}
+		}
+		if !ok || err != nil || w.Start == w.End {
+			return nil, fmt.Errorf("invalid maintenance window %q, use [day] HH:MM-HH:MM", part)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func clock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t, in its own location, falls within the window
+func (w Window) Contains(t time.Time) bool {
+	since := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	day := t.Weekday()
+	if w.Start < w.End {
+		return (w.EveryDay || day == w.Weekday) && since >= w.Start && since < w.End
+	}
+	// Crossing midnight, the part after it belongs to the window of the day before
+	if since >= w.Start {
+		return w.EveryDay || day == w.Weekday
+	}
+	return since < w.End && (w.EveryDay || (day+6)%7 == w.Weekday)
+}
+
+// Silence suppresses alerts and failover within the maintenance windows and until the time saved in File by SilenceFor
+type Silence struct {
+	Windows []Window
+	File    string // Shared by the running commands, empty disables
+}
+
+// Active reports whether t is silenced and why
+func (s Silence) Active(t time.Time) (bool, string) {
+	for _, w := range s.Windows {
+		if w.Contains(t) {
+			return true, "maintenance window"
+		}
+	}
+	if s.File != "" {
+		if until, err := ReadSilence(s.File); err == nil && t.Before(until) {
+			return true, "silenced until " + until.Format("2006-01-02 15:04")
+		}
+	}
+	return false, ""
+}
+
+type silenceFile struct {
+	Until time.Time `json:"until"`
+}
+
+// SilenceFor silences the commands sharing file for d from now, 0 lifts the silence
+func SilenceFor(file string, d time.Duration) (time.Time, error) {
+	until := time.Now().Add(d)
+	data, _ := json.Marshal(silenceFile{Until: until})
+	return until, os.WriteFile(file, data, 0o644)
+}
+
+// ReadSilence returns the end of the silence saved in file, the zero time when there is none
+func ReadSilence(file string) (time.Time, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	var s silenceFile
+	if err := json.Unmarshal(data, &s); err != nil {
+		return time.Time{}, fmt.Errorf("%s: %v", file, err)
+	}
+	return s.Until, nil
+}
@@ -0,0 +1,55 @@
+package alert
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWindows(t *testing.T) {
+	windows, err := ParseWindows("Sun 23:00-01:00, 12:00-12:15")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2024-01-07 is a Sunday
+	tests := []struct {
+		at   string
+		want bool
+	}{
+		{at: "2024-01-07 23:30", want: true},
+		{at: "2024-01-08 00:30", want: true},
+		{at: "2024-01-08 01:00", want: false},
+		{at: "2024-01-06 23:30", want: false},
+		{at: "2024-01-07 00:30", want: false},
+		{at: "2024-01-09 12:10", want: true},
+		{at: "2024-01-09 12:15", want: false},
+	}
+	s := Silence{Windows: windows}
+	for _, tt := range tests {
+		at, _ := time.Parse("2006-01-02 15:04", tt.at)
+		if got, _ := s.Active(at); got != tt.want {
+			t.Errorf("Active(%s) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"12:00", "Someday 01:00-02:00", "01:00-01:00", "25:00-26:00"} {
+		if _, err := ParseWindows(bad); err == nil {
+			t.Errorf("ParseWindows(%q) accepted", bad)
+		}
+	}
+}
+
+func TestSilenceFile(t *testing.T) {
+	s := Silence{File: filepath.Join(t.TempDir(), "silence.json")}
+	if got, _ := s.Active(time.Now()); got {
+		t.Error("silenced without a file")
+	}
+	if _, err := SilenceFor(s.File, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Active(time.Now()); !got {
+		t.Error("not silenced after SilenceFor")
+	}
+	if got, _ := s.Active(time.Now().Add(2 * time.Hour)); got {
+		t.Error("still silenced after the silence ended")
+	}
+}
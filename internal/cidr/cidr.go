@@ -0,0 +1,167 @@
+// Package cidr implements set arithmetic on IP ranges: aggregation, subtraction, counting and expansion.
+package cidr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Parse reads a range such as 1.1.1.0/24, a single IP is a /32 or /128
+func Parse(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return p.Masked(), nil
+	}
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	a = a.WithZone("")
+	return netip.PrefixFrom(a, a.BitLen()), nil
+}
+
+// ParseList reads ranges separated by newlines, commas or spaces, text after # is a comment
+func ParseList(r io.Reader) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			p, err := Parse(field)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			prefixes = append(prefixes, p)
+		}
+	}
+	return prefixes, scanner.Err()
+}
+
+// Aggregate returns the smallest list of ranges covering the same addresses
+func Aggregate(prefixes []netip.Prefix) []netip.Prefix {
+	return toPrefixes(toSpans(prefixes))
+}
+
+// Subtract returns the addresses of prefixes that are not in exclude
+func Subtract(prefixes, exclude []netip.Prefix) []netip.Prefix {
+	var result []span
+	cuts := toSpans(exclude)
+	for _, s := range toSpans(prefixes) {
+		for _, c := range cuts {
+			if c.to.Less(s.from) || s.to.Less(c.from) || c.from.BitLen() != s.from.BitLen() {
+				continue
+			}
+			if s.from.Less(c.from) {
+				result = append(result, span{s.from, c.from.Prev()})
+			}
+			if !c.to.Less(s.to) {
+				s.from = netip.Addr{} // Nothing left
+				break
+			}
+			s.from = c.to.Next()
+		}
+		if s.from.IsValid() {
+			result = append(result, s)
+		}
+	}
+	return toPrefixes(result)
+}
+
+// Count returns the number of distinct addresses
+func Count(prefixes []netip.Prefix) *big.Int {
+	total := new(big.Int)
+	one := big.NewInt(1)
+	for _, s := range toSpans(prefixes) {
+		n := new(big.Int).Sub(toInt(s.to), toInt(s.from))
+		total.Add(total, n.Add(n, one))
+	}
+	return total
+}
+
+// Expand calls fn for every distinct address in order until it returns false
+func Expand(prefixes []netip.Prefix, fn func(netip.Addr) bool) {
+	for _, s := range toSpans(prefixes) {
+		for a := s.from; a.IsValid() && !s.to.Less(a); a = a.Next() {
+			if !fn(a) {
+				return
+			}
+		}
+	}
+}
+
+// Inclusive address range
+type span struct {
+	from, to netip.Addr
+}
+
+// Sorted ranges with overlapping and adjacent ones merged, IPv4 before IPv6
+func toSpans(prefixes []netip.Prefix) []span {
+	spans := make([]span, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p.IsValid() {
+			p = p.Masked()
+			spans = append(spans, span{p.Addr(), lastAddr(p)})
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].from.Less(spans[j].from) })
+	merged := spans[:0]
+	for _, s := range spans {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			next := last.to.Next()
+			if s.from.BitLen() == last.to.BitLen() && (!next.IsValid() || !next.Less(s.from)) {
+				if last.to.Less(s.to) {
+					last.to = s.to
+				}
+				continue
+			}
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// Splits ranges into the largest aligned prefixes
+func toPrefixes(spans []span) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, s := range spans {
+		for from := s.from; ; {
+			var p netip.Prefix
+			for bits := 0; bits <= from.BitLen(); bits++ {
+				p = netip.PrefixFrom(from, bits)
+				if p.Masked().Addr() == from && !s.to.Less(lastAddr(p)) {
+					break
+				}
+			}
+			prefixes = append(prefixes, p)
+			last := lastAddr(p)
+			if last == s.to {
+				break
+			}
+			from = last.Next()
+		}
+	}
+	return prefixes
+}
+
+// Last address of a prefix
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+func toInt(a netip.Addr) *big.Int {
+	return new(big.Int).SetBytes(a.AsSlice())
+}
@@ -0,0 +1,106 @@
+package cidr
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, s string) []netip.Prefix {
+	t.Helper()
+	prefixes, err := ParseList(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prefixes
+}
+
+func join(prefixes []netip.Prefix) string {
+	s := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		s[i] = p.String()
+	}
+	return strings.Join(s, ",")
+}
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "1.1.1.0/25,1.1.1.128/25", want: "1.1.1.0/24"},
+		{in: "1.1.1.0/24\n1.1.1.7 # inside", want: "1.1.1.0/24"},
+		{in: "10.0.0.1,10.0.0.2", want: "10.0.0.1/32,10.0.0.2/32"},
+		{in: "10.0.0.2,10.0.0.3", want: "10.0.0.2/31"},
+		{in: "1.0.0.0/24 1.1.1.0/24 1.0.1.0/24", want: "1.0.0.0/23,1.1.1.0/24"},
+		{in: "2606:4700::/33,2606:4700:8000::/33,1.1.1.1", want: "1.1.1.1/32,2606:4700::/32"},
+		{in: "255.255.255.255,255.255.255.254", want: "255.255.255.254/31"},
+		{in: "1.1.1.5/24", want: "1.1.1.0/24"},
+	}
+	for _, tt := range tests {
+		if got := join(Aggregate(parse(t, tt.in))); got != tt.want {
+			t.Errorf("Aggregate(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	tests := []struct {
+		in, exclude, want string
+	}{
+		{in: "1.1.1.0/24", exclude: "1.1.1.0/25", want: "1.1.1.128/25"},
+		{in: "1.1.1.0/24", exclude: "1.1.1.0/24", want: ""},
+		{in: "1.1.1.0/24", exclude: "0.0.0.0/0", want: ""},
+		{in: "10.0.0.0/30", exclude: "10.0.0.1", want: "10.0.0.0/32,10.0.0.2/31"},
+		{in: "10.0.0.0/24,10.0.2.0/24", exclude: "10.0.0.128/25,10.0.1.0/24,10.0.2.0/25", want: "10.0.0.0/25,10.0.2.128/25"},
+		{in: "1.1.1.0/24,2606:4700::/32", exclude: "::/0", want: "1.1.1.0/24"},
+	}
+	for _, tt := range tests {
+		if got := join(Subtract(parse(t, tt.in), parse(t, tt.exclude))); got != tt.want {
+			t.Errorf("Subtract(%q, %q) = %s, want %s", tt.in, tt.exclude, got, tt.want)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "1.1.1.0/24,1.1.1.0/25", want: "256"},
+		{in: "1.1.1.1,1.0.0.0/31", want: "3"},
+		{in: "2606:4700::/32", want: "79228162514264337593543950336"},
+		{in: "", want: "0"},
+	}
+	for _, tt := range tests {
+		if got := Count(parse(t, tt.in)).String(); got != tt.want {
+			t.Errorf("Count(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	var got []string
+	Expand(parse(t, "10.0.0.2/31,10.0.0.0/32,255.255.255.255"), func(a netip.Addr) bool {
+		got = append(got, a.String())
+		return true
+	})
+	if want := "10.0.0.0,10.0.0.2,10.0.0.3,255.255.255.255"; strings.Join(got, ",") != want {
+		t.Errorf("Expand() = %v, want %s", got, want)
+	}
+
+	n := 0
+	Expand(parse(t, "2606:4700::/32"), func(netip.Addr) bool {
+		n++
+		return n < 5
+	})
+	if n != 5 {
+		t.Errorf("Expand() did not stop, visited %d", n)
+	}
+}
+
+func TestParseListErrors(t *testing.T) {
+	for _, s := range []string{"1.1.1.0/33", "nope", "1.1.1.1/24/8"} {
+		if _, err := ParseList(strings.NewReader(s)); err == nil {
+			t.Errorf("ParseList(%q) accepted", s)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package clientconf substitutes scan results into the server templates of iOS proxy clients: Surge, Quantumult X and Shadowrocket.
+package clientconf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of Render
+const (
+	Surge        = "surge"
+	Quantumult   = "quantumult"
+	Shadowrocket = "shadowrocket"
+)
+
+// Test of the policy groups choosing the fastest server
+const (
+	testURL      = "http://www.gstatic.com/generate_204"
+	testInterval = 600
+)
+
+// Server is a result to substitute into the template
+type Server struct {
+	IP    netip.Addr
+	Delay time.Duration
+	Speed float64 // Bytes per second
+}
+
+// Render fills the server template once per server, in rank order, and adds a policy group of them named group:
+//   - surge: a [Proxy] line "name = type, {ip}, port, ..." per server and a url-test [Proxy Group]
+//   - quantumult: a Quantumult X [server_local] line "type={ip}:port, ..., tag=name" per server and a url-latency-benchmark [policy]
+//   - shadowrocket: a subscription, the base64 of a share link per server such as "vless://uuid@{ip}:443?...#name", without a group
+//
+// The placeholders are {ip}, {n} (the rank from 1), {delay} (ms) and {speed} (MB/s); IPv6 addresses are bracketed where a port
+// follows them, i.e. in all but Surge. The names have to differ, e.g. by {n}.
+func Render(format, template, group string, servers []Server) ([]byte, error) {
+	if format != Surge && format != Quantumult && format != Shadowrocket {
+		return nil, fmt.Errorf("unknown format %q, use surge, quantumult or shadowrocket", format)
+	}
+	if !strings.Contains(template, "{ip}") {
+		return nil, errors.New("the template has no {ip}")
+	}
+	lines := make([]string, len(servers))
+	names := make([]string, len(servers))
+	seen := make(map[string]bool)
+	for i, s := range servers {
+		host := s.IP.String()
+		if s.IP.Is6() && format != Surge {
+			host = "[" + host + "]"
+		}
+		lines[i] = strings.NewReplacer(
+			"{ip}", host,
+			"{n}", strconv.Itoa(i+1),
+			"{delay}", strconv.FormatFloat(float64(s.Delay)/float64(time.Millisecond), 'f', 0, 64),
+			"{speed}", strconv.FormatFloat(s.Speed/1024/1024, 'f', 2, 64),
+		).Replace(template)
+		name, err := serverName(format, lines[i])
+		if err != nil {
+			return nil, err
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("server %d is named %q like an earlier one, make the names differ, e.g. with {n}", i+1, name)
+		}
+		seen[name], names[i] = true, name
+	}
+
+	var b bytes.Buffer
+	switch format {
+	case Surge:
+		b.WriteString("[Proxy]\n")
+		for _, line := range lines {
+			b.WriteString(line + "\n")
+		}
+		if group != "" && len(names) > 0 {
+			fmt.Fprintf(&b, "\n[Proxy Group]\n%s = url-test, %s, url=%s, interval=%d\n", group, strings.Join(names, ", "), testURL, testInterval)
+		}
+	case Quantumult:
+		b.WriteString("[server_local]\n")
+		for _, line := range lines {
+			b.WriteString(line + "\n")
+		}
+		if group != "" && len(names) > 0 {
+			fmt.Fprintf(&b, "\n[policy]\nurl-latency-benchmark=%s, %s, check-interval=%d\n", group, strings.Join(names, ", "), testInterval)
+		}
+	case Shadowrocket:
+		b.WriteString(base64.StdEncoding.EncodeToString([]byte(strings.Join(lines, "\n"))))
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), nil
+}
+
+// Name of a rendered server line in format
+func serverName(format, line string) (string, error) {
+	switch format {
+	case Surge:
+		if name, _, ok := strings.Cut(line, "="); ok && strings.TrimSpace(name) != "" {
+			return strings.TrimSpace(name), nil
+		}
+		return "", fmt.Errorf("invalid Surge proxy %q, expected name = type, server, port, ...", line)
+	case Quantumult:
+		for _, param := range strings.Split(line, ",") {
+			if key, value, ok := strings.Cut(param, "="); ok && strings.TrimSpace(key) == "tag" {
+				return strings.TrimSpace(value), nil
+			}
+		}
+		return "", fmt.Errorf("invalid Quantumult X server %q, expected a tag=name parameter", line)
+	}
+	if !strings.Contains(line, "://") {
+		return "", fmt.Errorf("invalid share link %q, expected e.g. vless://uuid@{ip}:443?...#name", line)
+	}
+	return line, nil
+}
+
+// Template returns the first line of data that isn't empty or a comment (# or //), so a template file can explain itself
+func Template(data []byte) (string, error) {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "//") {
+			return line, nil
+		}
+	}
+	return "", errors.New("the template is empty")
+}
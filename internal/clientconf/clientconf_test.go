@@ -0,0 +1,86 @@
+package clientconf
+
+import (
+	"encoding/base64"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+var servers = []Server{
+	{IP: netip.MustParseAddr("1.0.0.1"), Delay: 95 * time.Millisecond, Speed: 12.5 * 1024 * 1024},
+	{IP: netip.MustParseAddr("2606:4700::1"), Delay: 120 * time.Millisecond},
+}
+
+func TestRenderSurge(t *testing.T) {
+	got, err := Render(Surge, "CF-{n} = trojan, {ip}, 443, password=x, sni=a.com // {delay} ms {speed} MB/s", "CF", servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[Proxy]
+CF-1 = trojan, 1.0.0.1, 443, password=x, sni=a.com // 95 ms 12.50 MB/s
+CF-2 = trojan, 2606:4700::1, 443, password=x, sni=a.com // 120 ms 0.00 MB/s
+
+[Proxy Group]
+CF = url-test, CF-1, CF-2, url=http://www.gstatic.com/generate_204, interval=600
+`
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenderQuantumult(t *testing.T) {
+	got, err := Render(Quantumult, "trojan={ip}:443, password=x, over-tls=true, tls-host=a.com, tag=CF-{n}", "", servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[server_local]
+trojan=1.0.0.1:443, password=x, over-tls=true, tls-host=a.com, tag=CF-1
+trojan=[2606:4700::1]:443, password=x, over-tls=true, tls-host=a.com, tag=CF-2
+`
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if _, err := Render(Quantumult, "trojan={ip}:443, password=x", "CF", servers); err == nil {
+		t.Error("no tag: want an error")
+	}
+}
+
+func TestRenderShadowrocket(t *testing.T) {
+	got, err := Render(Shadowrocket, "vless://id@{ip}:443?security=tls&sni=a.com#CF-{n}", "CF", servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(got)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "vless://id@1.0.0.1:443?security=tls&sni=a.com#CF-1\nvless://id@[2606:4700::1]:443?security=tls&sni=a.com#CF-2"
+	if string(links) != want {
+		t.Errorf("got %q, want %q", links, want)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	for _, tc := range []struct{ format, template string }{
+		{"clash", "CF-{n} = trojan, {ip}, 443"},
+		{Surge, "CF-{n} = trojan, 1.1.1.1, 443"},
+		{Surge, "CF = trojan, {ip}, 443"},
+		{Shadowrocket, "{ip}:443"},
+	} {
+		if _, err := Render(tc.format, tc.template, "CF", servers); err == nil {
+			t.Errorf("%s %q: want an error", tc.format, tc.template)
+		}
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	line, err := Template([]byte("# Surge server\n\n// comment\n  CF-{n} = trojan, {ip}, 443  \nignored\n"))
+	if err != nil || line != "CF-{n} = trojan, {ip}, 443" {
+		t.Errorf("got %q, %v", line, err)
+	}
+	if _, err := Template([]byte("# only a comment\n")); err == nil {
+		t.Error("empty template: want an error")
+	}
+}
@@ -0,0 +1,122 @@
+// Package dns answers A and AAAA queries for a single name, enough for a small authoritative responder.
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"strings"
+)
+
+// Record types and response codes
+const (
+	TypeA    uint16 = 1
+	TypeAAAA uint16 = 28
+
+	classIN = 1
+
+	rcodeFormErr  = 1
+	rcodeServFail = 2
+	rcodeNotImp   = 4
+	rcodeRefused  = 5
+)
+
+const headerLen = 12
+
+// Query is the question of a request
+type Query struct {
+	Name string // Lowercase, without the trailing dot
+	Type uint16
+}
+
+// Lookup returns the addresses of a query for a name served, ok false when the name isn't served
+type Lookup func(q Query) (addrs []netip.Addr, ok bool, err error)
+
+// Answer builds the response to a request, nil when the request is too malformed to answer
+func Answer(request []byte, ttl uint32, lookup Lookup) []byte {
+	if len(request) < headerLen || request[2]&0x80 != 0 {
+		return nil // Too short or a response
+	}
+	id, flags := request[:2], request[2]
+	if opcode := flags >> 3 & 0x0f; opcode != 0 {
+		return reply(id, flags, rcodeNotImp, nil, nil)
+	}
+	if binary.BigEndian.Uint16(request[4:]) != 1 {
+		return reply(id, flags, rcodeFormErr, nil, nil)
+	}
+	q, question, err := parseQuestion(request[headerLen:])
+	if err != nil {
+		return reply(id, flags, rcodeFormErr, nil, nil)
+	}
+	addrs, ok, err := lookup(q)
+	switch {
+	case err != nil:
+		return reply(id, flags, rcodeServFail, question, nil)
+	case !ok:
+		return reply(id, flags, rcodeRefused, question, nil)
+	}
+	var answers [][]byte
+	for _, a := range addrs {
+		if q.Type == TypeA && a.Is4() || q.Type == TypeAAAA && a.Is6() {
+			answers = append(answers, answerRecord(q.Type, ttl, a.AsSlice()))
+		}
+	}
+	return reply(id, flags, 0, question, answers)
+}
+
+// Reads the question, returning it and its wire form to echo
+func parseQuestion(b []byte) (Query, []byte, error) {
+	var labels []string
+	i := 0
+	for {
+		if i >= len(b) {
+			return Query{}, nil, errors.New("truncated name")
+		}
+		n := int(b[i])
+		if n == 0 {
+			i++
+			break
+		}
+		// Compression pointers have no place in the only name of a query
+		if n&0xc0 != 0 || i+1+n > len(b) {
+			return Query{}, nil, errors.New("malformed name")
+		}
+		labels = append(labels, string(b[i+1:i+1+n]))
+		i += 1 + n
+	}
+	if i+4 > len(b) {
+		return Query{}, nil, errors.New("truncated question")
+	}
+	if binary.BigEndian.Uint16(b[i+2:]) != classIN {
+		return Query{}, nil, errors.New("unsupported class")
+	}
+	q := Query{Name: strings.ToLower(strings.Join(labels, ".")), Type: binary.BigEndian.Uint16(b[i:])}
+	return q, b[:i+4], nil
+}
+
+func answerRecord(qtype uint16, ttl uint32, data []byte) []byte {
+	record := []byte{0xc0, headerLen} // Points at the name of the question
+	record = binary.BigEndian.AppendUint16(record, qtype)
+	record = binary.BigEndian.AppendUint16(record, classIN)
+	record = binary.BigEndian.AppendUint32(record, ttl)
+	record = binary.BigEndian.AppendUint16(record, uint16(len(data)))
+	return append(record, data...)
+}
+
+func reply(id []byte, flags byte, rcode byte, question []byte, answers [][]byte) []byte {
+	b := append([]byte{}, id...)
+	// QR and AA set, the opcode and RD of the request kept
+	b = append(b, 0x80|flags&0x79|0x04, rcode)
+	qdcount := 0
+	if question != nil {
+		qdcount = 1
+	}
+	b = binary.BigEndian.AppendUint16(b, uint16(qdcount))
+	b = binary.BigEndian.AppendUint16(b, uint16(len(answers)))
+	b = append(b, 0, 0, 0, 0)
+	b = append(b, question...)
+	for _, a := range answers {
+		b = append(b, a...)
+	}
+	return b
+}
@@ -0,0 +1,67 @@
+package dns
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+)
+
+func query(name string, qtype uint16) []byte {
+	b := []byte{0x12, 0x34, 0x01, 0, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range []string{"Clean", "local"} {
+		if name == "" {
+			break
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	b = append(b, 0)
+	b = binary.BigEndian.AppendUint16(b, qtype)
+	return binary.BigEndian.AppendUint16(b, classIN)
+}
+
+func TestAnswer(t *testing.T) {
+	addrs := []netip.Addr{netip.MustParseAddr("1.1.1.1"), netip.MustParseAddr("2606:4700::1"), netip.MustParseAddr("1.0.0.1")}
+	lookup := func(q Query) ([]netip.Addr, bool, error) {
+		return addrs, q.Name == "clean.local", nil
+	}
+	tests := []struct {
+		name            string
+		request         []byte
+		rcode           byte
+		answers         int
+		firstAnswerData string
+	}{
+		{name: "A", request: query("clean.local", TypeA), answers: 2, firstAnswerData: "1.1.1.1"},
+		{name: "AAAA", request: query("clean.local", TypeAAAA), answers: 1, firstAnswerData: "2606:4700::1"},
+		{name: "TXT", request: query("clean.local", 16)},
+		{name: "other name", request: query("", TypeA), rcode: rcodeRefused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := Answer(tt.request, 60, lookup)
+			if len(resp) < headerLen || resp[0] != 0x12 || resp[1] != 0x34 || resp[2]&0x84 != 0x84 {
+				t.Fatalf("response header %x", resp)
+			}
+			if resp[3]&0x0f != tt.rcode {
+				t.Errorf("rcode = %d, want %d", resp[3]&0x0f, tt.rcode)
+			}
+			if n := int(binary.BigEndian.Uint16(resp[6:])); n != tt.answers {
+				t.Fatalf("%d answers, want %d", n, tt.answers)
+			}
+			if tt.answers == 0 {
+				return
+			}
+			// The first answer follows the echoed question
+			rdata := resp[len(tt.request)+10:]
+			size := int(binary.BigEndian.Uint16(rdata))
+			addr, _ := netip.AddrFromSlice(rdata[2 : 2+size])
+			if addr.String() != tt.firstAnswerData {
+				t.Errorf("first answer %s, want %s", addr, tt.firstAnswerData)
+			}
+		})
+	}
+	if Answer([]byte{1, 2, 3}, 60, lookup) != nil {
+		t.Error("answered a truncated request")
+	}
+}
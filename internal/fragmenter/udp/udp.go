@@ -0,0 +1,111 @@
+// Package udp shapes UDP datagrams against DPI, the counterpart of the TCP fragmentation of github.com/hadi77ir/fragmenter.
+// DPI of UDP matches the length of the first datagram of a flow and the QUIC Initial in it rather than TCP segments, so
+// instead of chunking it pads the Initial to other sizes and splits the start of the flow with junk datagrams sent ahead of
+// it, which QUIC servers drop as undecryptable.
+package udp
+
+import (
+	"crypto/rand"
+	"fmt"
+	mathrand "math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MinDatagram is the smallest datagram carrying a client Initial (RFC 9000, section 14.1)
+	MinDatagram = 1200
+	// MaxDatagram is the largest datagram sent, the UDP payload of a 1500 byte IPv6 packet
+	MaxDatagram = 1452
+)
+
+// Padding shapes the datagrams of a QUIC flow
+type Padding struct {
+	Size      int           // Datagram size of the Initial, MinDatagram~MaxDatagram
+	Jitter    int           // Random bytes up to this many added to Size, so the length doesn't mark the flow
+	Noise     int           // Junk datagrams sent before the first packet of a connection
+	NoiseMin  int           // Smallest junk datagram
+	NoiseMax  int           // Largest junk datagram
+	NoiseWait time.Duration // Between the junk and the first packet
+}
+
+// ParsePadding parses comma separated key=value items: size=1350 jitter=50 noise=2 noise-size=16-64 delay=10ms;
+// "none" returns nil
+func ParsePadding(opts string) (*Padding, error) {
+	if opts == "" || opts == "none" {
+		return nil, nil
+	}
+	p := &Padding{Size: MinDatagram, NoiseMin: 16, NoiseMax: 64}
+	for _, item := range strings.Split(opts, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid QUIC padding item %q, use key=value", item)
+		}
+		var err error
+		switch key {
+		case "size":
+			p.Size, err = strconv.Atoi(value)
+		case "jitter":
+			p.Jitter, err = strconv.Atoi(value)
+		case "noise":
+			p.Noise, err = strconv.Atoi(value)
+		case "noise-size":
+			from, to, isRange := strings.Cut(value, "-")
+			if !isRange {
+				to = from
+			}
+			if p.NoiseMin, err = strconv.Atoi(from); err == nil {
+				p.NoiseMax, err = strconv.Atoi(to)
+			}
+		case "delay":
+			p.NoiseWait, err = time.ParseDuration(value)
+		default:
+			return nil, fmt.Errorf("unknown QUIC padding item %q, use size, jitter, noise, noise-size or delay", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid QUIC padding item %q", item)
+		}
+	}
+	switch {
+	case p.Size < MinDatagram || p.Size > MaxDatagram:
+		return nil, fmt.Errorf("QUIC padding size %d is outside %d~%d", p.Size, MinDatagram, MaxDatagram)
+	case p.Jitter < 0 || p.Size+p.Jitter > MaxDatagram:
+		return nil, fmt.Errorf("QUIC padding jitter %d takes the size past %d", p.Jitter, MaxDatagram)
+	case p.Noise < 0 || p.Noise > 10:
+		return nil, fmt.Errorf("QUIC junk datagrams %d are outside 0~10", p.Noise)
+	case p.NoiseMin < 1 || p.NoiseMax < p.NoiseMin || p.NoiseMax > MaxDatagram:
+		return nil, fmt.Errorf("invalid QUIC junk size %d~%d (1~%d)", p.NoiseMin, p.NoiseMax, MaxDatagram)
+	case p.NoiseWait < 0 || p.NoiseWait > time.Second:
+		return nil, fmt.Errorf("QUIC junk delay %v is outside 0~1s", p.NoiseWait)
+	}
+	return p, nil
+}
+
+// DatagramSize returns the size of the next Initial datagram, MinDatagram for a nil Padding.
+// r is the random source of the calling goroutine.
+func (p *Padding) DatagramSize(r *mathrand.Rand) int {
+	if p == nil {
+		return MinDatagram
+	}
+	return p.Size + r.Intn(p.Jitter+1)
+}
+
+// WriteNoise sends the junk datagrams ahead of the first packet of a connection with write and waits NoiseWait.
+// r is the random source of the calling goroutine.
+func (p *Padding) WriteNoise(r *mathrand.Rand, write func([]byte) (int, error)) error {
+	if p == nil || p.Noise == 0 {
+		return nil
+	}
+	for i := 0; i < p.Noise; i++ {
+		junk := make([]byte, p.NoiseMin+r.Intn(p.NoiseMax-p.NoiseMin+1))
+		_, _ = rand.Read(junk)
+		// A short header form, like the 1-RTT packets of a connection the server doesn't know
+		junk[0] = junk[0]&^0x80 | 0x40
+		if _, err := write(junk); err != nil {
+			return err
+		}
+	}
+	time.Sleep(p.NoiseWait)
+	return nil
+}
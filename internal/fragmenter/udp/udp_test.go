@@ -0,0 +1,50 @@
+package udp
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestParsePadding(t *testing.T) {
+	for _, bad := range []string{"size=1000", "size=1400,jitter=100", "noise=11", "noise-size=0", "noise-size=64-16", "delay=2s", "pad=1", "size"} {
+		if _, err := ParsePadding(bad); err == nil {
+			t.Errorf("ParsePadding(%q): want an error", bad)
+		}
+	}
+	if p, err := ParsePadding("none"); p != nil || err != nil || p.DatagramSize(nil) != MinDatagram {
+		t.Errorf("none = %v, %v, want no padding", p, err)
+	}
+}
+
+func TestPadding(t *testing.T) {
+	p, err := ParsePadding("size=1300,jitter=20,noise=3,noise-size=8-12,delay=1ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		if size := p.DatagramSize(r); size < 1300 || size > 1320 {
+			t.Fatalf("datagram size %d is outside 1300~1320", size)
+		}
+	}
+	var junk [][]byte
+	err = p.WriteNoise(r, func(b []byte) (int, error) {
+		junk = append(junk, b)
+		return len(b), nil
+	})
+	if err != nil || len(junk) != 3 {
+		t.Fatalf("WriteNoise sent %d datagrams, %v, want 3", len(junk), err)
+	}
+	for _, b := range junk {
+		if len(b) < 8 || len(b) > 12 || b[0]&0xc0 != 0x40 {
+			t.Errorf("junk datagram of %d bytes, first byte %#x, want 8~12 bytes of a short header", len(b), b[0])
+		}
+	}
+	// The sizes follow the source, so a seeded scan shapes its datagrams the same way every run
+	a, b := rand.New(rand.NewSource(7)), rand.New(rand.NewSource(7))
+	for i := 0; i < 10; i++ {
+		if x, y := p.DatagramSize(a), p.DatagramSize(b); x != y {
+			t.Fatalf("sources of one seed gave sizes %d and %d", x, y)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Package lbconf writes scan results as the backends of reverse proxies load-balancing across them: an HAProxy backend or
+// an upstream of the Nginx stream module, weighted by download speed.
+package lbconf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"strings"
+)
+
+// Formats of Render
+const (
+	HAProxy = "haproxy"
+	Nginx   = "nginx"
+)
+
+// Weight of the fastest server, the others get theirs in proportion to their speed
+const maxWeight = 100
+
+// Server is a result to balance across
+type Server struct {
+	IP    netip.Addr
+	Speed float64 // Bytes per second, 0 without a download test
+}
+
+// Render writes the servers, in rank order, as a backend named name forwarding TCP to port:
+//   - haproxy: a "backend" section in tcp mode with a health-checked "server cfN ip:port weight W check" line per server
+//   - nginx: an "upstream" block for the stream {} context with a "server ip:port weight=W;" line per server
+//
+// The fastest server weighs 100 and the others in proportion to their speed, at least 1; without download speeds all
+// servers weigh the same.
+func Render(format, name string, port int, servers []Server) ([]byte, error) {
+	if format != HAProxy && format != Nginx {
+		return nil, fmt.Errorf("unknown format %q, use haproxy or nginx", format)
+	}
+	if name == "" || strings.ContainsAny(name, " \t\n{};#") {
+		return nil, fmt.Errorf("invalid backend name %q", name)
+	}
+	if port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", port)
+	}
+	if len(servers) == 0 {
+		return nil, errors.New("no servers")
+	}
+	weights := weigh(servers)
+
+	var b bytes.Buffer
+	switch format {
+	case HAProxy:
+		fmt.Fprintf(&b, "backend %s\n    mode tcp\n    balance roundrobin\n", name)
+		for i, s := range servers {
+			fmt.Fprintf(&b, "    server cf%d %s weight %d check\n", i+1, netip.AddrPortFrom(s.IP, uint16(port)), weights[i])
+		}
+	case Nginx:
+		fmt.Fprintf(&b, "upstream %s {\n", name)
+		for i, s := range servers {
+			fmt.Fprintf(&b, "    server %s weight=%d;\n", netip.AddrPortFrom(s.IP, uint16(port)), weights[i])
+		}
+		b.WriteString("}\n")
+	}
+	return b.Bytes(), nil
+}
+
+// Weights of the servers by their speed, see Render
+func weigh(servers []Server) []int {
+	fastest := 0.0
+	for _, s := range servers {
+		fastest = max(fastest, s.Speed)
+	}
+	weights := make([]int, len(servers))
+	for i, s := range servers {
+		weights[i] = 1
+		if fastest > 0 {
+			weights[i] = max(1, int(math.Round(s.Speed/fastest*maxWeight)))
+		}
+	}
+	return weights
+}
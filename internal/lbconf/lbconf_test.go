@@ -0,0 +1,69 @@
+package lbconf
+
+import (
+	"net/netip"
+	"testing"
+)
+
+var servers = []Server{
+	{IP: netip.MustParseAddr("1.0.0.1"), Speed: 20 * 1024 * 1024},
+	{IP: netip.MustParseAddr("2606:4700::1"), Speed: 5 * 1024 * 1024},
+	{IP: netip.MustParseAddr("1.1.1.1"), Speed: 1024},
+}
+
+func TestRenderHAProxy(t *testing.T) {
+	got, err := Render(HAProxy, "cloudflare", 443, servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `backend cloudflare
+    mode tcp
+    balance roundrobin
+    server cf1 1.0.0.1:443 weight 100 check
+    server cf2 [2606:4700::1]:443 weight 25 check
+    server cf3 1.1.1.1:443 weight 1 check
+`
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenderNginx(t *testing.T) {
+	got, err := Render(Nginx, "cloudflare", 8443, servers[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `upstream cloudflare {
+    server 1.0.0.1:8443 weight=100;
+    server [2606:4700::1]:8443 weight=25;
+}
+`
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWeighWithoutSpeeds(t *testing.T) {
+	weights := weigh([]Server{{IP: servers[0].IP}, {IP: servers[1].IP}})
+	if len(weights) != 2 || weights[0] != 1 || weights[1] != 1 {
+		t.Errorf("weights = %v, want the same for all", weights)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	for _, c := range []struct {
+		format, name string
+		port         int
+		servers      []Server
+	}{
+		{"caddy", "cloudflare", 443, servers},
+		{Nginx, "", 443, servers},
+		{Nginx, "cf {", 443, servers},
+		{HAProxy, "cloudflare", 0, servers},
+		{HAProxy, "cloudflare", 443, nil},
+	} {
+		if _, err := Render(c.format, c.name, c.port, c.servers); err == nil {
+			t.Errorf("Render(%q, %q, %d, %d servers) succeeded, want an error", c.format, c.name, c.port, len(c.servers))
+		}
+	}
+}
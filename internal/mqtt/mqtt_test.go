@@ -0,0 +1,79 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// Accepts one client, acknowledges it and hands over the packets it sends
+func fakeBroker(t *testing.T, code byte) (string, <-chan []byte) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	packets := make(chan []byte, 8)
+	go func() {
+		defer close(packets)
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			kind, body, err := ReadPacket(r)
+			if err != nil {
+				return
+			}
+			if kind == packetConnect {
+				_, _ = conn.Write([]byte{packetConnack, 2, 0, code})
+			}
+			packets <- append([]byte{kind}, body...)
+		}
+	}()
+	return "tcp://user:secret@" + l.Addr().String(), packets
+}
+
+func TestPublish(t *testing.T) {
+	broker, packets := fakeBroker(t, 0)
+	will := &Message{Topic: "cfscan/status", Payload: []byte(`{"state":"offline"}`), Retain: true}
+	c, err := Dial(broker, Options{ClientID: "test", KeepAlive: time.Minute, Will: will})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connect := <-packets
+	if connect[0] != packetConnect || !bytes.Contains(connect, []byte("MQTT")) || !bytes.Contains(connect, []byte("secret")) {
+		t.Errorf("CONNECT = %q", connect)
+	}
+	if flags := connect[8]; flags != flagCleanSession|flagWill|flagWillRetain|flagUsername|flagPassword {
+		t.Errorf("CONNECT flags = %08b", flags)
+	}
+
+	payload := bytes.Repeat([]byte("x"), 300) // Remaining length of two bytes
+	if err := c.Publish(Message{Topic: "cfscan/best", Payload: payload, Retain: true}); err != nil {
+		t.Fatal(err)
+	}
+	publish := <-packets
+	want := append(append([]byte{packetPublish | 1}, appendString(nil, "cfscan/best")...), payload...)
+	if !bytes.Equal(publish, want) {
+		t.Errorf("PUBLISH = %q", publish)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if disconnect := <-packets; disconnect[0] != packetDisconnect {
+		t.Errorf("got packet %x, want DISCONNECT", disconnect[0])
+	}
+}
+
+func TestDialRefused(t *testing.T) {
+	broker, _ := fakeBroker(t, 5)
+	if _, err := Dial(broker, Options{ClientID: "test"}); err == nil {
+		t.Error("refused connection succeeded")
+	}
+}
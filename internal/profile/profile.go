@@ -0,0 +1,87 @@
+// Package profile encodes scan options as one string to share, and checks that a profile only carries scan settings.
+package profile
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Prefix of profile strings, with the version of their encoding
+const Prefix = "cfscan1."
+
+// Options a shared profile may carry: how to scan and what to show. Options tied to the machine, its files or running
+// commands, and the safety limits of polite mode and [-max-data], are left to whoever runs it.
+var flags = map[string]bool{
+	// Latency and download tests
+	"n": true, "calibrate": true, "adaptive": true, "skip-subnets": true, "t": true, "dn": true, "dt-threads": true, "dt": true, "dht": true,
+	"tp": true, "url": true, "sni": true, "httping": true, "httping-code": true, "cfcolo": true, "colo-inline": true, "colo": true, "dd": true,
+	"allip": true, "polite": true, "tl": true, "tll": true, "tlr": true, "sl": true, "abort-after": true, "abort-fraction": true, "seed": true,
+	// Extra probes
+	"cache-bust": true, "cache-status": true, "session-resume": true, "sizes": true, "upload": true, "ul-url": true, "ul-size": true,
+	"quic": true, "waterfall": true, "require-cache": true, "warmup": true, "keepalive": true, "enrich": true, "cert-check": true,
+	"enrich-threads": true, "recheck": true, "route": true, "raw-bytes": true, "tcp-fingerprint": true, "tcp-signature": true,
+	// Evasion
+	"fingerprint": true, "fingerprint-sweep": true, "ja3": true, "ja3-only": true, "fragment": true, "fragment-probes": true,
+	"fragment-plain": true, "tos": true, "ttl": true,
+	// Ranges, selection and planning
+	"ip": true, "use-embedded": true, "hosts": true, "hosts-neighbors": true, "doh": true, "min-reputation": true, "per-colo": true,
+	"family-ratio": true, "max-per-subnet": true, "explore": true, "budget": true, "time": true, "want": true, "plan": true,
+	// Display
+	"p": true, "show": true, "show-columns": true, "show-filter": true, "speed-unit": true, "delay-unit": true, "precision": true,
+	"error-class": true, "json": true,
+}
+
+// Profile is the scan settings of a profile string
+type Profile struct {
+	Version string   `json:"version"` // Of the program that exported it
+	Args    []string `json:"args"`
+}
+
+// Encode returns args as a profile string exported by version, an error when they hold options a profile can't carry
+func Encode(version string, args []string) (string, error) {
+	if err := Check(args); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(Profile{Version: version, Args: args})
+	if err != nil {
+		return "", err
+	}
+	return Prefix + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// Decode parses a profile string, an error when it is corrupt or holds options a profile can't carry
+func Decode(s string) (Profile, error) {
+	var profile Profile
+	encoded, ok := strings.CutPrefix(strings.TrimSpace(s), Prefix)
+	if !ok {
+		return profile, fmt.Errorf("not a profile, expected it to start with %q", Prefix)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return profile, fmt.Errorf("corrupt profile: %v", err)
+	}
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return profile, fmt.Errorf("corrupt profile: %v", err)
+	}
+	return profile, Check(profile.Args)
+}
+
+// Check rejects options other than the scan settings, arguments not naming a flag are values and pass
+func Check(args []string) error {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if _, err := strconv.ParseFloat(arg, 64); err == nil { // A negative value, e.g. -explore -1
+			continue
+		}
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !flags[name] {
+			return fmt.Errorf("-%s can't be part of a profile, only scan settings can", name)
+		}
+	}
+	return nil
+}
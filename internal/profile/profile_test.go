@@ -0,0 +1,39 @@
+package profile
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	args := []string{"-tl", "200", "-fragment", "preset:tlshello", "-explore", "-1", "--httping", "-colo=FRA,AMS"}
+	s, err := Encode("v2.3.0", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Decode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version != "v2.3.0" || !slices.Equal(p.Args, args) {
+		t.Errorf("Decode = %+v, want the encoded args", p)
+	}
+	if _, err := Decode("cfscan0.abc"); err == nil {
+		t.Error("Decode accepted a string without the prefix")
+	}
+}
+
+func TestCheckRefusesLocalOptions(t *testing.T) {
+	for _, arg := range []string{"-i-know-what-im-doing", "-max-data=0", "-polite-rate", "-o", "-hook", "--rpc-stdio", "-hello-spec", "-ech", "-cache", "-f", "-unknown"} {
+		if _, err := Encode("v2.3.0", []string{"-tl", "200", arg, "x"}); err == nil {
+			t.Errorf("Encode accepted %s", arg)
+		}
+		// Profiles made by hand, not by export-profile
+		data, _ := json.Marshal(Profile{Args: []string{arg}})
+		if _, err := Decode(Prefix + base64.RawURLEncoding.EncodeToString(data)); err == nil {
+			t.Errorf("Decode accepted a profile setting %s", arg)
+		}
+	}
+}
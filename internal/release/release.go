@@ -0,0 +1,164 @@
+// Package release checks the archives self-update downloads: their checksum and ed25519 signature, the binary inside them
+// and whether their version is newer than the running one.
+package release
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Verify checks the archive against its sha256sum line and, when publicKey is set, its ed25519 signature in base64.
+// Without a key the checksum alone is trusted only with checksumOnly.
+func Verify(archive, sum, sig []byte, publicKey string, checksumOnly bool) error {
+	fields := strings.Fields(string(sum))
+	if len(fields) == 0 {
+		return errors.New("empty checksum file")
+	}
+	want, err := hex.DecodeString(fields[0])
+	if err != nil || len(want) != sha256.Size {
+		return errors.New("malformed checksum file")
+	}
+	if got := sha256.Sum256(archive); !bytes.Equal(got[:], want) {
+		return errors.New("checksum mismatch")
+	}
+	if publicKey == "" {
+		if !checksumOnly {
+			return errors.New("this build has no release signing key, use [-checksum-only] to trust the checksum alone")
+		}
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("malformed release signing key")
+	}
+	if len(sig) == 0 {
+		return errors.New("release is not signed")
+	}
+	if !ed25519.Verify(key, archive, sig) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// ExtractBinary returns the file called name in a zip archive, in any directory, reading at most limit bytes of it
+func ExtractBinary(archive []byte, name string, limit int64) ([]byte, error) {
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range r.File {
+		if path.Base(f.Name) != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > limit {
+			return nil, fmt.Errorf("%s is larger than %d MB", name, limit>>20)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("archive has no %s", name)
+}
+
+// Compare compares two semantic versions such as v2.3.0 or v2.3.0-rc.1, returning -1, 0 or +1 as a is older, the same or
+// newer than b; ok is false when either is not a version, e.g. a development build.
+func Compare(a, b string) (result int, ok bool) {
+	x, ok := parse(a)
+	if !ok {
+		return 0, false
+	}
+	y, ok := parse(b)
+	if !ok {
+		return 0, false
+	}
+	for i := range x.core {
+		if x.core[i] != y.core[i] {
+			return sign(x.core[i] - y.core[i]), true
+		}
+	}
+	switch {
+	case x.pre == y.pre:
+		return 0, true
+	case x.pre == "": // A release is newer than its pre-releases
+		return 1, true
+	case y.pre == "":
+		return -1, true
+	}
+	xs, ys := strings.Split(x.pre, "."), strings.Split(y.pre, ".")
+	for i := 0; i < len(xs) && i < len(ys); i++ {
+		if c := comparePre(xs[i], ys[i]); c != 0 {
+			return c, true
+		}
+	}
+	return sign(len(xs) - len(ys)), true
+}
+
+type semver struct {
+	core [3]int
+	pre  string
+}
+
+// Parses vMAJOR[.MINOR[.PATCH]][-PRE][+BUILD], the build metadata doesn't order versions
+func parse(v string) (semver, bool) {
+	var s semver
+	v, ok := strings.CutPrefix(v, "v")
+	if !ok {
+		return s, false
+	}
+	v, _, _ = strings.Cut(v, "+")
+	v, s.pre, _ = strings.Cut(v, "-")
+	parts := strings.Split(v, ".")
+	if len(parts) > 3 {
+		return s, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || part != strconv.Itoa(n) {
+			return s, false
+		}
+		s.core[i] = n
+	}
+	return s, true
+}
+
+// Numeric identifiers compare as numbers and before alphanumeric ones, which compare as text
+func comparePre(a, b string) int {
+	x, errX := strconv.Atoi(a)
+	y, errY := strconv.Atoi(b)
+	switch {
+	case errX == nil && errY == nil:
+		return sign(x - y)
+	case errX == nil:
+		return -1
+	case errY == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
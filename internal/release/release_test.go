@@ -0,0 +1,120 @@
+package release
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Zip archive of a release holding files of the given names and contents
+func testArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func checksum(archive []byte) []byte {
+	sum := sha256.Sum256(archive)
+	return []byte(hex.EncodeToString(sum[:]) + "  CloudflareScanner_linux-amd64.zip\n")
+}
+
+func TestVerify(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	key := base64.StdEncoding.EncodeToString(public)
+	archive := testArchive(t, map[string]string{"CloudflareScanner": "binary"})
+	sum, sig := checksum(archive), ed25519.Sign(private, archive)
+
+	tampered := bytes.Clone(archive)
+	tampered[len(tampered)/2] ^= 1
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	badSig := bytes.Clone(sig)
+	badSig[0] ^= 1
+
+	tests := []struct {
+		name          string
+		archive       []byte
+		sum, sig      []byte
+		key           string
+		checksumOnly  bool
+		wantErrSubstr string
+	}{
+		{"signed", archive, sum, sig, key, false, ""},
+		{"bad signature", archive, sum, badSig, key, false, "invalid signature"},
+		{"signed by another key", archive, sum, ed25519.Sign(otherKey, archive), key, false, "invalid signature"},
+		{"unsigned", archive, sum, nil, key, false, "not signed"},
+		{"checksum mismatch", archive, checksum([]byte("other")), sig, key, false, "checksum mismatch"},
+		{"malformed checksum", archive, []byte("abc  file.zip"), sig, key, false, "malformed"},
+		{"tampered archive", tampered, sum, sig, key, false, "checksum mismatch"},
+		// Tampered along with its checksum, only the signature catches it
+		{"tampered archive and checksum", tampered, checksum(tampered), sig, key, false, "invalid signature"},
+		{"no key", archive, sum, sig, "", false, "checksum-only"},
+		{"no key, checksum only", archive, sum, nil, "", true, ""},
+		{"no key, checksum only, tampered", tampered, sum, nil, "", true, "checksum mismatch"},
+	}
+	for _, tc := range tests {
+		err := Verify(tc.archive, tc.sum, tc.sig, tc.key, tc.checksumOnly)
+		switch {
+		case tc.wantErrSubstr == "" && err != nil:
+			t.Errorf("%s: %v, want it verified", tc.name, err)
+		case tc.wantErrSubstr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErrSubstr)):
+			t.Errorf("%s: %v, want an error containing %q", tc.name, err, tc.wantErrSubstr)
+		}
+	}
+}
+
+func TestExtractBinary(t *testing.T) {
+	archive := testArchive(t, map[string]string{"README.md": "readme", "dist/CloudflareScanner": "binary"})
+	if got, err := ExtractBinary(archive, "CloudflareScanner", 1<<20); err != nil || string(got) != "binary" {
+		t.Errorf("ExtractBinary = %q, %v, want the binary", got, err)
+	}
+	if _, err := ExtractBinary(archive, "CloudflareScanner.exe", 1<<20); err == nil {
+		t.Error("ExtractBinary found a binary the archive doesn't have")
+	}
+	if _, err := ExtractBinary(archive, "CloudflareScanner", 3); err == nil {
+		t.Error("ExtractBinary returned a binary over the limit")
+	}
+	if _, err := ExtractBinary([]byte("not a zip"), "CloudflareScanner", 1<<20); err == nil {
+		t.Error("ExtractBinary read a corrupt archive")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+		ok   bool
+	}{
+		{"v2.3.0", "v2.3.0", 0, true},
+		{"v2.2.9", "v2.3.0", -1, true},
+		{"v2.10.0", "v2.9.1", 1, true},
+		{"v3", "v2.9.9", 1, true},
+		{"v2.3.0-rc.1", "v2.3.0", -1, true},
+		{"v2.3.0-rc.2", "v2.3.0-rc.10", -1, true},
+		{"v2.3.0-rc.1", "v2.3.0-beta", 1, true},
+		{"v2.3.0+linux", "v2.3.0", 0, true},
+		{"v2.3.0", "(devel)", 0, false},
+		{"2.3.0", "v2.3.0", 0, false},
+		{"v2.03.0", "v2.3.0", 0, false},
+	}
+	for _, tc := range tests {
+		if got, ok := Compare(tc.a, tc.b); got != tc.want || ok != tc.ok {
+			t.Errorf("Compare(%q, %q) = %d, %v, want %d, %v", tc.a, tc.b, got, ok, tc.want, tc.ok)
+		}
+	}
+}
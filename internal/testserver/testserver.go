@@ -0,0 +1,375 @@
+// Package testserver runs a local HTTPS endpoint imitating a Cloudflare edge, used by the scanner tests.
+package testserver
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBodySize = 1 << 20
+	defaultColo     = "FRA"
+	chunkSize       = 16 * 1024
+	maxStall        = time.Minute
+)
+
+// Config controls how the server misbehaves
+type Config struct {
+	// Latency is added before every response
+	Latency time.Duration
+	// Bandwidth limits body writes in bytes per second, 0 is unlimited
+	Bandwidth int64
+	// ResetAfter resets the connection after sending this many body bytes, 0 never resets
+	ResetAfter int64
+	// BodySize is the /__down body size when the request has no "bytes" parameter
+	BodySize int64
+	// Colo is the datacenter code reported in CF-RAY and /cdn-cgi/trace
+	Colo string
+	// MaxConns resets the handshake of connections beyond this many open at once, like a stateful DPI; 0 is unlimited
+	MaxConns int
+	// HTTP2 offers h2 in the TLS handshake, serving HTTP/1.1 only otherwise
+	HTTP2 bool
+	// Faults are injected at random into connections and responses
+	Faults Faults
+}
+
+// Faults holds the probability (0~1) of each injected fault
+type Faults struct {
+	// HandshakeReset resets the connection after the ClientHello arrives
+	HandshakeReset float64
+	// Stall stops sending the body after the first chunk until the client gives up
+	Stall float64
+	// Truncate closes the connection after a random part of the body
+	Truncate float64
+	// Seed makes the fault sequence reproducible, 0 picks a random seed
+	Seed int64
+}
+
+type Server struct {
+	*httptest.Server
+	config Config
+
+	m    sync.Mutex
+	rand *rand.Rand
+	open int // Connections accepted and not closed yet
+}
+
+// ParseConfig parses "key=value" pairs separated by commas, for example
+// "latency=50ms,bandwidth=1048576,reset=0.1,stall=0.05,truncate=0.1,seed=1"
+func ParseConfig(opts string) (Config, error) {
+	var c Config
+	for _, part := range strings.Split(opts, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return c, fmt.Errorf("invalid option: %s", part)
+		}
+		var err error
+		switch key {
+		case "latency":
+			c.Latency, err = time.ParseDuration(value)
+		case "bandwidth":
+			c.Bandwidth, err = strconv.ParseInt(value, 10, 64)
+		case "reset-after":
+			c.ResetAfter, err = strconv.ParseInt(value, 10, 64)
+		case "size":
+			c.BodySize, err = strconv.ParseInt(value, 10, 64)
+		case "colo":
+			c.Colo = strings.ToUpper(value)
+		case "max-conns":
+			c.MaxConns, err = strconv.Atoi(value)
+		case "reset":
+			c.Faults.HandshakeReset, err = parseProbability(value)
+		case "stall":
+			c.Faults.Stall, err = parseProbability(value)
+		case "truncate":
+			c.Faults.Truncate, err = parseProbability(value)
+		case "seed":
+			c.Faults.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return c, fmt.Errorf("unknown option: %s", key)
+		}
+		if err != nil {
+			return c, fmt.Errorf("invalid %s: %s", key, value)
+		}
+	}
+	return c, nil
+}
+
+func parseProbability(value string) (float64, error) {
+	p, err := strconv.ParseFloat(value, 64)
+	if err != nil || p < 0 || p > 1 {
+		return 0, fmt.Errorf("invalid probability: %s", value)
+	}
+	return p, nil
+}
+
+// New starts an HTTPS server with the given behavior, close it with Close
+func New(config Config) *Server {
+	if config.BodySize <= 0 {
+		config.BodySize = defaultBodySize
+	}
+	if config.Colo == "" {
+		config.Colo = defaultColo
+	}
+	seed := config.Faults.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	s := &Server{config: config, rand: rand.New(rand.NewSource(seed))}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/__down", s.handleDown)
+	mux.HandleFunc("/__up", s.handleUp)
+	mux.HandleFunc("/cdn-cgi/trace", s.handleTrace)
+	mux.HandleFunc("/", s.handleDefault)
+	s.Server = httptest.NewUnstartedServer(mux)
+	// TCPing and injected faults abort handshakes all the time
+	s.Config.ErrorLog = log.New(io.Discard, "", 0)
+	// The TLS listener is stacked on top, so faults see the raw handshake
+	s.Listener = &faultListener{Listener: s.Listener, server: s}
+	s.EnableHTTP2 = config.HTTP2
+	s.StartTLS()
+	return s
+}
+
+// Reports whether a fault with probability p happens
+func (s *Server) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.rand.Float64() < p
+}
+
+func (s *Server) int63n(n int64) int64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.rand.Int63n(n)
+}
+
+// Port returns the port the server listens on
+func (s *Server) Port() int {
+	return s.Listener.Addr().(*net.TCPAddr).Port
+}
+
+// IP returns the address the server listens on
+func (s *Server) IP() *net.IPAddr {
+	return &net.IPAddr{IP: s.Listener.Addr().(*net.TCPAddr).IP}
+}
+
+// CertPool returns a pool trusting the server certificate
+func (s *Server) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.Certificate())
+	return pool
+}
+
+// URL of the download endpoint serving size bytes
+func (s *Server) DownloadURL(size int64) string {
+	return s.URL + "/__down?bytes=" + strconv.FormatInt(size, 10)
+}
+
+func (s *Server) setEdgeHeaders(w http.ResponseWriter) {
+	w.Header().Set("Server", "cloudflare")
+	w.Header().Set("CF-RAY", fmt.Sprintf("%016x-%s", time.Now().UnixNano(), s.config.Colo))
+}
+
+func (s *Server) handleDefault(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(s.config.Latency)
+	s.setEdgeHeaders(w)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleTrace(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(s.config.Latency)
+	s.setEdgeHeaders(w)
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "fl=1f1\nh=%s\nip=%s\nts=%.3f\nvisit_scheme=https\nuag=%s\ncolo=%s\nsliver=none\nhttp=http/1.1\nloc=DE\ntls=TLSv1.3\nsni=plaintext\nwarp=off\ngateway=off\nrbi=off\nkex=X25519\n",
+		r.Host, host, float64(time.Now().UnixNano())/1e9, r.UserAgent(), s.config.Colo)
+}
+
+func (s *Server) handleDown(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(s.config.Latency)
+	size := s.config.BodySize
+	if v, err := strconv.ParseInt(r.URL.Query().Get("bytes"), 10, 64); err == nil && v >= 0 {
+		size = v
+	}
+	s.setEdgeHeaders(w)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if s.config.ResetAfter > 0 && s.config.ResetAfter < size {
+		s.writePartial(w, size, s.config.ResetAfter, true)
+		return
+	}
+	if size > 0 && s.chance(s.config.Faults.Truncate) {
+		s.writePartial(w, size, s.int63n(size), false)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if size > chunkSize && s.chance(s.config.Faults.Stall) {
+		s.writeBody(w, chunkSize)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(maxStall):
+		}
+		return
+	}
+	s.writeBody(w, size)
+}
+
+func (s *Server) handleUp(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(s.config.Latency)
+	_, _ = io.Copy(io.Discard, r.Body)
+	s.setEdgeHeaders(w)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Writes size zero bytes, shaped to the configured bandwidth
+func (s *Server) writeBody(w http.ResponseWriter, size int64) int64 {
+	chunk := make([]byte, chunkSize)
+	start := time.Now()
+	var written int64
+	for written < size {
+		n := int64(len(chunk))
+		if size-written < n {
+			n = size - written
+		}
+		if _, err := w.Write(chunk[:n]); err != nil {
+			return written
+		}
+		written += n
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		if s.config.Bandwidth > 0 {
+			expected := time.Duration(float64(written) / float64(s.config.Bandwidth) * float64(time.Second))
+			if d := expected - time.Since(start); d > 0 {
+				time.Sleep(d)
+			}
+		}
+	}
+	return written
+}
+
+// Sends the headers and the first sent bytes of the body, then closes the connection (with RST when reset is set)
+func (s *Server) writePartial(w http.ResponseWriter, size, sent int64, reset bool) {
+	conn, buf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nServer: cloudflare\r\nContent-Length: %d\r\n\r\n", size)
+	s.writeBody(&rawWriter{buf}, sent)
+	_ = buf.Flush()
+	if !reset {
+		return
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if tcpConn, ok := tlsConn.NetConn().(*net.TCPConn); ok {
+			_ = tcpConn.SetLinger(0) // Closing now sends RST instead of FIN
+		}
+	}
+}
+
+// Injects handshake resets below the TLS layer
+type faultListener struct {
+	net.Listener
+	server *Server
+}
+
+func (l *faultListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.server.chance(l.server.config.Faults.HandshakeReset) || !l.server.admit() {
+			go resetHandshake(conn)
+			continue
+		}
+		if l.server.config.MaxConns > 0 {
+			conn = &countedConn{Conn: conn, server: l.server}
+		}
+		return conn, nil
+	}
+}
+
+// Counts a new connection as open, false when MaxConns are already open
+func (s *Server) admit() bool {
+	if s.config.MaxConns <= 0 {
+		return true
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.open >= s.config.MaxConns {
+		return false
+	}
+	s.open++
+	return true
+}
+
+// Connection counted against MaxConns until closed
+type countedConn struct {
+	net.Conn
+	server *Server
+	once   sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() {
+		c.server.m.Lock()
+		c.server.open--
+		c.server.m.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// Waits for the ClientHello so the reset lands inside the handshake
+func resetHandshake(conn net.Conn) {
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _ = conn.Read(make([]byte, 512))
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetLinger(0)
+	}
+	_ = conn.Close()
+}
+
+// Adapts a hijacked connection to the body writer
+type rawWriter struct {
+	buf *bufio.ReadWriter
+}
+
+func (w *rawWriter) Header() http.Header {
+	return http.Header{}
+}
+
+func (w *rawWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *rawWriter) WriteHeader(int) {}
+
+func (w *rawWriter) Flush() {
+	_ = w.buf.Flush()
+}
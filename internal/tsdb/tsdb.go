@@ -0,0 +1,158 @@
+// Package tsdb writes scan results as time series: InfluxDB line protocol, Prometheus remote-write and a Grafana dashboard charting them.
+package tsdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+)
+
+// Point is the result of one IP in one scan
+type Point struct {
+	Time     time.Time
+	IP       string
+	LossRate float64       // 0~1
+	Delay    time.Duration // Average
+	Speed    float64       // Bytes per second, 0 without a download test
+}
+
+// Names of the Prometheus metrics, after a prefix such as cfscan_
+const (
+	metricDelay    = "delay_seconds"
+	metricLossRate = "loss_ratio"
+	metricSpeed    = "download_bytes_per_second"
+)
+
+// WriteInflux writes the points as InfluxDB line protocol, one line per point of measurement with the IP as tag
+func WriteInflux(w io.Writer, measurement string, points []Point) error {
+	for _, p := range points {
+		_, err := fmt.Fprintf(w, "%s,ip=%s loss_rate=%s,delay_ms=%s,speed=%s %d\n", escapeInflux(measurement), escapeInflux(p.IP),
+			formatFloat(p.LossRate), formatFloat(float64(p.Delay)/float64(time.Millisecond)), formatFloat(p.Speed), p.Time.UnixNano())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Escapes the commas, equal signs and spaces of a measurement or tag
+func escapeInflux(s string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// RemoteWrite encodes the points as a snappy-compressed Prometheus remote-write request, three series per IP named after prefix
+func RemoteWrite(prefix string, points []Point) []byte {
+	var req []byte
+	for _, p := range points {
+		ms := p.Time.UnixMilli()
+		req = appendSeries(req, prefix+metricDelay, p.IP, p.Delay.Seconds(), ms)
+		req = appendSeries(req, prefix+metricLossRate, p.IP, p.LossRate, ms)
+		req = appendSeries(req, prefix+metricSpeed, p.IP, p.Speed, ms)
+	}
+	return s2.EncodeSnappy(nil, req)
+}
+
+// Appends a TimeSeries of one sample as field 1 of a WriteRequest
+func appendSeries(b []byte, name, ip string, value float64, ms int64) []byte {
+	var series []byte
+	// Labels sorted by name, as Prometheus expects
+	series = appendMessage(series, 1, appendString(appendString(nil, 1, "__name__"), 2, name))
+	series = appendMessage(series, 1, appendString(appendString(nil, 1, "ip"), 2, ip))
+	var sample []byte
+	sample = binary.AppendUvarint(sample, 1<<3|1) // Field 1, 64-bit
+	sample = binary.LittleEndian.AppendUint64(sample, math.Float64bits(value))
+	sample = binary.AppendUvarint(sample, 2<<3|0) // Field 2, varint
+	sample = binary.AppendUvarint(sample, uint64(ms))
+	series = appendMessage(series, 2, sample)
+	return appendMessage(b, 1, series)
+}
+
+func appendString(b []byte, field int, s string) []byte {
+	return appendMessage(b, field, []byte(s))
+}
+
+// Appends a length-delimited protobuf field
+func appendMessage(b []byte, field int, m []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(m)))
+	return append(b, m...)
+}
+
+// Dashboard returns a Grafana dashboard charting the delay, loss rate and speed of each IP, for an InfluxDB (InfluxQL)
+// datasource when measurement is set and a Prometheus one with the metrics of prefix otherwise
+func Dashboard(measurement, prefix string) ([]byte, error) {
+	type panel struct {
+		title, field, metric, unit string
+	}
+	panels := []panel{
+		{"Average delay", "delay_ms", metricDelay, "ms"},
+		{"Loss rate", "loss_rate", metricLossRate, "percentunit"},
+		{"Download speed", "speed", metricSpeed, "Bps"},
+	}
+	datasource := map[string]string{"type": "prometheus", "uid": "${datasource}"}
+	if measurement != "" {
+		datasource["type"] = "influxdb"
+	}
+	var list []map[string]any
+	for i, p := range panels {
+		target := map[string]any{"refId": "A", "datasource": datasource}
+		if measurement != "" {
+			target["rawQuery"] = true
+			target["query"] = fmt.Sprintf(`SELECT mean("%s") FROM "%s" WHERE $timeFilter GROUP BY time($__interval), "ip" fill(none)`, p.field, measurement)
+			target["alias"] = "$tag_ip"
+		} else {
+			expr := prefix + p.metric
+			if p.unit == "ms" {
+				expr += " * 1000"
+			}
+			target["expr"] = expr
+			target["legendFormat"] = "{{ip}}"
+		}
+		list = append(list, map[string]any{
+			"id":          i + 1,
+			"type":        "timeseries",
+			"title":       p.title,
+			"datasource":  datasource,
+			"gridPos":     map[string]int{"x": 0, "y": i * 8, "w": 24, "h": 8},
+			"fieldConfig": map[string]any{"defaults": map[string]any{"unit": p.unit}, "overrides": []any{}},
+			"targets":     []any{target},
+		})
+	}
+	dashboard := map[string]any{
+		"title":         "Cloudflare clean IPs",
+		"schemaVersion": 39,
+		"time":          map[string]string{"from": "now-7d", "to": "now"},
+		"templating": map[string]any{"list": []any{map[string]any{
+			"name": "datasource", "type": "datasource", "query": datasource["type"],
+		}}},
+		"panels": list,
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(dashboard)
+	return buf.Bytes(), err
+}
+
+// SortPoints orders points by time, then by IP, as time series databases prefer
+func SortPoints(points []Point) {
+	sort.SliceStable(points, func(i, j int) bool {
+		if !points[i].Time.Equal(points[j].Time) {
+			return points[i].Time.Before(points[j].Time)
+		}
+		return points[i].IP < points[j].IP
+	})
+}
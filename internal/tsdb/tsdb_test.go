@@ -0,0 +1,115 @@
+package tsdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+)
+
+var testPoints = []Point{
+	{Time: time.Unix(1700000000, 0), IP: "2606:4700::1", LossRate: 0, Delay: 150 * time.Millisecond},
+	{Time: time.Unix(1700000000, 0), IP: "104.16.1.1", LossRate: 0.25, Delay: 42500 * time.Microsecond, Speed: 1.5e6},
+}
+
+func TestWriteInflux(t *testing.T) {
+	points := append([]Point(nil), testPoints...)
+	SortPoints(points)
+	var buf bytes.Buffer
+	if err := WriteInflux(&buf, "cf scan", points); err != nil {
+		t.Fatal(err)
+	}
+	want := `cf\ scan,ip=104.16.1.1 loss_rate=0.25,delay_ms=42.5,speed=1500000 1700000000000000000
+cf\ scan,ip=2606:4700::1 loss_rate=0,delay_ms=150,speed=0 1700000000000000000
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+// Decodes the fields of a protobuf message, the length-delimited ones as bytes
+func decodeFields(t *testing.T, b []byte) map[uint64][]any {
+	t.Helper()
+	fields := make(map[uint64][]any)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		b = b[n:]
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			b = b[n:]
+			fields[key>>3] = append(fields[key>>3], v)
+		case 1:
+			fields[key>>3] = append(fields[key>>3], math.Float64frombits(binary.LittleEndian.Uint64(b)))
+			b = b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			b = b[n:]
+			fields[key>>3] = append(fields[key>>3], b[:l])
+			b = b[l:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func TestRemoteWrite(t *testing.T) {
+	req, err := s2.Decode(nil, RemoteWrite("cfscan_", testPoints[1:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := decodeFields(t, req)[1]
+	if len(series) != 3 {
+		t.Fatalf("got %d series, want 3", len(series))
+	}
+	want := map[string]float64{"cfscan_delay_seconds": 0.0425, "cfscan_loss_ratio": 0.25, "cfscan_download_bytes_per_second": 1.5e6}
+	for _, s := range series {
+		fields := decodeFields(t, s.([]byte))
+		labels := map[string]string{}
+		for _, l := range fields[1] {
+			label := decodeFields(t, l.([]byte))
+			labels[string(label[1][0].([]byte))] = string(label[2][0].([]byte))
+		}
+		sample := decodeFields(t, fields[2][0].([]byte))
+		name := labels["__name__"]
+		if labels["ip"] != "104.16.1.1" || sample[1][0] != want[name] || sample[2][0] != uint64(1700000000000) {
+			t.Errorf("series %v: sample %v", labels, sample)
+		}
+		delete(want, name)
+	}
+	if len(want) != 0 {
+		t.Errorf("missing series %v", want)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	for _, tc := range []struct{ measurement, query string }{
+		{"cfscan", `FROM \"cfscan\"`},
+		{"", "cfscan_delay_seconds * 1000"},
+	} {
+		data, err := Dashboard(tc.measurement, "cfscan_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var dashboard struct {
+			Panels []struct {
+				Targets []map[string]any
+			}
+		}
+		if err := json.Unmarshal(data, &dashboard); err != nil {
+			t.Fatal(err)
+		}
+		if len(dashboard.Panels) != 3 {
+			t.Fatalf("got %d panels, want 3", len(dashboard.Panels))
+		}
+		if !strings.Contains(string(data), tc.query) {
+			t.Errorf("dashboard of %q lacks %s", tc.measurement, tc.query)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Set in the environment of the test binary run as the scanner of serve and rpc-stdio
+const fakeScannerEnv = "CLOUDFLARESCANNER_FAKE_SCAN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeScannerEnv) == "1" {
+		os.Exit(fakeScan(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// Stands in for a scan: reports 50% progress and one result, waits -fake-sleep and writes the result file,
+// or exits with an error with -fake-fail
+func fakeScan(args []string) int {
+	option := func(name string) string {
+		// Later flags win, as with the flag package
+		for i := len(args) - 2; i >= 0; i-- {
+			if args[i] == "-"+name {
+				return args[i+1]
+			}
+		}
+		return ""
+	}
+	fmt.Println("[Info] Fake scan of", strings.Join(args, " "))
+	if heartbeat := option("heartbeat"); heartbeat != "" {
+		_ = os.WriteFile(heartbeat, []byte(time.Now().Format(time.RFC3339)+" 50%\n"), 0o644)
+	}
+	if stream := option("stream"); stream != "" {
+		_ = os.WriteFile(stream, []byte(`{"ip":"1.1.1.1","delay":100}`+"\n"), 0o644)
+	}
+	if sleep, err := time.ParseDuration(option("fake-sleep")); err == nil {
+		time.Sleep(sleep)
+	}
+	if slices.Contains(args, "-fake-fail") {
+		fmt.Println("[!] Fake failure")
+		return 1
+	}
+	rows := "IP Address,Sent,Received,Loss Rate,Average Delay (ms),Download Speed (MB/s)\n1.1.1.1,4,4,0.00,100.00,5.00\n"
+	if err := os.WriteFile(option("o"), []byte(rows), 0o644); err != nil {
+		fmt.Println("[!]", err)
+		return 1
+	}
+	return 0
+}
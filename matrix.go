@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/task"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const matrixUsage = "usage: matrix [-ip 1.1.1.1,1.0.0.1 | -f result.csv -n 5] [-sni a.com,b.com] [-ports 443,2053] [-fingerprints all] [-o matrix.csv]"
+
+// Tries every SNI, port and ClientHello against a few IPs and exports what works as a matrix, for configuring clients
+func matrixCommand(args []string) error {
+	fs := flag.NewFlagSet("matrix", flag.ExitOnError)
+	ipList := fs.String("ip", "", "IPs to sweep, separated by commas")
+	file := fs.String("f", "result.csv", "Result file to take the IPs from when -ip is not set")
+	n := fs.Int("n", 5, "Best IPs of the result file to sweep")
+	sniList := fs.String("sni", "speed.cloudflare.com", "SNIs, separated by commas")
+	portList := fs.String("ports", "443,2053,2083,2087,2096,8443", "Ports, separated by commas, default the HTTPS ports Cloudflare proxies")
+	helloList := fs.String("fingerprints", "all", "TLS fingerprints, separated by commas, or all")
+	threads := fs.Int("threads", 16, "Handshakes at once")
+	handshakeTime := fs.Int("dht", 5, "Handshake timeout in seconds")
+	output := fs.String("o", "matrix.csv", "Matrix file")
+	_ = fs.Parse(args)
+
+	ips, err := matrixIPs(*ipList, *file, *n)
+	if err != nil {
+		return err
+	}
+	var snis []string
+	for _, sni := range strings.Split(*sniList, ",") {
+		if sni = strings.TrimSpace(sni); sni != "" {
+			snis = append(snis, sni)
+		}
+	}
+	ports, err := task.ParsePortList(*portList)
+	if err != nil {
+		return err
+	}
+	hellos := task.AllFingerprints()
+	if *helloList != "all" {
+		if hellos, err = task.ParseFingerprints(*helloList); err != nil {
+			return err
+		}
+	}
+	if len(ips) == 0 || len(snis) == 0 || len(ports) == 0 || len(hellos) == 0 {
+		return errors.New(matrixUsage)
+	}
+	task.HandshakeTimeout = time.Duration(*handshakeTime) * time.Second
+
+	cells := task.SweepMatrix(ips, snis, ports, hellos, *threads)
+	printMatrixSummary(cells, len(ips), hellos)
+	if err := writeMatrix(*output, cells, hellos); err != nil {
+		return err
+	}
+	fmt.Printf("[Info] Saved the handshake time (ms) or failure class of every combination to %s\n", *output)
+	return nil
+}
+
+// IPs of -ip, or the n best of the result file
+func matrixIPs(list, file string, n int) ([]*net.IPAddr, error) {
+	var ips []*net.IPAddr
+	if list != "" {
+		for _, s := range strings.Split(list, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			ip, err := net.ResolveIPAddr("ip", s)
+			if err != nil {
+				return nil, err
+			}
+			ips = append(ips, ip)
+		}
+		return ips, nil
+	}
+	results, err := utils.ReadResultIPs(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range results[:min(len(results), n)] {
+		ips = append(ips, &net.IPAddr{IP: ip.AsSlice()})
+	}
+	return ips, nil
+}
+
+// Number of IPs each SNI, port and fingerprint got through with
+func printMatrixSummary(cells []task.MatrixCell, ipCount int, hellos []string) {
+	fmt.Printf("\nIPs passing of %d:\n%-32s%-7s", ipCount, "SNI", "Port")
+	for _, hello := range hellos {
+		fmt.Printf("%-11s", hello)
+	}
+	fmt.Println()
+	// Cells are nested IP > SNI > port > hello, so the same SNI, port and hello repeats every perIP cells
+	perIP := len(cells) / ipCount
+	for row := 0; row < perIP; row += len(hellos) {
+		fmt.Printf("%-32s%-7d", cells[row].SNI, cells[row].Port)
+		for h := range hellos {
+			passed := 0
+			for i := row + h; i < len(cells); i += perIP {
+				if cells[i].Err == nil {
+					passed++
+				}
+			}
+			fmt.Printf("%-11s", fmt.Sprintf("%d/%d", passed, ipCount))
+		}
+		fmt.Println()
+	}
+}
+
+// One row per IP, SNI and port with a column per fingerprint: the handshake time in ms or the class of the failure
+func writeMatrix(path string, cells []task.MatrixCell, hellos []string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	_ = w.Write(append([]string{"IP Address", "SNI", "Port"}, hellos...))
+	for row := 0; row < len(cells); row += len(hellos) {
+		record := []string{cells[row].IP.String(), cells[row].SNI, strconv.Itoa(cells[row].Port)}
+		for _, cell := range cells[row : row+len(hellos)] {
+			if cell.Err != nil {
+				record = append(record, task.ErrorClass(cell.Err))
+			} else {
+				record = append(record, strconv.FormatFloat(cell.Took.Seconds()*1000, 'f', 2, 64))
+			}
+		}
+		_ = w.Write(record)
+	}
+	w.Flush()
+	return w.Error()
+}
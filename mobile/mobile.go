@@ -0,0 +1,217 @@
+// Package mobile embeds the scanner in Android and iOS apps through gomobile, e.g.
+//
+//	gomobile bind -target android -o cfscanner.aar ./mobile
+//	gomobile bind -target ios -o CFScanner.xcframework ./mobile
+//
+// Its types only use what gomobile can bind: numbers, strings, structs of them, and interfaces the app implements.
+package mobile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/task"
+)
+
+// NoLossLimit as the MaxLossRate keeps every loss rate
+const NoLossLimit = -1
+
+// Config of a scan, zero values keep the defaults of the command line except MaxLossRate, make it with NewConfig
+type Config struct {
+	IPRanges string // IPs or ranges separated by commas or lines, empty tests the built-in list
+
+	Routines  int  // Latency test threads
+	Port      int  // Test port
+	PingTimes int  // Latency tests per IP
+	Httping   bool // HTTP latency test instead of TCP
+
+	URL             string  // Download test address
+	TimeoutSeconds  int     // Of each download
+	TestCount       int     // Results wanted from the download test
+	DownloadThreads int     // Download tests at once
+	MinSpeed        float64 // In MB/s
+	DisableDownload bool
+	ClientHello     string // Fingerprint of the TLS ClientHello, e.g. chrome or go
+
+	MaxDelayMillis int     // Average delay upper limit
+	MinDelayMillis int     // Average delay lower limit
+	MaxLossRate    float64 // 0~1 as [-tlr], 0 allows no loss; NoLossLimit keeps every loss rate
+}
+
+// NewConfig returns a Config keeping every default
+func NewConfig() *Config {
+	return &Config{MaxLossRate: NoLossLimit}
+}
+
+// Result of an IP
+type Result struct {
+	IP          string
+	Sent        int
+	Received    int
+	LossRate    float64
+	DelayMillis float64 // Average
+	Speed       float64 // Download speed in MB/s, 0 when not tested
+	Colo        string  // Datacenter, e.g. FRA, empty when unknown
+}
+
+// Results of a scan, fastest first
+type Results struct {
+	list []*Result
+}
+
+// Len returns the number of results
+func (r *Results) Len() int {
+	return len(r.list)
+}
+
+// Get returns the i-th result, nil when out of range
+func (r *Results) Get(i int) *Result {
+	if i < 0 || i >= len(r.list) {
+		return nil
+	}
+	return r.list[i]
+}
+
+// Listener is implemented by the app to follow a scan; it is called from other threads than the one running it
+type Listener interface {
+	// OnProgress reports the items done and total of the running test (latency, then download)
+	OnProgress(done, total int)
+	// OnLog passes a line of the messages the command line prints
+	OnLog(line string)
+}
+
+// Scanner runs scans, a Scanner one at a time; the scans of several Scanners run at once
+type Scanner struct {
+	config Config
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// NewScanner returns a Scanner of a copy of config, the defaults when nil
+func NewScanner(config *Config) *Scanner {
+	if config == nil {
+		config = NewConfig()
+	}
+	return &Scanner{config: *config}
+}
+
+// Run scans, blocking until done, so call it off the UI thread. listener may be nil.
+// After Cancel it returns the results so far with an error.
+func (s *Scanner) Run(listener Listener) (*Results, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.mu.Unlock()
+		cancel()
+		return nil, errors.New("the scanner is already running")
+	}
+	s.cancel = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.cancel = nil
+		s.mu.Unlock()
+		cancel()
+	}()
+
+	options := s.config.options()
+	lines := &lineWriter{}
+	if listener != nil {
+		lines.line = listener.OnLog
+		options.Progress = listener.OnProgress
+	}
+	options.Log = lines
+	data, err := task.NewScanner(options).Run(ctx)
+	lines.flush()
+
+	results := &Results{list: make([]*Result, len(data))}
+	for i, d := range data {
+		results.list[i] = &Result{
+			IP:          d.IP.String(),
+			Sent:        d.Sended,
+			Received:    d.Received,
+			LossRate:    float64(d.LossRate()),
+			DelayMillis: float64(d.Delay) / float64(time.Millisecond),
+			Speed:       d.DownloadSpeed / 1024 / 1024,
+			Colo:        d.Colo,
+		}
+	}
+	return results, err
+}
+
+// Cancel stops the running scan soon, if any
+func (s *Scanner) Cancel() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+func (c *Config) options() task.Options {
+	o := task.Options{
+		Routines:        c.Routines,
+		Port:            c.Port,
+		PingTimes:       c.PingTimes,
+		Httping:         c.Httping,
+		URL:             c.URL,
+		Timeout:         time.Duration(c.TimeoutSeconds) * time.Second,
+		TestCount:       c.TestCount,
+		DownloadThreads: c.DownloadThreads,
+		MinSpeed:        c.MinSpeed,
+		DisableDownload: c.DisableDownload,
+		ClientHello:     c.ClientHello,
+		MaxDelay:        time.Duration(c.MaxDelayMillis) * time.Millisecond,
+		MinDelay:        time.Duration(c.MinDelayMillis) * time.Millisecond,
+	}
+	if ranges := strings.FieldsFunc(c.IPRanges, func(r rune) bool { return r == ',' || r == '\n' }); len(ranges) > 0 {
+		o.IPRanges = ranges
+	} else {
+		o.UseEmbedded = true // Apps have no ip.txt next to them
+	}
+	if c.MaxLossRate >= 0 {
+		rate := float32(c.MaxLossRate)
+		o.MaxLossRate = &rate
+	}
+	return o
+}
+
+// Passes the messages of the scan to line a line at a time, dropping them when line is nil
+type lineWriter struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	line func(string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.line == nil {
+		return len(p), nil
+	}
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := strings.TrimSpace(string(w.buf.Next(i + 1)))
+		if line != "" {
+			w.line(line)
+		}
+	}
+}
+
+func (w *lineWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if line := strings.TrimSpace(w.buf.String()); line != "" && w.line != nil {
+		w.line(line)
+	}
+	w.buf.Reset()
+}
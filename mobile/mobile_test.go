@@ -0,0 +1,95 @@
+package mobile
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+)
+
+type testListener struct {
+	mu       sync.Mutex
+	lines    []string
+	progress [2]int
+}
+
+func (l *testListener) OnProgress(done, total int) {
+	l.mu.Lock()
+	l.progress = [2]int{done, total}
+	l.mu.Unlock()
+}
+
+func (l *testListener) OnLog(line string) {
+	l.mu.Lock()
+	l.lines = append(l.lines, line)
+	l.mu.Unlock()
+}
+
+func TestScanner(t *testing.T) {
+	server := testserver.New(testserver.Config{})
+	defer server.Close()
+
+	config := NewConfig()
+	config.IPRanges = server.IP().String()
+	config.Port = server.Port()
+	config.PingTimes = 2
+	config.DisableDownload = true
+	listener := &testListener{}
+	results, err := NewScanner(config).Run(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Len() != 1 || results.Get(0).IP != server.IP().String() || results.Get(0).Received != 2 {
+		t.Fatalf("got %d results, first %+v", results.Len(), results.Get(0))
+	}
+	if results.Get(1) != nil {
+		t.Error("Get past the end: want nil")
+	}
+	if listener.progress != [2]int{1, 1} {
+		t.Errorf("last progress = %v, want [1 1]", listener.progress)
+	}
+	if len(listener.lines) == 0 || !strings.HasPrefix(listener.lines[0], "Start latency test") {
+		t.Errorf("log lines = %q", listener.lines)
+	}
+
+	config.IPRanges = "1.1.1.1/99"
+	if _, err := NewScanner(config).Run(nil); err == nil {
+		t.Error("invalid range: want an error")
+	}
+}
+
+func TestConfigOptions(t *testing.T) {
+	o := NewConfig().options()
+	if o.MaxLossRate != nil {
+		t.Errorf("default loss rate = %v, want no limit", *o.MaxLossRate)
+	}
+	if o.IPRanges != nil || !o.UseEmbedded {
+		t.Errorf("no ranges = %v, %v, want the built-in list", o.IPRanges, o.UseEmbedded)
+	}
+	config := &Config{IPRanges: "1.1.1.0/24,\n1.0.0.1", MaxLossRate: 0.25}
+	o = config.options()
+	if o.MaxLossRate == nil || *o.MaxLossRate != 0.25 {
+		t.Errorf("loss rate = %v, want 0.25", o.MaxLossRate)
+	}
+	if len(o.IPRanges) != 2 || o.UseEmbedded {
+		t.Errorf("ranges = %q, %v, want the two ranges", o.IPRanges, o.UseEmbedded)
+	}
+	// As with [-tlr], 0 requires no loss
+	config.MaxLossRate = 0
+	if o = config.options(); o.MaxLossRate == nil || *o.MaxLossRate != 0 {
+		t.Errorf("loss rate = %v, want 0", o.MaxLossRate)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := &lineWriter{line: func(s string) { lines = append(lines, s) }}
+	fmt.Fprint(w, "one\n\ntw")
+	fmt.Fprint(w, "o\nthree")
+	w.flush()
+	if strings.Join(lines, "|") != "one|two|three" {
+		t.Errorf("got %q", lines)
+	}
+}
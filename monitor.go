@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/alert"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const monitorHookTimeout = time.Minute
+
+// Retests a set of IPs every interval with a scan of its own and alerts on their changes, e.g.
+// "monitor -f result.csv -n 3 -every 5m -- -url https://example.com/100mb"
+func monitorCommand(args []string) error {
+	fs := flag.NewFlagSet("monitor", flag.ExitOnError)
+	ipText := fs.String("ip", "", "IPs to monitor, e.g. 1.1.1.1,1.0.0.1")
+	file := fs.String("f", "result.csv", "Result file whose best IPs are monitored when -ip is not set")
+	count := fs.Int("n", 3, "Best IPs of the result file to monitor")
+	every := fs.Duration("every", 10*time.Minute, "Interval of the tests")
+	var rules alert.Rules
+	fs.DurationVar(&rules.MaxDelay, "max-delay", 0, "Alert on delays above this, 0 disables")
+	fs.Float64Var(&rules.Rise, "rise", 2, "Alert on delays this many times the lowest of -rise-window, 0 disables")
+	fs.DurationVar(&rules.RiseWindow, "rise-window", 10*time.Minute, "Window of -rise")
+	fs.Float64Var(&rules.Drop, "drop", 0.5, "Alert on speeds this fraction below the mean of -baseline, 0 disables")
+	fs.DurationVar(&rules.Baseline, "baseline", 24*time.Hour, "Window of -drop")
+	fs.BoolVar(&rules.Down, "down", true, "Alert on IPs failing the tests")
+	fs.IntVar(&rules.Confirm, "confirm", 2, "Tests in a row needed to raise or clear an alert")
+	hook := fs.String("alert-hook", "", "Command receiving each alert as JSON on stdin")
+	maintenance := fs.String("maintenance", "", "Maintenance windows without alerts, e.g. Sun 02:00-04:00,12:00-12:15")
+	silenceFile := fs.String("silence-file", "silence.json", "File of the silence command, empty disables")
+	_ = fs.Parse(args)
+	if *every <= 0 || *count < 1 || rules.Rise < 0 || rules.Drop < 0 || rules.Drop >= 1 {
+		return errors.New("usage: monitor [-ip 1.1.1.1,... | -f result.csv -n 3] [-every 10m] [-max-delay 0] [-rise 2 -rise-window 10m] [-drop 0.5 -baseline 24h] [-confirm 2] [-alert-hook cmd] [-maintenance windows] [-silence-file silence.json] [-- scan options]")
+	}
+	windows, err := alert.ParseWindows(*maintenance)
+	if err != nil {
+		return err
+	}
+	silence := alert.Silence{Windows: windows, File: *silenceFile}
+	ips, err := monitorIPs(*ipText, *file, *count)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "cfscan-monitor")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	trackers := make(map[netip.Addr]*alert.Tracker)
+	list := make([]string, len(ips))
+	for i, ip := range ips {
+		trackers[ip] = alert.NewTracker(rules)
+		list[i] = ip.String()
+	}
+	// Later flags win, so the scan options can't change the tested IPs or the output; only -i-know-what-im-doing turns -polite off
+	scanArgs := append(append([]string{}, fs.Args()...), "-ip", strings.Join(list, ","), "-dn", strconv.Itoa(len(ips)), "-o", filepath.Join(dir, "result.csv"), "-p", "0", "-yes", "-polite")
+	fmt.Printf("[Info] Monitoring %s every %v\n", strings.Join(list, ", "), *every)
+	for {
+		now := time.Now()
+		results, err := monitorRound(exe, scanArgs, filepath.Join(dir, "result.csv"))
+		if err != nil {
+			fmt.Println("[!] Testing failed, retrying at the next interval:", err)
+		} else {
+			// Samples are still recorded while silenced, so the history stays whole
+			silenced, reason := silence.Active(now)
+			for _, ip := range ips {
+				sample := alert.Sample{Time: now}
+				if r, ok := results[ip]; ok {
+					sample.OK, sample.Delay, sample.Speed = true, r.Delay, r.Speed
+					fmt.Printf("[Info] %s %s delay %.2f ms, speed %.2f MB/s\n", now.Format("15:04:05"), ip, float64(r.Delay)/float64(time.Millisecond), r.Speed/1024/1024)
+				} else {
+					fmt.Printf("[Info] %s %s failed the tests\n", now.Format("15:04:05"), ip)
+				}
+				for _, e := range trackers[ip].Add(sample) {
+					if silenced {
+						fmt.Printf("[Info] Suppressed %s %s (%s): %s\n", e.Rule, ip, reason, e.Message)
+						continue
+					}
+					reportAlert(ip, e, *hook)
+				}
+			}
+		}
+		time.Sleep(time.Until(now.Add(*every)))
+	}
+}
+
+// Silences the alerts of monitor and the failover of forward for a while, e.g. "silence 2h" before planned maintenance
+func silenceCommand(args []string) error {
+	fs := flag.NewFlagSet("silence", flag.ExitOnError)
+	file := fs.String("f", "silence.json", "Silence file shared with monitor and forward")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: silence [-f silence.json] 2h|0")
+	}
+	d, err := utils.ParseAge(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	until, err := alert.SilenceFor(*file, d)
+	if err != nil {
+		return err
+	}
+	if d == 0 {
+		fmt.Println("[Info] Silence lifted.")
+	} else {
+		fmt.Printf("[Info] Alerts and failover silenced until %s.\n", until.Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+func monitorIPs(ipText, file string, count int) ([]netip.Addr, error) {
+	if ipText != "" {
+		var ips []netip.Addr
+		for _, s := range strings.Split(ipText, ",") {
+			ip, err := netip.ParseAddr(strings.TrimSpace(s))
+			if err != nil {
+				return nil, err
+			}
+			ips = append(ips, ip)
+		}
+		return ips, nil
+	}
+	ips, err := utils.ReadResultIPs(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IPs in %s", file)
+	}
+	return ips[:min(count, len(ips))], nil
+}
+
+// Runs a scan of the monitored IPs, those missing from its result failed the tests
+func monitorRound(exe string, args []string, result string) (map[netip.Addr]utils.Result, error) {
+	_ = os.Remove(result)
+	if output, err := exec.Command(exe, args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	results := make(map[netip.Addr]utils.Result)
+	list, err := utils.ReadResults(result)
+	if errors.Is(err, os.ErrNotExist) {
+		return results, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, r := range list {
+		results[r.IP] = r
+	}
+	return results, nil
+}
+
+// Alert as given to the alert hook
+type monitorAlert struct {
+	IP string `json:"ip"`
+	alert.Event
+}
+
+func reportAlert(ip netip.Addr, e alert.Event, hook string) {
+	if e.Firing {
+		fmt.Printf("[Warning] ALERT %s %s: %s\n", e.Rule, ip, e.Message)
+	} else {
+		fmt.Printf("[Info] RESOLVED %s %s: %s\n", e.Rule, ip, e.Message)
+	}
+	args := strings.Fields(hook)
+	if len(args) == 0 {
+		return
+	}
+	data, _ := json.Marshal(monitorAlert{IP: ip.String(), Event: e})
+	ctx, cancel := context.WithTimeout(context.Background(), monitorHookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(string(data) + "\n")
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Println("[!] Alert hook failed:", err)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/profile"
+)
+
+// Prints the scan options as a profile string, e.g. "export-profile -tl 200 -fragment preset:tlshello"
+func exportProfileCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: export-profile [scan options]")
+	}
+	s, err := profile.Encode(currentVersion(), args)
+	if err != nil {
+		return err
+	}
+	fmt.Println(s)
+	return nil
+}
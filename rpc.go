@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcScanError      = -32000
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"` // Absent for notifications, which get no response
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Result of a call answered once it completes, without holding up the requests read meanwhile
+type rpcPending func() (any, *rpcError)
+
+// Scan started over RPC, a separate scanner process like the jobs of serve
+type rpcScan struct {
+	ID    string   `json:"id"`
+	Args  []string `json:"args"`
+	State string   `json:"state"`
+	Error string   `json:"error,omitempty"`
+
+	dir    string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Speaks JSON-RPC 2.0 over stdin and stdout, one message per line, so GUI frontends can drive scans without parsing the console.
+// Methods: version, scan.start {"args": [...]}, scan.stop {"id"}, scan.status {"id"}, scan.results {"id"};
+// notifications: scan.log, scan.progress, scan.result and scan.end of each scan.
+type rpcServer struct {
+	exe string
+	dir string
+
+	outM sync.Mutex
+	out  *json.Encoder
+
+	m       sync.Mutex
+	scans   map[string]*rpcScan
+	next    int
+	pending sync.WaitGroup // Answers and scan.end notifications not sent yet
+}
+
+func rpcStdioCommand() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "cfscan-rpc-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	s := &rpcServer{exe: exe, dir: dir, out: json.NewEncoder(os.Stdout), scans: make(map[string]*rpcScan)}
+	s.notify("ready", map[string]string{"version": currentVersion()})
+
+	in := bufio.NewScanner(os.Stdin)
+	in.Buffer(make([]byte, 64*1024), 1<<20)
+	for in.Scan() {
+		if len(in.Bytes()) > 0 {
+			s.handle(in.Bytes())
+		}
+	}
+	// The frontend went away, its scans go with it
+	s.m.Lock()
+	scans := make([]*rpcScan, 0, len(s.scans))
+	for _, scan := range s.scans {
+		scan.cancel()
+		scans = append(scans, scan)
+	}
+	s.m.Unlock()
+	for _, scan := range scans {
+		<-scan.done
+	}
+	s.pending.Wait()
+	return in.Err()
+}
+
+func (s *rpcServer) send(v any) {
+	s.outM.Lock()
+	defer s.outM.Unlock()
+	_ = s.out.Encode(v)
+}
+
+func (s *rpcServer) notify(method string, params any) {
+	s.send(rpcNotification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *rpcServer) handle(line []byte) {
+	var req rpcRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		s.send(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, err.Error()}})
+		return
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		s.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{rpcInvalidRequest, "not a JSON-RPC 2.0 request"}})
+		return
+	}
+	result, rpcErr := s.call(req.Method, req.Params)
+	if pending, ok := result.(rpcPending); ok {
+		s.pending.Add(1)
+		go func() {
+			defer s.pending.Done()
+			if result, rpcErr := pending(); req.ID != nil {
+				s.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr})
+			}
+		}()
+		return
+	}
+	if req.ID == nil {
+		return
+	}
+	s.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr})
+}
+
+func (s *rpcServer) call(method string, params json.RawMessage) (any, *rpcError) {
+	var p struct {
+		ID   string   `json:"id"`
+		Args []string `json:"args"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+	}
+	if method == "version" {
+		return map[string]string{"version": currentVersion()}, nil
+	}
+	if method == "scan.start" {
+		scan, err := s.start(p.Args)
+		if err != nil {
+			return nil, &rpcError{rpcScanError, err.Error()}
+		}
+		return s.status(scan), nil
+	}
+	s.m.Lock()
+	scan := s.scans[p.ID]
+	s.m.Unlock()
+	switch method {
+	case "scan.stop", "scan.status", "scan.results":
+		if scan == nil {
+			return nil, &rpcError{rpcInvalidParams, fmt.Sprintf("no scan %q", p.ID)}
+		}
+	default:
+		return nil, &rpcError{rpcMethodNotFound, "unknown method " + method}
+	}
+	switch method {
+	case "scan.stop":
+		// Answered with the final state once the process exited
+		scan.cancel()
+		return rpcPending(func() (any, *rpcError) {
+			<-scan.done
+			return s.status(scan), nil
+		}), nil
+	case "scan.results":
+		select {
+		case <-scan.done:
+		default:
+			return nil, &rpcError{rpcScanError, "the scan is still running, its results qualifying so far are sent as scan.result"}
+		}
+		rows, err := readResultRows(filepath.Join(scan.dir, "result.csv"))
+		if err != nil {
+			return nil, &rpcError{rpcScanError, err.Error()}
+		}
+		return rows, nil
+	}
+	return s.status(scan), nil
+}
+
+// A copy of the scan's public state
+func (s *rpcServer) status(scan *rpcScan) rpcScan {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return rpcScan{ID: scan.ID, Args: scan.Args, State: scan.State, Error: scan.Error}
+}
+
+// Starts a scanner process with the options, its output can't be redirected and it never waits for confirmation
+func (s *rpcServer) start(args []string) (*rpcScan, error) {
+	s.m.Lock()
+	s.next++
+	id := strconv.Itoa(s.next)
+	s.m.Unlock()
+	dir := filepath.Join(s.dir, id)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	heartbeat, stream := filepath.Join(dir, "heartbeat"), filepath.Join(dir, "stream.jsonl")
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, s.exe, append(args, "-o", filepath.Join(dir, "result.csv"), "-p", "0", "-yes", "-polite", "-heartbeat", heartbeat, "-stream", stream)...)
+	logs, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+	scan := &rpcScan{ID: id, Args: args, State: jobRunning, dir: dir, cancel: cancel, done: make(chan struct{})}
+	s.m.Lock()
+	s.scans[id] = scan
+	s.m.Unlock()
+
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		s.forwardLogs(id, logs)
+	}()
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		stopWatch := s.watch(id, heartbeat, stream)
+		<-logged
+		err := cmd.Wait()
+		stopWatch()
+		s.m.Lock()
+		switch {
+		case ctx.Err() != nil:
+			scan.State = jobCanceled
+		case err != nil:
+			scan.State, scan.Error = jobFailed, err.Error()
+		default:
+			scan.State = jobDone
+		}
+		s.m.Unlock()
+		cancel()
+		// Done before scan.end, so a scan.results answering it has the results
+		close(scan.done)
+		s.notify("scan.end", s.status(scan))
+	}()
+	return scan, nil
+}
+
+// Sends the console output of a scan as scan.log, lines and progress bar updates alike
+func (s *rpcServer) forwardLogs(id string, r io.Reader) {
+	lines := bufio.NewScanner(r)
+	lines.Split(scanLogLines)
+	for lines.Scan() {
+		if line := lines.Text(); line != "" {
+			s.notify("scan.log", map[string]string{"id": id, "line": line})
+		}
+	}
+}
+
+// Splits at \n and at the \r of redrawn progress bars
+func scanLogLines(data []byte, atEOF bool) (int, []byte, error) {
+	for i, b := range data {
+		if b == '\n' || b == '\r' {
+			return i + 1, data[:i], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Sends the results of a scan as they qualify and its progress when it changes, until stopped; the last results are sent on stop
+func (s *rpcServer) watch(id, heartbeat, stream string) (stop func()) {
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(streamPoll)
+		defer ticker.Stop()
+		var offset int64
+		progress := -1.0
+		for {
+			var lines [][]byte
+			lines, offset = tailLines(stream, offset)
+			for _, line := range lines {
+				s.notify("scan.result", map[string]any{"id": id, "result": json.RawMessage(line)})
+			}
+			if p := readProgress(heartbeat); p != progress {
+				progress = p
+				s.notify("scan.progress", map[string]any{"id": id, "progress": p})
+			}
+			select {
+			case <-done:
+				lines, _ = tailLines(stream, offset)
+				for _, line := range lines {
+					s.notify("scan.result", map[string]any{"id": id, "result": json.RawMessage(line)})
+				}
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// Rows of a result file as objects keyed by its header, none when no IP passed
+func readResultRows(path string) ([]map[string]string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil || len(records) == 0 {
+		return []map[string]string{}, err
+	}
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]string, len(record))
+		for i, value := range record {
+			if i < len(records[0]) {
+				row[records[0][i]] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
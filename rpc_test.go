@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A message of the server, a response or a notification
+type rpcMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// RPC server whose scans are fake scans (see fakeScan), with its messages one per line
+func testRPCServer(t *testing.T) (*rpcServer, <-chan rpcMessage) {
+	t.Setenv(fakeScannerEnv, "1")
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, w := io.Pipe()
+	s := &rpcServer{exe: exe, dir: t.TempDir(), out: json.NewEncoder(w), scans: make(map[string]*rpcScan)}
+	messages := make(chan rpcMessage, 100)
+	go func() {
+		lines := bufio.NewScanner(r)
+		for lines.Scan() {
+			var m rpcMessage
+			if err := json.Unmarshal(lines.Bytes(), &m); err != nil {
+				t.Errorf("message %q is not one line of JSON: %v", lines.Text(), err)
+			}
+			messages <- m
+		}
+	}()
+	t.Cleanup(func() {
+		// The scans of the test must not outlive its directory
+		s.m.Lock()
+		for _, scan := range s.scans {
+			scan.cancel()
+		}
+		s.m.Unlock()
+		for _, scan := range s.scans {
+			<-scan.done
+		}
+		s.pending.Wait()
+		_ = w.Close()
+	})
+	return s, messages
+}
+
+// Waits for the response to id, or the notification of method when id is empty, skipping the other messages
+func nextRPC(t *testing.T, messages <-chan rpcMessage, id, method string) rpcMessage {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case m := <-messages:
+			if id != "" && string(m.ID) == id || id == "" && m.Method == method {
+				return m
+			}
+		case <-timeout:
+			t.Fatalf("no message %s%s", id, method)
+		}
+	}
+}
+
+func TestRPCErrors(t *testing.T) {
+	s, messages := testRPCServer(t)
+	tests := []struct {
+		request string
+		id      string
+		code    int
+	}{
+		{`{"jsonrpc": "2.0", "id": 1, "method": "version"`, "null", rpcParseError},
+		{`{"jsonrpc": "1.0", "id": 2, "method": "version"}`, "2", rpcInvalidRequest},
+		{`{"jsonrpc": "2.0", "id": 3}`, "3", rpcInvalidRequest},
+		{`{"jsonrpc": "2.0", "id": 4, "method": "scan.pause"}`, "4", rpcMethodNotFound},
+		{`{"jsonrpc": "2.0", "id": 5, "method": "scan.status", "params": {"id": "9"}}`, "5", rpcInvalidParams},
+		{`{"jsonrpc": "2.0", "id": 6, "method": "scan.stop", "params": [1]}`, "6", rpcInvalidParams},
+	}
+	for _, tt := range tests {
+		s.handle([]byte(tt.request))
+		if m := nextRPC(t, messages, tt.id, ""); m.Error == nil || m.Error.Code != tt.code || m.Result != nil {
+			t.Errorf("%s: error %+v, want code %d", tt.request, m.Error, tt.code)
+		}
+	}
+
+	// Notifications get no response, the IDs of the others come back as they were
+	s.handle([]byte(`{"jsonrpc": "2.0", "method": "version"}`))
+	s.handle([]byte(`{"jsonrpc": "2.0", "id": "a", "method": "version"}`))
+	if m := <-messages; string(m.ID) != `"a"` || m.Error != nil {
+		t.Errorf("response %s %s, want the version for \"a\"", m.ID, m.Result)
+	}
+}
+
+func TestScanLogLines(t *testing.T) {
+	// A progress bar redrawn with \r between two lines
+	lines := bufio.NewScanner(strings.NewReader("[Info] start\n1 / 3\r2 / 3\r3 / 3\ndone"))
+	lines.Split(scanLogLines)
+	var got []string
+	for lines.Scan() {
+		got = append(got, lines.Text())
+	}
+	if want := []string{"[Info] start", "1 / 3", "2 / 3", "3 / 3", "done"}; !slices.Equal(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestRPCScan(t *testing.T) {
+	s, messages := testRPCServer(t)
+	s.handle([]byte(`{"jsonrpc": "2.0", "id": 1, "method": "scan.start", "params": {"args": ["-fake-sleep", "100ms"]}}`))
+	var scan rpcScan
+	if m := nextRPC(t, messages, "1", ""); m.Error != nil || json.Unmarshal(m.Result, &scan) != nil || scan.ID != "1" || scan.State != jobRunning {
+		t.Fatalf("scan.start = %s %+v, want scan 1 running", m.Result, m.Error)
+	}
+	// The results are only complete once the scan ended
+	s.handle([]byte(`{"jsonrpc": "2.0", "id": 2, "method": "scan.results", "params": {"id": "1"}}`))
+	if m := nextRPC(t, messages, "2", ""); m.Error == nil || m.Error.Code != rpcScanError {
+		t.Errorf("scan.results of a running scan = %s %+v, want a scan error", m.Result, m.Error)
+	}
+
+	var result struct {
+		ID     string          `json:"id"`
+		Result json.RawMessage `json:"result"`
+	}
+	if m := nextRPC(t, messages, "", "scan.result"); json.Unmarshal(m.Params, &result) != nil || result.ID != "1" || string(result.Result) != `{"ip":"1.1.1.1","delay":100}` {
+		t.Errorf("scan.result = %s, want the streamed result", m.Params)
+	}
+	if m := nextRPC(t, messages, "", "scan.end"); json.Unmarshal(m.Params, &scan) != nil || scan.State != jobDone {
+		t.Errorf("scan.end = %s, want done", m.Params)
+	}
+	s.handle([]byte(`{"jsonrpc": "2.0", "id": 3, "method": "scan.results", "params": {"id": "1"}}`))
+	var rows []map[string]string
+	if m := nextRPC(t, messages, "3", ""); json.Unmarshal(m.Result, &rows) != nil || len(rows) != 1 || rows[0]["IP Address"] != "1.1.1.1" {
+		t.Errorf("scan.results = %s %+v, want the row of 1.1.1.1", m.Result, m.Error)
+	}
+}
+
+func TestRPCStop(t *testing.T) {
+	s, messages := testRPCServer(t)
+	s.handle([]byte(`{"jsonrpc": "2.0", "id": 1, "method": "scan.start", "params": {"args": ["-fake-sleep", "1m"]}}`))
+	nextRPC(t, messages, "1", "")
+	s.handle([]byte(`{"jsonrpc": "2.0", "id": 2, "method": "scan.stop", "params": {"id": "1"}}`))
+	var scan rpcScan
+	if m := nextRPC(t, messages, "2", ""); json.Unmarshal(m.Result, &scan) != nil || scan.State != jobCanceled {
+		t.Errorf("scan.stop = %s %+v, want canceled", m.Result, m.Error)
+	}
+
+	// A scan slow to exit doesn't hold up the requests after its stop
+	done := make(chan struct{})
+	s.m.Lock()
+	s.scans["slow"] = &rpcScan{ID: "slow", State: jobRunning, cancel: func() {}, done: done}
+	s.m.Unlock()
+	stopped := make(chan struct{})
+	go func() {
+		s.handle([]byte(`{"jsonrpc": "2.0", "id": 3, "method": "scan.stop", "params": {"id": "slow"}}`))
+		s.handle([]byte(`{"jsonrpc": "2.0", "id": 4, "method": "version"}`))
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scan.stop blocked the requests after it")
+	}
+	nextRPC(t, messages, "4", "")
+	s.m.Lock()
+	s.scans["slow"].State = jobCanceled
+	s.m.Unlock()
+	close(done)
+	if m := nextRPC(t, messages, "3", ""); json.Unmarshal(m.Result, &scan) != nil || scan.State != jobCanceled {
+		t.Errorf("scan.stop = %s %+v, want the state once it exited", m.Result, m.Error)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/release"
+)
+
+const (
+	releasesAPI    = "https://api.github.com/repos/Ptechgithub/CloudflareScanner/releases/latest"
+	maxReleaseSize = 64 << 20
+)
+
+// Base64 ed25519 public key the release archives are signed with, set with -ldflags "-X main.updatePublicKey=..."
+var updatePublicKey string
+
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func selfUpdateCommand(args []string) error {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	force := fs.Bool("force", false, "Reinstall the current version or downgrade to an older latest release")
+	checksumOnly := fs.Bool("checksum-only", false, "Accept releases verified by checksum only when this build has no signing key")
+	_ = fs.Parse(args)
+
+	fmt.Println("Checking for updates...")
+	latest, err := latestRelease()
+	if err != nil {
+		return fmt.Errorf("checking for updates failed: %v", err)
+	}
+	// Development builds don't compare, any release replaces them
+	current := currentVersion()
+	cmp, ok := release.Compare(latest.TagName, current)
+	switch {
+	case *force:
+	case ok && cmp == 0 || latest.TagName == current:
+		fmt.Println("Current version is the latest [" + current + "]!")
+		return nil
+	case ok && cmp < 0:
+		return fmt.Errorf("the latest release %s is older than %s, use [-force] to downgrade to it", latest.TagName, current)
+	}
+
+	name := assetName()
+	var archiveURL, sumURL, sigURL string
+	for _, asset := range latest.Assets {
+		switch asset.Name {
+		case name:
+			archiveURL = asset.URL
+		case name + ".sha256":
+			sumURL = asset.URL
+		case name + ".sig":
+			sigURL = asset.URL
+		}
+	}
+	if archiveURL == "" {
+		return fmt.Errorf("release %s has no build for this platform (%s)", latest.TagName, name)
+	}
+	if sumURL == "" {
+		return fmt.Errorf("release %s has no checksum for %s", latest.TagName, name)
+	}
+
+	fmt.Printf("Downloading %s %s...\n", latest.TagName, name)
+	archive, err := download(archiveURL)
+	if err != nil {
+		return err
+	}
+	sum, err := download(sumURL)
+	if err != nil {
+		return err
+	}
+	var sig []byte
+	if sigURL != "" {
+		if sig, err = download(sigURL); err != nil {
+			return err
+		}
+	}
+	if err := release.Verify(archive, sum, sig, updatePublicKey, *checksumOnly); err != nil {
+		return fmt.Errorf("verifying %s failed: %v", name, err)
+	}
+	binary, err := release.ExtractBinary(archive, binaryName(), maxReleaseSize)
+	if err != nil {
+		return err
+	}
+	if err := replaceExecutable(binary); err != nil {
+		return fmt.Errorf("replacing the executable failed: %v", err)
+	}
+	fmt.Printf("[Info] Updated to %s.\n", latest.TagName)
+	return nil
+}
+
+func latestRelease() (*githubRelease, error) {
+	data, err := download(releasesAPI)
+	if err != nil {
+		return nil, err
+	}
+	var r githubRelease
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func download(url string) ([]byte, error) {
+	client := http.Client{Timeout: 5 * time.Minute}
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: %s", url, res.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxReleaseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxReleaseSize {
+		return nil, fmt.Errorf("downloading %s: larger than %d MB", url, maxReleaseSize>>20)
+	}
+	return data, nil
+}
+
+// Release archive name of this platform, as built by the release workflow
+func assetName() string {
+	arch := runtime.GOARCH
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "GOARM" {
+				arch += setting.Value
+			}
+		}
+	}
+	return fmt.Sprintf("CloudflareScanner_%s-%s.zip", runtime.GOOS, arch)
+}
+
+// Name of the executable in the release archives
+func binaryName() string {
+	if runtime.GOOS == "windows" {
+		return "CloudflareScanner.exe"
+	}
+	return "CloudflareScanner"
+}
+
+// Writes the new binary next to the running one and renames it into place
+func replaceExecutable(binary []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(exe), filepath.Base(exe)+".new-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	if runtime.GOOS != "windows" {
+		return os.Rename(tmp.Name(), exe)
+	}
+	// A running executable can't be replaced on Windows, but it can be moved away
+	old := exe + ".old"
+	_ = os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		_ = os.Rename(old, exe)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var jobNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// How often the event stream looks for new results
+const streamPoll = 500 * time.Millisecond
+
+// How often the job configuration file is checked for changes
+const jobsPoll = 5 * time.Second
+
+// Job states
+const (
+	jobIdle     = "idle"
+	jobQueued   = "queued"
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+// Named scan configuration, e.g. one per ISP or interface
+type serveJob struct {
+	Name string   `json:"name"`
+	Args []string `json:"args"` // Scan options, e.g. ["-src", "192.168.1.10", "-tl", "200"]
+
+	m         sync.Mutex
+	state     string
+	queued    time.Time
+	started   time.Time
+	finished  time.Time
+	lastErr   string
+	heartbeat string          // Progress of the running scan
+	stream    string          // Results of the running scan as they qualify
+	ctx       context.Context // Of the latest run, older runs still stopping must not touch the state
+	cancel    context.CancelFunc
+}
+
+type jobStatus struct {
+	Name     string    `json:"name"`
+	Args     []string  `json:"args"`
+	State    string    `json:"state"`
+	Progress float64   `json:"progress"` // Percent of the running test
+	Queued   time.Time `json:"queued,omitzero"`
+	Started  time.Time `json:"started,omitzero"`
+	Finished time.Time `json:"finished,omitzero"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type scanServer struct {
+	exe      string
+	dir      string
+	jobsFile string
+	slots    chan struct{} // Limits the scans running at once
+	archive  archivePolicy
+
+	m        sync.RWMutex
+	jobs     map[string]*serveJob
+	modified time.Time // Of the job configuration file last loaded
+}
+
+// Serves named scan jobs over HTTP, every run is a separate scanner process with its own options and result directory
+func serveCommand(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8080", "Listen address")
+	jobsFile := fs.String("jobs", "jobs.json", "Job configuration file")
+	dataDir := fs.String("data", "serve-data", "Directory of the job results")
+	concurrency := fs.Int("concurrency", 1, "Scans running at once, the others wait in the queue")
+	archive := archiveFlags(fs)
+	_ = fs.Parse(args)
+	if *concurrency < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+
+	s, err := newScanServer(*jobsFile, *dataDir, *concurrency)
+	if err != nil {
+		return err
+	}
+	if s.archive, err = archive(); err != nil {
+		return err
+	}
+	go s.watchJobs()
+	fmt.Printf("[Info] Serving %d jobs on http://%s, running %d at once\n", len(s.jobs), *listen, *concurrency)
+	return http.ListenAndServe(*listen, s.handler())
+}
+
+func newScanServer(jobsFile, dataDir string, concurrency int) (*scanServer, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	s := &scanServer{exe: exe, dir: dataDir, jobsFile: jobsFile, jobs: make(map[string]*serveJob), slots: make(chan struct{}, concurrency)}
+	if _, err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Changes to the jobs of a reload
+type reloadSummary struct {
+	Added   []string `json:"added"`
+	Changed []string `json:"changed"`
+	Removed []string `json:"removed"`
+}
+
+// Applies the job configuration file: new jobs are added, the options of kept jobs change from their next run on
+// without losing their state and results, and removed jobs are canceled; an invalid file leaves the jobs as they are
+func (s *scanServer) reload() (reloadSummary, error) {
+	var summary reloadSummary
+	info, err := os.Stat(s.jobsFile)
+	if err != nil {
+		return summary, err
+	}
+	data, err := os.ReadFile(s.jobsFile)
+	if err != nil {
+		return summary, err
+	}
+	var jobs []*serveJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return summary, fmt.Errorf("%s: %v", s.jobsFile, err)
+	}
+	loaded := make(map[string]*serveJob)
+	for _, job := range jobs {
+		if !jobNameRegexp.MatchString(job.Name) {
+			return summary, fmt.Errorf("%s: invalid job name %q, use letters, digits, - and _", s.jobsFile, job.Name)
+		}
+		if _, ok := loaded[job.Name]; ok {
+			return summary, fmt.Errorf("%s: duplicate job %q", s.jobsFile, job.Name)
+		}
+		loaded[job.Name] = job
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.modified = info.ModTime()
+	for name, job := range loaded {
+		if old, ok := s.jobs[name]; ok {
+			if old.setArgs(job.Args) {
+				summary.Changed = append(summary.Changed, name)
+			}
+			continue
+		}
+		job.state = jobIdle
+		job.heartbeat = filepath.Join(s.dir, job.Name, "heartbeat")
+		job.stream = filepath.Join(s.dir, job.Name, "stream.jsonl")
+		s.jobs[name] = job
+		summary.Added = append(summary.Added, name)
+	}
+	for name, job := range s.jobs {
+		if _, ok := loaded[name]; !ok {
+			job.stop()
+			delete(s.jobs, name)
+			summary.Removed = append(summary.Removed, name)
+		}
+	}
+	sort.Strings(summary.Added)
+	sort.Strings(summary.Changed)
+	sort.Strings(summary.Removed)
+	return summary, nil
+}
+
+// Reloads the job configuration on SIGHUP and whenever the file changes
+func (s *scanServer) watchJobs() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(jobsPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-hup:
+		case <-ticker.C:
+			info, err := os.Stat(s.jobsFile)
+			s.m.RLock()
+			unchanged := err != nil || info.ModTime().Equal(s.modified)
+			s.m.RUnlock()
+			if unchanged {
+				continue
+			}
+		}
+		s.logReload(s.reload())
+	}
+}
+
+func (s *scanServer) logReload(summary reloadSummary, err error) {
+	if err != nil {
+		fmt.Println("[!] Reloading the jobs failed, keeping the current ones:", err)
+		return
+	}
+	fmt.Printf("[Info] Reloaded %s: %d added, %d changed, %d removed\n", s.jobsFile, len(summary.Added), len(summary.Changed), len(summary.Removed))
+}
+
+// The job of a name, nil when there is none
+func (s *scanServer) job(name string) *serveJob {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.jobs[name]
+}
+
+func (s *scanServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("POST /reload", func(w http.ResponseWriter, r *http.Request) {
+		summary, err := s.reload()
+		s.logReload(summary, err)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		writeJSON(w, http.StatusOK, summary)
+	})
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		s.m.RLock()
+		list := make([]jobStatus, 0, len(s.jobs))
+		for _, job := range s.jobs {
+			list = append(list, job.status())
+		}
+		s.m.RUnlock()
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		writeJSON(w, http.StatusOK, list)
+	})
+	mux.HandleFunc("GET /jobs/{name}", s.withJob(func(w http.ResponseWriter, r *http.Request, job *serveJob) {
+		writeJSON(w, http.StatusOK, job.status())
+	}))
+	mux.HandleFunc("POST /jobs/{name}/run", s.withJob(func(w http.ResponseWriter, r *http.Request, job *serveJob) {
+		ctx, ok := job.enqueue()
+		if !ok {
+			// Already waiting or running, the pending run serves this request too
+			writeJSON(w, http.StatusOK, job.status())
+			return
+		}
+		go s.run(ctx, job)
+		writeJSON(w, http.StatusAccepted, job.status())
+	}))
+	mux.HandleFunc("POST /jobs/{name}/cancel", s.withJob(func(w http.ResponseWriter, r *http.Request, job *serveJob) {
+		if !job.stop() {
+			writeJSON(w, http.StatusConflict, job.status())
+			return
+		}
+		writeJSON(w, http.StatusOK, job.status())
+	}))
+	mux.HandleFunc("GET /jobs/{name}/result", s.withJob(func(w http.ResponseWriter, r *http.Request, job *serveJob) {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		http.ServeFile(w, r, filepath.Join(s.dir, job.Name, "result.csv"))
+	}))
+	mux.HandleFunc("GET /jobs/{name}/archive", s.withJob(func(w http.ResponseWriter, r *http.Request, job *serveJob) {
+		names, err := listArchives(filepath.Join(s.dir, job.Name, "archive"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, names)
+	}))
+	mux.HandleFunc("GET /jobs/{name}/archive/{file}", s.withJob(func(w http.ResponseWriter, r *http.Request, job *serveJob) {
+		file := r.PathValue("file")
+		if !archiveNameRegexp.MatchString(file) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		http.ServeFile(w, r, filepath.Join(s.dir, job.Name, "archive", file))
+	}))
+	mux.HandleFunc("GET /jobs/{name}/events", s.withJob(streamEvents))
+	mux.HandleFunc("GET /jobs/{name}/log", s.withJob(func(w http.ResponseWriter, r *http.Request, job *serveJob) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		http.ServeFile(w, r, filepath.Join(s.dir, job.Name, "last.log"))
+	}))
+	return mux
+}
+
+func (s *scanServer) withJob(handle func(w http.ResponseWriter, r *http.Request, job *serveJob)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job := s.job(r.PathValue("name"))
+		if job == nil {
+			http.NotFound(w, r)
+			return
+		}
+		handle(w, r, job)
+	}
+}
+
+// Waits for a free slot and runs a scan with the job's options, the result replaces the previous one only when the scan succeeds
+func (s *scanServer) run(ctx context.Context, job *serveJob) {
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-ctx.Done():
+		job.finish(ctx, ctx.Err())
+		return
+	}
+	if !job.begin(ctx) {
+		return
+	}
+	err := func() error {
+		dir := filepath.Join(s.dir, job.Name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		log, err := os.Create(filepath.Join(dir, "last.log"))
+		if err != nil {
+			return err
+		}
+		defer log.Close()
+		tmp := filepath.Join(dir, "result.csv.tmp")
+		// Later flags win, so the job can't redirect its output or wait for confirmation
+		args := append(job.args(), "-o", tmp, "-p", "0", "-yes", "-polite", "-heartbeat", job.heartbeat, "-stream", job.stream)
+		cmd := exec.CommandContext(ctx, s.exe, args...)
+		cmd.Stdout, cmd.Stderr = log, log
+		if err := cmd.Run(); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		result := filepath.Join(dir, "result.csv")
+		if err := os.Rename(tmp, result); errors.Is(err, os.ErrNotExist) {
+			return errors.New("no IP passed the tests")
+		} else if err != nil {
+			return err
+		}
+		if err := s.archive.store(result, filepath.Join(dir, "archive"), time.Now()); err != nil {
+			fmt.Printf("[!] Archiving the result of %s failed: %v\n", job.Name, err)
+		}
+		return nil
+	}()
+	job.finish(ctx, err)
+}
+
+// Replaces the options of the job's next runs, false when they are the same
+func (job *serveJob) setArgs(args []string) bool {
+	job.m.Lock()
+	defer job.m.Unlock()
+	if slices.Equal(job.Args, args) {
+		return false
+	}
+	job.Args = args
+	return true
+}
+
+// A copy of the job's options
+func (job *serveJob) args() []string {
+	job.m.Lock()
+	defer job.m.Unlock()
+	return append([]string{}, job.Args...)
+}
+
+// Queues a run unless one is already pending
+func (job *serveJob) enqueue() (context.Context, bool) {
+	job.m.Lock()
+	defer job.m.Unlock()
+	if job.state == jobQueued || job.state == jobRunning {
+		return nil, false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	job.state, job.queued, job.ctx, job.cancel = jobQueued, time.Now(), ctx, cancel
+	job.started, job.finished, job.lastErr = time.Time{}, time.Time{}, ""
+	return ctx, true
+}
+
+// Moves a queued run to running, false if it was canceled meanwhile
+func (job *serveJob) begin(ctx context.Context) bool {
+	job.m.Lock()
+	defer job.m.Unlock()
+	if job.ctx != ctx || job.state != jobQueued {
+		return false
+	}
+	_ = os.Remove(job.heartbeat)
+	_ = os.Remove(job.stream)
+	job.state, job.started = jobRunning, time.Now()
+	return true
+}
+
+// Cancels a queued or running run
+func (job *serveJob) stop() bool {
+	job.m.Lock()
+	defer job.m.Unlock()
+	if job.state != jobQueued && job.state != jobRunning {
+		return false
+	}
+	job.cancel()
+	job.state, job.finished, job.lastErr = jobCanceled, time.Now(), ""
+	return true
+}
+
+func (job *serveJob) finish(ctx context.Context, err error) {
+	job.m.Lock()
+	defer job.m.Unlock()
+	if job.ctx != ctx || job.state == jobCanceled {
+		return
+	}
+	job.cancel()
+	job.state, job.finished = jobDone, time.Now()
+	if err != nil {
+		job.state, job.lastErr = jobFailed, err.Error()
+	}
+}
+
+func (job *serveJob) status() jobStatus {
+	job.m.Lock()
+	defer job.m.Unlock()
+	status := jobStatus{
+		Name:     job.Name,
+		Args:     job.Args,
+		State:    job.state,
+		Queued:   job.queued,
+		Started:  job.started,
+		Finished: job.finished,
+		Error:    job.lastErr,
+	}
+	switch job.state {
+	case jobRunning:
+		status.Progress = readProgress(job.heartbeat)
+	case jobDone:
+		status.Progress = 100
+	}
+	return status
+}
+
+// Sends the job's results as server-sent events while they qualify, then its final status once the run is over
+func streamEvents(w http.ResponseWriter, r *http.Request, job *serveJob) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	ticker := time.NewTicker(streamPoll)
+	defer ticker.Stop()
+	var offset int64
+	for {
+		// Checked before reading, so that the last results of a finished run are sent before its end
+		status := job.status()
+		var lines [][]byte
+		lines, offset = tailLines(job.stream, offset)
+		for _, line := range lines {
+			fmt.Fprintf(w, "event: result\ndata: %s\n\n", line)
+		}
+		if status.State != jobQueued && status.State != jobRunning {
+			data, _ := json.Marshal(status)
+			fmt.Fprintf(w, "event: end\ndata: %s\n\n", data)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reads the complete lines of file past offset, starting over when the file was replaced by a new run
+func tailLines(file string, offset int64) ([][]byte, int64) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, 0
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil || info.Size() < offset {
+		offset = 0
+	}
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, 1<<62))
+	if err != nil {
+		return nil, offset
+	}
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		return nil, offset
+	}
+	return bytes.Split(data[:end], []byte("\n")), offset + int64(end) + 1
+}
+
+// Reads the progress from a scanner heartbeat line such as "2024-01-02T15:04:05Z 42%"
+func readProgress(heartbeat string) float64 {
+	data, err := os.ReadFile(heartbeat)
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0
+	}
+	progress, _ := strconv.ParseFloat(strings.TrimSuffix(fields[1], "%"), 64)
+	return progress
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
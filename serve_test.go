@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Serves the jobs of jobsJSON, each run a fake scan (see fakeScan)
+func testScanServer(t *testing.T, jobsJSON string, concurrency int) (*scanServer, *httptest.Server) {
+	t.Setenv(fakeScannerEnv, "1")
+	dir := t.TempDir()
+	jobsFile := filepath.Join(dir, "jobs.json")
+	if err := os.WriteFile(jobsFile, []byte(jobsJSON), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := newScanServer(jobsFile, filepath.Join(dir, "data"), concurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.handler())
+	t.Cleanup(func() {
+		ts.Close()
+		// The scans of the test must not outlive its directory
+		s.m.RLock()
+		for _, job := range s.jobs {
+			job.stop()
+		}
+		s.m.RUnlock()
+		// Runs free their slot once the process exited
+		for deadline := time.Now().Add(5 * time.Second); len(s.slots) > 0 && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	return s, ts
+}
+
+func serveRequest(t *testing.T, method, url string, v any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil && resp.StatusCode < 400 {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// Polls the job until it is in one of the states
+func waitJob(t *testing.T, ts *httptest.Server, name string, states ...string) jobStatus {
+	t.Helper()
+	var status jobStatus
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		serveRequest(t, "GET", ts.URL+"/jobs/"+name, &status)
+		if slices.Contains(states, status.State) {
+			return status
+		}
+	}
+	t.Fatalf("job %s is %s (%s), want %v", name, status.State, status.Error, states)
+	return status
+}
+
+func TestServeQueue(t *testing.T) {
+	_, ts := testScanServer(t, `[{"name": "a", "args": ["-fake-sleep", "300ms"]}, {"name": "b", "args": []}]`, 1)
+	var status jobStatus
+	if code := serveRequest(t, "POST", ts.URL+"/jobs/a/run", &status); code != http.StatusAccepted || status.State != jobQueued {
+		t.Fatalf("run a = %d %s, want 202 queued", code, status.State)
+	}
+	waitJob(t, ts, "a", jobRunning)
+	// A pending run serves another request too
+	if code := serveRequest(t, "POST", ts.URL+"/jobs/a/run", &status); code != http.StatusOK || status.State != jobRunning {
+		t.Errorf("second run of a = %d %s, want 200 running", code, status.State)
+	}
+	// From the heartbeat of the scan
+	for deadline := time.Now().Add(5 * time.Second); status.State == jobRunning && status.Progress != 50 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		serveRequest(t, "GET", ts.URL+"/jobs/a", &status)
+	}
+	if status.State == jobRunning && status.Progress != 50 {
+		t.Errorf("progress of a = %v, want 50", status.Progress)
+	}
+	// One scan at a time, b waits for a
+	serveRequest(t, "POST", ts.URL+"/jobs/b/run", nil)
+	if status := waitJob(t, ts, "b", jobQueued, jobRunning); status.State != jobQueued {
+		t.Errorf("b = %s while a runs, want queued", status.State)
+	}
+	a := waitJob(t, ts, "a", jobDone)
+	b := waitJob(t, ts, "b", jobDone)
+	if b.Started.Before(a.Finished) || a.Progress != 100 {
+		t.Errorf("b started at %v, a finished at %v with %v%%, want b after a", b.Started, a.Finished, a.Progress)
+	}
+
+	resp, err := http.Get(ts.URL + "/jobs/b/result")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Errorf("result of b = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if code := serveRequest(t, "POST", ts.URL+"/jobs/c/run", nil); code != http.StatusNotFound {
+		t.Errorf("run of an unknown job = %d, want 404", code)
+	}
+}
+
+func TestServeStop(t *testing.T) {
+	s, ts := testScanServer(t, `[{"name": "a", "args": ["-fake-sleep", "1m"]}, {"name": "b", "args": []}, {"name": "c", "args": ["-fake-fail"]}]`, 1)
+	serveRequest(t, "POST", ts.URL+"/jobs/a/run", nil)
+	waitJob(t, ts, "a", jobRunning)
+	serveRequest(t, "POST", ts.URL+"/jobs/b/run", nil)
+
+	// A queued run never starts
+	var status jobStatus
+	if code := serveRequest(t, "POST", ts.URL+"/jobs/b/cancel", &status); code != http.StatusOK || status.State != jobCanceled {
+		t.Errorf("cancel b = %d %s, want 200 canceled", code, status.State)
+	}
+	// A running scan is killed and frees its slot
+	start := time.Now()
+	if code := serveRequest(t, "POST", ts.URL+"/jobs/a/cancel", &status); code != http.StatusOK || status.State != jobCanceled {
+		t.Errorf("cancel a = %d %s, want 200 canceled", code, status.State)
+	}
+	serveRequest(t, "POST", ts.URL+"/jobs/c/run", nil)
+	if status := waitJob(t, ts, "c", jobFailed); time.Since(start) > 5*time.Second || status.Error == "" {
+		t.Errorf("c failed after %v with %q, want the slot freed at once and the exit status", time.Since(start), status.Error)
+	}
+	for _, name := range []string{"a", "b"} {
+		if status := waitJob(t, ts, name, jobCanceled, jobDone, jobFailed); status.State != jobCanceled {
+			t.Errorf("%s = %s after the cancel, want canceled", name, status.State)
+		}
+		if _, err := os.Stat(filepath.Join(s.dir, name, "result.csv")); err == nil {
+			t.Errorf("canceled %s wrote a result", name)
+		}
+	}
+	if code := serveRequest(t, "POST", ts.URL+"/jobs/a/cancel", nil); code != http.StatusConflict {
+		t.Errorf("cancel of a stopped job = %d, want 409", code)
+	}
+	// and can run again
+	if code := serveRequest(t, "POST", ts.URL+"/jobs/b/run", nil); code != http.StatusAccepted {
+		t.Errorf("run after the cancel = %d, want 202", code)
+	}
+	waitJob(t, ts, "b", jobDone)
+}
+
+func TestServeReload(t *testing.T) {
+	s, ts := testScanServer(t, `[{"name": "a", "args": []}, {"name": "b", "args": ["-fake-sleep", "1m"]}]`, 2)
+	serveRequest(t, "POST", ts.URL+"/jobs/a/run", nil)
+	waitJob(t, ts, "a", jobDone)
+	serveRequest(t, "POST", ts.URL+"/jobs/b/run", nil)
+	waitJob(t, ts, "b", jobRunning)
+	b := s.job("b")
+
+	if err := os.WriteFile(s.jobsFile, []byte(`[{"name": "a", "args": ["-tl", "200"]}, {"name": "c", "args": []}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var summary reloadSummary
+	if code := serveRequest(t, "POST", ts.URL+"/reload", &summary); code != http.StatusOK {
+		t.Fatalf("reload = %d", code)
+	}
+	if !slices.Equal(summary.Added, []string{"c"}) || !slices.Equal(summary.Changed, []string{"a"}) || !slices.Equal(summary.Removed, []string{"b"}) {
+		t.Errorf("reload = %+v, want c added, a changed and b removed", summary)
+	}
+	// A kept job keeps its state with the new options, a removed one is stopped
+	var status jobStatus
+	serveRequest(t, "GET", ts.URL+"/jobs/a", &status)
+	if status.State != jobDone || !slices.Equal(status.Args, []string{"-tl", "200"}) {
+		t.Errorf("a = %s %q, want done with the new options", status.State, status.Args)
+	}
+	if code := serveRequest(t, "GET", ts.URL+"/jobs/b", nil); code != http.StatusNotFound {
+		t.Errorf("removed job = %d, want 404", code)
+	}
+	if status := b.status(); status.State != jobCanceled {
+		t.Errorf("removed running job = %s, want canceled", status.State)
+	}
+
+	// An invalid file keeps the jobs
+	if err := os.WriteFile(s.jobsFile, []byte(`[{"name": "a b"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code := serveRequest(t, "POST", ts.URL+"/reload", nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("reload of an invalid file = %d, want 422", code)
+	}
+	var list []jobStatus
+	serveRequest(t, "GET", ts.URL+"/jobs", &list)
+	if len(list) != 2 || list[0].Name != "a" || list[1].Name != "c" {
+		t.Errorf("jobs = %+v, want a and c", list)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/dns"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+// Answers A/AAAA queries for a name with the best IPs of a result file, e.g. "serve-dns :5353 -domain clean.local"
+func serveDNSCommand(args []string) error {
+	listen := ":5353"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		listen, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("serve-dns", flag.ExitOnError)
+	domain := fs.String("domain", "", "Name answered, e.g. clean.local")
+	file := fs.String("f", "result.csv", "Result file, reloaded when it changes")
+	count := fs.Int("n", 4, "IPs per answer")
+	ttl := fs.Duration("ttl", time.Minute, "TTL of the answers")
+	_ = fs.Parse(args)
+	name := strings.ToLower(strings.TrimSuffix(*domain, "."))
+	if name == "" {
+		return errors.New("usage: serve-dns [:5353] -domain clean.local [-f result.csv] [-n 4] [-ttl 1m]")
+	}
+	if *count < 1 {
+		return errors.New("n must be at least 1")
+	}
+
+	conn, err := net.ListenPacket("udp", listen)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	results := &resultWatcher{path: *file}
+	if ips, err := results.current(); err != nil {
+		fmt.Printf("[Warning] %v, answering SERVFAIL until it exists\n", err)
+	} else {
+		fmt.Printf("[Info] Loaded %d IPs from %s.\n", len(ips), *file)
+	}
+	fmt.Printf("[Info] Answering %s on udp %s with the best %d IPs of %s\n", name, conn.LocalAddr(), *count, *file)
+
+	var turn atomic.Uint64
+	lookup := func(q dns.Query) ([]netip.Addr, bool, error) {
+		if q.Name != name {
+			return nil, false, nil
+		}
+		ips, err := results.current()
+		if err != nil {
+			return nil, true, err
+		}
+		return rotate(bestOfFamily(ips, q.Type == dns.TypeA, *count), int(turn.Add(1))), true, nil
+	}
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		if resp := dns.Answer(buf[:n], uint32(ttl.Seconds()), lookup); resp != nil {
+			_, _ = conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+// The first n IPs of a family, IPv4 or IPv6
+func bestOfFamily(ips []netip.Addr, v4 bool, n int) []netip.Addr {
+	var best []netip.Addr
+	for _, ip := range ips {
+		if ip.Is4() == v4 && len(best) < n {
+			best = append(best, ip)
+		}
+	}
+	return best
+}
+
+// Round-robin: every answer starts one IP further
+func rotate(ips []netip.Addr, turn int) []netip.Addr {
+	if len(ips) == 0 {
+		return ips
+	}
+	i := turn % len(ips)
+	return append(append([]netip.Addr{}, ips[i:]...), ips[:i]...)
+}
+
+// The IPs of a result file, reread when a scan rewrites it
+type resultWatcher struct {
+	path string
+
+	m        sync.Mutex
+	modified time.Time
+	ips      []netip.Addr
+}
+
+func (w *resultWatcher) current() ([]netip.Addr, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	info, err := os.Stat(w.path)
+	if err == nil && !info.ModTime().Equal(w.modified) {
+		var ips []netip.Addr
+		if ips, err = utils.ReadResultIPs(w.path); err == nil {
+			w.ips, w.modified = ips, info.ModTime()
+		}
+	}
+	// A file being rewritten by a scan leaves the last good IPs in place
+	if err != nil && w.ips == nil {
+		return nil, err
+	}
+	return w.ips, nil
+}
@@ -0,0 +1,264 @@
+package task
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+// Version of the agent protocol: JSON lines over TCP, a hello and its reply, then requests and replies matched by id
+const agentProtocol = 1
+
+const agentDialTimeout = 10 * time.Second
+
+var (
+	// Agent is the address of an agent running the latency probes, e.g. box1:7890, empty probes from this machine
+	Agent string
+	// AgentToken is the shared secret of the agent
+	AgentToken string
+
+	remoteAgent *agentConn
+)
+
+type agentHello struct {
+	Version int    `json:"version"`
+	Token   string `json:"token"`
+}
+
+// Asks for Times TCP connections to the IP on Port
+type agentRequest struct {
+	ID    uint64 `json:"id"`
+	IP    string `json:"ip"`
+	Port  int    `json:"port"`
+	Times int    `json:"times"`
+}
+
+// Raw samples of a request: connection times in ms, -1 for each failed connection; id 0 replies to the hello
+type agentReply struct {
+	ID    uint64    `json:"id"`
+	RTT   []float64 `json:"rtt,omitempty"`
+	Error string    `json:"error,omitempty"`
+}
+
+// CheckAgent validates the options of an agent, which only runs TCP latency probes
+func CheckAgent() error {
+	if Agent == "" {
+		return nil
+	}
+	if AgentToken == "" {
+		return errors.New("-agent needs the token of the agent, set -agent-token")
+	}
+	if Httping || TCPFingerprint || Via != "" {
+		return errors.New("-agent only runs TCP latency tests, it can't be combined with -httping, -tcp-fingerprint or -via")
+	}
+	return nil
+}
+
+// ConnectAgent connects to the agent, the latency probes are then sent to it
+func ConnectAgent() (close func(), err error) {
+	if Agent == "" {
+		return func() {}, nil
+	}
+	conn, err := net.DialTimeout("tcp", Agent, agentDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	a := &agentConn{conn: conn, enc: json.NewEncoder(conn), pending: make(map[uint64]chan agentReply)}
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	_ = conn.SetDeadline(time.Now().Add(agentDialTimeout))
+	var reply agentReply
+	if err = a.enc.Encode(agentHello{Version: agentProtocol, Token: AgentToken}); err == nil {
+		err = dec.Decode(&reply)
+	}
+	if err == nil && reply.Error != "" {
+		err = errors.New(reply.Error)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("agent refused the connection: %v", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	go a.read(dec)
+	remoteAgent = a
+	utils.Printf("[Info] Sending latency probes to the agent %s\n", Agent)
+	return func() {
+		a.m.Lock()
+		a.closed = true
+		a.m.Unlock()
+		remoteAgent = nil
+		conn.Close()
+	}, nil
+}
+
+// Controller side of an agent connection
+type agentConn struct {
+	conn net.Conn
+	enc  *json.Encoder
+	wm   sync.Mutex
+
+	m       sync.Mutex
+	next    uint64
+	pending map[uint64]chan agentReply
+	err     error
+	closed  bool
+}
+
+// Hands each reply to the request waiting for it, failing all of them when the connection breaks
+func (a *agentConn) read(dec *json.Decoder) {
+	var err error
+	for {
+		var reply agentReply
+		if err = dec.Decode(&reply); err != nil {
+			break
+		}
+		a.m.Lock()
+		if ch, ok := a.pending[reply.ID]; ok {
+			delete(a.pending, reply.ID)
+			ch <- reply
+		}
+		a.m.Unlock()
+	}
+	a.m.Lock()
+	defer a.m.Unlock()
+	if !a.closed {
+		utils.Printf("\n[!] Lost the connection to the agent (%v), the remaining IPs count as unreachable\n", err)
+	}
+	a.err = err
+	for id, ch := range a.pending {
+		delete(a.pending, id)
+		ch <- agentReply{ID: id, Error: err.Error()}
+	}
+}
+
+// Connection times of ip measured by the agent
+func (a *agentConn) probe(ip *net.IPAddr) ([]float64, error) {
+	ch := make(chan agentReply, 1)
+	a.m.Lock()
+	if a.err != nil {
+		a.m.Unlock()
+		return nil, a.err
+	}
+	a.next++
+	id := a.next
+	a.pending[id] = ch
+	a.m.Unlock()
+
+	a.wm.Lock()
+	err := a.enc.Encode(agentRequest{ID: id, IP: ip.String(), Port: TCPPort, Times: PingTimes})
+	a.wm.Unlock()
+	if err != nil {
+		a.m.Lock()
+		delete(a.pending, id)
+		a.m.Unlock()
+		return nil, err
+	}
+	reply := <-ch
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+	return reply.RTT, nil
+}
+
+// Received count and total delay of ip from the samples of the agent
+func agentCheck(ip *net.IPAddr) (recv int, totalDelay time.Duration) {
+	samples, err := remoteAgent.probe(ip)
+	if err != nil {
+		return 0, 0
+	}
+	for _, ms := range samples {
+		if ms >= 0 {
+			recv++
+			totalDelay += time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	return
+}
+
+// ServeAgent runs the probes requested by controllers presenting token, at most routines connections at once
+func ServeAgent(l net.Listener, token string, routines int) error {
+	limit := make(chan struct{}, routines)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveController(conn, token, limit)
+	}
+}
+
+func serveController(conn net.Conn, token string, limit chan struct{}) {
+	defer conn.Close()
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	enc := json.NewEncoder(conn)
+	var hello agentHello
+	_ = conn.SetDeadline(time.Now().Add(agentDialTimeout))
+	if err := dec.Decode(&hello); err != nil {
+		return
+	}
+	switch {
+	case subtle.ConstantTimeCompare([]byte(hello.Token), []byte(token)) != 1:
+		_ = enc.Encode(agentReply{Error: "wrong token"})
+		utils.Printf("[Warning] Refused %s: wrong token\n", conn.RemoteAddr())
+		return
+	case hello.Version != agentProtocol:
+		_ = enc.Encode(agentReply{Error: fmt.Sprintf("protocol version %d, the agent speaks %d", hello.Version, agentProtocol)})
+		return
+	}
+	if err := enc.Encode(agentReply{}); err != nil {
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	utils.Printf("[Info] Controller %s connected\n", conn.RemoteAddr())
+
+	var wm sync.Mutex
+	var wg sync.WaitGroup
+	for {
+		var req agentRequest
+		if err := dec.Decode(&req); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reply := runAgentRequest(req, limit)
+			wm.Lock()
+			_ = enc.Encode(reply)
+			wm.Unlock()
+		}()
+	}
+	wg.Wait()
+	utils.Printf("[Info] Controller %s disconnected\n", conn.RemoteAddr())
+}
+
+func runAgentRequest(req agentRequest, limit chan struct{}) agentReply {
+	ip := net.ParseIP(req.IP)
+	if ip == nil || req.Port < 1 || req.Port > 65535 || req.Times < 1 || req.Times > 100 {
+		return agentReply{ID: req.ID, Error: "invalid request"}
+	}
+	if Polite && !isCDNAddr(ip) {
+		return agentReply{ID: req.ID, Error: "not a Cloudflare address, refused by polite mode"}
+	}
+	address := net.JoinHostPort(ip.String(), strconv.Itoa(req.Port))
+	reply := agentReply{ID: req.ID, RTT: make([]float64, req.Times)}
+	for i := range reply.RTT {
+		limit <- struct{}{}
+		start := time.Now()
+		conn, err := newDialer(tcpConnectTimeout).Dial("tcp", address)
+		<-limit
+		if err != nil {
+			reply.RTT[i] = -1
+			continue
+		}
+		reply.RTT[i] = float64(time.Since(start)) / float64(time.Millisecond)
+		conn.Close()
+	}
+	return reply
+}
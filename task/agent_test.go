@@ -0,0 +1,61 @@
+package task
+
+import (
+	"net"
+	"testing"
+)
+
+// Starts an agent on loopback, returning its address
+func useAgent(t *testing.T, token string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() { _ = ServeAgent(l, token, 8) }()
+	return l.Addr().String()
+}
+
+func TestAgentCheck(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	oldAgent, oldToken, oldPort, oldTimes := Agent, AgentToken, TCPPort, PingTimes
+	t.Cleanup(func() { Agent, AgentToken, TCPPort, PingTimes = oldAgent, oldToken, oldPort, oldTimes })
+	Agent, AgentToken = useAgent(t, "secret"), "secret"
+	TCPPort, PingTimes = target.Addr().(*net.TCPAddr).Port, 3
+
+	stop, err := ConnectAgent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if recv, delay := agentCheck(&net.IPAddr{IP: net.ParseIP("127.0.0.1")}); recv != 3 || delay <= 0 {
+		t.Errorf("agentCheck of an open port = %d, %v, want 3 received", recv, delay)
+	}
+	target.Close()
+	if recv, _ := agentCheck(&net.IPAddr{IP: net.ParseIP("127.0.0.1")}); recv != 0 {
+		t.Errorf("agentCheck of a closed port = %d received, want 0", recv)
+	}
+}
+
+func TestAgentToken(t *testing.T) {
+	oldAgent, oldToken := Agent, AgentToken
+	t.Cleanup(func() { Agent, AgentToken = oldAgent, oldToken })
+	Agent, AgentToken = useAgent(t, "secret"), "guess"
+	if _, err := ConnectAgent(); err == nil {
+		t.Error("agent accepted a wrong token")
+	}
+}
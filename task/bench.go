@@ -0,0 +1,183 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+)
+
+// Timeout of a bench handshake, long enough for the fragment delays of the aggressive presets
+const benchHandshakeTimeout = 30 * time.Second
+
+// Thread counts the concurrency bench steps through
+var benchThreads = []int{16, 32, 64, 128, 256, 512, maxRoutine}
+
+// HandshakeBench is the time of the local TLS handshakes with one ClientHello or fragment preset
+type HandshakeBench struct {
+	Name  string
+	Mean  time.Duration // Of a handshake, both ends included
+	Delay time.Duration // Of a handshake spent in fragment delays
+	Err   error         // Of the first failed handshake, the others aren't tried
+}
+
+// ConcurrencyBench is the rate of local TCP connections opened by a number of threads at once
+type ConcurrencyBench struct {
+	Threads int
+	Rate    float64 // Connections per second
+	Failed  int
+}
+
+// Local edge the bench handshakes with, both ends run in this process so the times are CPU bound
+type benchEdge struct {
+	server *testserver.Server
+	remote string
+}
+
+func newBenchEdge() *benchEdge {
+	server := testserver.New(testserver.Config{})
+	rootCAs = server.CertPool()
+	return &benchEdge{server: server, remote: server.Listener.Addr().String()}
+}
+
+func (e *benchEdge) close() {
+	e.server.Close()
+	rootCAs = nil
+}
+
+// Times n handshakes one after another, the first one is left out as it warms up the caches
+func (e *benchEdge) handshakes(n int, hello string, config *FragmentConfig) HandshakeBench {
+	result := HandshakeBench{Name: hello}
+	var total, delay time.Duration
+	for i := 0; i <= n; i++ {
+		var metrics FragmentMetrics
+		ctx, cancel := context.WithTimeout(context.Background(), benchHandshakeTimeout)
+		start := time.Now()
+		conn, err := dialTLS(ctx, newDialer(benchHandshakeTimeout), e.remote, "127.0.0.1", getClientHelloId(hello), config, &metrics)
+		took := time.Since(start)
+		cancel()
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		_ = conn.Close()
+		if i > 0 {
+			total += took
+			delay += metrics.Sleep()
+		}
+	}
+	result.Mean, result.Delay = total/time.Duration(n), delay/time.Duration(n)
+	return result
+}
+
+// BenchHandshakes times n local TLS handshakes with each ClientHello fingerprint, fastest first and failed ones last
+func BenchHandshakes(n int) []HandshakeBench {
+	edge := newBenchEdge()
+	defer edge.close()
+	results := make([]HandshakeBench, 0, len(clientHelloNames))
+	for _, name := range clientHelloNames {
+		results = append(results, edge.handshakes(n, name, nil))
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		return a.Err == nil && (b.Err != nil || a.Mean < b.Mean)
+	})
+	return results
+}
+
+// BenchFragments times n local TLS handshakes with the [-fingerprint] ClientHello unfragmented, then with each built-in preset
+func BenchFragments(n int) ([]HandshakeBench, error) {
+	edge := newBenchEdge()
+	defer edge.close()
+	names := make([]string, 0, len(fragmentPresets))
+	for name := range fragmentPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	results := make([]HandshakeBench, 0, len(names)+1)
+	r := edge.handshakes(n, ClientHelloID, nil)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	r.Name = "none"
+	results = append(results, r)
+	for _, name := range names {
+		config, err := ParseFragmentOptions(fragmentPresets[name])
+		if err != nil {
+			return nil, err
+		}
+		r := edge.handshakes(n, ClientHelloID, config)
+		r.Name = name
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// BenchConcurrency opens local TCP connections with each number of threads for d, like the latency test does
+func BenchConcurrency(d time.Duration) ([]ConcurrencyBench, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	var results []ConcurrencyBench
+	for _, threads := range benchThreads {
+		var opened, failed atomic.Int64
+		deadline := time.Now().Add(d)
+		var wg sync.WaitGroup
+		for range threads {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for time.Now().Before(deadline) {
+					conn, err := newDialer(tcpConnectTimeout).Dial("tcp", l.Addr().String())
+					if err != nil {
+						failed.Add(1)
+						continue
+					}
+					// Reset rather than close, so the bench doesn't run out of ports held in TIME_WAIT
+					if tcp, ok := conn.(*net.TCPConn); ok {
+						_ = tcp.SetLinger(0)
+					}
+					_ = conn.Close()
+					opened.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		results = append(results, ConcurrencyBench{Threads: threads, Rate: float64(opened.Load()) / d.Seconds(), Failed: int(failed.Load())})
+	}
+	if len(results) == 0 || results[0].Rate == 0 {
+		return results, errors.New("no local connection succeeded")
+	}
+	return results, nil
+}
+
+// SaturatingThreads returns the fewest threads reaching 90% of the best connection rate, more only add CPU load, and that rate
+func SaturatingThreads(results []ConcurrencyBench) (int, float64) {
+	var best float64
+	for _, r := range results {
+		best = max(best, r.Rate)
+	}
+	for _, r := range results {
+		if r.Rate >= best*0.9 {
+			return r.Threads, r.Rate
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,28 @@
+package task
+
+import "testing"
+
+func TestSaturatingThreads(t *testing.T) {
+	results := []ConcurrencyBench{{Threads: 16, Rate: 5000}, {Threads: 32, Rate: 9000}, {Threads: 64, Rate: 9500}, {Threads: 128, Rate: 9800}, {Threads: 256, Rate: 8000}}
+	if threads, rate := SaturatingThreads(results); threads != 32 || rate != 9000 {
+		t.Errorf("SaturatingThreads = %d, %v, want 32, 9000", threads, rate)
+	}
+	if threads, _ := SaturatingThreads(nil); threads != 0 {
+		t.Errorf("SaturatingThreads(nil) = %d, want 0", threads)
+	}
+}
+
+func TestBenchHandshakes(t *testing.T) {
+	results := BenchHandshakes(1)
+	if len(results) != len(clientHelloNames) {
+		t.Fatalf("got %d results, want %d", len(results), len(clientHelloNames))
+	}
+	for i, r := range results {
+		if r.Name == "go" && r.Err != nil {
+			t.Errorf("go handshake failed: %v", r.Err)
+		}
+		if i > 0 && r.Err == nil && (results[i-1].Err != nil || r.Mean < results[i-1].Mean) {
+			t.Errorf("results not sorted: %v", results)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package task
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	// CacheStatus records the cf-cache-status and Age headers of each download test
+	CacheStatus = false
+	// RequireCache only accepts downloads whose cf-cache-status is this (e.g. HIT or MISS), empty accepts any
+	RequireCache = ""
+
+	// Cache headers of the last download from each IP
+	cacheStatuses sync.Map
+)
+
+type cacheStatus struct {
+	status, age string
+}
+
+// Records the cache headers of a download, reporting whether the cache status is acceptable
+func recordCacheStatus(ip *net.IPAddr, header http.Header) bool {
+	if !CacheStatus && RequireCache == "" {
+		return true
+	}
+	status := header.Get("cf-cache-status")
+	cacheStatuses.Store(ip.IP.String(), cacheStatus{status: status, age: header.Get("Age")})
+	return cacheAccepted(status)
+}
+
+func cacheAccepted(status string) bool {
+	return RequireCache == "" || strings.EqualFold(status, RequireCache)
+}
+
+// cf-cache-status and Age of the last download from an IP, "-" when the download had no such header
+func cacheStatusOf(ip *net.IPAddr) (status, age string, ok bool) {
+	c, ok := cacheStatuses.Load(ip.IP.String())
+	if !ok {
+		return "", "", false
+	}
+	status, age = c.(cacheStatus).status, c.(cacheStatus).age
+	if status == "" {
+		status = "-"
+	}
+	if age == "" {
+		age = "-"
+	}
+	return status, age, true
+}
@@ -0,0 +1,86 @@
+package task
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	calibrationWindow = 2 * time.Second
+	// Latency test threads per CPU, the threads mostly wait on the network
+	routinesPerCPU = 64
+	// Rough bytes on the wire of one TCPing: SYN, SYN-ACK, ACK and the close
+	pingWireBytes = 240
+	// TCPings a thread sends per second, most are answered well within the connect timeout
+	pingsPerThread = 5
+	// Share of the line the latency test may take, the rest is left to other traffic
+	pingLineShare = 0.2
+	// Download speed a single connection to the edge is assumed to reach, lines faster than this take more download threads
+	downloadConnSpeed = 8 << 20
+	// Download test threads per CPU, each runs a TLS stream at full speed
+	downloadRoutinesPerCPU = 2
+	maxDownloadRoutines    = 8
+)
+
+var (
+	// Calibrate measures the line speed with a short transfer through the default route before the scan
+	Calibrate = false
+	// LineSpeed is the measured line speed in bytes per second, 0 when not measured
+	LineSpeed float64
+)
+
+// MeasureLineSpeed downloads from the test address for a short while through the default route,
+// i.e. the system's DNS and routing instead of a tested IP, returning bytes per second
+func MeasureLineSpeed() (float64, error) {
+	checkDownloadDefault()
+	client := &http.Client{Transport: &http.Transport{DisableCompression: RawBytes, TLSClientConfig: &tls.Config{RootCAs: rootCAs}}}
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout+calibrationWindow)
+	defer cancel()
+	target := URL
+	if cacheBusting() {
+		target = cacheBustURL(URL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
+	if RawBytes {
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("calibration transfer: %s", resp.Status)
+	}
+	speed := measureSpeed(resp.Body, resp.ContentLength, calibrationWindow, 0)
+	if speed <= 0 {
+		return 0, fmt.Errorf("calibration transfer received no data")
+	}
+	return speed, nil
+}
+
+// AutoRoutines returns latency test threads fitting the CPUs and, when measured, the line speed in bytes per second
+func AutoRoutines(cpus int, lineSpeed float64) int {
+	n := cpus * routinesPerCPU
+	if lineSpeed > 0 {
+		n = min(n, int(lineSpeed*pingLineShare/pingWireBytes/pingsPerThread))
+	}
+	return min(max(n, minAdaptiveRoutines), maxRoutine)
+}
+
+// AutoDownloadRoutines returns download test threads filling the line speed in bytes per second, assumedLineSpeed when
+// not measured, with as few connections as the CPUs can keep up with
+func AutoDownloadRoutines(cpus int, lineSpeed float64) int {
+	if lineSpeed <= 0 {
+		lineSpeed = float64(assumedLineSpeed)
+	}
+	n := int(lineSpeed / downloadConnSpeed)
+	return max(min(n, cpus*downloadRoutinesPerCPU, maxDownloadRoutines), 1)
+}
@@ -0,0 +1,67 @@
+package task
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestAutoRoutines(t *testing.T) {
+	const mbps = 1e6 / 8
+	tests := []struct {
+		cpus      int
+		lineSpeed float64
+		want      int
+	}{
+		{cpus: 1, want: 64},
+		{cpus: 4, want: 256},
+		{cpus: 64, want: maxRoutine},
+		{cpus: 4, lineSpeed: 10 * mbps, want: 208},
+		{cpus: 4, lineSpeed: 1000 * mbps, want: 256},
+		{cpus: 4, lineSpeed: 0.5 * mbps, want: 10},
+		{cpus: 4, lineSpeed: 0.1 * mbps, want: minAdaptiveRoutines},
+	}
+	for _, tt := range tests {
+		if got := AutoRoutines(tt.cpus, tt.lineSpeed); got != tt.want {
+			t.Errorf("AutoRoutines(%d, %.0f) = %d, want %d", tt.cpus, tt.lineSpeed, got, tt.want)
+		}
+	}
+}
+
+func TestAutoDownloadRoutines(t *testing.T) {
+	const mbps = 1e6 / 8
+	tests := []struct {
+		cpus      int
+		lineSpeed float64
+		want      int
+	}{
+		{cpus: 4, want: 1},
+		{cpus: 4, lineSpeed: 10 * mbps, want: 1},
+		{cpus: 4, lineSpeed: 200 * mbps, want: 2},
+		{cpus: 4, lineSpeed: 1000 * mbps, want: maxDownloadRoutines},
+		{cpus: 1, lineSpeed: 1000 * mbps, want: downloadRoutinesPerCPU},
+	}
+	for _, tt := range tests {
+		if got := AutoDownloadRoutines(tt.cpus, tt.lineSpeed); got != tt.want {
+			t.Errorf("AutoDownloadRoutines(%d, %.0f) = %d, want %d", tt.cpus, tt.lineSpeed, got, tt.want)
+		}
+	}
+}
+
+func TestMeasureLineSpeed(t *testing.T) {
+	body := bytes.Repeat([]byte{0}, testBodySize)
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	})
+	speed, err := MeasureLineSpeed()
+	if err != nil || speed <= 0 {
+		t.Errorf("MeasureLineSpeed() = %v, %v", speed, err)
+	}
+
+	useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	})
+	if _, err := MeasureLineSpeed(); err == nil {
+		t.Error("MeasureLineSpeed() accepted an error response")
+	}
+}
@@ -0,0 +1,98 @@
+package task
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/crypto/ocsp"
+)
+
+// CertCheck checks the stapled OCSP response and the certificate transparency proofs of enriched IPs,
+// a certificate from an intercepting proxy usually has neither
+var CertCheck = false
+
+// X.509 extension carrying the SCTs embedded by the CA
+var sctListOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// Verdict on the stapled OCSP response: good, revoked, unknown, stale, invalid or none when nothing was stapled
+func ocspVerdict(state *utls.ConnectionState, now time.Time) string {
+	if len(state.OCSPResponse) == 0 {
+		return "none"
+	}
+	leaf, issuer := leafAndIssuer(state)
+	if leaf == nil || issuer == nil {
+		return "invalid (no issuer)"
+	}
+	resp, err := ocsp.ParseResponseForCert(state.OCSPResponse, leaf, issuer)
+	if err != nil {
+		return fmt.Sprintf("invalid (%v)", err)
+	}
+	switch {
+	case resp.Status == ocsp.Revoked:
+		return "revoked"
+	case resp.Status != ocsp.Good:
+		return "unknown"
+	case !resp.NextUpdate.IsZero() && now.After(resp.NextUpdate):
+		return "stale"
+	}
+	return "good"
+}
+
+// Verdict on certificate transparency: the number of SCTs from the certificate and the handshake, or none.
+// Log signatures are not verified, as that needs the current log list.
+func ctVerdict(state *utls.ConnectionState) string {
+	n := len(state.SignedCertificateTimestamps)
+	if leaf, _ := leafAndIssuer(state); leaf != nil {
+		n += embeddedSCTs(leaf)
+	}
+	switch n {
+	case 0:
+		return "none"
+	case 1:
+		return "1 SCT"
+	}
+	return fmt.Sprintf("%d SCTs", n)
+}
+
+func leafAndIssuer(state *utls.ConnectionState) (leaf, issuer *x509.Certificate) {
+	chain := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		chain = state.VerifiedChains[0]
+	}
+	if len(chain) > 0 {
+		leaf = chain[0]
+	}
+	if len(chain) > 1 {
+		issuer = chain[1]
+	}
+	return
+}
+
+// Number of SCTs in the certificate's SCT list extension (RFC 6962 section 3.3)
+func embeddedSCTs(cert *x509.Certificate) int {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(sctListOID) {
+			continue
+		}
+		var list []byte
+		if _, err := asn1.Unmarshal(ext.Value, &list); err != nil || len(list) < 2 {
+			return 0
+		}
+		list = list[2:] // Total length
+		n := 0
+		for len(list) >= 2 {
+			size := int(binary.BigEndian.Uint16(list))
+			if len(list) < 2+size {
+				break
+			}
+			list = list[2+size:]
+			n++
+		}
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,121 @@
+package task
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/crypto/ocsp"
+)
+
+// Issues a CA and a leaf, the leaf embedding an SCT list of the given number of entries
+func testChain(t *testing.T, scts int) (leaf, ca *x509.Certificate, caKey *ecdsa.PrivateKey) {
+	t.Helper()
+	caKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ = x509.ParseCertificate(der)
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if scts > 0 {
+		list := []byte{0, 0}
+		for i := 0; i < scts; i++ {
+			list = append(list, 0, 3, 1, 2, 3)
+		}
+		list[1] = byte(len(list) - 2)
+		value, _ := asn1.Marshal(list)
+		leafTemplate.ExtraExtensions = []pkix.Extension{{Id: sctListOID, Value: value}}
+	}
+	leafKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, err = x509.CreateCertificate(rand.Reader, leafTemplate, ca, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ = x509.ParseCertificate(der)
+	return leaf, ca, caKey
+}
+
+func TestOCSPVerdict(t *testing.T) {
+	leaf, ca, caKey := testChain(t, 0)
+	now := time.Now()
+	staple := func(status int, nextUpdate time.Time) []byte {
+		resp, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:       status,
+			SerialNumber: leaf.SerialNumber,
+			ThisUpdate:   now.Add(-time.Hour),
+			NextUpdate:   nextUpdate,
+			RevokedAt:    now.Add(-time.Hour),
+		}, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	tests := []struct {
+		name  string
+		state utls.ConnectionState
+		want  string
+	}{
+		{name: "none", state: utls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, ca}}, want: "none"},
+		{name: "good", state: utls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, ca}, OCSPResponse: staple(ocsp.Good, now.Add(time.Hour))}, want: "good"},
+		{name: "revoked", state: utls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, ca}, OCSPResponse: staple(ocsp.Revoked, now.Add(time.Hour))}, want: "revoked"},
+		{name: "stale", state: utls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, ca}, OCSPResponse: staple(ocsp.Good, now.Add(-time.Minute))}, want: "stale"},
+		{name: "no-issuer", state: utls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}, OCSPResponse: staple(ocsp.Good, now.Add(time.Hour))}, want: "invalid (no issuer)"},
+	}
+	for _, tt := range tests {
+		if got := ocspVerdict(&tt.state, now); got != tt.want {
+			t.Errorf("%s: ocspVerdict() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// A response signed by another CA, as a proxy would have to
+	other, _, otherKey := testChain(t, 0)
+	forged, _ := ocsp.CreateResponse(other, other, ocsp.Response{Status: ocsp.Good, SerialNumber: leaf.SerialNumber, ThisUpdate: now}, otherKey)
+	state := utls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, ca}, OCSPResponse: forged}
+	if got := ocspVerdict(&state, now); !strings.HasPrefix(got, "invalid") {
+		t.Errorf("forged response: ocspVerdict() = %q, want invalid", got)
+	}
+}
+
+func TestCTVerdict(t *testing.T) {
+	leaf, ca, _ := testChain(t, 2)
+	bare, _, _ := testChain(t, 0)
+	tests := []struct {
+		name  string
+		state utls.ConnectionState
+		want  string
+	}{
+		{name: "embedded", state: utls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, ca}}, want: "2 SCTs"},
+		{name: "handshake", state: utls.ConnectionState{PeerCertificates: []*x509.Certificate{bare}, SignedCertificateTimestamps: [][]byte{{1}}}, want: "1 SCT"},
+		{name: "none", state: utls.ConnectionState{PeerCertificates: []*x509.Certificate{bare}}, want: "none"},
+	}
+	for _, tt := range tests {
+		if got := ctVerdict(&tt.state); got != tt.want {
+			t.Errorf("%s: ctVerdict() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package task
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+var (
+	// Colos keeps only the IPs terminating at these datacenters (airport codes such as FRA) in every test mode, empty keeps all
+	Colos []string
+
+	// Colo of the CF-RAY header of the last download from each IP
+	downloadColos sync.Map
+)
+
+// ParseColos parses airport codes separated by commas, e.g. "fra,AMS"
+func ParseColos(list string) ([]string, error) {
+	var colos []string
+	for _, c := range strings.Split(list, ",") {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		if !OutRegexp.MatchString(c) || len(c) != 3 {
+			return nil, fmt.Errorf("invalid colo %q, use the three-letter airport code, e.g. FRA", c)
+		}
+		colos = append(colos, c)
+	}
+	return colos, nil
+}
+
+func coloAccepted(colo string) bool {
+	return len(Colos) == 0 || slices.Contains(Colos, colo)
+}
+
+// Records the colo of a download response, false when it isn't one of Colos
+func recordColo(ip *net.IPAddr, header http.Header) bool {
+	if len(Colos) == 0 {
+		return true
+	}
+	colo := OutRegexp.FindString(header.Get("CF-RAY"))
+	downloadColos.Store(ip.IP.String(), colo)
+	return coloAccepted(colo)
+}
+
+// Colo of the last download from an IP, "" when unknown
+func downloadColoOf(ip *net.IPAddr) string {
+	colo, _ := downloadColos.Load(ip.IP.String())
+	s, _ := colo.(string)
+	return s
+}
+
+// Keeps the latency results of Colos, for when the download test is disabled; the colos HTTPing didn't record are taken from
+// /cdn-cgi/trace, [-enrich-threads] at a time
+func filterColos(ipSet utils.PingDelaySet) utils.PingDelaySet {
+	if len(Colos) == 0 {
+		return ipSet
+	}
+	routines := EnrichRoutines
+	if routines <= 0 {
+		routines = defaultEnrichRoutines
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < routines; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				ipSet[i].Colo = detectColo(&ipSet[i])
+			}
+		}()
+	}
+	for i := range ipSet {
+		if ipSet[i].Colo == "" && !ipSet[i].Pinned {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return keepColos(ipSet)
+}
+
+// Results of Colos and pinned ones
+func keepColos(ipSet utils.PingDelaySet) (data utils.PingDelaySet) {
+	if len(Colos) == 0 {
+		return ipSet
+	}
+	for _, v := range ipSet {
+		if v.Pinned || coloAccepted(v.Colo) {
+			data = append(data, v)
+		}
+	}
+	return
+}
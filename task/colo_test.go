@@ -0,0 +1,50 @@
+package task
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+func TestParseColos(t *testing.T) {
+	colos, err := ParseColos(" fra,AMS,")
+	if err != nil || len(colos) != 2 || colos[0] != "FRA" || colos[1] != "AMS" {
+		t.Errorf("got %v, %v", colos, err)
+	}
+	for _, bad := range []string{"FRANKFURT", "F1A", "fr"} {
+		if _, err := ParseColos(bad); err == nil {
+			t.Errorf("%q: want an error", bad)
+		}
+	}
+}
+
+func TestDownloadColo(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), testBodySize)
+	ip := useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("CF-RAY", "8a1b2c3d4e5f6a7b-AMS")
+		_, _ = w.Write(body)
+	})
+	old := Colos
+	t.Cleanup(func() { Colos = old })
+
+	for _, tc := range []struct {
+		colos []string
+		kept  bool
+	}{
+		{nil, true},
+		{[]string{"AMS"}, true},
+		{[]string{"FRA", "LHR"}, false},
+	} {
+		Colos = tc.colos
+		data := TestDownloadSpeed(utils.PingDelaySet{{PingData: &utils.PingData{IP: ip, Sended: 4, Received: 4}}})
+		kept := len(data) == 1 && data[0].DownloadSpeed > 0
+		if kept != tc.kept {
+			t.Errorf("colos %v: kept %v, want %v", tc.colos, kept, tc.kept)
+		}
+		if kept && len(tc.colos) > 0 && data[0].Colo != "AMS" {
+			t.Errorf("colos %v: colo %q, want AMS", tc.colos, data[0].Colo)
+		}
+	}
+}
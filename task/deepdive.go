@@ -0,0 +1,314 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+	utls "github.com/refraction-networking/utls"
+)
+
+const (
+	stabilityProbes   = 20
+	stabilityInterval = 100 * time.Millisecond
+)
+
+// DiveStep is the outcome of one probe of a deep dive
+type DiveStep struct {
+	Probe  string
+	OK     bool
+	Took   time.Duration
+	Detail string
+}
+
+type diveProbe struct {
+	name string
+	run  func() (bool, string)
+}
+
+func (p diveProbe) step() DiveStep {
+	start := time.Now()
+	ok, detail := p.run()
+	return DiveStep{Probe: p.name, OK: ok, Took: time.Since(start), Detail: detail}
+}
+
+// DeepDive runs every probe of the scanner against one IP, the light ones in parallel and the transfer tests (download,
+// HTTP/3 download with QUIC, upload with Upload) last one at a time so their traffic doesn't skew the latencies;
+// the steps come back in a fixed order
+func DeepDive(ip *net.IPAddr) []DiveStep {
+	checkPingDefault()
+	checkDownloadDefault()
+	serverName := ""
+	if u, err := url.Parse(URL); err == nil {
+		serverName = u.Hostname()
+	}
+	ping := &Ping{config: globalConfig()}
+	if TCPFingerprint {
+		ping.synAcks = startSynAckSniffer(ping.config.port)
+		defer ping.synAcks.Close()
+	}
+	probes := []diveProbe{
+		{"tcp", func() (bool, string) { return diveTCP(ping, ip) }},
+		{"stability", func() (bool, string) { return diveStability(ping, ip) }},
+		{"tls", func() (bool, string) { return diveTLS(ip, serverName) }},
+		{"http", func() (bool, string) { return diveHTTP(ping, ip) }},
+		{"trace", func() (bool, string) { return diveTrace(ip) }},
+		{"fingerprints", func() (bool, string) { return diveFingerprints(ip, serverName) }},
+		{"keepalive", func() (bool, string) { return diveKeepAlive(ip) }},
+		{"warmup", func() (bool, string) { return diveWarmUp(ip, serverName) }},
+		{"quic", func() (bool, string) { return diveQUIC(ip) }},
+	}
+	steps := make([]DiveStep, len(probes))
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			steps[i] = p.step()
+		}()
+	}
+	wg.Wait()
+
+	var transfers []diveProbe
+	if !Disable {
+		transfers = append(transfers, diveProbe{"download", func() (bool, string) { return diveDownload(ip) }})
+		if QUIC && viaClient == nil {
+			transfers = append(transfers, diveProbe{"http3", func() (bool, string) { return diveHTTP3(ip) }})
+		}
+	}
+	if Upload {
+		transfers = append(transfers, diveProbe{"upload", func() (bool, string) { return diveUpload(ip) }})
+	}
+	for _, p := range transfers {
+		steps = append(steps, p.step())
+	}
+	return steps
+}
+
+// Failure of a probe with its class, e.g. "failed (tls-reset): ..."
+func diveFailure(ip *net.IPAddr) string {
+	err := LastFailure(ip)
+	if err == nil {
+		return "failed"
+	}
+	return fmt.Sprintf("failed (%s): %v", ErrorClass(err), err)
+}
+
+func diveTCP(p *Ping, ip *net.IPAddr) (bool, string) {
+	var recv int
+	var total time.Duration
+	var fingerprint string
+	for range PingTimes {
+		if ok, delay, fp := p.tcping(ip); ok {
+			recv++
+			total += delay
+			fingerprint = fp
+		}
+	}
+	if recv == 0 {
+		return false, fmt.Sprintf("0/%d connections, %s", PingTimes, diveFailure(ip))
+	}
+	detail := fmt.Sprintf("%d/%d connections, %.2f ms", recv, PingTimes, ms(total/time.Duration(recv)))
+	if fingerprint != "" {
+		detail += ", SYN-ACK " + fingerprint
+		if isMiddlebox(fingerprint) {
+			detail += " (not the edge signature, middlebox?)"
+		}
+	}
+	return true, detail
+}
+
+// Spaced connections showing loss and jitter, which a few back-to-back ones hide
+func diveStability(p *Ping, ip *net.IPAddr) (bool, string) {
+	var delays []float64
+	for i := range stabilityProbes {
+		if i > 0 {
+			time.Sleep(stabilityInterval)
+		}
+		if ok, delay, _ := p.tcping(ip); ok {
+			delays = append(delays, ms(delay))
+		}
+	}
+	if len(delays) == 0 {
+		return false, fmt.Sprintf("0/%d connections", stabilityProbes)
+	}
+	lowest, highest, sum := delays[0], delays[0], 0.0
+	for _, d := range delays {
+		lowest, highest, sum = min(lowest, d), max(highest, d), sum+d
+	}
+	mean := sum / float64(len(delays))
+	var variance float64
+	for _, d := range delays {
+		variance += (d - mean) * (d - mean)
+	}
+	jitter := math.Sqrt(variance / float64(len(delays)))
+	loss := 1 - float64(len(delays))/stabilityProbes
+	return loss < 0.5, fmt.Sprintf("%d/%d connections over %v, min/avg/max %.2f/%.2f/%.2f ms, jitter %.2f ms",
+		len(delays), stabilityProbes, time.Duration(stabilityProbes-1)*stabilityInterval, lowest, mean, highest, jitter)
+}
+
+// Handshake with the [-fingerprint] ClientHello, reporting what was negotiated; h2 shows in the ALPN
+func diveTLS(ip *net.IPAddr, serverName string) (bool, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+	start := time.Now()
+	conn, err := dialTLS(ctx, newDialer(HandshakeTimeout), remoteAddr(ip).String(), serverName, getClientHelloId(ClientHelloID), fragmentFor(ProbeSweep, true), nil)
+	if err != nil {
+		err := probeError(ProbeSweep, err)
+		return false, fmt.Sprintf("%s, failed (%s): %v", ClientHelloID, ErrorClass(err), err.Err)
+	}
+	took := time.Since(start)
+	defer conn.Close()
+	detail := fmt.Sprintf("%s, %.2f ms", ClientHelloID, ms(took))
+	if uConn, ok := conn.(*utls.UConn); ok {
+		state := uConn.ConnectionState()
+		alpn := state.NegotiatedProtocol
+		if alpn == "" {
+			alpn = "none"
+		}
+		detail += fmt.Sprintf(", %s, %s, ALPN %s", tlsVersionName(state.Version), utls.CipherSuiteName(state.CipherSuite), alpn)
+	}
+	return true, detail
+}
+
+func tlsVersionName(v uint16) string {
+	switch v {
+	case utls.VersionTLS13:
+		return "TLS 1.3"
+	case utls.VersionTLS12:
+		return "TLS 1.2"
+	}
+	return fmt.Sprintf("TLS 0x%04x", v)
+}
+
+func diveHTTP(p *Ping, ip *net.IPAddr) (bool, string) {
+	recv, total, colo := p.httping(ip)
+	if recv == 0 {
+		return false, diveFailure(ip)
+	}
+	detail := fmt.Sprintf("%d/%d requests, %.2f ms", recv, PingTimes, ms(total/time.Duration(recv)))
+	if colo != "" {
+		detail += ", colo " + colo
+	}
+	return true, detail
+}
+
+// The trace request with its certificate, checked for OCSP and certificate transparency
+func diveTrace(ip *net.IPAddr) (bool, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), enrichTimeout)
+	defer cancel()
+	colo, cfRay, state := trace(ctx, ip)
+	if colo == "" {
+		return false, "no colo in /cdn-cgi/trace"
+	}
+	detail := fmt.Sprintf("colo %s, CF-RAY %s", colo, cfRay)
+	if state != nil && len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		detail += fmt.Sprintf(", certificate %s (issuer: %s, expires: %s), OCSP %s, CT %s", certName(leaf.Subject, leaf.DNSNames),
+			certName(leaf.Issuer, nil), leaf.NotAfter.Format("2006-01-02"), ocspVerdict(state, time.Now()), ctVerdict(state))
+	}
+	return true, detail
+}
+
+// A handshake with every ClientHello, a DPI often lets only some through
+func diveFingerprints(ip *net.IPAddr, serverName string) (bool, string) {
+	var passed, failed []string
+	for _, name := range clientHelloNames {
+		if err := handshake(ip, serverName, getClientHelloId(name), fragmentFor(ProbeSweep, true)); err != nil {
+			failed = append(failed, name)
+		} else {
+			passed = append(passed, name)
+		}
+	}
+	detail := fmt.Sprintf("%d/%d passed", len(passed), len(clientHelloNames))
+	if len(failed) > 0 {
+		detail += ", failed: " + strings.Join(failed, ", ")
+	}
+	return len(passed) > 0, detail
+}
+
+func diveKeepAlive(ip *net.IPAddr) (bool, string) {
+	if KeepAliveRequests <= 0 {
+		return true, "skipped"
+	}
+	latencies, reconnects := keepAliveHandler(ip)
+	if len(latencies) == 0 {
+		return false, diveFailure(ip)
+	}
+	parts := make([]string, len(latencies))
+	for i, l := range latencies {
+		parts[i] = fmt.Sprintf("%.2f", ms(l))
+	}
+	return reconnects == 0, fmt.Sprintf("%d/%d requests, %s ms, %d reconnects", len(latencies), KeepAliveRequests, strings.Join(parts, " "), reconnects)
+}
+
+func diveWarmUp(ip *net.IPAddr, serverName string) (bool, string) {
+	if WarmUpConns <= 0 {
+		return true, "skipped"
+	}
+	results, total := warmUpIP(ip, serverName)
+	passed := 0
+	for _, r := range results {
+		if r.ok {
+			passed++
+		}
+	}
+	detail := fmt.Sprintf("%d/%d parallel handshakes in %.2f ms", passed, len(results), ms(total))
+	if throttled(results) {
+		return false, detail + ", throttled after the first connections"
+	}
+	return passed > 0, detail
+}
+
+func diveDownload(ip *net.IPAddr) (bool, string) {
+	speed := downloadHandler(ip)
+	if speed == 0 {
+		return false, diveFailure(ip)
+	}
+	detail := fmt.Sprintf("%.2f MB/s", speed/1024/1024)
+	if status, age, ok := cacheStatusOf(ip); ok {
+		detail += fmt.Sprintf(", cf-cache-status %s, age %s", status, age)
+	}
+	return true, detail
+}
+
+// Version negotiation on UDP at the test port, without a handshake
+func diveQUIC(ip *net.IPAddr) (bool, string) {
+	if !QUIC {
+		return true, "skipped"
+	}
+	if viaClient != nil {
+		return true, "skipped, the SSH jump host only forwards TCP"
+	}
+	versions, rtt, err := quicProbe(ip, newRand())
+	if err != nil {
+		return false, fmt.Sprintf("UDP %d, failed: %v", TCPPort, err)
+	}
+	return true, fmt.Sprintf("UDP %d, %.2f ms, versions %s", TCPPort, ms(rtt), strings.Join(versions, " "))
+}
+
+func diveHTTP3(ip *net.IPAddr) (bool, string) {
+	speed, err := quicDownload(ip, newRand())
+	if err != nil {
+		return false, fmt.Sprintf("failed: %v", err)
+	}
+	return true, fmt.Sprintf("%.2f MB/s", speed/1024/1024)
+}
+
+func diveUpload(ip *net.IPAddr) (bool, string) {
+	speed := uploadSpeed(ip)
+	if speed == 0 {
+		return false, diveFailure(ip)
+	}
+	return true, fmt.Sprintf("%s, %.2f MB/s", utils.FormatSize(UploadSize), speed/1024/1024)
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
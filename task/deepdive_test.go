@@ -0,0 +1,63 @@
+package task
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestDeepDive(t *testing.T) {
+	server := testserver.New(testserver.Config{})
+	defer server.Close()
+	// The same edge over HTTP/3 at the same port on UDP
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: server.Port()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h3 := &http3.Server{Handler: server.Config.Handler, TLSConfig: &tls.Config{Certificates: server.TLS.Certificates}}
+	go func() { _ = h3.Serve(conn) }()
+	defer h3.Close()
+
+	defer func(u, upURL string, port, times, keepAlive, warmUp int, timeout time.Duration, disable, quic, upload, fingerprint bool, size int64) {
+		rootCAs, URL, UploadURL, TCPPort, PingTimes, KeepAliveRequests, WarmUpConns = nil, u, upURL, port, times, keepAlive, warmUp
+		Timeout, Disable, QUIC, Upload, TCPFingerprint, UploadSize = timeout, disable, quic, upload, fingerprint, size
+	}(URL, UploadURL, TCPPort, PingTimes, KeepAliveRequests, WarmUpConns, Timeout, Disable, QUIC, Upload, TCPFingerprint, UploadSize)
+	rootCAs = server.CertPool()
+	URL, UploadURL, TCPPort = server.DownloadURL(256<<10), "https://127.0.0.1/__up", server.Port()
+	PingTimes, KeepAliveRequests, WarmUpConns, Timeout = 2, 2, 2, time.Second
+	Disable, QUIC, Upload, TCPFingerprint, UploadSize = false, true, true, true, 256<<10
+	ip := &net.IPAddr{IP: net.ParseIP("127.0.0.1")}
+
+	steps := DeepDive(ip)
+	want := []string{"tcp", "stability", "tls", "http", "trace", "fingerprints", "keepalive", "warmup", "quic", "download", "http3", "upload"}
+	if len(steps) != len(want) {
+		t.Fatalf("steps = %v, want %v", steps, want)
+	}
+	for i, s := range steps {
+		if s.Probe != want[i] || !s.OK {
+			t.Errorf("step %d = %+v, want %s passing", i, s, want[i])
+		}
+	}
+	if !strings.Contains(steps[8].Detail, "versions") || !strings.HasSuffix(steps[10].Detail, "MB/s") {
+		t.Errorf("quic = %q, http3 = %q, want the versions and the speed", steps[8].Detail, steps[10].Detail)
+	}
+
+	// Without the transfer tests, against a closed port
+	Disable, QUIC, Upload = true, false, false
+	server.Close()
+	steps = DeepDive(ip)
+	if len(steps) != 9 {
+		t.Fatalf("steps = %v, want no transfer tests", steps)
+	}
+	if steps[0].OK || !strings.Contains(steps[0].Detail, "0/2 connections") {
+		t.Errorf("tcp = %+v, want it failing", steps[0])
+	}
+	if !steps[8].OK || steps[8].Detail != "skipped" {
+		t.Errorf("quic = %+v, want it skipped", steps[8])
+	}
+}
@@ -0,0 +1,139 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// SourceAddr is the local address probes are sent from, nil lets the system choose
+	SourceAddr *net.IPAddr
+	// LocalPorts is the range of local ports probes are sent from, nil lets the system choose
+	LocalPorts *PortRange
+
+	// Next port of LocalPorts to bind to
+	nextLocalPort atomic.Uint32
+)
+
+// PortRange is an inclusive range of ports
+type PortRange struct {
+	From, To int
+}
+
+// Size returns the number of ports in the range
+func (r *PortRange) Size() int {
+	return r.To - r.From + 1
+}
+
+// ParseSourceAddr parses a local IP to bind to, link-local IPv6 needs a zone such as fe80::1%eth0
+func ParseSourceAddr(s string) (*net.IPAddr, error) {
+	if s == "" {
+		return nil, nil
+	}
+	ip, zone := splitZone(s)
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, fmt.Errorf("invalid source address %q", s)
+	}
+	if parsed.IsLinkLocalUnicast() && parsed.To4() == nil && zone == "" {
+		return nil, fmt.Errorf("link-local source address %q needs a zone, e.g. %s%%eth0", s, ip)
+	}
+	return &net.IPAddr{IP: parsed, Zone: zone}, nil
+}
+
+// ParseLocalPorts parses a local port or port range such as 40000-40999
+func ParseLocalPorts(s string) (*PortRange, error) {
+	if s == "" {
+		return nil, nil
+	}
+	from, to, isRange := strings.Cut(s, "-")
+	if !isRange {
+		to = from
+	}
+	r := &PortRange{}
+	var err1, err2 error
+	r.From, err1 = strconv.Atoi(strings.TrimSpace(from))
+	r.To, err2 = strconv.Atoi(strings.TrimSpace(to))
+	if err1 != nil || err2 != nil || r.From < 1 || r.To > 65535 || r.From > r.To {
+		return nil, fmt.Errorf("invalid local port range %q, use a port or a range such as 40000-40999 within 1-65535", s)
+	}
+	return r, nil
+}
+
+// CheckPorts validates the remote test port
+func CheckPorts() error {
+	if TCPPort < 1 || TCPPort > 65535 {
+		return fmt.Errorf("invalid test port %d, use 1-65535", TCPPort)
+	}
+	return nil
+}
+
+// Dialer of probes, sending them through the jump host of Via when connected
+type probeDialer struct {
+	*net.Dialer
+}
+
+func (d probeDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := politeWait(ctx, address); err != nil {
+		return nil, err
+	}
+	if viaClient != nil {
+		return dialVia(ctx, d.Timeout, network, address)
+	}
+	if SourceRotate != nil && isIPv6Addr(address) {
+		dialer := *d.Dialer
+		SourceRotate.bind(&dialer)
+		conn, err := dialer.DialContext(ctx, network, address)
+		recordRotation(dialer.LocalAddr, err == nil)
+		return conn, err
+	}
+	return d.Dialer.DialContext(ctx, network, address)
+}
+
+func isIPv6Addr(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	ip := net.ParseIP(host)
+	return err == nil && ip != nil && ip.To4() == nil
+}
+
+func (d probeDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// Dialer bound to SourceAddr and the next port of LocalPorts when set, applying the socket options
+func newDialer(timeout time.Duration) probeDialer {
+	dialer := &net.Dialer{Timeout: timeout}
+	if SourceAddr != nil || LocalPorts != nil {
+		local := &net.TCPAddr{}
+		if SourceAddr != nil {
+			local.IP, local.Zone = SourceAddr.IP, SourceAddr.Zone
+		}
+		if LocalPorts != nil {
+			local.Port = LocalPorts.From + int(nextLocalPort.Add(1)-1)%LocalPorts.Size()
+		}
+		dialer.LocalAddr = local
+	}
+	if socketOptionsSet() {
+		dialer.Control = controlSocket
+	}
+	return probeDialer{dialer}
+}
+
+// Remote address of an IP: the IP on the test port, link-local IPv6 without a zone borrows the zone of the source address
+func remoteAddr(ip *net.IPAddr) *net.TCPAddr {
+	return remoteAddrOn(ip, TCPPort)
+}
+
+// remoteAddr on port
+func remoteAddrOn(ip *net.IPAddr, port int) *net.TCPAddr {
+	zone := ip.Zone
+	if zone == "" && SourceAddr != nil && ip.IP.IsLinkLocalUnicast() {
+		zone = SourceAddr.Zone
+	}
+	return &net.TCPAddr{IP: ip.IP, Port: port, Zone: zone}
+}
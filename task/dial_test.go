@@ -0,0 +1,89 @@
+package task
+
+import (
+	"net"
+	"testing"
+)
+
+func TestRemoteAddr(t *testing.T) {
+	oldPort, oldSource := TCPPort, SourceAddr
+	t.Cleanup(func() { TCPPort, SourceAddr = oldPort, oldSource })
+	TCPPort = 443
+
+	tests := []struct {
+		ip     *net.IPAddr
+		source string
+		want   string
+	}{
+		{ip: &net.IPAddr{IP: net.ParseIP("1.1.1.1")}, want: "1.1.1.1:443"},
+		{ip: &net.IPAddr{IP: net.ParseIP("2606:4700::1")}, want: "[2606:4700::1]:443"},
+		{ip: &net.IPAddr{IP: net.ParseIP("fe80::1"), Zone: "eth0"}, want: "[fe80::1%eth0]:443"},
+		{ip: &net.IPAddr{IP: net.ParseIP("fe80::1")}, source: "fe80::2%wlan0", want: "[fe80::1%wlan0]:443"},
+		{ip: &net.IPAddr{IP: net.ParseIP("2606:4700::1")}, source: "fe80::2%wlan0", want: "[2606:4700::1]:443"},
+		{ip: &net.IPAddr{IP: net.ParseIP("::ffff:1.1.1.1")}, want: "1.1.1.1:443"},
+	}
+	for _, tt := range tests {
+		var err error
+		if SourceAddr, err = ParseSourceAddr(tt.source); err != nil {
+			t.Fatal(err)
+		}
+		if got := remoteAddr(tt.ip).String(); got != tt.want {
+			t.Errorf("remoteAddr(%v) with source %q = %q, want %q", tt.ip, tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestParseSourceAddr(t *testing.T) {
+	for _, s := range []string{"fe80::1", "not-an-ip"} {
+		if _, err := ParseSourceAddr(s); err == nil {
+			t.Errorf("ParseSourceAddr(%q) accepted", s)
+		}
+	}
+}
+
+func TestParseLocalPorts(t *testing.T) {
+	tests := []struct {
+		in       string
+		from, to int
+	}{
+		{in: "40000-40999", from: 40000, to: 40999},
+		{in: "50000", from: 50000, to: 50000},
+		{in: " 1 - 65535 ", from: 1, to: 65535},
+	}
+	for _, tt := range tests {
+		r, err := ParseLocalPorts(tt.in)
+		if err != nil || r.From != tt.from || r.To != tt.to {
+			t.Errorf("ParseLocalPorts(%q) = %v, %v, want %d-%d", tt.in, r, err, tt.from, tt.to)
+		}
+	}
+	for _, in := range []string{"0", "65536", "2000-1000", "a-b", "1000-", "-"} {
+		if _, err := ParseLocalPorts(in); err == nil {
+			t.Errorf("ParseLocalPorts(%q) accepted", in)
+		}
+	}
+}
+
+func TestNewDialerLocalPorts(t *testing.T) {
+	oldPorts, oldSource := LocalPorts, SourceAddr
+	t.Cleanup(func() { LocalPorts, SourceAddr = oldPorts, oldSource })
+	SourceAddr = &net.IPAddr{IP: net.ParseIP("2001:db8::1")}
+	LocalPorts = &PortRange{From: 40000, To: 40002}
+	nextLocalPort.Store(0)
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, newDialer(0).LocalAddr.String())
+	}
+	want := []string{"[2001:db8::1]:40000", "[2001:db8::1]:40001", "[2001:db8::1]:40002", "[2001:db8::1]:40000"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("local addresses = %v, want %v", got, want)
+		}
+	}
+
+	// A port without a source address binds to any address
+	SourceAddr = nil
+	if got := newDialer(0).LocalAddr.String(); got != ":40001" {
+		t.Errorf("local address = %s, want :40001", got)
+	}
+}
@@ -0,0 +1,87 @@
+package task
+
+import (
+	"context"
+	"net"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+var (
+	// PerColo keeps at most this many results from each datacenter, 0 selects the global top results
+	PerColo = 0
+	// MaxPerSubnet keeps at most this many results from each /24 (IPv4) or /48 (IPv6), 0 is unlimited
+	MaxPerSubnet = 0
+)
+
+// Results taken from each colo and subnet so far, IPs sharing either usually share fate
+type diversity struct {
+	colos   map[string]int
+	subnets map[string]int
+}
+
+func newDiversity() *diversity {
+	return &diversity{colos: map[string]int{}, subnets: map[string]int{}}
+}
+
+func diversityEnabled() bool {
+	return PerColo > 0 || MaxPerSubnet > 0
+}
+
+// Reports whether the IP's colo and subnet still have room, detecting the colo first when unknown
+func (d *diversity) room(data *utils.CloudflareIPData) bool {
+	if MaxPerSubnet > 0 && d.subnets[subnetOf(data.IP)] >= MaxPerSubnet {
+		return false
+	}
+	if PerColo > 0 {
+		if data.Colo == "" {
+			data.Colo = detectColo(data)
+		}
+		return d.colos[data.Colo] < PerColo
+	}
+	return true
+}
+
+func (d *diversity) take(data *utils.CloudflareIPData) {
+	d.colos[data.Colo]++
+	d.subnets[subnetOf(data.IP)]++
+}
+
+// The /24 or /48 an IP belongs to
+func subnetOf(ip *net.IPAddr) string {
+	if v4 := ip.IP.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.IP.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// Colo of an IP from its /cdn-cgi/trace, cached with the enrichment data
+func detectColo(data *utils.CloudflareIPData) string {
+	if cached, ok := enrichCache.Load(data.IP.String()); ok {
+		return cached.(*enrichment).Colo
+	}
+	var e enrichment
+	if utils.Cache.Get(traceCacheKind, data.IP.String(), &e) {
+		return e.Colo
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), enrichTimeout)
+	defer cancel()
+	colo, _, _ := trace(ctx, data.IP)
+	return colo
+}
+
+// Keeps the first results that fit the colo and subnet limits, for when the download test is disabled
+func selectDiverse(ipSet utils.PingDelaySet) (data utils.DownloadSpeedSet) {
+	d := newDiversity()
+	for i := range ipSet {
+		if ipSet[i].Pinned {
+			data = append(data, ipSet[i])
+			continue
+		}
+		if d.room(&ipSet[i]) {
+			d.take(&ipSet[i])
+			data = append(data, ipSet[i])
+		}
+	}
+	return
+}
@@ -2,6 +2,7 @@ package task
 
 import (
 	"context"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"net"
@@ -12,35 +13,49 @@ import (
 
 	"github.com/Ptechgithub/CloudflareScanner/utils"
 	"github.com/VividCortex/ewma"
-	"github.com/hadi77ir/fragmenter"
 	utls "github.com/refraction-networking/utls"
 )
 
 const (
-	bufferSize                     = 1024
-	defaultURL                     = "https://cf.xiu2.xyz/url"
-	defaultTimeout                 = 10 * time.Second
-	defaultDisableDownload         = false
-	defaultTestNum                 = 10
-	defaultMinSpeed        float64 = 0.0
-	defaultHelloID                 = "chrome"
-	defaultFragmentEnabled         = false
+	bufferSize                      = 1024
+	defaultURL                      = "https://cf.xiu2.xyz/url"
+	defaultTimeout                  = 10 * time.Second
+	defaultHandshakeTimeout         = 5 * time.Second
+	defaultDisableDownload          = false
+	defaultTestNum                  = 10
+	defaultMinSpeed         float64 = 0.0
+	defaultHelloID                  = "chrome"
+	defaultFragmentEnabled          = false
+	defaultRawBytes                 = false
 )
 
 var (
-	defaultFragmentOptions *fragmenter.FragmentConfig = nil
+	defaultFragmentOptions *FragmentConfig = nil
+	// Certificate authorities trusted by the TLS dialer, nil uses the system pool (replaced in tests)
+	rootCAs *x509.CertPool
 )
 
 var (
-	URL             = defaultURL
-	Timeout         = defaultTimeout
-	Disable         = defaultDisableDownload
-	ClientHelloID   = defaultHelloID
-	FragmentEnabled = defaultFragmentEnabled
-	FragmentOptions = defaultFragmentOptions
+	URL              = defaultURL
+	Timeout          = defaultTimeout
+	HandshakeTimeout = defaultHandshakeTimeout
+	Disable          = defaultDisableDownload
+	ClientHelloID    = defaultHelloID
+	FragmentEnabled  = defaultFragmentEnabled
+	FragmentOptions  = defaultFragmentOptions
+	RawBytes         = defaultRawBytes
+	// SNI is the TLS server name of the probes, empty uses the host of the request address, which stays the Host header either way
+	SNI string
 
 	TestCount = defaultTestNum
 	MinSpeed  = defaultMinSpeed
+	// DownloadRoutines is the number of download tests run at once, sharing the line speed
+	DownloadRoutines = 1
+
+	// AbortAfter is the warm-up after which a download slower than AbortFraction of MinSpeed is abandoned, 0 never abandons
+	AbortAfter time.Duration
+	// AbortFraction of MinSpeed below which a download is abandoned after AbortAfter
+	AbortFraction = 0.5
 )
 
 func checkDownloadDefault() {
@@ -50,6 +65,9 @@ func checkDownloadDefault() {
 	if Timeout <= 0 {
 		Timeout = defaultTimeout
 	}
+	if HandshakeTimeout <= 0 {
+		HandshakeTimeout = defaultHandshakeTimeout
+	}
 	if TestCount <= 0 {
 		TestCount = defaultTestNum
 	}
@@ -58,72 +76,225 @@ func checkDownloadDefault() {
 	}
 }
 
-func TestDownloadSpeed(ipSet utils.PingDelaySet) (speedSet utils.DownloadSpeedSet) {
+// TestDownloadSpeed runs the download test of the command line
+func TestDownloadSpeed(ipSet utils.PingDelaySet) utils.DownloadSpeedSet {
 	checkDownloadDefault()
-	if Disable {
-		return utils.DownloadSpeedSet(ipSet)
+	return testDownloadSpeed(globalConfig(), ipSet)
+}
+
+func testDownloadSpeed(c *scanConfig, ipSet utils.PingDelaySet) (speedSet utils.DownloadSpeedSet) {
+	if c.disable {
+		ipSet = filterColos(ipSet)
+		if diversityEnabled() {
+			speedSet = selectDiverse(ipSet)
+		} else {
+			speedSet = utils.DownloadSpeedSet(ipSet)
+		}
+		// Without a download test the IPs qualify once the latency test is over
+		for i := range speedSet {
+			utils.StreamResult(&speedSet[i])
+		}
+		return speedSet
 	}
 	if len(ipSet) <= 0 {
-		fmt.Println("\n[Info] The number of delay test IP addresses is 0, skipping download speed test.")
+		c.println("\n[Info] The number of delay test IP addresses is 0, skipping download speed test.")
 		return
 	}
-	testNum := TestCount
-	if len(ipSet) < TestCount || MinSpeed > 0 {
+	ipSet = interleaveResults(ipSet)
+	testCount, testNum := c.testCount, c.testCount
+	if len(ipSet) < testCount || c.minSpeed > 0 || diversityEnabled() {
 		testNum = len(ipSet)
 	}
-	if testNum < TestCount {
-		TestCount = testNum
-	}
+	testCount = min(testCount, testNum)
 
-	fmt.Printf("Start download speed test (Minimum speed: %.2f MB/s, Number: %d, Queue: %d)\n", MinSpeed, TestCount, testNum)
+	switch {
+	case PerColo > 0:
+		c.printf("Start download speed test (Minimum speed: %.2f MB/s, Number: %d, Queue: %d, Per colo: %d)\n", c.minSpeed, testCount, testNum, PerColo)
+	case c.downloadThreads > 1:
+		c.printf("Start download speed test (Minimum speed: %.2f MB/s, Number: %d, Queue: %d, Threads: %d)\n", c.minSpeed, testCount, testNum, c.downloadThreads)
+	default:
+		c.printf("Start download speed test (Minimum speed: %.2f MB/s, Number: %d, Queue: %d)\n", c.minSpeed, testCount, testNum)
+	}
 	// Ensures that the length of the download speed progress bar matches the length of the latency progress bar (for OCD purposes)
 	bar_a := len(strconv.Itoa(len(ipSet)))
 	bar_b := "     "
 	for i := 0; i < bar_a; i++ {
 		bar_b += " "
 	}
-	bar := utils.NewBar(TestCount, bar_b, "")
-	for i := 0; i < testNum; i++ {
-		speed := downloadHandler(ipSet[i].IP)
+	bar := c.newBar(testCount, bar_b, "")
+	found := 0
+	diverse := newDiversity()
+	// Takes the download of an IP into the results, in queue order
+	take := func(i int, speed float64) {
 		ipSet[i].DownloadSpeed = speed
+		status, age, recorded := cacheStatusOf(ipSet[i].IP)
+		ipSet[i].CacheStatus, ipSet[i].CacheAge = status, age
+		ipSet[i].Resumption = resumptionOf(ipSet[i].IP)
+		if ipSet[i].Colo == "" {
+			ipSet[i].Colo = downloadColoOf(ipSet[i].IP)
+		}
+		if !coloAccepted(ipSet[i].Colo) && !ipSet[i].Pinned {
+			return
+		}
+		// A download of the wrong cache status says nothing about the IP
+		if recorded && !cacheAccepted(status) && !ipSet[i].Pinned {
+			return
+		}
+		if ja3, ja4 := helloFingerprintOf(ipSet[i].IP); ja3 != "" {
+			ipSet[i].JA3, ipSet[i].JA4 = ja3, ja4
+		}
+		if ech := echOf(ipSet[i].IP); ech != "" {
+			ipSet[i].ECH = ech
+		}
+		// Only results of the wanted ClientHello count
+		if !helloAccepted(ipSet[i].IP) && !ipSet[i].Pinned {
+			return
+		}
+		// The download test is the end-to-end validation of an IP
+		if speed == 0 {
+			ipSet[i].Error = ErrorClass(LastFailure(ipSet[i].IP))
+			utils.Reputation.Observe(ipSet[i].IP.String(), 0)
+			utils.Blocklist.Fail(ipSet[i].IP.String())
+		} else {
+			utils.Blocklist.Pass(ipSet[i].IP.String())
+		}
+		if ipSet[i].Pinned {
+			speedSet = append(speedSet, ipSet[i])
+			utils.StreamResult(&ipSet[i])
+			return
+		}
+		// Another download of the colo or subnet may have qualified while this one ran
+		if diversityEnabled() && !diverse.room(&ipSet[i]) {
+			return
+		}
 		// After measuring the download speed for each IP, filter the results based on the [minimum download speed] condition.
-		if speed >= MinSpeed*1024*1024 {
+		if speed >= c.minSpeed*1024*1024 {
 			bar.Grow(1, "")
 			speedSet = append(speedSet, ipSet[i])
-			if len(speedSet) == TestCount {
-				break
+			diverse.take(&ipSet[i])
+			utils.StreamResult(&ipSet[i])
+			found++
+		}
+	}
+
+	// Downloads run on a pool of workers and are taken in queue order, so the same IPs qualify as when testing one at a time;
+	// an IP is only started while the downloads running could still leave a result missing
+	routines := max(c.downloadThreads, 1)
+	jobs, done := make(chan int), make(chan int)
+	speeds := make([]float64, len(ipSet))
+	for w := 0; w < routines; w++ {
+		go func() {
+			for i := range jobs {
+				speeds[i] = c.download(ipSet[i].IP)
+				done <- i
 			}
+		}()
+	}
+	var running []int // Started downloads not yet taken, in queue order
+	finished := make([]bool, len(ipSet))
+	active, unpinned, tested := 0, 0, 0
+	next := 0
+	for {
+		for active < routines && next < len(ipSet) && c.ctx.Err() == nil { // Stops starting on a canceled scan
+			i := next
+			// Pinned IPs are always tested and kept, past the queue and regardless of the minimum speed
+			if !ipSet[i].Pinned {
+				if i >= testNum || found == testCount {
+					next++
+					continue
+				}
+				if found+unpinned >= testCount { // Enough downloads running, wait for their results
+					break
+				}
+				// IPs of a colo or subnet that already has enough results are not worth a download
+				if diversityEnabled() && !diverse.room(&ipSet[i]) {
+					next++
+					continue
+				}
+				// A colo HTTPing recorded spares the download of IPs outside [-colo]
+				if ipSet[i].Colo != "" && !coloAccepted(ipSet[i].Colo) {
+					next++
+					continue
+				}
+				unpinned++
+			}
+			next++
+			active++
+			running = append(running, i)
+			jobs <- i
+		}
+		if len(running) == 0 {
+			break
+		}
+		i := <-done
+		finished[i] = true
+		active--
+		tested++
+		for len(running) > 0 && finished[running[0]] {
+			j := running[0]
+			running = running[1:]
+			if !ipSet[j].Pinned {
+				unpinned--
+			}
+			take(j, speeds[j])
+		}
+		if routines > 1 {
+			bar.Grow(0, fmt.Sprintf("Tested: %d, Running: %d", tested, active))
 		}
 	}
+	close(jobs)
 	bar.Done()
-	if len(speedSet) == 0 {
-		speedSet = utils.DownloadSpeedSet(ipSet)
+	if found == 0 {
+		speedSet = utils.DownloadSpeedSet(keepColos(ipSet))
 	}
 	// Sorts the results by speed
 	sort.Sort(speedSet)
 	return
 }
 
-func getDialContext(ip *net.IPAddr) func(ctx context.Context, network, address string) (net.Conn, error) {
-	var fakeSourceAddr string
-	if isIPv4(ip.String()) {
-		fakeSourceAddr = fmt.Sprintf("%s:%d", ip.String(), TCPPort)
-	} else {
-		fakeSourceAddr = fmt.Sprintf("[%s]:%d", ip.String(), TCPPort)
-	}
+// Plain TCP dialer of ip for probe, the fragmentation of its connections is added to metrics when not nil
+func getDialContext(ip *net.IPAddr, probe string, metrics *FragmentMetrics) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return globalConfig().dialContext(ip, probe, metrics)
+}
+
+func (c *scanConfig) dialContext(ip *net.IPAddr, probe string, metrics *FragmentMetrics) func(ctx context.Context, network, address string) (net.Conn, error) {
+	// The request address only names the host, connections go to the tested IP
+	remote := remoteAddrOn(ip, c.port).String()
 	return func(ctx context.Context, network, address string) (net.Conn, error) {
-		return (&net.Dialer{}).DialContext(ctx, network, fakeSourceAddr)
+		conn, err := newDialer(0).DialContext(ctx, network, remote)
+		if err != nil {
+			return nil, err
+		}
+		recordRoute(conn)
+		if fragment := fragmentFor(probe, false); fragment != nil {
+			conn = fragmentConn(conn, fragment, metrics)
+		}
+		return conn, nil
+	}
+}
+
+// Speed in bytes per second below which a download is abandoned after AbortAfter, 0 never
+func (c *scanConfig) abortBelow() float64 {
+	if AbortAfter <= 0 || AbortAfter >= c.timeout {
+		return 0
 	}
+	return c.minSpeed * 1024 * 1024 * AbortFraction
 }
 
 // return download Speed
 func downloadHandler(ip *net.IPAddr) float64 {
+	return globalConfig().download(ip)
+}
+
+func (c *scanConfig) download(ip *net.IPAddr) float64 {
+	cacheStatuses.Delete(ip.IP.String())
+	downloadColos.Delete(ip.IP.String())
 	client := &http.Client{
 		Transport: &http.Transport{
-			DialContext:    getDialContext(ip),
-			DialTLSContext: getDialTLSContext(ip),
+			DialContext:        c.dialContext(ip, ProbeDownload, nil),
+			DialTLSContext:     c.dialTLSContext(ip, ProbeDownload, nil),
+			DisableCompression: RawBytes,
 		},
-		Timeout: Timeout,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			if len(via) > 10 {
 				return http.ErrUseLastResponse
@@ -134,30 +305,66 @@ func downloadHandler(ip *net.IPAddr) float64 {
 			return nil
 		},
 	}
-	req, err := http.NewRequest("GET", URL, nil)
+	// The handshake and the transfer are timed separately, so a slow handshake fails fast without shortening the measurement window
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+	handshakeTimer := time.AfterFunc(c.handshakeTimeout, cancel)
+
+	target := c.url
+	if cacheBusting() {
+		target = cacheBustURL(c.url)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
 	if err != nil {
 		return 0.0
 	}
+	if target != c.url {
+		req.Header.Set("Cache-Control", "no-cache")
+	}
 
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
+	if RawBytes { // Decompressed byte counts inflate the speed of compressible test files
+		req.Header.Set("Accept-Encoding", "identity")
+	}
 
 	response, err := client.Do(req)
 	if err != nil {
+		recordFailure(ip, probeError(ProbeDownload, err))
 		return 0.0
 	}
 	defer response.Body.Close()
+	if !handshakeTimer.Stop() { // The handshake timeout fired just as the response arrived
+		return 0.0
+	}
 	if response.StatusCode != 200 {
+		recordFailure(ip, statusError(ProbeDownload, response))
 		return 0.0
 	}
+	if !recordCacheStatus(ip, response.Header) { // Not the cache path the user wants to measure
+		return 0.0
+	}
+	if !recordColo(ip, response.Header) { // Outside [-colo], no need to measure
+		return 0.0
+	}
+	// Unblocks a stalled body read once the measurement window is over
+	transferTimer := time.AfterFunc(c.timeout, cancel)
+	defer transferTimer.Stop()
+	return measureSpeed(response.Body, response.ContentLength, c.timeout, c.abortBelow())
+}
+
+// Measures the download speed (bytes per second) of body within the time window.
+// contentLength is -1 when unknown (chunked, compressed or HTTP/1.0 close-delimited responses),
+// in which case the body is read until EOF or until the window ends.
+// Past AbortAfter, a speed below abortBelow (bytes per second, 0 never) ends the measurement early.
+func measureSpeed(body io.Reader, contentLength int64, window time.Duration, abortBelow float64) float64 {
 	timeStart := time.Now()
-	timeEnd := timeStart.Add(Timeout)
+	timeEnd := timeStart.Add(window)
 
-	contentLength := response.ContentLength
 	buffer := make([]byte, bufferSize)
 
 	var (
 		contentRead     int64 = 0
-		timeSlice             = Timeout / 100
+		timeSlice             = window / 100
 		timeCounter           = 1
 		lastContentRead int64 = 0
 	)
@@ -165,8 +372,15 @@ func downloadHandler(ip *net.IPAddr) float64 {
 	var nextTime = timeStart.Add(timeSlice * time.Duration(timeCounter))
 	e := ewma.NewMovingAverage()
 
-	// Continuously calculates; if the file download is complete (both are equal), exits the loop (terminates speed testing)
-	for contentLength != contentRead {
+	// Adds the data of the current, unfinished time slice scaled up to a full slice
+	addLastSlice := func() {
+		// Obtains the previous time slice
+		lastTimeSlice := timeStart.Add(timeSlice * time.Duration(timeCounter-1))
+		// Downloaded data amount / (current time - previous time slice / time slice)
+		e.Add(float64(contentRead-lastContentRead) / (float64(time.Since(lastTimeSlice)) / float64(timeSlice)))
+	}
+
+	for {
 		currentTime := time.Now()
 		if currentTime.After(nextTime) {
 			timeCounter++
@@ -178,64 +392,114 @@ func downloadHandler(ip *net.IPAddr) float64 {
 		if currentTime.After(timeEnd) {
 			break
 		}
-		bufferRead, err := response.Body.Read(buffer)
+		// Hopeless downloads don't need the whole window
+		if abortBelow > 0 && currentTime.Sub(timeStart) >= AbortAfter && e.Value()/(window.Seconds()/120) < abortBelow {
+			break
+		}
+		bufferRead, err := body.Read(buffer)
+		contentRead += int64(bufferRead)
 		if err != nil {
-			if err != io.EOF {
-				break
-			} else if contentLength == -1 {
-				break
+			// The file download is complete; any other error (reset, truncated body) keeps what was measured so far
+			if err == io.EOF {
+				addLastSlice()
 			}
-			// Obtains the previous time slice
-			last_time_slice := timeStart.Add(timeSlice * time.Duration(timeCounter-1))
-			// Downloaded data amount / (current time - previous time slice / time slice)
-			e.Add(float64(contentRead-lastContentRead) / (float64(currentTime.Sub(last_time_slice)) / float64(timeSlice)))
+			break
+		}
+		// The announced length has been read, no need to wait for EOF
+		if contentLength >= 0 && contentRead >= contentLength {
+			addLastSlice()
+			break
 		}
-		contentRead += int64(bufferRead)
 	}
-	return e.Value() / (Timeout.Seconds() / 120)
+	return e.Value() / (window.Seconds() / 120)
 }
 
-func getDialTLSContext(ip *net.IPAddr) func(ctx context.Context, network string, addr string) (net.Conn, error) {
-	var fakeSourceAddr string
-	if isIPv4(ip.String()) {
-		fakeSourceAddr = fmt.Sprintf("%s:%d", ip.String(), TCPPort)
-	} else {
-		fakeSourceAddr = fmt.Sprintf("[%s]:%d", ip.String(), TCPPort)
-	}
+// TLS dialer of ip for probe, the fragmentation of its connections is added to metrics when not nil
+func getDialTLSContext(ip *net.IPAddr, probe string, metrics *FragmentMetrics) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	return globalConfig().dialTLSContext(ip, probe, metrics)
+}
+
+func (c *scanConfig) dialTLSContext(ip *net.IPAddr, probe string, metrics *FragmentMetrics) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	remote := remoteAddrOn(ip, c.port).String()
 	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
-		dialer := &net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}
+		dialer := newDialer(30 * time.Second)
+		dialer.KeepAlive = 30 * time.Second
 
-		// Override the default TLS dialer
-		conn, err := dialer.DialContext(ctx, "tcp", fakeSourceAddr)
+		// addr carries the port of the request address, the SNI only needs the host
+		serverName, _, err := net.SplitHostPort(addr)
 		if err != nil {
-			return nil, fmt.Errorf("dial error: %v", err)
+			serverName = addr
 		}
-
-		// fragmenter support
-		if FragmentEnabled {
-			tcpConn, ok := conn.(*net.TCPConn)
-			if ok {
-				// Set TCP_NODELAY to true, to prevent kernel from reconstructing fragments
-				_ = tcpConn.SetNoDelay(true)
+		if SNI != "" {
+			serverName = SNI
+		}
+		config := &utls.Config{ServerName: serverName, RootCAs: rootCAs}
+		sessions := sessionsOf(ip, probe)
+		if sessions != nil {
+			config.ClientSessionCache = sessions.cache
+		}
+		// The server name goes in the encrypted inner ClientHello, the outer one names the public name of the ECH config
+		if echConfigList != nil {
+			config.EncryptedClientHelloConfigList = echConfigList
+		}
+		conn, err := dialTLSConfig(ctx, dialer, remote, config, getClientHelloId(c.hello), fragmentFor(probe, true), metrics)
+		recordECH(ip, conn, err)
+		if uConn, ok := conn.(*utls.UConn); ok {
+			recordHello(ip, uConn)
+			if sessions != nil {
+				sessions.record(ip, probe, uConn)
 			}
-			conn = fragmenter.WrapConn(conn, FragmentOptions)
 		}
+		return conn, err
+	}
+}
 
-		// Create a uTLS connection
-		uConn := utls.UClient(conn, &utls.Config{
-			ServerName: addr,
-		}, getClientHelloId(ClientHelloID))
+// Dials remote and performs a uTLS handshake with the hello fingerprint, fragmenting it when fragment is not nil
+func dialTLS(ctx context.Context, dialer probeDialer, remote, serverName string, hello utls.ClientHelloID, fragment *FragmentConfig, metrics *FragmentMetrics) (net.Conn, error) {
+	return dialTLSConfig(ctx, dialer, remote, &utls.Config{ServerName: serverName, RootCAs: rootCAs}, hello, fragment, metrics)
+}
+
+// dialTLS with the TLS config, e.g. with a session cache
+func dialTLSConfig(ctx context.Context, dialer probeDialer, remote string, config *utls.Config, hello utls.ClientHelloID, fragment *FragmentConfig, metrics *FragmentMetrics) (net.Conn, error) {
+	// Override the default TLS dialer
+	conn, err := dialer.DialContext(ctx, "tcp", remote)
+	if err != nil {
+		return nil, fmt.Errorf("dial error: %w", err)
+	}
+	recordRoute(conn)
+	return handshakeTLSConfig(ctx, conn, config, hello, fragment, metrics)
+}
 
-		// Perform the TLS handshake
-		if err := uConn.HandshakeContext(ctx); err != nil {
+// Performs a uTLS handshake over conn, closing it when the handshake fails
+func handshakeTLS(ctx context.Context, conn net.Conn, serverName string, hello utls.ClientHelloID, fragment *FragmentConfig, metrics *FragmentMetrics) (net.Conn, error) {
+	return handshakeTLSConfig(ctx, conn, &utls.Config{ServerName: serverName, RootCAs: rootCAs}, hello, fragment, metrics)
+}
+
+func handshakeTLSConfig(ctx context.Context, conn net.Conn, config *utls.Config, hello utls.ClientHelloID, fragment *FragmentConfig, metrics *FragmentMetrics) (net.Conn, error) {
+	// fragmenter support
+	if fragment != nil {
+		conn = fragmentConn(conn, fragment, metrics)
+	}
+
+	// Create a uTLS connection
+	uConn := utls.UClient(conn, config, hello)
+	if hello == utls.HelloCustom {
+		spec, err := newHelloSpec()
+		if err == nil {
+			err = uConn.ApplyPreset(spec)
+		}
+		if err != nil {
 			_ = conn.Close()
-			return nil, fmt.Errorf("TLS handshake error: %v", err)
+			return nil, fmt.Errorf("TLS handshake error: %w", err)
 		}
-		return conn, nil
 	}
+
+	// Perform the TLS handshake
+	if err := uConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("TLS handshake error: %w", err)
+	}
+	return uConn, nil
 }
 
 func getClientHelloId(id string) utls.ClientHelloID {
@@ -260,6 +524,10 @@ func getClientHelloId(id string) utls.ClientHelloID {
 		return utls.HelloRandomized
 	case "360":
 		return utls.Hello360_Auto
+	case HelloSpecID:
+		if helloSpecData != nil {
+			return utls.HelloCustom
+		}
 	}
 	return utls.HelloGolang
 }
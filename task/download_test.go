@@ -0,0 +1,309 @@
+package task
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const testBodySize = 256 * 1024
+
+// Points the download test at a local plain-HTTP server
+func useTestServer(t *testing.T, handler http.HandlerFunc) *net.IPAddr {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	addr := server.Listener.Addr().(*net.TCPAddr)
+	oldURL, oldPort, oldTimeout := URL, TCPPort, Timeout
+	t.Cleanup(func() { URL, TCPPort, Timeout = oldURL, oldPort, oldTimeout })
+	URL = server.URL + "/__down"
+	TCPPort = addr.Port
+	Timeout = 2 * time.Second
+	return &net.IPAddr{IP: addr.IP}
+}
+
+func TestDownloadHandler(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789abcdef"), testBodySize/16)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		// Speed check, nil when only a timely return matters
+		want func(speed float64) bool
+	}{
+		{
+			name: "content-length",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				_, _ = w.Write(body)
+			},
+			want: positive,
+		},
+		{
+			name: "chunked",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				for i := 0; i < len(body); i += 16 * 1024 {
+					_, _ = w.Write(body[i : i+16*1024])
+					w.(http.Flusher).Flush()
+				}
+			},
+			want: positive,
+		},
+		{
+			name: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "gzip")
+				gw := gzip.NewWriter(w)
+				_, _ = gw.Write(body)
+				_ = gw.Close()
+			},
+			want: positive,
+		},
+		{
+			name: "abruptly-closed",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				conn, buf, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: " + strconv.Itoa(len(body)*4) + "\r\n\r\n")
+				_, _ = buf.Write(body)
+				_ = buf.Flush()
+			},
+		},
+		{
+			name: "http-1.0-close-delimited",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				conn, buf, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				_, _ = buf.WriteString("HTTP/1.0 200 OK\r\n\r\n")
+				_, _ = buf.Write(body)
+				_ = buf.Flush()
+			},
+			want: positive,
+		},
+		{
+			name: "status-not-ok",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.NotFound(w, r)
+			},
+			want: func(speed float64) bool { return speed == 0 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip := useTestServer(t, tt.handler)
+			start := time.Now()
+			speed := downloadHandler(ip)
+			if elapsed := time.Since(start); elapsed > Timeout+HandshakeTimeout {
+				t.Errorf("download took %v, longer than the test window", elapsed)
+			}
+			if tt.want != nil && !tt.want(speed) {
+				t.Errorf("unexpected speed %v", speed)
+			}
+		})
+	}
+}
+
+func TestDownloadHandlerRawBytes(t *testing.T) {
+	ip := useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "identity" {
+			http.Error(w, "compressed response", http.StatusNotAcceptable)
+			return
+		}
+		_, _ = w.Write(bytes.Repeat([]byte{0}, testBodySize))
+	})
+	RawBytes = true
+	t.Cleanup(func() { RawBytes = defaultRawBytes })
+	if speed := downloadHandler(ip); speed <= 0 {
+		t.Errorf("speed = %v, want > 0", speed)
+	}
+}
+
+func TestMeasureSpeedUnknownLengthStopsAtWindow(t *testing.T) {
+	window := 500 * time.Millisecond
+	start := time.Now()
+	speed := measureSpeed(endlessReader{}, -1, window, 0)
+	if elapsed := time.Since(start); elapsed > 2*window {
+		t.Errorf("measurement took %v, want about %v", elapsed, window)
+	}
+	if speed <= 0 {
+		t.Errorf("speed = %v, want > 0", speed)
+	}
+}
+
+// Delivers a KB every 10ms, about 100 KB/s
+type slowReader struct{}
+
+func (slowReader) Read(p []byte) (int, error) {
+	time.Sleep(10 * time.Millisecond)
+	return min(len(p), 1024), nil
+}
+
+func TestMeasureSpeedAbortsHopelessDownload(t *testing.T) {
+	old := AbortAfter
+	t.Cleanup(func() { AbortAfter = old })
+	AbortAfter = 300 * time.Millisecond
+
+	window := 5 * time.Second
+	start := time.Now()
+	speed := measureSpeed(slowReader{}, -1, window, 10*1024*1024)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("hopeless download took %v, want it abandoned after about %v", elapsed, AbortAfter)
+	}
+	if speed <= 0 || speed >= 10*1024*1024 {
+		t.Errorf("speed = %v, want the slow speed measured so far", speed)
+	}
+
+	// Fast enough downloads run the whole window
+	window = 500 * time.Millisecond
+	start = time.Now()
+	measureSpeed(endlessReader{}, -1, window, 1024)
+	if elapsed := time.Since(start); elapsed < window {
+		t.Errorf("fast download ended after %v, before the %v window", elapsed, window)
+	}
+}
+
+func positive(speed float64) bool {
+	return speed > 0
+}
+
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func BenchmarkMeasureSpeed(b *testing.B) {
+	body := make([]byte, 4<<20)
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		measureSpeed(bytes.NewReader(body), int64(len(body)), time.Minute, 0)
+	}
+}
+
+func BenchmarkDownloadHandler(b *testing.B) {
+	body := make([]byte, 4<<20)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	addr := server.Listener.Addr().(*net.TCPAddr)
+	oldURL, oldPort := URL, TCPPort
+	defer func() { URL, TCPPort = oldURL, oldPort }()
+	URL, TCPPort = server.URL+"/__down", addr.Port
+	ip := &net.IPAddr{IP: addr.IP}
+
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		downloadHandler(ip)
+	}
+}
+
+func TestDownloadHandlerCacheBust(t *testing.T) {
+	var queries []string
+	ip := useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("cfscan"))
+		w.Write(bytes.Repeat([]byte{'x'}, 1024))
+	})
+	defer func(mode string) { CacheBust = mode }(CacheBust)
+	for _, mode := range []string{"on", "on", "auto", "off"} {
+		CacheBust = mode
+		downloadHandler(ip)
+	}
+	// Each download gets its own parameter, the local server isn't an origin for "auto"
+	if len(queries) != 4 || queries[0] == "" || queries[0] == queries[1] || queries[2] != "" || queries[3] != "" {
+		t.Errorf("cache busting parameters = %q", queries)
+	}
+}
+
+func TestIsOrigin(t *testing.T) {
+	defer func(u string) { URL = u }(URL)
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{url: "https://speed.cloudflare.com/__down?bytes=52428800", want: false},
+		{url: "https://127.0.0.1:8443/__down", want: false},
+		{url: "https://worker.example.com/file.bin", want: true},
+	}
+	for _, tt := range tests {
+		URL = tt.url
+		if got := IsOrigin(); got != tt.want {
+			t.Errorf("IsOrigin(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestTestDownloadSpeedRequireCache(t *testing.T) {
+	ip := useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("cf-cache-status", "MISS")
+		w.Header().Set("Age", "0")
+		w.Write(bytes.Repeat([]byte{'x'}, 1024))
+	})
+	defer func(require string) { RequireCache = require }(RequireCache)
+	data := func() utils.PingDelaySet {
+		return utils.PingDelaySet{{PingData: &utils.PingData{IP: ip, Sended: 1, Received: 1}}}
+	}
+
+	RequireCache = "miss"
+	result := TestDownloadSpeed(data())
+	if len(result) != 1 || result[0].DownloadSpeed <= 0 || result[0].CacheStatus != "MISS" || result[0].CacheAge != "0" {
+		t.Fatalf("accepted download = %+v", result)
+	}
+	RequireCache = "HIT"
+	if speed := downloadHandler(ip); speed != 0 {
+		t.Errorf("download with the wrong cache status measured %v", speed)
+	}
+}
+
+func TestDownloadSNI(t *testing.T) {
+	var names []string
+	var hosts []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+		w.Write(bytes.Repeat([]byte{'x'}, 1024))
+	}))
+	server.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		names = append(names, hello.ServerName)
+		return nil, nil
+	}}
+	server.StartTLS()
+	defer server.Close()
+	rootCAs = x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+
+	addr := server.Listener.Addr().(*net.TCPAddr)
+	defer func(u string, port int, sni string) { rootCAs, URL, TCPPort, SNI = nil, u, port, sni }(URL, TCPPort, SNI)
+	URL, TCPPort = "https://127.0.0.1/__down", addr.Port
+	ip := &net.IPAddr{IP: addr.IP}
+	downloadHandler(ip)
+	// The test certificate is for example.com and 127.0.0.1
+	SNI = "example.com"
+	downloadHandler(ip)
+	if len(names) != 2 || names[0] != "" || names[1] != "example.com" {
+		t.Errorf("server names = %q, want none for the IP address and then example.com", names)
+	}
+	if len(hosts) != 2 || hosts[1] != "127.0.0.1" {
+		t.Errorf("hosts = %q, want the URL host", hosts)
+	}
+}
@@ -0,0 +1,56 @@
+package task
+
+import (
+	"net"
+	"time"
+)
+
+// RangeCount is the number of IPs the latency test would probe in one range of the IP list
+type RangeCount struct {
+	Range string
+	IPs   int
+}
+
+// DryRun expands the IP list like a scan without any network I/O, returning the IPs of each range and the IPs to test
+// after the blocklist and the pinned IPs; the hostnames of [-hosts] are not resolved
+func DryRun() ([]RangeCount, []*net.IPAddr, error) {
+	checkPingDefault()
+	list, err := sourceRanges(globalConfig())
+	if err != nil {
+		return nil, nil, err
+	}
+	var counts []RangeCount
+	var ips []*net.IPAddr
+	for _, r := range list {
+		ranges := newIPRanges()
+		if err := ranges.add(r); err != nil {
+			return nil, nil, err
+		}
+		counts = append(counts, RangeCount{Range: r, IPs: len(ranges.ips)})
+		ips = append(ips, ranges.ips...)
+	}
+	return counts, addPinned(skipBlocked(ips)), nil
+}
+
+// EstimateDuration returns the worst-case duration of the latency and download tests of ipCount IPs,
+// every probe waiting for its timeout
+func EstimateDuration(ipCount int) (pingTime, downloadTime time.Duration) {
+	checkPingDefault()
+	checkDownloadDefault()
+	probes, timeout := PingTimes, tcpConnectTimeout
+	if Httping { // The first request checks the status code and colo
+		probes, timeout = PingTimes+1, httpingTimeout
+	}
+	// Routines IPs are tested at once
+	rounds := (ipCount + Routines - 1) / Routines
+	pingTime = time.Duration(rounds*probes) * timeout
+	if Disable {
+		return
+	}
+	testNum := TestCount
+	if MinSpeed > 0 || diversityEnabled() || testNum > ipCount {
+		testNum = ipCount
+	}
+	downloadTime = time.Duration(testNum) * (HandshakeTimeout + Timeout)
+	return
+}
@@ -0,0 +1,182 @@
+package task
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+const (
+	// ECHAuto fetches the ECH config from the HTTPS DNS record of the test host
+	ECHAuto = "auto"
+	// DNS record type of HTTPS records and the SvcParam key of their ECH config
+	dnsTypeHTTPS = 65
+	svcParamECH  = 5
+)
+
+var (
+	// ECH config list the TLS probes encrypt their ClientHello with, nil without [-ech]
+	echConfigList []byte
+	// ECH result of the last handshake with each IP: accepted or rejected
+	echResults sync.Map
+)
+
+// LoadECH sets the ECH config of the TLS probes from [-ech]: "auto" fetches it over DoH from the HTTPS record of the SNI or
+// the host of URL, other values are a base64 ECHConfigList or a file with one, in base64 or binary. An empty value turns ECH off.
+func LoadECH(value string) error {
+	echConfigList = nil
+	var list []byte
+	var err error
+	switch {
+	case value == "":
+		return nil
+	case value == ECHAuto:
+		host := SNI
+		if host == "" {
+			host = hostOf(URL)
+		}
+		list, err = fetchECHConfig(host)
+	default:
+		if data, readErr := os.ReadFile(value); readErr == nil {
+			if list, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err != nil {
+				list, err = data, nil
+			}
+		} else if list, err = base64.StdEncoding.DecodeString(value); err != nil {
+			return fmt.Errorf("%q is neither a base64 ECH config list nor a readable file", value)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkECHConfigList(list); err != nil {
+		return err
+	}
+	echConfigList = list
+	return nil
+}
+
+// An ECHConfigList is a length-prefixed list of ECHConfigs, each a version, a length and its contents
+func checkECHConfigList(list []byte) error {
+	if len(list) <= 2 || int(binary.BigEndian.Uint16(list)) != len(list)-2 {
+		return errors.New("invalid ECH config list")
+	}
+	for rest := list[2:]; len(rest) > 0; {
+		if len(rest) < 4 || len(rest) < 4+int(binary.BigEndian.Uint16(rest[2:])) {
+			return errors.New("invalid ECH config list, truncated config")
+		}
+		rest = rest[4+int(binary.BigEndian.Uint16(rest[2:])):]
+	}
+	return nil
+}
+
+// ECH config of host from its HTTPS record, resolved with DoHServer
+func fetchECHConfig(host string) ([]byte, error) {
+	client := &http.Client{Timeout: dohTimeout}
+	req, err := http.NewRequest("GET", DoHServer+"?"+url.Values{"name": {host}, "type": {fmt.Sprint(dnsTypeHTTPS)}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/dns-json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching the ECH config of %s: %w", host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching the ECH config of %s: DoH server answered %s", host, resp.Status)
+	}
+	var answer dohResponse
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("fetching the ECH config of %s: %w", host, err)
+	}
+	if answer.Status != 0 {
+		return nil, fmt.Errorf("fetching the ECH config of %s: DNS status %d", host, answer.Status)
+	}
+	for _, record := range answer.Answer {
+		if record.Type != dnsTypeHTTPS {
+			continue
+		}
+		if list := echParam(record.Data); list != nil {
+			return list, nil
+		}
+	}
+	return nil, fmt.Errorf("the HTTPS record of %s has no ECH config, give one to [-ech]", host)
+}
+
+// ECH config of an HTTPS record in presentation format (1 . alpn=h2 ech=AEX+...) or in the generic one (\# 71 0001...)
+func echParam(data string) []byte {
+	fields := strings.Fields(data)
+	if len(fields) > 2 && fields[0] == `\#` {
+		wire, err := hex.DecodeString(strings.Join(fields[2:], ""))
+		if err != nil {
+			return nil
+		}
+		return echParamWire(wire)
+	}
+	for _, field := range fields {
+		if value, ok := strings.CutPrefix(field, "ech="); ok {
+			if list, err := base64.StdEncoding.DecodeString(strings.Trim(value, `"`)); err == nil {
+				return list
+			}
+		}
+	}
+	return nil
+}
+
+// ECH SvcParam of the RDATA of an HTTPS record: priority, target name, then key, length and value of each param
+func echParamWire(rdata []byte) []byte {
+	if len(rdata) < 3 {
+		return nil
+	}
+	i := 2
+	for i < len(rdata) && rdata[i] != 0 { // Labels of the target name
+		i += 1 + int(rdata[i])
+	}
+	for i++; i+4 <= len(rdata); {
+		key, length := binary.BigEndian.Uint16(rdata[i:]), int(binary.BigEndian.Uint16(rdata[i+2:]))
+		if i+4+length > len(rdata) {
+			return nil
+		}
+		if key == svcParamECH {
+			return rdata[i+4 : i+4+length]
+		}
+		i += 4 + length
+	}
+	return nil
+}
+
+// Records whether the server of an IP accepted the encrypted ClientHello of a handshake, other failures leave no result
+func recordECH(ip *net.IPAddr, conn net.Conn, err error) {
+	if echConfigList == nil {
+		return
+	}
+	var rejection *utls.ECHRejectionError
+	if errors.As(err, &rejection) {
+		echResults.Store(ip.IP.String(), "rejected")
+	} else if uConn, ok := conn.(*utls.UConn); ok && err == nil {
+		if uConn.ConnectionState().ECHAccepted {
+			echResults.Store(ip.IP.String(), "accepted")
+		} else {
+			echResults.Store(ip.IP.String(), "rejected")
+		}
+	}
+}
+
+// ECH result of the last handshake with an IP, empty without one
+func echOf(ip *net.IPAddr) string {
+	if v, ok := echResults.Load(ip.IP.String()); ok {
+		return v.(string)
+	}
+	return ""
+}
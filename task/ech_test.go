@@ -0,0 +1,138 @@
+package task
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// An ECHConfigList of one X25519, HKDF-SHA256 and AES-128-GCM config for publicName, and its private key
+func testECHConfig(t *testing.T, publicName string) (list []byte, config []byte, key []byte) {
+	t.Helper()
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := priv.PublicKey().Bytes()
+	contents := []byte{1, 0x00, 0x20, byte(len(pub) >> 8), byte(len(pub))}
+	contents = append(contents, pub...)
+	contents = append(contents, 0, 4, 0x00, 0x01, 0x00, 0x01, 32, byte(len(publicName)))
+	contents = append(contents, publicName...)
+	contents = append(contents, 0, 0)
+	config = append([]byte{0xfe, 0x0d, byte(len(contents) >> 8), byte(len(contents))}, contents...)
+	list = append([]byte{byte(len(config) >> 8), byte(len(config))}, config...)
+	return list, config, priv.Bytes()
+}
+
+func TestLoadECH(t *testing.T) {
+	list, _, _ := testECHConfig(t, "public.example")
+	defer func() { echConfigList = nil }()
+
+	if err := LoadECH(base64.StdEncoding.EncodeToString(list)); err != nil || string(echConfigList) != string(list) {
+		t.Fatalf("base64 config = %x, %v", echConfigList, err)
+	}
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{"ech.txt": []byte(base64.StdEncoding.EncodeToString(list) + "\n"), "ech.bin": list} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		echConfigList = nil
+		if err := LoadECH(path); err != nil || string(echConfigList) != string(list) {
+			t.Errorf("%s: config = %x, %v", name, echConfigList, err)
+		}
+	}
+	for _, bad := range []string{"AAA=", base64.StdEncoding.EncodeToString(list[:len(list)-1]), filepath.Join(dir, "missing")} {
+		if err := LoadECH(bad); err == nil || echConfigList != nil {
+			t.Errorf("LoadECH(%q) = %v, config %x, want an error", bad, err, echConfigList)
+		}
+	}
+	if err := LoadECH(""); err != nil || echConfigList != nil {
+		t.Errorf("LoadECH(\"\") = %v, config %x, want ECH off", err, echConfigList)
+	}
+}
+
+func TestFetchECHConfig(t *testing.T) {
+	list, _, _ := testECHConfig(t, "public.example")
+	// RDATA of "1 . alpn=h2 ech=...": priority 1, the root as target name, alpn (key 1) and ech (key 5)
+	rdata := []byte{0, 1, 0, 0, 1, 0, 3, 2, 'h', '2', 0, 5, byte(len(list) >> 8), byte(len(list))}
+	rdata = append(rdata, list...)
+	answers := map[string]string{
+		"presentation.example": "1 . alpn=h3,h2 ipv4hint=104.16.1.1 ech=" + base64.StdEncoding.EncodeToString(list),
+		"generic.example":      fmt.Sprintf(`\# %d %s`, len(rdata), hex.EncodeToString(rdata)),
+		"plain.example":        "1 . alpn=h2",
+	}
+	var names []string
+	dns := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		names = append(names, name)
+		if r.URL.Query().Get("type") != "65" {
+			t.Errorf("query type = %s, want HTTPS", r.URL.Query().Get("type"))
+		}
+		fmt.Fprintf(w, `{"Status":0,"Answer":[{"type":65,"TTL":300,"data":%q}]}`, answers[name])
+	}))
+	defer dns.Close()
+	defer func(server, sni, u string) { DoHServer, SNI, URL, echConfigList = server, sni, u, nil }(DoHServer, SNI, URL)
+	DoHServer = dns.URL
+
+	URL, SNI = "https://presentation.example/__down", ""
+	if err := LoadECH(ECHAuto); err != nil || string(echConfigList) != string(list) {
+		t.Errorf("presentation format: config = %x, %v", echConfigList, err)
+	}
+	SNI = "generic.example"
+	if err := LoadECH(ECHAuto); err != nil || string(echConfigList) != string(list) {
+		t.Errorf("generic format: config = %x, %v", echConfigList, err)
+	}
+	SNI = "plain.example"
+	if err := LoadECH(ECHAuto); err == nil || echConfigList != nil {
+		t.Errorf("record without ech = %v, config %x, want an error", err, echConfigList)
+	}
+	if len(names) != 3 || names[0] != "presentation.example" || names[1] != "generic.example" {
+		t.Errorf("queried names = %q, want the URL host and then the SNI", names)
+	}
+}
+
+func TestECHHandshake(t *testing.T) {
+	list, config, key := testECHConfig(t, "public.example")
+	var inner []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{
+		EncryptedClientHelloKeys: []tls.EncryptedClientHelloKey{{Config: config, PrivateKey: key}},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			inner = append(inner, hello.ServerName)
+			return nil, nil
+		},
+	}
+	server.StartTLS()
+	defer server.Close()
+	rootCAs = x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+
+	addr := server.Listener.Addr().(*net.TCPAddr)
+	defer func(port int, sni string) { rootCAs, TCPPort, SNI, echConfigList = nil, port, sni, nil }(TCPPort, SNI)
+	// The test certificate is for example.com, the name of the inner ClientHello
+	TCPPort, SNI, echConfigList = addr.Port, "example.com", list
+	ip := &net.IPAddr{IP: addr.IP}
+	defer echResults.Delete(ip.IP.String())
+	conn, err := getDialTLSContext(ip, ProbeDownload, nil)(t.Context(), "tcp", "127.0.0.1:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if got := echOf(ip); got != "accepted" {
+		t.Errorf("ECH = %q, want accepted", got)
+	}
+	if len(inner) == 0 || inner[len(inner)-1] != "example.com" {
+		t.Errorf("server names = %q, want example.com from the inner ClientHello", inner)
+	}
+}
@@ -0,0 +1,181 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+	utls "github.com/refraction-networking/utls"
+)
+
+const (
+	defaultEnrichRoutines = 8
+	enrichTimeout         = 5 * time.Second
+	traceCacheKind        = "trace"
+	traceCacheTTL         = time.Hour // Colos of an IP rarely change within a daemon's cycles
+)
+
+var (
+	// EnrichCount is the number of finalists to collect PTR, trace, certificate and CF-RAY data for, 0 disables
+	EnrichCount    = 0
+	EnrichRoutines = defaultEnrichRoutines
+
+	// Enrichment results by IP, kept for the lifetime of the process
+	enrichCache sync.Map
+)
+
+// Exported fields for the disk cache
+type enrichment struct {
+	PTR   string `json:"ptr"`
+	Colo  string `json:"colo"`
+	CFRay string `json:"cf_ray"`
+	Cert  string `json:"cert"`
+	OCSP  string `json:"ocsp"`
+	CT    string `json:"ct"`
+}
+
+// Enrich collects extra data for the first EnrichCount results with a bounded worker pool
+func Enrich(data utils.DownloadSpeedSet) {
+	count := EnrichCount
+	if count > len(data) {
+		count = len(data)
+	}
+	if count <= 0 {
+		return
+	}
+	routines := EnrichRoutines
+	if routines <= 0 {
+		routines = defaultEnrichRoutines
+	}
+	utils.Printf("Start collecting PTR, trace and certificate data (Number: %d, Threads: %d)\n", count, routines)
+	bar := utils.NewBar(count, "", "")
+	jobs := make(chan int)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < routines; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				e := enrichIP(data[i].IP)
+				data[i].PTR, data[i].CFRay, data[i].Cert = e.PTR, e.CFRay, e.Cert
+				data[i].OCSP, data[i].CT = e.OCSP, e.CT
+				if data[i].Colo == "" {
+					data[i].Colo = e.Colo
+				}
+				bar.Grow(1, "")
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	bar.Done()
+}
+
+func enrichIP(ip *net.IPAddr) *enrichment {
+	if cached, ok := enrichCache.Load(ip.String()); ok {
+		return cached.(*enrichment)
+	}
+	e := &enrichment{}
+	if utils.Cache.Get(traceCacheKind, ip.String(), e) {
+		enrichCache.Store(ip.String(), e)
+		return e
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), enrichTimeout)
+	defer cancel()
+
+	// The reverse lookup and the trace request are independent
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if names, err := net.DefaultResolver.LookupAddr(ctx, ip.String()); err == nil && len(names) > 0 {
+			e.PTR = strings.TrimSuffix(names[0], ".")
+		}
+	}()
+	var state *utls.ConnectionState
+	e.Colo, e.CFRay, state = trace(ctx, ip)
+	if state != nil && len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		e.Cert = fmt.Sprintf("%s (issuer: %s, expires: %s)", certName(leaf.Subject, leaf.DNSNames), certName(leaf.Issuer, nil), leaf.NotAfter.Format("2006-01-02"))
+		if CertCheck {
+			e.OCSP, e.CT = ocspVerdict(state, time.Now()), ctVerdict(state)
+		}
+	}
+	wg.Wait()
+
+	enrichCache.Store(ip.String(), e)
+	// Failed traces are retried by the next run
+	if e.Colo != "" {
+		utils.Cache.Put(traceCacheKind, ip.String(), e, traceCacheTTL)
+	}
+	return e
+}
+
+// Requests /cdn-cgi/trace of the test host through the IP, returning the colo, CF-RAY and the TLS state
+func trace(ctx context.Context, ip *net.IPAddr) (colo, cfRay string, state *utls.ConnectionState) {
+	u, err := url.Parse(URL)
+	if err != nil {
+		return
+	}
+	dialTLS := getDialTLSContext(ip, ProbeTrace, nil)
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: getDialContext(ip, ProbeTrace, nil),
+			DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				conn, err := dialTLS(ctx, network, addr)
+				if uConn, ok := conn.(*utls.UConn); ok {
+					s := uConn.ConnectionState()
+					state = &s
+				}
+				return conn, err
+			},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.Scheme+"://"+u.Host+"/cdn-cgi/trace", nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	cfRay = resp.Header.Get("CF-RAY")
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if v, ok := strings.CutPrefix(scanner.Text(), "colo="); ok {
+			colo = v
+			break
+		}
+	}
+	return
+}
+
+// Common name of a certificate party, falling back to the first DNS name or organization
+func certName(name pkix.Name, dnsNames []string) string {
+	switch {
+	case name.CommonName != "":
+		return name.CommonName
+	case len(dnsNames) > 0:
+		return dnsNames[0]
+	case len(name.Organization) > 0:
+		return name.Organization[0]
+	}
+	return ""
+}
@@ -0,0 +1,165 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+	utls "github.com/refraction-networking/utls"
+)
+
+const probeTCPing = "tcping"
+
+// Classes of probe failures, test them with errors.Is
+var (
+	ErrConnectTimeout = errors.New("connect timeout")
+	ErrConnectRefused = errors.New("connection refused")
+	ErrTLSReset       = errors.New("TLS handshake reset")
+	ErrHTTPStatus     = errors.New("unexpected HTTP status")
+	ErrThrottled      = errors.New("throttled")
+	ErrECHRejected    = errors.New("ECH rejected")
+)
+
+// Names of the classes in results, logs and the API
+var errorClasses = []struct {
+	err  error
+	name string
+}{
+	{ErrConnectTimeout, "connect-timeout"},
+	{ErrConnectRefused, "connect-refused"},
+	{ErrTLSReset, "tls-reset"},
+	{ErrHTTPStatus, "http-status"},
+	{ErrThrottled, "throttled"},
+	{ErrECHRejected, "ech-rejected"},
+}
+
+// ProbeError is a failed probe of an IP, matching its class and its cause with errors.Is
+type ProbeError struct {
+	Probe string // e.g. tcping, httping or download
+	Class error  // One of the Err* classes, nil when unknown
+	Err   error
+
+	retryAfter time.Duration // Of the response, which polite mode honors
+}
+
+func (e *ProbeError) Error() string {
+	if e.Class == nil {
+		return fmt.Sprintf("%s: %v", e.Probe, e.Err)
+	}
+	return fmt.Sprintf("%s: %v: %v", e.Probe, e.Class, e.Err)
+}
+
+func (e *ProbeError) Unwrap() []error {
+	if e.Class == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Class, e.Err}
+}
+
+// Wraps the error of a probe in a ProbeError of its class
+func probeError(probe string, err error) *ProbeError {
+	return &ProbeError{Probe: probe, Class: classify(err), Err: err}
+}
+
+// Status error of an HTTP probe, 429 is throttling
+func statusError(probe string, resp *http.Response) *ProbeError {
+	class := ErrHTTPStatus
+	if resp.StatusCode == http.StatusTooManyRequests {
+		class = ErrThrottled
+	}
+	return &ProbeError{Probe: probe, Class: class, Err: errors.New(resp.Status), retryAfter: retryAfter(resp)}
+}
+
+func classify(err error) error {
+	for _, c := range errorClasses {
+		if errors.Is(err, c.err) {
+			return c.err
+		}
+	}
+	var netErr net.Error
+	timeout := errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+	tls := strings.Contains(err.Error(), "TLS handshake") || strings.Contains(err.Error(), "tls:")
+	var rejection *utls.ECHRejectionError
+	switch {
+	case errors.As(err, &rejection):
+		return ErrECHRejected
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrConnectRefused
+	// Handshakes cut off or stalled are interference with TLS rather than an unreachable IP
+	case tls && (timeout || errors.Is(err, context.Canceled) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)):
+		return ErrTLSReset
+	case timeout:
+		return ErrConnectTimeout
+	}
+	return nil
+}
+
+// ErrorClass names the class of err, e.g. tls-reset, "other" when it has none and "" for nil
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, c := range errorClasses {
+		if errors.Is(err, c.err) {
+			return c.name
+		}
+	}
+	return "other"
+}
+
+var (
+	// Last failure of each IP
+	lastFailures sync.Map
+	// Failures of each class during the run
+	failureCounts   = make(map[string]int)
+	failureCountsMu sync.Mutex
+)
+
+// Records a failed probe of an IP
+func recordFailure(ip *net.IPAddr, err *ProbeError) {
+	lastFailures.Store(ip.IP.String(), err)
+	politeBackOff(ip, err.retryAfter)
+	failureCountsMu.Lock()
+	failureCounts[ErrorClass(err)]++
+	failureCountsMu.Unlock()
+}
+
+// LastFailure returns the last failed probe of an IP, nil when none failed
+func LastFailure(ip *net.IPAddr) error {
+	if err, ok := lastFailures.Load(ip.IP.String()); ok {
+		return err.(*ProbeError)
+	}
+	return nil
+}
+
+// PrintFailures logs the number of failed probes of each class, most frequent first
+func PrintFailures() {
+	failureCountsMu.Lock()
+	defer failureCountsMu.Unlock()
+	if len(failureCounts) == 0 {
+		return
+	}
+	classes := make([]string, 0, len(failureCounts))
+	for class := range failureCounts {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		a, b := classes[i], classes[j]
+		return failureCounts[a] > failureCounts[b] || failureCounts[a] == failureCounts[b] && a < b
+	})
+	parts := make([]string, len(classes))
+	for i, class := range classes {
+		parts[i] = fmt.Sprintf("%s %d", class, failureCounts[class])
+	}
+	utils.Printf("[Info] Failed probes: %s\n", strings.Join(parts, ", "))
+}
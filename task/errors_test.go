@@ -0,0 +1,40 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestErrorClass(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: probeError(probeTCPing, refused), want: "connect-refused"},
+		{err: probeError(probeTCPing, &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}), want: "connect-timeout"},
+		{err: probeError(ProbeDownload, fmt.Errorf("dial error: %w", context.DeadlineExceeded)), want: "connect-timeout"},
+		{err: probeError(ProbeDownload, fmt.Errorf("TLS handshake error: %w", io.EOF)), want: "tls-reset"},
+		{err: probeError(ProbeDownload, fmt.Errorf("TLS handshake error: %w", syscall.ECONNRESET)), want: "tls-reset"},
+		{err: statusError(ProbeHTTPing, &http.Response{StatusCode: 403, Status: "403 Forbidden"}), want: "http-status"},
+		{err: statusError(ProbeHTTPing, &http.Response{StatusCode: 429, Status: "429 Too Many Requests"}), want: "throttled"},
+		{err: probeError(ProbeHTTPing, errors.New("malformed response")), want: "other"},
+		{err: nil, want: ""},
+	}
+	for _, tt := range tests {
+		if got := ErrorClass(tt.err); got != tt.want {
+			t.Errorf("ErrorClass(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+	// The cause stays reachable next to the class
+	if err := probeError(probeTCPing, refused); !errors.Is(err, ErrConnectRefused) || !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("%v doesn't match its class and cause", err)
+	}
+}
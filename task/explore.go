@@ -0,0 +1,80 @@
+package task
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+// Reputation from which a subnet counts as historically good
+const exploreGoodReputation = 0.5
+
+// Explore is the share of a sampled scan spent on subnets without reputation history (epsilon-greedy), the rest goes to
+// subnets that did well before, weighted by their reputation; negative samples uniformly
+var Explore = -1.0
+
+// CheckExplore validates [-explore]
+func CheckExplore() error {
+	if Explore > 1 {
+		return errors.New("-explore must be between 0 and 1, e.g. 0.2")
+	}
+	return nil
+}
+
+// Mean reputation of the tested IPs of each /24 (/48)
+func subnetReputations() map[string]float64 {
+	if utils.Reputation == nil {
+		return nil
+	}
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, r := range utils.Reputation.Top(0) {
+		ip := net.ParseIP(r.IP)
+		if ip == nil {
+			continue
+		}
+		subnet := subnetOf(&net.IPAddr{IP: ip})
+		sums[subnet] += r.Value()
+		counts[subnet]++
+	}
+	for subnet := range sums {
+		sums[subnet] /= float64(counts[subnet])
+	}
+	return sums
+}
+
+// Keeps n of the IPs, about 1-Explore of them from good subnets and Explore from unexplored ones; when either runs out
+// the other fills in, then the subnets that did badly
+func exploreSample(ips []*net.IPAddr, n int, reputations map[string]float64, r *rand.Rand) []*net.IPAddr {
+	var good, unexplored, bad []*net.IPAddr
+	keys := make(map[*net.IPAddr]float64)
+	for _, ip := range ips {
+		value, ok := reputations[subnetOf(ip)]
+		switch {
+		case !ok:
+			unexplored = append(unexplored, ip)
+		case value >= exploreGoodReputation:
+			good = append(good, ip)
+			keys[ip] = math.Pow(r.Float64(), 1/value) // Weighted random order (Efraimidis-Spirakis)
+		default:
+			bad = append(bad, ip)
+		}
+	}
+	sort.SliceStable(good, func(i, j int) bool { return keys[good[i]] > keys[good[j]] })
+	r.Shuffle(len(unexplored), func(i, j int) { unexplored[i], unexplored[j] = unexplored[j], unexplored[i] })
+	r.Shuffle(len(bad), func(i, j int) { bad[i], bad[j] = bad[j], bad[i] })
+
+	exploit := min(len(good), int(math.Round(float64(n)*(1-Explore))))
+	explore := min(len(unexplored), n-exploit)
+	exploit = min(len(good), n-explore)
+	kept := make([]*net.IPAddr, 0, n)
+	kept = append(kept, good[:exploit]...)
+	kept = append(kept, unexplored[:explore]...)
+	kept = append(kept, bad[:min(len(bad), n-len(kept))]...)
+	utils.Printf("[Info] Sampled %d IPs of good subnets, %d of unexplored ones and %d of the rest.\n", exploit, explore, len(kept)-exploit-explore)
+	return kept
+}
@@ -0,0 +1,36 @@
+package task
+
+import (
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestExploreSample(t *testing.T) {
+	defer func(e float64) { Explore = e }(Explore)
+	Explore = 0.25
+	var ips []*net.IPAddr
+	for _, prefix := range []string{"104.16.1.", "104.16.2.", "104.16.3."} {
+		for i := 1; i <= 20; i++ {
+			ips = append(ips, &net.IPAddr{IP: net.ParseIP(prefix + strconv.Itoa(i))})
+		}
+	}
+	reputations := map[string]float64{"104.16.1.0": 0.9, "104.16.2.0": 0.1}
+	count := func(kept []*net.IPAddr) map[string]int {
+		counts := map[string]int{}
+		for _, ip := range kept {
+			counts[subnetOf(ip)]++
+		}
+		return counts
+	}
+
+	counts := count(exploreSample(ips, 8, reputations, newRand()))
+	if counts["104.16.1.0"] != 6 || counts["104.16.3.0"] != 2 || counts["104.16.2.0"] != 0 {
+		t.Errorf("sample of 8 = %v, want 6 good and 2 unexplored", counts)
+	}
+	// Both run out, the bad subnet fills in
+	counts = count(exploreSample(ips, 50, reputations, newRand()))
+	if counts["104.16.1.0"] != 20 || counts["104.16.3.0"] != 20 || counts["104.16.2.0"] != 10 {
+		t.Errorf("sample of 50 = %v, want 20 good, 20 unexplored and 10 bad", counts)
+	}
+}
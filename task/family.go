@@ -0,0 +1,70 @@
+package task
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+// FamilyRatio is the share of IPv4 against IPv6 in the latency probe order and the download queue when both are scanned,
+// so a scan cut short still has results of both; 0 for a family puts it after the other
+var FamilyRatio = [2]int{1, 1}
+
+// ParseFamilyRatio parses a ratio of IPv4 to IPv6 such as 1:1 or 3:1
+func ParseFamilyRatio(s string) ([2]int, error) {
+	v4, v6, ok := strings.Cut(s, ":")
+	a, errA := strconv.Atoi(strings.TrimSpace(v4))
+	b, errB := strconv.Atoi(strings.TrimSpace(v6))
+	if !ok || errA != nil || errB != nil || a < 0 || b < 0 || a+b == 0 {
+		return FamilyRatio, fmt.Errorf("invalid family ratio %q, use IPv4:IPv6 such as 1:1 or 3:1", s)
+	}
+	return [2]int{a, b}, nil
+}
+
+// Interleaves the IPv4 and IPv6 items of list by FamilyRatio, starting with the family of the first item and keeping
+// the order within each family
+func interleave[T any](list []T, isIPv4 func(T) bool) []T {
+	var v4, v6 []T
+	for _, item := range list {
+		if isIPv4(item) {
+			v4 = append(v4, item)
+		} else {
+			v6 = append(v6, item)
+		}
+	}
+	if len(v4) == 0 || len(v6) == 0 {
+		return list
+	}
+	first, second := v4, v6
+	wFirst, wSecond := FamilyRatio[0], FamilyRatio[1]
+	if !isIPv4(list[0]) {
+		first, second = v6, v4
+		wFirst, wSecond = wSecond, wFirst
+	}
+	merged := make([]T, 0, len(list))
+	i, j := 0, 0
+	for i < len(first) && j < len(second) {
+		// The family furthest behind its share goes next
+		if wFirst > 0 && i*wSecond <= j*wFirst {
+			merged = append(merged, first[i])
+			i++
+		} else {
+			merged = append(merged, second[j])
+			j++
+		}
+	}
+	merged = append(merged, first[i:]...)
+	return append(merged, second[j:]...)
+}
+
+func interleaveIPs(ips []*net.IPAddr) []*net.IPAddr {
+	return interleave(ips, func(ip *net.IPAddr) bool { return ip.IP.To4() != nil })
+}
+
+// Orders the download queue by FamilyRatio, each family still by latency
+func interleaveResults(ipSet utils.PingDelaySet) utils.PingDelaySet {
+	return interleave(ipSet, func(data utils.CloudflareIPData) bool { return data.IP.IP.To4() != nil })
+}
@@ -0,0 +1,48 @@
+package task
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseFamilyRatio(t *testing.T) {
+	if r, err := ParseFamilyRatio("3:1"); err != nil || r != [2]int{3, 1} {
+		t.Errorf("3:1: got %v, %v", r, err)
+	}
+	for _, bad := range []string{"", "1", "0:0", "-1:2", "a:b"} {
+		if _, err := ParseFamilyRatio(bad); err == nil {
+			t.Errorf("%q: want an error", bad)
+		}
+	}
+}
+
+func TestInterleaveIPs(t *testing.T) {
+	var ips []*net.IPAddr
+	for _, s := range []string{"1.0.0.1", "1.0.0.2", "1.0.0.3", "1.0.0.4", "2606::1", "2606::2", "2606::3"} {
+		ips = append(ips, &net.IPAddr{IP: net.ParseIP(s)})
+	}
+	old := FamilyRatio
+	t.Cleanup(func() { FamilyRatio = old })
+
+	tests := []struct {
+		ratio [2]int
+		want  string
+	}{
+		{[2]int{1, 1}, "1.0.0.1 2606::1 1.0.0.2 2606::2 1.0.0.3 2606::3 1.0.0.4"},
+		{[2]int{2, 1}, "1.0.0.1 2606::1 1.0.0.2 1.0.0.3 2606::2 1.0.0.4 2606::3"},
+		{[2]int{1, 0}, "1.0.0.1 1.0.0.2 1.0.0.3 1.0.0.4 2606::1 2606::2 2606::3"},
+		{[2]int{0, 1}, "2606::1 2606::2 2606::3 1.0.0.1 1.0.0.2 1.0.0.3 1.0.0.4"},
+		{[2]int{1, 2}, "1.0.0.1 2606::1 2606::2 1.0.0.2 2606::3 1.0.0.3 1.0.0.4"},
+	}
+	for _, tc := range tests {
+		FamilyRatio = tc.ratio
+		var got []string
+		for _, ip := range interleaveIPs(ips) {
+			got = append(got, ip.String())
+		}
+		if strings.Join(got, " ") != tc.want {
+			t.Errorf("ratio %v: got %v, want %s", tc.ratio, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hadi77ir/fragmenter"
+)
+
+// The fragmenter reframes ClientHello chunks in a 1024 byte buffer with a 5 byte record header
+const maxFragmentLength = 1024 - 5
+
+// Built-in [-fragment] presets, used as preset:<name>
+var fragmentPresets = map[string]string{
+	// ClientHello split into TLS records of 10~20 bytes, sent in one segment
+	"tlshello": "0,1,10,20,0s,0s",
+	// ClientHello split into TLS records of 1~5 bytes, sent in one segment
+	"tlshello-small": "0,1,1,5,0s,0s",
+	// ClientHello split into TLS records of 10~20 bytes, each sent in its own segment 5~10ms apart
+	"tlshello-delayed": "0,1,10,20,5ms,10ms",
+	// ClientHello split into TLS records of 1~3 bytes, each sent in its own segment 10~20ms apart
+	"aggressive": "0,1,1,3,10ms,20ms",
+	// First three writes split into 5~10 byte segments 1~5ms apart
+	"first-packets": "1,3,5,10,1ms,5ms",
+	// ClientHello split into TLS records at the start, the middle and the end of the SNI hostname, sent in one segment
+	"sni-split": "mode=sni",
+	// ClientHello split around the SNI hostname, each record sent in its own segment 5~10ms apart
+	"sni-split-delayed": "0,1,10,20,5ms,10ms,mode=sni",
+}
+
+// FragmentConfig is a fragmenter config with the mode of [-fragment]
+type FragmentConfig struct {
+	fragmenter.FragmentConfig
+	// SNI splits the ClientHello around its SNI hostname (mode=sni) instead of into random lengths, with the delays of
+	// the config between the records
+	SNI bool
+}
+
+// Probes with connections that can be fragmented
+const (
+	ProbeHTTPing   = "httping"
+	ProbeDownload  = "download"
+	ProbeTrace     = "trace"
+	ProbeKeepAlive = "keepalive"
+	ProbeSweep     = "sweep"
+	ProbeWarmUp    = "warmup"
+	ProbeWaterfall = "waterfall"
+	ProbeUpload    = "upload"
+)
+
+var fragmentProbes = []string{ProbeHTTPing, ProbeDownload, ProbeTrace, ProbeKeepAlive, ProbeSweep, ProbeWarmUp, ProbeWaterfall, ProbeUpload}
+
+var (
+	// FragmentProbes are the probes fragmenting their connections when fragmentation is enabled
+	FragmentProbes = map[string]bool{ProbeHTTPing: true, ProbeDownload: true, ProbeTrace: true, ProbeKeepAlive: true, ProbeSweep: true, ProbeWarmUp: true, ProbeWaterfall: true, ProbeUpload: true}
+	// FragmentPlain fragments plain TCP connections as well as TLS ones, e.g. HTTPing on port 80
+	FragmentPlain bool
+)
+
+// FragmentPresetsFile is a JSON object of preset names to [-fragment] values, its presets take precedence over the built-in ones
+var FragmentPresetsFile string
+
+// ParseFragmentOptions parses the [-fragment] value, "none" disables fragmentation and returns nil, preset:<name> uses a preset.
+// A mode=sni item splits the ClientHello around its SNI hostname instead, with the delays of the options between the records.
+// Values the fragmenter would panic or stall on are rejected.
+func ParseFragmentOptions(opts string) (*FragmentConfig, error) {
+	if opts == "" || opts == "none" {
+		return nil, nil
+	}
+	if name, ok := strings.CutPrefix(opts, "preset:"); ok {
+		var err error
+		if opts, err = fragmentPreset(name); err != nil {
+			return nil, err
+		}
+	}
+	sni := false
+	var values []string
+	for _, part := range strings.Split(opts, ",") {
+		if mode, ok := strings.CutPrefix(part, "mode="); ok {
+			if mode != "sni" {
+				return nil, fmt.Errorf("unknown fragment mode %q, use mode=sni", mode)
+			}
+			sni = true
+			continue
+		}
+		values = append(values, part)
+	}
+	if opts = strings.Join(values, ","); opts == "" {
+		opts = "0,1"
+	}
+	parsed, err := fragmenter.ParseConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	config := &FragmentConfig{FragmentConfig: *parsed, SNI: sni}
+	// fragmenter.ParseConfig stores delayMax in IntervalMin
+	if parts := strings.Split(opts, ","); len(parts) > 5 {
+		config.IntervalMin, _ = time.ParseDuration(parts[4])
+		config.IntervalMax, _ = time.ParseDuration(parts[5])
+	}
+	switch {
+	case config.PacketsFrom < 0 || config.PacketsTo < config.PacketsFrom:
+		return nil, fmt.Errorf("invalid packet range: %d~%d", config.PacketsFrom, config.PacketsTo)
+	case config.LengthMin <= 0 || config.LengthMax < config.LengthMin || config.LengthMax > maxFragmentLength:
+		return nil, fmt.Errorf("invalid chunk size range: %d~%d (1~%d)", config.LengthMin, config.LengthMax, maxFragmentLength)
+	case config.IntervalMin < 0 || config.IntervalMax < config.IntervalMin:
+		return nil, fmt.Errorf("invalid delay range: %v~%v", config.IntervalMin, config.IntervalMax)
+	case sni && (config.PacketsFrom != 0 || config.PacketsTo != 1):
+		return nil, errors.New("mode=sni splits the ClientHello, its packet range is 0,1")
+	}
+	return config, nil
+}
+
+// ParseFragmentProbes parses the [-fragment-probes] list, "all" selects every probe
+func ParseFragmentProbes(list string) (map[string]bool, error) {
+	probes := map[string]bool{}
+	for _, probe := range strings.Split(list, ",") {
+		switch probe = strings.TrimSpace(probe); {
+		case probe == "":
+		case probe == "all":
+			for _, p := range fragmentProbes {
+				probes[p] = true
+			}
+		case slices.Contains(fragmentProbes, probe):
+			probes[probe] = true
+		default:
+			return nil, fmt.Errorf("unknown fragment probe %q, use %s or all", probe, strings.Join(fragmentProbes, ", "))
+		}
+	}
+	return probes, nil
+}
+
+// Fragment options of a probe's TLS or plain TCP connections, nil when they aren't fragmented
+func fragmentFor(probe string, tls bool) *FragmentConfig {
+	if !FragmentEnabled || !FragmentProbes[probe] || !tls && !FragmentPlain {
+		return nil
+	}
+	return FragmentOptions
+}
+
+// Wraps conn with the fragmenter, recording what it adds in metrics when not nil
+func fragmentConn(conn net.Conn, config *FragmentConfig, metrics *FragmentMetrics) net.Conn {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		// Set TCP_NODELAY to true, to prevent kernel from reconstructing fragments
+		_ = tcpConn.SetNoDelay(true)
+	}
+	return wrapFragmented(conn, config, metrics)
+}
+
+// FormatFragmentOptions returns config as a [-fragment] value
+func FormatFragmentOptions(config *FragmentConfig) string {
+	if config == nil {
+		return "none"
+	}
+	if config.SNI {
+		return fmt.Sprintf("%d,%d,%d,%d,%v,%v,mode=sni", config.PacketsFrom, config.PacketsTo, config.LengthMin, config.LengthMax, config.IntervalMin, config.IntervalMax)
+	}
+	return fmt.Sprintf("%d,%d,%d,%d,%v,%v", config.PacketsFrom, config.PacketsTo, config.LengthMin, config.LengthMax, config.IntervalMin, config.IntervalMax)
+}
+
+// SaveFragmentPreset adds or replaces a preset in FragmentPresetsFile
+func SaveFragmentPreset(name string, config *FragmentConfig) error {
+	if FragmentPresetsFile == "" {
+		return errors.New("no fragment presets file")
+	}
+	presets, err := loadFragmentPresets()
+	if err != nil {
+		return err
+	}
+	presets[name] = FormatFragmentOptions(config)
+	data, err := json.MarshalIndent(presets, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := FragmentPresetsFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, FragmentPresetsFile)
+}
+
+// Options of a preset from FragmentPresetsFile or the built-in ones
+func fragmentPreset(name string) (string, error) {
+	presets, err := loadFragmentPresets()
+	if err != nil {
+		return "", err
+	}
+	if opts, ok := presets[name]; ok {
+		return opts, nil
+	}
+	if opts, ok := fragmentPresets[name]; ok {
+		return opts, nil
+	}
+	names := make([]string, 0, len(fragmentPresets)+len(presets))
+	for n := range fragmentPresets {
+		names = append(names, n)
+	}
+	for n := range presets {
+		if _, ok := fragmentPresets[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("unknown fragment preset %q, available: %s", name, strings.Join(names, ", "))
+}
+
+// User presets, a missing file has none
+func loadFragmentPresets() (map[string]string, error) {
+	presets := map[string]string{}
+	if FragmentPresetsFile == "" {
+		return presets, nil
+	}
+	data, err := os.ReadFile(FragmentPresetsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return presets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &presets); err != nil {
+		return nil, fmt.Errorf("%s: %v", FragmentPresetsFile, err)
+	}
+	return presets, nil
+}
@@ -0,0 +1,311 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hadi77ir/fragmenter"
+)
+
+// A minimal TLS handshake record carrying a ClientHello-sized payload
+func testHelloRecord() []byte {
+	payload := bytes.Repeat([]byte{0x42}, 512)
+	return append([]byte{22, 3, 1, byte(len(payload) >> 8), byte(len(payload))}, payload...)
+}
+
+func FuzzParseFragmentOptions(f *testing.F) {
+	for _, seed := range []string{"none", "0,1,10,20,10ms,15ms", "1,3,5,10", "0,1,1,1019", "2,1", "0,1,-5,-1", "0,1,10,2000", "mode=sni", "1,1,mode=sni"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, opts string) {
+		config, err := ParseFragmentOptions(opts)
+		if err != nil || config == nil {
+			return
+		}
+		// Accepted options must be safe to write a ClientHello with; delays are dropped to keep the fuzzer fast
+		noDelay := *config
+		noDelay.IntervalMin, noDelay.IntervalMax = 0, 0
+		var out bytes.Buffer
+		var w io.Writer = &sniSplitter{w: &out, config: &noDelay}
+		if !noDelay.SNI {
+			w = fragmenter.WrapWriter(&out, &noDelay.FragmentConfig)
+		}
+		if _, err := w.Write(testHelloRecord()); err != nil {
+			t.Fatalf("write with %q: %v", opts, err)
+		}
+		if out.Len() < len(testHelloRecord()) {
+			t.Fatalf("write with %q lost data: %d bytes out", opts, out.Len())
+		}
+	})
+}
+
+func TestParseFragmentOptionsPresets(t *testing.T) {
+	for name, opts := range fragmentPresets {
+		if _, err := ParseFragmentOptions(opts); err != nil {
+			t.Errorf("preset %s (%s): %v", name, opts, err)
+		}
+	}
+
+	old := FragmentPresetsFile
+	t.Cleanup(func() { FragmentPresetsFile = old })
+	FragmentPresetsFile = filepath.Join(t.TempDir(), "presets.json")
+	if err := os.WriteFile(FragmentPresetsFile, []byte(`{"my-isp": "0,1,2,4,1ms,3ms", "aggressive": "0,1,7,9"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := ParseFragmentOptions("preset:my-isp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fragmenter.FragmentConfig{PacketsFrom: 0, PacketsTo: 1, LengthMin: 2, LengthMax: 4, IntervalMin: time.Millisecond, IntervalMax: 3 * time.Millisecond}
+	if config.FragmentConfig != want || config.SNI {
+		t.Errorf("preset:my-isp = %+v, want %+v", *config, want)
+	}
+	// User presets override the built-in ones
+	if config, err := ParseFragmentOptions("preset:aggressive"); err != nil || config.LengthMin != 7 {
+		t.Errorf("preset:aggressive = %+v, %v, want the user preset", config, err)
+	}
+	if _, err := ParseFragmentOptions("preset:nope"); err == nil || !strings.Contains(err.Error(), "my-isp") {
+		t.Errorf("unknown preset error = %v, want the available presets listed", err)
+	}
+}
+
+func TestSaveFragmentPreset(t *testing.T) {
+	old := FragmentPresetsFile
+	t.Cleanup(func() { FragmentPresetsFile = old })
+	FragmentPresetsFile = filepath.Join(t.TempDir(), "presets.json")
+
+	want := &FragmentConfig{FragmentConfig: fragmenter.FragmentConfig{PacketsFrom: 0, PacketsTo: 1, LengthMin: 4, LengthMax: 9, IntervalMin: 23 * time.Millisecond, IntervalMax: 23 * time.Millisecond}}
+	if err := SaveFragmentPreset("tuned", want); err != nil {
+		t.Fatal(err)
+	}
+	config, err := ParseFragmentOptions("preset:tuned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *config != *want {
+		t.Errorf("saved preset = %+v, want %+v", *config, *want)
+	}
+}
+
+func TestFragmentedConnMetrics(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         string
+		data         []byte
+		chunks       int64
+		delayed      int64
+		sleepAtLeast time.Duration
+		sleepAtMost  time.Duration
+	}{
+		// Records are gathered into one write without delays
+		{name: "tls hello", opts: "0,1,10,20,0s,0s", data: testHelloRecord(), sleepAtMost: 0},
+		// 4+4+2 bytes, each chunk followed by a 2ms delay
+		{name: "data", opts: "1,1,4,4,2ms,2ms", data: []byte("0123456789"), chunks: 3, delayed: 6, sleepAtLeast: 6 * time.Millisecond, sleepAtMost: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseFragmentOptions(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, server := net.Pipe()
+			defer server.Close()
+			go func() { _, _ = io.Copy(io.Discard, server) }()
+			var m FragmentMetrics
+			conn := wrapFragmented(client, config, &m)
+			defer conn.Close()
+			if _, err := conn.Write(tt.data); err != nil {
+				t.Fatal(err)
+			}
+			if m.Chunks() != tt.chunks || m.BytesDelayed() != tt.delayed {
+				t.Errorf("chunks, delayed = %d, %d, want %d, %d", m.Chunks(), m.BytesDelayed(), tt.chunks, tt.delayed)
+			}
+			if m.Sleep() < tt.sleepAtLeast || m.Sleep() > tt.sleepAtMost {
+				t.Errorf("sleep = %v, want %v~%v", m.Sleep(), tt.sleepAtLeast, tt.sleepAtMost)
+			}
+			if FragmentTotals().Chunks() < m.Chunks() {
+				t.Errorf("totals missed the connection's chunks")
+			}
+		})
+	}
+}
+
+func TestFragmentFor(t *testing.T) {
+	oldEnabled, oldOptions, oldProbes, oldPlain := FragmentEnabled, FragmentOptions, FragmentProbes, FragmentPlain
+	t.Cleanup(func() {
+		FragmentEnabled, FragmentOptions, FragmentProbes, FragmentPlain = oldEnabled, oldOptions, oldProbes, oldPlain
+	})
+
+	probes, err := ParseFragmentProbes("httping, download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	FragmentEnabled, FragmentOptions, FragmentProbes = true, &FragmentConfig{FragmentConfig: fragmenter.FragmentConfig{PacketsTo: 1, LengthMin: 1, LengthMax: 1}}, probes
+	tests := []struct {
+		probe string
+		tls   bool
+		plain bool
+		want  bool
+	}{
+		{probe: ProbeHTTPing, tls: true, want: true},
+		{probe: ProbeHTTPing, tls: false, want: false},
+		{probe: ProbeHTTPing, tls: false, plain: true, want: true},
+		{probe: ProbeDownload, tls: true, want: true},
+		{probe: ProbeTrace, tls: true, want: false},
+		{probe: ProbeKeepAlive, tls: false, plain: true, want: false},
+	}
+	for _, tt := range tests {
+		FragmentPlain = tt.plain
+		if got := fragmentFor(tt.probe, tt.tls) != nil; got != tt.want {
+			t.Errorf("fragmentFor(%s, tls %v) with plain %v = %v, want %v", tt.probe, tt.tls, tt.plain, got, tt.want)
+		}
+	}
+
+	if probes, err := ParseFragmentProbes("all"); err != nil || len(probes) != len(fragmentProbes) {
+		t.Errorf("ParseFragmentProbes(all) = %v, %v", probes, err)
+	}
+	if _, err := ParseFragmentProbes("tcping"); err == nil {
+		t.Error("ParseFragmentProbes(tcping) accepted")
+	}
+}
+
+// The ClientHello record crypto/tls sends to serverName
+func testClientHello(t *testing.T, serverName string) []byte {
+	t.Helper()
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		_ = tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true}).Handshake()
+		client.Close()
+	}()
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(server, header); err != nil {
+		t.Fatal(err)
+	}
+	record := make([]byte, 5+int(binary.BigEndian.Uint16(header[3:])))
+	copy(record, header)
+	if _, err := io.ReadFull(server, record[5:]); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestParseFragmentOptionsSNI(t *testing.T) {
+	config, err := ParseFragmentOptions("0,1,10,20,5ms,10ms,mode=sni")
+	if err != nil || !config.SNI {
+		t.Fatalf("mode=sni = %+v, %v", config, err)
+	}
+	if got := FormatFragmentOptions(config); got != "0,1,10,20,5ms,10ms,mode=sni" {
+		t.Errorf("FormatFragmentOptions = %q, want the options back", got)
+	}
+	if config, err := ParseFragmentOptions("preset:sni-split"); err != nil || !config.SNI || config.IntervalMax != 0 {
+		t.Errorf("preset:sni-split = %+v, %v", config, err)
+	}
+	if config, err := ParseFragmentOptions("0,1,10,20"); err != nil || config.SNI {
+		t.Errorf("options without a mode = %+v, %v, want random lengths", config, err)
+	}
+	for _, bad := range []string{"1,3,mode=sni", "mode=tcp"} {
+		if _, err := ParseFragmentOptions(bad); err == nil {
+			t.Errorf("ParseFragmentOptions(%q) accepted", bad)
+		}
+	}
+}
+
+func TestSNISplitter(t *testing.T) {
+	const host = "speed.cloudflare.com"
+	hello := testClientHello(t, host)
+	start, end, ok := sniRange(hello)
+	if !ok || string(hello[start:end]) != host {
+		t.Fatalf("sniRange = %d, %d, %v, want the offsets of %s", start, end, ok, host)
+	}
+
+	config, err := ParseFragmentOptions("mode=sni")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	w := &sniSplitter{w: &out, config: config}
+	if n, err := w.Write(append(hello, "after"...)); err != nil || n != len(hello)+5 {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	var payload []byte
+	var records []string
+	rest := out.Bytes()
+	for len(rest) >= 5 && rest[0] == 22 {
+		l := 5 + int(binary.BigEndian.Uint16(rest[3:]))
+		records = append(records, string(rest[5:l]))
+		payload = append(payload, rest[5:l]...)
+		rest = rest[l:]
+	}
+	if len(records) != 4 || string(payload) != string(hello[5:]) || string(rest) != "after" {
+		t.Fatalf("%d records of %d bytes and %q after, want 4 records of the ClientHello and the rest unchanged", len(records), len(payload), rest)
+	}
+	for i, r := range records {
+		if strings.Contains(r, host) {
+			t.Errorf("record %d carries the whole hostname", i)
+		}
+	}
+	if !strings.HasSuffix(records[1]+records[2], host) || !strings.HasPrefix(records[2], host[len(host)/2:]) {
+		t.Errorf("records %q, %q, want the two halves of the hostname", records[1], records[2])
+	}
+	if _, err := w.Write(hello); err != nil || !bytes.HasSuffix(out.Bytes(), hello) {
+		t.Errorf("a later write was changed")
+	}
+
+	// With delays every record is a write of its own
+	config, err = ParseFragmentOptions("0,1,10,20,1ms,1ms,mode=sni")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() { _, _ = io.Copy(io.Discard, server) }()
+	var m FragmentMetrics
+	conn := wrapFragmented(client, config, &m)
+	defer conn.Close()
+	if _, err := conn.Write(hello); err != nil {
+		t.Fatal(err)
+	}
+	if m.Chunks() != 4 || m.Sleep() < 3*time.Millisecond {
+		t.Errorf("chunks, sleep = %d, %v, want 4 writes 1ms apart", m.Chunks(), m.Sleep())
+	}
+
+	// Without a hostname the ClientHello goes as it is
+	out.Reset()
+	plain := testClientHello(t, "")
+	if _, err := (&sniSplitter{w: &out, config: config}).Write(plain); err != nil || !bytes.Equal(out.Bytes(), plain) {
+		t.Errorf("ClientHello without SNI was changed")
+	}
+}
+
+func TestSNISplitterHandshake(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	rootCAs = x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+	defer func() { rootCAs = nil }()
+	config, err := ParseFragmentOptions("preset:sni-split-delayed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// The test certificate is for example.com
+	conn, err := dialTLS(ctx, newDialer(time.Second), server.Listener.Addr().String(), "example.com", getClientHelloId("chrome"), config, nil)
+	if err != nil {
+		t.Fatalf("handshake with the ClientHello split around the SNI: %v", err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,107 @@
+package task
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/hadi77ir/fragmenter"
+)
+
+// FragmentMetrics counts what fragmentation added to connections, safe for concurrent use
+type FragmentMetrics struct {
+	chunks       atomic.Int64
+	bytesDelayed atomic.Int64
+	sleep        atomic.Int64
+}
+
+// Metrics of every fragmented connection of the scan
+var fragmentTotals FragmentMetrics
+
+// FragmentTotals returns the metrics of every fragmented connection of the scan
+func FragmentTotals() *FragmentMetrics {
+	return &fragmentTotals
+}
+
+// Chunks returns the number of writes the split writes were sent as
+func (m *FragmentMetrics) Chunks() int64 {
+	return m.chunks.Load()
+}
+
+// BytesDelayed returns the bytes held back behind a delay
+func (m *FragmentMetrics) BytesDelayed() int64 {
+	return m.bytesDelayed.Load()
+}
+
+// Sleep returns the time spent in delays, the latency fragmentation added
+func (m *FragmentMetrics) Sleep() time.Duration {
+	return time.Duration(m.sleep.Load())
+}
+
+func (m *FragmentMetrics) add(chunks, bytesDelayed int64, sleep time.Duration) {
+	m.chunks.Add(chunks)
+	m.bytesDelayed.Add(bytesDelayed)
+	m.sleep.Add(int64(sleep))
+}
+
+// Connection writing through the fragmenter, recording what each write cost in metrics and the scan totals
+type fragmentedConn struct {
+	net.Conn
+	writer  io.Writer
+	inner   *chunkRecorder
+	metrics *FragmentMetrics
+}
+
+// Records the writes the fragmenter makes to the connection
+type chunkRecorder struct {
+	w     io.Writer
+	sizes []int
+	spent time.Duration
+}
+
+func (r *chunkRecorder) Write(b []byte) (int, error) {
+	start := time.Now()
+	n, err := r.w.Write(b)
+	r.spent += time.Since(start)
+	r.sizes = append(r.sizes, n)
+	return n, err
+}
+
+func wrapFragmented(conn net.Conn, config *FragmentConfig, metrics *FragmentMetrics) net.Conn {
+	inner := &chunkRecorder{w: conn}
+	var writer io.Writer
+	if config.SNI {
+		writer = &sniSplitter{w: inner, config: config}
+	} else {
+		writer = fragmenter.WrapWriter(inner, &config.FragmentConfig)
+	}
+	return &fragmentedConn{Conn: conn, writer: writer, inner: inner, metrics: metrics}
+}
+
+func (c *fragmentedConn) Write(b []byte) (int, error) {
+	c.inner.sizes, c.inner.spent = c.inner.sizes[:0], 0
+	start := time.Now()
+	n, err := c.writer.Write(b)
+	// What isn't writing is delay, the fragmenter's own work takes microseconds and its delays whole milliseconds
+	sleep := time.Since(start) - c.inner.spent
+	if sleep < time.Millisecond {
+		sleep = 0
+	}
+	var chunks, delayed int64
+	if len(c.inner.sizes) > 1 {
+		chunks = int64(len(c.inner.sizes))
+		if sleep > 0 {
+			for _, size := range c.inner.sizes[1:] {
+				delayed += int64(size)
+			}
+		}
+	}
+	if chunks > 0 || sleep > 0 {
+		fragmentTotals.add(chunks, delayed, sleep)
+		if c.metrics != nil {
+			c.metrics.add(chunks, delayed, sleep)
+		}
+	}
+	return n, err
+}
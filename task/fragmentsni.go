@@ -0,0 +1,103 @@
+package task
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/hadi77ir/fragmenter"
+)
+
+// Writer of mode=sni configs in place of the fragmenter's: splits the first write, when it is a ClientHello with a hostname,
+// into TLS records at the start, the middle and the end of the hostname, so no record carries the whole name, nor any
+// segment when delays separate the records. Other writes go through unchanged.
+type sniSplitter struct {
+	w      io.Writer
+	config *FragmentConfig
+	count  int
+}
+
+func (s *sniSplitter) Write(b []byte) (int, error) {
+	s.count++
+	if s.count != 1 {
+		return s.w.Write(b)
+	}
+	start, end, ok := sniRange(b)
+	if !ok {
+		return s.w.Write(b)
+	}
+	recordLen := 5 + int(binary.BigEndian.Uint16(b[3:]))
+	cuts := []int{5, start, (start + end) / 2, end, recordLen}
+	var hello []byte
+	for i := 1; i < len(cuts); i++ {
+		from, to := cuts[i-1], cuts[i]
+		if from == to {
+			continue
+		}
+		record := append([]byte{b[0], b[1], b[2], byte((to - from) >> 8), byte(to - from)}, b[from:to]...)
+		if s.config.IntervalMax == 0 {
+			hello = append(hello, record...)
+			continue
+		}
+		if from > 5 {
+			time.Sleep(time.Duration(fragmenter.RandBetween(s.config.IntervalMin.Milliseconds(), s.config.IntervalMax.Milliseconds())) * time.Millisecond)
+		}
+		if _, err := s.w.Write(record); err != nil {
+			return 0, err
+		}
+	}
+	if len(hello) > 0 {
+		if _, err := s.w.Write(hello); err != nil {
+			return 0, err
+		}
+	}
+	if len(b) > recordLen {
+		n, err := s.w.Write(b[recordLen:])
+		return recordLen + n, err
+	}
+	return len(b), nil
+}
+
+// Offsets of the server_name hostname in a TLS record holding a whole ClientHello, false without one
+func sniRange(b []byte) (start, end int, ok bool) {
+	if len(b) < 5+4 || b[0] != 22 || b[5] != 1 {
+		return 0, 0, false
+	}
+	recordLen := 5 + int(binary.BigEndian.Uint16(b[3:]))
+	if recordLen > len(b) {
+		return 0, 0, false
+	}
+	// Version and random, then the session ID, cipher suites and compression methods
+	i := 5 + 4 + 2 + 32
+	for _, lengthBytes := range []int{1, 2, 1} {
+		if i+lengthBytes > recordLen {
+			return 0, 0, false
+		}
+		n := int(b[i])
+		if lengthBytes == 2 {
+			n = int(binary.BigEndian.Uint16(b[i:]))
+		}
+		i += lengthBytes + n
+	}
+	if i+2 > recordLen {
+		return 0, 0, false
+	}
+	extEnd := min(i+2+int(binary.BigEndian.Uint16(b[i:])), recordLen)
+	for i += 2; i+4 <= extEnd; {
+		extType, extLen := binary.BigEndian.Uint16(b[i:]), int(binary.BigEndian.Uint16(b[i+2:]))
+		i += 4
+		if i+extLen > extEnd {
+			return 0, 0, false
+		}
+		// server_name: the list length, then a name type and length before the host_name
+		if extType == 0 && extLen >= 5 && b[i+2] == 0 {
+			nameLen := int(binary.BigEndian.Uint16(b[i+3:]))
+			if nameLen == 0 || 5+nameLen > extLen {
+				return 0, 0, false
+			}
+			return i + 5, i + 5 + nameLen, true
+		}
+		i += extLen
+	}
+	return 0, 0, false
+}
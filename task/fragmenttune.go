@@ -0,0 +1,96 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+	"github.com/hadi77ir/fragmenter"
+	utls "github.com/refraction-networking/utls"
+)
+
+// Limits of the fragment settings the tuner searches
+const (
+	tuneMaxLength = 512
+	tuneMaxDelay  = 100 * time.Millisecond
+)
+
+// TuneFragment searches the fragment options with the least overhead that still get a TLS handshake to every IP through,
+// each setting is tried tries times; nil options mean the handshake gets through unfragmented
+func TuneFragment(ips []*net.IPAddr, tries int) (*FragmentConfig, error) {
+	u, err := url.Parse(URL)
+	if err != nil {
+		return nil, err
+	}
+	probe := func(config *FragmentConfig) bool {
+		for i := 0; i < tries; i++ {
+			for _, ip := range ips {
+				if err := handshake(ip, u.Hostname(), getClientHelloId(ClientHelloID), config); err != nil {
+					utils.Printf("[Info] %-24s blocked (%s: %v)\n", FormatFragmentOptions(config), ip, err)
+					return false
+				}
+			}
+		}
+		utils.Printf("[Info] %-24s passed\n", FormatFragmentOptions(config))
+		return true
+	}
+	return tuneFragment(probe)
+}
+
+// A TLS handshake with serverName through ip
+func handshake(ip *net.IPAddr, serverName string, hello utls.ClientHelloID, config *FragmentConfig) error {
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+	conn, err := dialTLS(ctx, newDialer(HandshakeTimeout), remoteAddr(ip).String(), serverName, hello, config, nil)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Finds the smallest delay that gets one byte chunks through, then the largest chunk size that passes with that delay.
+// Assumes smaller chunks and longer delays evade the DPI at least as well as larger and shorter ones.
+func tuneFragment(probe func(*FragmentConfig) bool) (*FragmentConfig, error) {
+	if probe(nil) {
+		return nil, nil
+	}
+	fixed := func(length int, delay time.Duration) *FragmentConfig {
+		return &FragmentConfig{FragmentConfig: fragmenter.FragmentConfig{PacketsFrom: 0, PacketsTo: 1, LengthMin: length, LengthMax: length, IntervalMin: delay, IntervalMax: delay}}
+	}
+
+	var delay time.Duration
+	if !probe(fixed(1, 0)) {
+		if !probe(fixed(1, tuneMaxDelay)) {
+			return nil, errors.New("no fragment setting got through, check that the IPs are reachable")
+		}
+		// lo fails and hi passes
+		lo, hi := time.Duration(0), tuneMaxDelay
+		for hi-lo > time.Millisecond {
+			mid := (lo + hi) / 2 / time.Millisecond * time.Millisecond
+			if probe(fixed(1, mid)) {
+				hi = mid
+			} else {
+				lo = mid
+			}
+		}
+		delay = hi
+	}
+
+	// lo passes and hi fails
+	lo, hi := 1, tuneMaxLength+1
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if probe(fixed(mid, delay)) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	// Sizes vary so the chunks don't form a pattern, smaller ones get through as well
+	config := fixed(lo, delay)
+	config.LengthMin = max(1, lo/2)
+	return config, nil
+}
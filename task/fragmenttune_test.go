@@ -0,0 +1,46 @@
+package task
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTuneFragment(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxLength int           // Largest chunk the fake DPI lets through
+		minDelay  time.Duration // Shortest delay it lets through
+		want      string
+	}{
+		{name: "no DPI", maxLength: 1 << 20, want: "none"},
+		{name: "chunks", maxLength: 37, want: "0,1,18,37,0s,0s"},
+		{name: "chunks and delay", maxLength: 9, minDelay: 23 * time.Millisecond, want: "0,1,4,9,23ms,23ms"},
+		{name: "largest chunk", maxLength: tuneMaxLength, want: "0,1,256,512,0s,0s"},
+		{name: "single bytes", maxLength: 1, minDelay: time.Millisecond, want: "0,1,1,1,1ms,1ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probes := 0
+			config, err := tuneFragment(func(config *FragmentConfig) bool {
+				probes++
+				if config == nil {
+					return tt.maxLength >= 1<<20
+				}
+				return config.LengthMax <= tt.maxLength && config.IntervalMin >= tt.minDelay
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := FormatFragmentOptions(config); got != tt.want {
+				t.Errorf("tuneFragment() = %s, want %s", got, tt.want)
+			}
+			if probes > 20 {
+				t.Errorf("tuneFragment() took %d probes", probes)
+			}
+		})
+	}
+
+	if _, err := tuneFragment(func(*FragmentConfig) bool { return false }); err == nil {
+		t.Error("tuneFragment() succeeded with everything blocked")
+	}
+}
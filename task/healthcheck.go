@@ -0,0 +1,92 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Modes of HealthCheck
+const (
+	HealthTCP  = "tcp"
+	HealthTLS  = "tls"
+	HealthHTTP = "http"
+)
+
+// HealthCheck probes an IP once, as keepalived track scripts and the like need, all within the deadline of ctx: a TCP
+// connection to the test port, a TLS handshake with the [-fingerprint] ClientHello, or a HEAD request of URL answered with
+// a status HTTPing accepts. It returns the time the probe took, failures are a *ProbeError of their class.
+func HealthCheck(ctx context.Context, ip *net.IPAddr, mode string) (time.Duration, error) {
+	timeout := HandshakeTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	start := time.Now()
+	switch mode {
+	case HealthTCP:
+		conn, err := newDialer(timeout).DialContext(ctx, "tcp", remoteAddr(ip).String())
+		if err != nil {
+			return 0, probeError(probeTCPing, err)
+		}
+		took := time.Since(start)
+		_ = conn.Close()
+		return took, nil
+	case HealthTLS:
+		serverName := SNI
+		if serverName == "" {
+			serverName = hostOf(URL)
+		}
+		conn, err := dialTLS(ctx, newDialer(timeout), remoteAddr(ip).String(), serverName, getClientHelloId(ClientHelloID), fragmentFor(ProbeHTTPing, true), nil)
+		if err != nil {
+			return 0, probeError(ProbeHTTPing, err)
+		}
+		took := time.Since(start)
+		_ = conn.Close()
+		return took, nil
+	case HealthHTTP:
+		return healthHTTP(ctx, ip)
+	}
+	return 0, fmt.Errorf("unknown health check mode %q, use tcp, tls or http", mode)
+}
+
+// A HEAD request of URL on a new connection, redirects are answers rather than followed
+func healthHTTP(ctx context.Context, ip *net.IPAddr) (time.Duration, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext:       getDialContext(ip, ProbeHTTPing, nil),
+			DialTLSContext:    getDialTLSContext(ip, ProbeHTTPing, nil),
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, probeError(ProbeHTTPing, err)
+	}
+	took := time.Since(start)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if !healthStatus(resp.StatusCode) {
+		return 0, statusError(ProbeHTTPing, resp)
+	}
+	return took, nil
+}
+
+// Whether HTTPing accepts the status: [-httping-code], or 200, 301 and 302 without one
+func healthStatus(code int) bool {
+	if HttpingStatusCode < 100 || HttpingStatusCode > 599 {
+		return code == http.StatusOK || code == http.StatusMovedPermanently || code == http.StatusFound
+	}
+	return code == HttpingStatusCode
+}
@@ -0,0 +1,60 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+)
+
+func TestHealthCheck(t *testing.T) {
+	server := testserver.New(testserver.Config{})
+	defer server.Close()
+	rootCAs = server.CertPool()
+	defer func(u string, port, code int) { rootCAs, URL, TCPPort, HttpingStatusCode = nil, u, port, code }(URL, TCPPort, HttpingStatusCode)
+	URL, TCPPort = "https://127.0.0.1/cdn-cgi/trace", server.Port()
+	ip := &net.IPAddr{IP: net.ParseIP("127.0.0.1")}
+
+	for _, mode := range []string{HealthTCP, HealthTLS, HealthHTTP} {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		took, err := HealthCheck(ctx, ip, mode)
+		cancel()
+		if err != nil || took <= 0 {
+			t.Errorf("%s: took %v, %v", mode, took, err)
+		}
+	}
+	HttpingStatusCode = 204
+	if _, err := HealthCheck(context.Background(), ip, HealthHTTP); !errors.Is(err, ErrHTTPStatus) {
+		t.Errorf("unexpected status: %v, want ErrHTTPStatus", err)
+	}
+	if _, err := HealthCheck(context.Background(), ip, "icmp"); err == nil {
+		t.Error("unknown mode: want an error")
+	}
+}
+
+func TestHealthCheckBudget(t *testing.T) {
+	server := testserver.New(testserver.Config{Latency: time.Second})
+	defer server.Close()
+	rootCAs = server.CertPool()
+	defer func(u string, port int) { rootCAs, URL, TCPPort = nil, u, port }(URL, TCPPort)
+	URL, TCPPort = "https://127.0.0.1/", server.Port()
+	ip := &net.IPAddr{IP: net.ParseIP("127.0.0.1")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := HealthCheck(ctx, ip, HealthHTTP); err == nil {
+		t.Error("response after the budget: want an error")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("took %v, want it cut off at the budget", elapsed)
+	}
+
+	server.Close()
+	if _, err := HealthCheck(context.Background(), ip, HealthTCP); !errors.Is(err, ErrConnectRefused) {
+		t.Errorf("closed port: %v, want ErrConnectRefused", err)
+	}
+}
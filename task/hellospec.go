@@ -0,0 +1,63 @@
+package task
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// HelloSpecID is the ClientHelloID name of the ClientHello loaded by LoadHelloSpec
+const HelloSpecID = "custom"
+
+var (
+	// ClientHello of [-hello-spec], nil without one
+	helloSpecData []byte
+	helloSpecJSON bool
+)
+
+// LoadHelloSpec loads the ClientHello the "custom" fingerprint sends: a uTLS ClientHelloSpec as JSON (cipher_suites,
+// compression_methods and extensions with their settings, GREASE where it goes) or a hex dump of a captured ClientHello record
+func LoadHelloSpec(path string) error {
+	helloSpecData = nil
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		helloSpecData, helloSpecJSON = trimmed, true
+	} else {
+		// Spaces, line breaks, colons and 0x prefixes of hex dumps are left out
+		digits := strings.NewReplacer("0x", "", ":", "", " ", "", "\t", "", "\r", "", "\n", "").Replace(string(data))
+		raw, err := hex.DecodeString(digits)
+		if err != nil {
+			return fmt.Errorf("%s: neither JSON nor a hex dump: %v", path, err)
+		}
+		// A bare handshake message gets its record header
+		if len(raw) > 0 && raw[0] == 0x01 {
+			raw = append([]byte{0x16, 0x03, 0x01, byte(len(raw) >> 8), byte(len(raw))}, raw...)
+		}
+		helloSpecData, helloSpecJSON = raw, false
+	}
+	if _, err := newHelloSpec(); err != nil {
+		helloSpecData = nil
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// A new ClientHelloSpec of [-hello-spec] for each connection, as uTLS shares the extensions of a spec between the connections using it
+func newHelloSpec() (*utls.ClientHelloSpec, error) {
+	if helloSpecData == nil {
+		return nil, errors.New("no ClientHello spec loaded")
+	}
+	f := &utls.Fingerprinter{AllowBluntMimicry: true}
+	if helloSpecJSON {
+		return f.UnmarshalJSONClientHello(helloSpecData)
+	}
+	return f.RawClientHello(helloSpecData)
+}
@@ -0,0 +1,98 @@
+package task
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+	utls "github.com/refraction-networking/utls"
+)
+
+const testHelloSpec = `{
+	"cipher_suites": ["GREASE", "TLS_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"],
+	"compression_methods": ["NULL"],
+	"extensions": [
+		{"name": "GREASE"},
+		{"name": "server_name"},
+		{"name": "supported_groups", "named_group_list": ["GREASE", "x25519", "secp256r1"]},
+		{"name": "ec_point_formats", "ec_point_format_list": ["uncompressed"]},
+		{"name": "application_layer_protocol_negotiation", "protocol_name_list": ["http/1.1"]},
+		{"name": "signature_algorithms", "supported_signature_algorithms": ["ecdsa_secp256r1_sha256", "rsa_pss_rsae_sha256", "rsa_pkcs1_sha256"]},
+		{"name": "key_share", "client_shares": [{"group": "GREASE", "key_exchange": [0]}, {"group": "x25519"}]},
+		{"name": "supported_versions", "versions": ["GREASE", "TLS 1.3", "TLS 1.2"]}
+	]
+}`
+
+// A ClientHello record of crypto/tls
+func captureClientHello(t *testing.T) []byte {
+	client, server := net.Pipe()
+	go func() {
+		_ = tls.Client(client, &tls.Config{ServerName: "example.com"}).Handshake()
+	}()
+	defer client.Close()
+	defer server.Close()
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(server, header); err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, int(header[3])<<8|int(header[4]))
+	if _, err := io.ReadFull(server, body); err != nil {
+		t.Fatal(err)
+	}
+	return append(header, body...)
+}
+
+func TestHelloSpec(t *testing.T) {
+	server := testserver.New(testserver.Config{})
+	defer server.Close()
+	rootCAs = server.CertPool()
+	defer func(port int) { rootCAs, TCPPort, helloSpecData = nil, port, nil }(TCPPort)
+	TCPPort = server.Port()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"spec.json": testHelloSpec,
+		// Bare handshake message, as copied from Wireshark
+		"hello.hex": hex.EncodeToString(captureClientHello(t)[5:]),
+	}
+	if _, err := ParseFingerprints(HelloSpecID); err == nil {
+		t.Error("custom without a spec: want an error")
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadHelloSpec(path); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		hello := getClientHelloId(HelloSpecID)
+		if hello != utls.HelloCustom {
+			t.Fatalf("%s: got %v, want the custom ClientHello", name, hello)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		conn, err := dialTLS(ctx, newDialer(time.Second), remoteAddr(server.IP()).String(), "example.com", hello, nil, nil)
+		cancel()
+		if err != nil {
+			t.Errorf("%s: handshake failed: %v", name, err)
+			continue
+		}
+		conn.Close()
+	}
+	if _, err := ParseFingerprints("go," + HelloSpecID); err != nil {
+		t.Error(err)
+	}
+
+	bad := filepath.Join(dir, "bad.hex")
+	_ = os.WriteFile(bad, []byte("zz"), 0o644)
+	if err := LoadHelloSpec(bad); err == nil || helloSpecData != nil {
+		t.Errorf("invalid file: got %v, want an error and no spec", err)
+	}
+}
@@ -0,0 +1,205 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const (
+	defaultDoHServer = "https://cloudflare-dns.com/dns-query"
+	dohTimeout       = 10 * time.Second
+	dnsCacheKind     = "dns"
+	// DNS record types of the JSON DoH API
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+)
+
+var (
+	// Hostnames known to be on Cloudflare, their IPs and the surrounding /24 (/120 for IPv6) join the test queue
+	Hostnames string
+	// HostNeighbors adds this many adjacent blocks on each side of the surrounding one
+	HostNeighbors = 0
+	// DoHServer resolves Hostnames with the JSON DNS-over-HTTPS API
+	DoHServer = defaultDoHServer
+)
+
+type dohResponse struct {
+	Status int `json:"Status"`
+	Answer []struct {
+		Type int    `json:"type"`
+		TTL  int    `json:"TTL"`
+		Data string `json:"data"`
+	} `json:"Answer"`
+}
+
+// CheckHosts validates the [-hosts] options
+func CheckHosts() error {
+	if HostNeighbors < 0 {
+		return errors.New("hosts-neighbors can't be negative")
+	}
+	if Hostnames == "" {
+		return nil
+	}
+	if u, err := url.Parse(DoHServer); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("invalid DoH server %q, expected an https:// URL", DoHServer)
+	}
+	return nil
+}
+
+// Ranges to test around the IPs of Hostnames, hosts failing to resolve are skipped
+func hostRanges() []string {
+	var list []string
+	seen := make(map[string]bool)
+	resolved := 0
+	for _, host := range strings.Split(Hostnames, ",") {
+		if host = hostOf(strings.TrimSpace(host)); host == "" {
+			continue
+		}
+		ips, err := resolveDoH(host)
+		if err != nil {
+			utils.Printf("[Warning] Resolving %s failed: %v\n", host, err)
+			continue
+		}
+		resolved += len(ips)
+		for _, ip := range ips {
+			for _, r := range surroundingRanges(ip, HostNeighbors) {
+				if !seen[r] {
+					seen[r] = true
+					list = append(list, r)
+				}
+			}
+		}
+	}
+	if len(list) > 0 {
+		utils.Printf("[Info] Added %d IPs and ranges around the %d IPs of [-hosts].\n", len(list), resolved)
+	}
+	return list
+}
+
+// Host of a hostname or URL, e.g. https://example.com/path
+func hostOf(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// A and AAAA records of host, an error only when both lookups fail
+func resolveDoH(host string) ([]netip.Addr, error) {
+	var ips []netip.Addr
+	var errs []error
+	for _, qtype := range []int{dnsTypeA, dnsTypeAAAA} {
+		found, err := queryDoH(host, qtype)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		ips = append(ips, found...)
+	}
+	if len(errs) == 2 {
+		return nil, errors.Join(errs...)
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("no A or AAAA records")
+	}
+	return ips, nil
+}
+
+// Records of host, from the disk cache while their TTL lasts
+func queryDoH(host string, qtype int) ([]netip.Addr, error) {
+	key := fmt.Sprintf("%s/%d", host, qtype)
+	var ips []netip.Addr
+	if utils.Cache.Get(dnsCacheKind, key, &ips) {
+		return ips, nil
+	}
+	client := &http.Client{Timeout: dohTimeout}
+	req, err := http.NewRequest("GET", DoHServer+"?"+url.Values{"name": {host}, "type": {fmt.Sprint(qtype)}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/dns-json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server answered %s", resp.Status)
+	}
+	var answer dohResponse
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, err
+	}
+	if answer.Status != 0 {
+		return nil, fmt.Errorf("DNS status %d", answer.Status)
+	}
+	ttl := 0
+	for _, record := range answer.Answer {
+		// CNAMEs of the chain are skipped, their targets are answered too
+		if record.Type != qtype {
+			continue
+		}
+		if ip, err := netip.ParseAddr(record.Data); err == nil {
+			ips = append(ips, ip)
+			if ttl == 0 || record.TTL < ttl {
+				ttl = record.TTL
+			}
+		}
+	}
+	utils.Cache.Put(dnsCacheKind, key, ips, time.Duration(ttl)*time.Second)
+	return ips, nil
+}
+
+// The IP itself, its /24 (/120 for IPv6) and as many neighbor blocks on each side, as ranges for IPRanges
+func surroundingRanges(ip netip.Addr, neighbors int) []string {
+	bits := 24
+	if ip.Is6() {
+		bits = 120
+	}
+	base := netip.PrefixFrom(ip, bits).Masked().Addr()
+	list := []string{ip.String()}
+	for n := -neighbors; n <= neighbors; n++ {
+		if block, ok := shiftBlock(base, n); ok {
+			list = append(list, netip.PrefixFrom(block, bits).String())
+		}
+	}
+	return list
+}
+
+// Moves a block-aligned address by n blocks of 256 addresses, false past the end of the address space
+func shiftBlock(a netip.Addr, n int) (netip.Addr, bool) {
+	b := a.AsSlice()
+	for ; n > 0; n-- {
+		i := len(b) - 2
+		for ; i >= 0 && b[i] == 0xff; i-- {
+			b[i] = 0
+		}
+		if i < 0 {
+			return netip.Addr{}, false
+		}
+		b[i]++
+	}
+	for ; n < 0; n++ {
+		i := len(b) - 2
+		for ; i >= 0 && b[i] == 0; i-- {
+			b[i] = 0xff
+		}
+		if i < 0 {
+			return netip.Addr{}, false
+		}
+		b[i]--
+	}
+	shifted, _ := netip.AddrFromSlice(b)
+	return shifted, true
+}
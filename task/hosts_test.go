@@ -0,0 +1,49 @@
+package task
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestSurroundingRanges(t *testing.T) {
+	got := surroundingRanges(netip.MustParseAddr("104.16.0.5"), 1)
+	want := []string{"104.16.0.5", "104.15.255.0/24", "104.16.0.0/24", "104.16.1.0/24"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	got = surroundingRanges(netip.MustParseAddr("2606:4700::6810:84e5"), 0)
+	want = []string{"2606:4700::6810:84e5", "2606:4700::6810:8400/120"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := surroundingRanges(netip.MustParseAddr("255.255.255.1"), 1); len(got) != 3 {
+		t.Errorf("got %v, want the blocks past the end left out", got)
+	}
+}
+
+func TestHostRanges(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") != "example.com" {
+			fmt.Fprint(w, `{"Status":3}`)
+			return
+		}
+		if r.URL.Query().Get("type") == "1" {
+			fmt.Fprint(w, `{"Status":0,"Answer":[{"type":5,"data":"alias.example.com."},{"type":1,"data":"104.16.0.5"},{"type":1,"data":"104.16.0.6"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"Status":0}`)
+	}))
+	defer srv.Close()
+	oldServer, oldHosts := DoHServer, Hostnames
+	t.Cleanup(func() { DoHServer, Hostnames = oldServer, oldHosts })
+	DoHServer, Hostnames = srv.URL, "https://example.com/path, missing.example"
+
+	want := []string{"104.16.0.5", "104.16.0.0/24", "104.16.0.6"}
+	if got := hostRanges(); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,93 @@
+package task
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// Downloads the test file over HTTP/3 from ip at UDP [-tp] and returns the speed in bytes per second, the Initial and the
+// junk ahead of it shaped by QUICPad with r. quic-go does the TLS handshake, so the ClientHello fingerprint and
+// fragmentation of the TCP probes don't apply.
+func quicDownload(ip *net.IPAddr, r *rand.Rand) (float64, error) {
+	u, err := url.Parse(URL)
+	if err != nil || u.Scheme != "https" {
+		return 0, errors.New("HTTP/3 needs an https:// test address")
+	}
+	var local *net.UDPAddr
+	if SourceAddr != nil {
+		local = &net.UDPAddr{IP: SourceAddr.IP, Zone: SourceAddr.Zone}
+	}
+	conn, err := net.ListenUDP("udp", local)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	tcp := remoteAddr(ip)
+	remote := &net.UDPAddr{IP: tcp.IP, Port: tcp.Port, Zone: tcp.Zone}
+
+	serverName := u.Hostname()
+	if SNI != "" {
+		serverName = SNI
+	}
+	config := &quic.Config{HandshakeIdleTimeout: HandshakeTimeout}
+	if QUICPad != nil {
+		config.InitialPacketSize = uint16(QUICPad.DatagramSize(r))
+	}
+	transport := &http3.Transport{
+		TLSClientConfig:    &tls.Config{ServerName: serverName, RootCAs: rootCAs},
+		QUICConfig:         config,
+		DisableCompression: RawBytes,
+		// Every request goes to ip whatever the host of the address
+		Dial: func(ctx context.Context, _ string, tlsConfig *tls.Config, config *quic.Config) (*quic.Conn, error) {
+			if err := QUICPad.WriteNoise(r, func(b []byte) (int, error) { return conn.WriteTo(b, remote) }); err != nil {
+				return nil, err
+			}
+			return quic.DialEarly(ctx, conn, remote, tlsConfig, config)
+		},
+	}
+	defer transport.Close()
+
+	// The handshake and the transfer are timed separately, as in the download test
+	ctx, cancel := context.WithCancel(RunContext)
+	defer cancel()
+	handshakeTimer := time.AfterFunc(HandshakeTimeout, cancel)
+
+	target := URL
+	if cacheBusting() {
+		target = cacheBustURL(URL)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return 0, err
+	}
+	if target != URL {
+		req.Header.Set("Cache-Control", "no-cache")
+	}
+	if RawBytes {
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+	response, err := transport.RoundTrip(req)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if !handshakeTimer.Stop() {
+		return 0, context.DeadlineExceeded
+	}
+	if response.StatusCode != 200 {
+		return 0, fmt.Errorf("HTTP/3 status %d", response.StatusCode)
+	}
+	transferTimer := time.AfterFunc(Timeout, cancel)
+	defer transferTimer.Stop()
+	return measureSpeed(response.Body, response.ContentLength, Timeout, 0), nil
+}
@@ -4,7 +4,6 @@ import (
 	//"crypto/tls"
 	//"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"regexp"
@@ -13,21 +12,27 @@ import (
 	"time"
 )
 
+// Timeout of each HTTPing request
+const httpingTimeout = 2 * time.Second
+
 var (
 	Httping           bool
 	HttpingStatusCode int
 	HttpingCFColo     string
 	HttpingCFColomap  *sync.Map
 	OutRegexp         = regexp.MustCompile(`[A-Z]{3}`)
+	// ColoInline records the colo of every IP from the first HTTPing response, sparing a separate trace request
+	ColoInline bool
 )
 
-// pingReceived pingTotalTime
-func (p *Ping) httping(ip *net.IPAddr) (int, time.Duration) {
+// pingReceived pingTotalTime colo
+func (p *Ping) httping(ip *net.IPAddr) (int, time.Duration, string) {
+	var fragment FragmentMetrics
 	hc := http.Client{
-		Timeout: time.Second * 2,
+		Timeout: httpingTimeout,
 		Transport: &http.Transport{
-			DialContext: getDialContext(ip),
-			DialTLSContext: getDialTLSContext(ip),
+			DialContext:    p.config.dialContext(ip, ProbeHTTPing, &fragment),
+			DialTLSContext: p.config.dialTLSContext(ip, ProbeHTTPing, &fragment),
 			//TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // Skip certificate verification
 		},
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
@@ -36,15 +41,17 @@ func (p *Ping) httping(ip *net.IPAddr) (int, time.Duration) {
 	}
 
 	// First, access to obtain the HTTP status code and Cloudflare Colo
+	var colo string
 	{
-		requ, err := http.NewRequest(http.MethodHead, URL, nil)
+		requ, err := http.NewRequest(http.MethodHead, p.config.url, nil)
 		if err != nil {
-			return 0, 0
+			return 0, 0, ""
 		}
 		requ.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
 		resp, err := hc.Do(requ)
 		if err != nil {
-			return 0, 0
+			recordFailure(ip, probeError(ProbeHTTPing, err))
+			return 0, 0, ""
 		}
 		defer resp.Body.Close()
 
@@ -52,18 +59,20 @@ func (p *Ping) httping(ip *net.IPAddr) (int, time.Duration) {
 		// If the HTTP status code is unspecified or not compliant, only 200, 301, and 302 are considered successful HTTPing
 		if HttpingStatusCode == 0 || HttpingStatusCode < 100 && HttpingStatusCode > 599 {
 			if resp.StatusCode != 200 && resp.StatusCode != 301 && resp.StatusCode != 302 {
-				return 0, 0
+				recordFailure(ip, statusError(ProbeHTTPing, resp))
+				return 0, 0, ""
 			}
 		} else {
 			if resp.StatusCode != HttpingStatusCode {
-				return 0, 0
+				recordFailure(ip, statusError(ProbeHTTPing, resp))
+				return 0, 0, ""
 			}
 		}
 
 		io.Copy(io.Discard, resp.Body)
 
-		// Only match airport codes if the region is specified
-		if HttpingCFColo != "" {
+		// Only match airport codes if the region is specified or the colo is recorded
+		if HttpingCFColo != "" || ColoInline {
 			// Determine whether it is Cloudflare or AWS CloudFront based on the Server header value and set cfRay to the airport code of each
 			cfRay := func() string {
 				if resp.Header.Get("Server") == "cloudflare" {
@@ -71,9 +80,10 @@ func (p *Ping) httping(ip *net.IPAddr) (int, time.Duration) {
 				}
 				return resp.Header.Get("x-amz-cf-pop") // Example X-Amz-Cf-Pop: SIN52-P1
 			}()
-			colo := p.getColo(cfRay)
-			if colo == "" { // If no airport code is matched or does not match the specified region, end the IP test directly
-				return 0, 0
+			// CF-RAY ends with the same colo as /cdn-cgi/trace reports
+			colo = OutRegexp.FindString(cfRay)
+			if HttpingCFColo != "" && p.getColo(cfRay) == "" { // If no airport code is matched or does not match the specified region, end the IP test directly
+				return 0, 0, ""
 			}
 		}
 
@@ -82,30 +92,31 @@ func (p *Ping) httping(ip *net.IPAddr) (int, time.Duration) {
 	// Loop to calculate latency
 	success := 0
 	var delay time.Duration
-	for i := 0; i < PingTimes; i++ {
-		requ, err := http.NewRequest(http.MethodHead, URL, nil)
+	for i := 0; i < p.config.pingTimes; i++ {
+		requ, err := http.NewRequest(http.MethodHead, p.config.url, nil)
 		if err != nil {
-			log.Fatal("Unexpected error, please report:", err)
-			return 0, 0
+			return 0, 0, ""
 		}
 		requ.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
-		if i == PingTimes-1 {
+		if i == p.config.pingTimes-1 {
 			requ.Header.Set("Connection", "close")
 		}
-		startTime := time.Now()
+		startTime, slept := time.Now(), fragment.Sleep()
 		resp, err := hc.Do(requ)
 		if err != nil {
+			recordFailure(ip, probeError(ProbeHTTPing, err))
 			continue
 		}
 		success++
 		io.Copy(io.Discard, resp.Body)
 		_ = resp.Body.Close()
-		duration := time.Since(startTime)
-		delay += duration
+		// Fragmentation delays are left out, so results stay comparable to unfragmented ones
+		duration := time.Since(startTime) - (fragment.Sleep() - slept)
+		delay += max(duration, 0)
 
 	}
 
-	return success, delay
+	return success, delay, colo
 
 }
 
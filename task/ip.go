@@ -2,13 +2,19 @@ package task
 
 import (
 	"bufio"
-	"log"
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io/fs"
 	"math/rand"
 	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
 )
 
 const defaultInputFile = "ip.txt"
@@ -19,21 +25,40 @@ var (
 	// IPFile is the filename of IP ranges
 	IPFile = defaultInputFile
 	IPText string
-)
+	// UseEmbedded reads the IP ranges built into the binary instead of the [-f] file
+	UseEmbedded = false
+	// EmbeddedLists are the IP range files built into the binary by name (ip.txt, ipv6.txt)
+	EmbeddedLists = map[string][]byte{"ip.txt": embeddedIPv4, "ipv6.txt": embeddedIPv6}
 
-func InitRandSeed() {
-	rand.Seed(time.Now().UnixNano())
-}
+	//go:embed ip.txt
+	embeddedIPv4 []byte
+	//go:embed ipv6.txt
+	embeddedIPv6 []byte
+)
 
 func isIPv4(ip string) bool {
+	ip, _ = splitZone(ip) // Zones such as eth0.100 may contain dots
 	return strings.Contains(ip, ".")
 }
 
-func randIPEndWith(num byte) byte {
+// Splits the zone off an IPv6 address or range, e.g. fe80::1%eth0 or fe80::%eth0/64
+func splitZone(ip string) (string, string) {
+	i := strings.IndexByte(ip, '%')
+	if i < 0 {
+		return ip, ""
+	}
+	zone := ip[i+1:]
+	if j := strings.IndexByte(zone, '/'); j >= 0 {
+		return ip[:i] + zone[j:], zone[:j]
+	}
+	return ip[:i], zone
+}
+
+func (r *IPRanges) randIPEndWith(num byte) byte {
 	if num == 0 { // For single IP like /32
 		return byte(0)
 	}
-	return byte(rand.Intn(int(num)))
+	return byte(r.rand.Intn(int(num)))
 }
 
 type IPRanges struct {
@@ -41,11 +66,14 @@ type IPRanges struct {
 	mask    string
 	firstIP net.IP
 	ipNet   *net.IPNet
+	zone    string // Zone of link-local IPv6 ranges
+	rand    *rand.Rand
 }
 
 func newIPRanges() *IPRanges {
 	return &IPRanges{
-		ips: make([]*net.IPAddr, 0),
+		ips:  make([]*net.IPAddr, 0),
+		rand: newRand(),
 	}
 }
 
@@ -66,11 +94,13 @@ func (r *IPRanges) fixIP(ip string) string {
 }
 
 // Parse IP range to get IP, IP range, and subnet mask
-func (r *IPRanges) parseCIDR(ip string) {
+func (r *IPRanges) parseCIDR(ip string) error {
 	var err error
+	ip, r.zone = splitZone(ip)
 	if r.firstIP, r.ipNet, err = net.ParseCIDR(r.fixIP(ip)); err != nil {
-		log.Fatalln("ParseCIDR error", err)
+		return fmt.Errorf("invalid IP or range %q", ip)
 	}
+	return nil
 }
 
 func (r *IPRanges) appendIPv4(d byte) {
@@ -78,7 +108,7 @@ func (r *IPRanges) appendIPv4(d byte) {
 }
 
 func (r *IPRanges) appendIP(ip net.IP) {
-	r.ips = append(r.ips, &net.IPAddr{IP: ip})
+	r.ips = append(r.ips, &net.IPAddr{IP: ip, Zone: r.zone})
 }
 
 // Get the minimum value and available number of the fourth segment of the IP
@@ -110,7 +140,7 @@ func (r *IPRanges) chooseIPv4() {
 					r.appendIPv4(byte(i) + minIP)
 				}
 			} else { // Randomize the last segment of the IP 0.0.0.X
-				r.appendIPv4(minIP + randIPEndWith(hosts))
+				r.appendIPv4(minIP + r.randIPEndWith(hosts))
 			}
 			r.firstIP[14]++ // 0.0.(X+1).X
 			if r.firstIP[14] == 0 {
@@ -129,17 +159,17 @@ func (r *IPRanges) chooseIPv6() {
 	} else {
 		var tempIP uint8                  // Temporary variable to record the value of the previous bit
 		for r.ipNet.Contains(r.firstIP) { // Continue looping as long as the IP does not exceed the IP range
-			r.firstIP[15] = randIPEndWith(255) // Randomize the last segment of the IP
-			r.firstIP[14] = randIPEndWith(255) // Randomize the last segment of the IP
+			r.firstIP[15] = r.randIPEndWith(255) // Randomize the last segment of the IP
+			r.firstIP[14] = r.randIPEndWith(255) // Randomize the last segment of the IP
 
 			targetIP := make([]byte, len(r.firstIP))
 			copy(targetIP, r.firstIP)
 			r.appendIP(targetIP) // Add to the IP address pool
 
 			for i := 13; i >= 0; i-- { // Randomize from the third to the first bit
-				tempIP = r.firstIP[i]              // Save the value of the previous bit
-				r.firstIP[i] += randIPEndWith(255) // Randomize 0~255 and add it to the current bit
-				if r.firstIP[i] >= tempIP {        // If the value of the current bit is greater than or equal to the value of the previous bit, the randomization is successful and the loop can be exited
+				tempIP = r.firstIP[i]                // Save the value of the previous bit
+				r.firstIP[i] += r.randIPEndWith(255) // Randomize 0~255 and add it to the current bit
+				if r.firstIP[i] >= tempIP {          // If the value of the current bit is greater than or equal to the value of the previous bit, the randomization is successful and the loop can be exited
 					break
 				}
 			}
@@ -147,44 +177,141 @@ func (r *IPRanges) chooseIPv6() {
 	}
 }
 
-func loadIPRanges() []*net.IPAddr {
+func loadIPRanges(config *scanConfig) ([]*net.IPAddr, error) {
 	ranges := newIPRanges()
-	if IPText != "" { // Get IP range data from the parameter
-		IPs := strings.Split(IPText, ",") // Split by comma and iterate over the array
-		for _, IP := range IPs {
-			IP = strings.TrimSpace(IP) // Trim leading and trailing whitespace (spaces, tabs, newline characters, etc.)
-			if IP == "" {              // Skip empty lines (e.g., consecutive ,, at the beginning, end, or in between)
-				continue
-			}
-			ranges.parseCIDR(IP) // Parse IP range to get IP, IP range, and subnet mask
-			if isIPv4(IP) {      // Generate all IPv4 / IPv6 addresses to be tested (single / random / all)
-				ranges.chooseIPv4()
-			} else {
-				ranges.chooseIPv6()
-			}
+	list, err := sourceRanges(config)
+	if err != nil {
+		return nil, err
+	}
+	list = append(list, hostRanges()...)
+	if err := checkCDNRanges(list); err != nil {
+		return nil, err
+	}
+	for _, r := range list {
+		if err := ranges.add(r); err != nil {
+			return nil, err
 		}
-	} else { // Get IP range data from the file
-		if IPFile == "" {
-			IPFile = defaultInputFile
+	}
+	return interleaveIPs(addPinned(skipBlocked(ranges.ips))), nil
+}
+
+// The IP ranges of [-ip], or of the [-f] file when it is not set
+func sourceRanges(config *scanConfig) ([]string, error) {
+	if config.ipRanges != nil { // Get IP range data from the parameter
+		return splitRanges(strings.Join(config.ipRanges, ",")), nil
+	}
+	// Get IP range data from the file
+	data, embedded, err := readIPList(config.ipFile, config.useEmbedded)
+	if err != nil {
+		return nil, err
+	}
+	if embedded && !config.useEmbedded {
+		config.printf("[Info] %s not found, using the built-in IP list.\n", config.ipFile)
+	}
+	var list []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() { // Iterate over each line in the file
+		line := strings.TrimSpace(scanner.Text()) // Trim leading and trailing whitespace (spaces, tabs, newline characters, etc.)
+		if line == "" {                           // Skip empty lines
+			continue
 		}
-		file, err := os.Open(IPFile)
-		if err != nil {
-			log.Fatal(err)
+		list = append(list, line)
+	}
+	return list, nil
+}
+
+// IPs and ranges of a list separated by commas
+func splitRanges(text string) []string {
+	var list []string
+	IPs := strings.Split(text, ",") // Split by comma and iterate over the array
+	for _, IP := range IPs {
+		IP = strings.TrimSpace(IP) // Trim leading and trailing whitespace (spaces, tabs, newline characters, etc.)
+		if IP == "" {              // Skip empty lines (e.g., consecutive ,, at the beginning, end, or in between)
+			continue
 		}
-		defer file.Close()
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() { // Iterate over each line in the file
-			line := strings.TrimSpace(scanner.Text()) // Trim leading and trailing whitespace (spaces, tabs, newline characters, etc.)
-			if line == "" {                           // Skip empty lines
-				continue
-			}
-			ranges.parseCIDR(line) // Parse IP range to get IP, IP range, and subnet mask
-			if isIPv4(line) {      // Generate all IPv4 / IPv6 addresses to be tested (single / random / all)
-				ranges.chooseIPv4()
-			} else {
-				ranges.chooseIPv6()
+		list = append(list, IP)
+	}
+	return list
+}
+
+// Candidates returns the IPs a scan of the ranges tests, in the order it tests them, without the pins, blocklist and [-hosts]
+func Candidates(list []string) ([]*net.IPAddr, error) {
+	ranges := newIPRanges()
+	for _, r := range list {
+		if err := checkIPRange(r); err != nil {
+			return nil, err
+		}
+		if r = strings.TrimSpace(r); r != "" {
+			if err := ranges.add(r); err != nil {
+				return nil, err
 			}
 		}
 	}
-	return ranges.ips
+	return interleaveIPs(ranges.ips), nil
+}
+
+// Reports an IP or range the scan can't parse, which would otherwise end the program
+func checkIPRange(ip string) error {
+	ip, _ = splitZone(strings.TrimSpace(ip))
+	if ip == "" {
+		return nil
+	}
+	if _, _, err := net.ParseCIDR(new(IPRanges).fixIP(ip)); err != nil {
+		return fmt.Errorf("invalid IP or range %q", ip)
+	}
+	return nil
+}
+
+// Adds the IPs to test of a single IP or range
+func (r *IPRanges) add(ip string) error {
+	if err := r.parseCIDR(ip); err != nil { // Parse IP range to get IP, IP range, and subnet mask
+		return err
+	}
+	if isIPv4(ip) { // Generate all IPv4 / IPv6 addresses to be tested (single / random / all)
+		r.chooseIPv4()
+	} else {
+		r.chooseIPv6()
+	}
+	return nil
+}
+
+// ReadIPList returns the [-f] IP range data, or the built-in copy of ip.txt / ipv6.txt when asked for or missing on disk
+func ReadIPList() (data []byte, embedded bool, err error) {
+	if IPFile == "" {
+		IPFile = defaultInputFile
+	}
+	return readIPList(IPFile, UseEmbedded)
+}
+
+// IP range data of file, or the built-in copy of a list of its name when useEmbedded or missing on disk
+func readIPList(file string, useEmbedded bool) (data []byte, embedded bool, err error) {
+	builtIn, ok := EmbeddedLists[filepath.Base(file)]
+	if useEmbedded {
+		if !ok {
+			builtIn = EmbeddedLists[defaultInputFile]
+		}
+		return builtIn, true, nil
+	}
+	data, err = os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) && ok {
+		return builtIn, true, nil
+	}
+	return data, false, err
+}
+
+// Leaves out IPs banned by the blocklist
+func skipBlocked(ips []*net.IPAddr) []*net.IPAddr {
+	if utils.Blocklist == nil {
+		return ips
+	}
+	allowed := ips[:0]
+	for _, ip := range ips {
+		if !utils.Blocklist.Banned(ip.String()) {
+			allowed = append(allowed, ip)
+		}
+	}
+	if skipped := len(ips) - len(allowed); skipped > 0 {
+		utils.Printf("[Info] Skipped %d IPs banned by the blocklist.\n", skipped)
+	}
+	return allowed
 }
@@ -0,0 +1,138 @@
+package task
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+func TestSplitZone(t *testing.T) {
+	tests := []struct {
+		in, ip, zone string
+	}{
+		{in: "1.1.1.1", ip: "1.1.1.1"},
+		{in: "fe80::1%eth0", ip: "fe80::1", zone: "eth0"},
+		{in: "fe80::%eth0/64", ip: "fe80::/64", zone: "eth0"},
+		{in: "fe80::1%eth0.100", ip: "fe80::1", zone: "eth0.100"},
+	}
+	for _, tt := range tests {
+		if ip, zone := splitZone(tt.in); ip != tt.ip || zone != tt.zone {
+			t.Errorf("splitZone(%q) = %q, %q, want %q, %q", tt.in, ip, zone, tt.ip, tt.zone)
+		}
+	}
+	if isIPv4("fe80::1%eth0.100") {
+		t.Error("zone with dots detected as IPv4")
+	}
+}
+
+func TestLoadIPRangesZone(t *testing.T) {
+	oldIPText := IPText
+	t.Cleanup(func() { IPText = oldIPText })
+	IPText = "fe80::1%eth0, 1.1.1.1"
+	ips, err := loadIPRanges(globalConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 2 {
+		t.Fatalf("got %d IPs, want 2", len(ips))
+	}
+	if ips[0].Zone != "eth0" || ips[1].Zone != "" {
+		t.Errorf("zones = %q, %q", ips[0].Zone, ips[1].Zone)
+	}
+}
+
+func TestLoadIPRangesErrors(t *testing.T) {
+	if _, err := loadIPRanges(&scanConfig{ipRanges: []string{"1.1.1.1/99"}}); err == nil {
+		t.Error("invalid range: want an error")
+	}
+	if _, err := loadIPRanges(&scanConfig{ipFile: filepath.Join(t.TempDir(), "missing.txt")}); err == nil {
+		t.Error("missing IP file without a built-in copy: want an error")
+	}
+}
+
+func TestSourceRangesEmbedded(t *testing.T) {
+	list, err := sourceRanges(&scanConfig{ipFile: "ipv6.txt", useEmbedded: true})
+	if err != nil || len(list) == 0 || isIPv4(list[0]) {
+		t.Errorf("built-in ipv6.txt = %d ranges, %v, want its IPv6 ranges", len(list), err)
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	ips, err := Candidates([]string{"1.1.1.1", " 1.0.0.0/24", "2606:4700::1", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, subnet, _ := net.ParseCIDR("1.0.0.0/24")
+	if len(ips) != 3 || ips[0].String() != "1.1.1.1" || ips[1].String() != "2606:4700::1" || !subnet.Contains(ips[2].IP) {
+		t.Errorf("got %v", ips)
+	}
+	if _, err := Candidates([]string{"1.1.1.1/99"}); err == nil {
+		t.Error("invalid range: want an error")
+	}
+}
+
+func TestSubnetOf(t *testing.T) {
+	tests := []struct {
+		ip, want string
+	}{
+		{ip: "104.16.12.34", want: "104.16.12.0"},
+		{ip: "::ffff:104.16.12.34", want: "104.16.12.0"},
+		{ip: "2606:4700:1234:5678::1", want: "2606:4700:1234::"},
+	}
+	for _, tt := range tests {
+		if got := subnetOf(&net.IPAddr{IP: net.ParseIP(tt.ip)}); got != tt.want {
+			t.Errorf("subnetOf(%s) = %s, want %s", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	oldIPText, oldTestAll := IPText, TestAll
+	t.Cleanup(func() { IPText, TestAll = oldIPText, oldTestAll })
+	IPText, TestAll = "1.1.1.0/24, 1.0.0.1", true
+	counts, ips, err := DryRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 2 || counts[0] != (RangeCount{Range: "1.1.1.0/24", IPs: 256}) || counts[1] != (RangeCount{Range: "1.0.0.1", IPs: 1}) {
+		t.Errorf("counts = %v", counts)
+	}
+	if len(ips) != 257 {
+		t.Errorf("got %d IPs, want 257", len(ips))
+	}
+}
+
+func TestSkipBlocked(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("# Shared list\n104.16.0.0/24\n2606:4700::1\n"))
+	}))
+	defer server.Close()
+	blocklist, err := utils.LoadBlocklist("", 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blocklist.Refresh(server.URL, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	blocklist.Fail("1.1.1.1")
+	utils.Blocklist = blocklist
+	defer func() { utils.Blocklist = nil }()
+
+	var ips []*net.IPAddr
+	for _, ip := range []string{"104.16.0.7", "104.16.1.7", "1.1.1.1", "1.0.0.1", "2606:4700::1", "2606:4700::2"} {
+		ips = append(ips, &net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	var allowed []string
+	for _, ip := range skipBlocked(ips) {
+		allowed = append(allowed, ip.String())
+	}
+	if want := []string{"104.16.1.7", "1.0.0.1", "2606:4700::2"}; !slices.Equal(allowed, want) {
+		t.Errorf("skipBlocked = %v, want %v", allowed, want)
+	}
+}
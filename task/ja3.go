@@ -0,0 +1,275 @@
+package task
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+var (
+	// HelloFingerprint records the JA3 and JA4 of the ClientHello sent to each IP
+	HelloFingerprint bool
+	// JA3Only keeps the IPs whose ClientHello had this JA3 (hash or full string) or JA4, empty keeps any
+	JA3Only string
+
+	// Fingerprints of the last ClientHello sent to each IP
+	helloFingerprints sync.Map
+)
+
+// Fingerprints of a ClientHello
+type helloFingerprint struct {
+	ja3     string // Full JA3 string
+	ja3Hash string
+	ja4     string
+}
+
+// Records the fingerprints of the ClientHello a connection sent
+func recordHello(ip *net.IPAddr, conn *utls.UConn) {
+	if !HelloFingerprint && JA3Only == "" || conn.HandshakeState.Hello == nil {
+		return
+	}
+	if f, err := fingerprintHello(conn.HandshakeState.Hello.Raw); err == nil {
+		helloFingerprints.Store(ip.IP.String(), f)
+	}
+}
+
+// JA3 hash and JA4 of the last ClientHello sent to an IP
+func helloFingerprintOf(ip *net.IPAddr) (ja3, ja4 string) {
+	f, ok := helloFingerprints.Load(ip.IP.String())
+	if !ok {
+		return "", ""
+	}
+	return f.(helloFingerprint).ja3Hash, f.(helloFingerprint).ja4
+}
+
+// Whether the last ClientHello sent to an IP matches [-ja3-only], an IP without one only passes when there is no filter
+func helloAccepted(ip *net.IPAddr) bool {
+	if JA3Only == "" {
+		return true
+	}
+	v, ok := helloFingerprints.Load(ip.IP.String())
+	if !ok {
+		return false
+	}
+	f := v.(helloFingerprint)
+	return JA3Only == f.ja3 || strings.EqualFold(JA3Only, f.ja3Hash) || strings.EqualFold(JA3Only, f.ja4)
+}
+
+// Computes the JA3 and JA4 fingerprints of a ClientHello handshake message
+func fingerprintHello(raw []byte) (helloFingerprint, error) {
+	h, err := parseHello(raw)
+	if err != nil {
+		return helloFingerprint{}, err
+	}
+	join := func(values []uint16, format func(uint16) string, sep string) string {
+		s := make([]string, len(values))
+		for i, v := range values {
+			s[i] = format(v)
+		}
+		return strings.Join(s, sep)
+	}
+	decimal := func(v uint16) string { return strconv.Itoa(int(v)) }
+	hex4 := func(v uint16) string { return fmt.Sprintf("%04x", v) }
+
+	var f helloFingerprint
+	f.ja3 = fmt.Sprintf("%d,%s,%s,%s,%s", h.version, join(h.ciphers, decimal, "-"), join(h.extensions, decimal, "-"),
+		join(h.groups, decimal, "-"), join(h.pointFormats, decimal, "-"))
+	sum := md5.Sum([]byte(f.ja3))
+	f.ja3Hash = hex.EncodeToString(sum[:])
+
+	version := h.version
+	for _, v := range h.versions {
+		version = max(version, v)
+	}
+	versions := map[uint16]string{0x0304: "13", 0x0303: "12", 0x0302: "11", 0x0301: "10", 0x0300: "s3"}
+	ja4Version, ok := versions[version]
+	if !ok {
+		ja4Version = "00"
+	}
+	sni := "i"
+	if h.sni {
+		sni = "d"
+	}
+	ciphers := append([]uint16{}, h.ciphers...)
+	sort.Slice(ciphers, func(i, j int) bool { return ciphers[i] < ciphers[j] })
+	var extensions []uint16
+	for _, e := range h.extensions {
+		if e != 0x0000 && e != 0x0010 { // SNI and ALPN are already in the first part
+			extensions = append(extensions, e)
+		}
+	}
+	sort.Slice(extensions, func(i, j int) bool { return extensions[i] < extensions[j] })
+	exts := join(extensions, hex4, ",")
+	if len(h.sigAlgs) > 0 {
+		exts += "_" + join(h.sigAlgs, hex4, ",")
+	}
+	f.ja4 = fmt.Sprintf("t%s%s%02d%02d%s_%s_%s", ja4Version, sni, min(len(h.ciphers), 99), min(len(h.extensions), 99), ja4ALPN(h.alpn),
+		ja4Hash(len(ciphers), join(ciphers, hex4, ",")), ja4Hash(len(extensions), exts))
+	return f, nil
+}
+
+// First 12 hex digits of the SHA-256 of a JA4 list, zeros for an empty one
+func ja4Hash(n int, list string) string {
+	if n == 0 {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(list))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// First and last character of the first ALPN protocol, hex digits when they aren't alphanumeric
+func ja4ALPN(alpn string) string {
+	if alpn == "" {
+		return "00"
+	}
+	alnum := func(c byte) bool { return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+	first, last := alpn[0], alpn[len(alpn)-1]
+	if alnum(first) && alnum(last) {
+		return string([]byte{first, last})
+	}
+	return hex.EncodeToString([]byte{first})[:1] + hex.EncodeToString([]byte{last})[1:]
+}
+
+// ClientHello fields the fingerprints are made of, GREASE values left out
+type clientHello struct {
+	version      uint16
+	ciphers      []uint16
+	extensions   []uint16
+	groups       []uint16
+	pointFormats []uint16
+	versions     []uint16
+	sigAlgs      []uint16
+	sni          bool
+	alpn         string
+}
+
+var errMalformedHello = errors.New("malformed ClientHello")
+
+// Reserved values clients send to keep servers tolerant of unknown ones (RFC 8701)
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// Reads length-prefixed fields of a handshake message
+type helloReader []byte
+
+func (r *helloReader) bytes(n int) ([]byte, bool) {
+	if n < 0 || len(*r) < n {
+		return nil, false
+	}
+	b := (*r)[:n]
+	*r = (*r)[n:]
+	return b, true
+}
+
+// A field with a size prefix of n bytes
+func (r *helloReader) vector(n int) (helloReader, bool) {
+	size, ok := r.bytes(n)
+	if !ok {
+		return nil, false
+	}
+	length := 0
+	for _, b := range size {
+		length = length<<8 | int(b)
+	}
+	b, ok := r.bytes(length)
+	return b, ok
+}
+
+// uint16 values of a field, GREASE left out
+func (r helloReader) uint16s() []uint16 {
+	var values []uint16
+	for ; len(r) >= 2; r = r[2:] {
+		if v := binary.BigEndian.Uint16(r); !isGREASE(v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func parseHello(raw []byte) (*clientHello, error) {
+	r := helloReader(raw)
+	if t, ok := r.bytes(1); !ok || t[0] != 1 {
+		return nil, errMalformedHello
+	}
+	body, ok := r.vector(3)
+	if !ok {
+		return nil, errMalformedHello
+	}
+	h := &clientHello{}
+	version, ok := body.bytes(2)
+	if !ok {
+		return nil, errMalformedHello
+	}
+	h.version = binary.BigEndian.Uint16(version)
+	if _, ok := body.bytes(32); !ok { // Random
+		return nil, errMalformedHello
+	}
+	if _, ok := body.vector(1); !ok { // Session ID
+		return nil, errMalformedHello
+	}
+	ciphers, ok := body.vector(2)
+	if !ok {
+		return nil, errMalformedHello
+	}
+	h.ciphers = ciphers.uint16s()
+	if _, ok := body.vector(1); !ok { // Compression methods
+		return nil, errMalformedHello
+	}
+	if len(body) == 0 {
+		return h, nil
+	}
+	extensions, ok := body.vector(2)
+	if !ok {
+		return nil, errMalformedHello
+	}
+	for len(extensions) > 0 {
+		header, ok := extensions.bytes(2)
+		if !ok {
+			return nil, errMalformedHello
+		}
+		data, ok := extensions.vector(2)
+		if !ok {
+			return nil, errMalformedHello
+		}
+		t := binary.BigEndian.Uint16(header)
+		if isGREASE(t) {
+			continue
+		}
+		h.extensions = append(h.extensions, t)
+		switch t {
+		case 0x0000:
+			h.sni = true
+		case 0x000a:
+			groups, _ := data.vector(2)
+			h.groups = groups.uint16s()
+		case 0x000b:
+			formats, _ := data.vector(1)
+			for _, f := range formats {
+				h.pointFormats = append(h.pointFormats, uint16(f))
+			}
+		case 0x000d:
+			algs, _ := data.vector(2)
+			h.sigAlgs = algs.uint16s()
+		case 0x0010:
+			protocols, _ := data.vector(2)
+			if proto, ok := protocols.vector(1); ok {
+				h.alpn = string(proto)
+			}
+		case 0x002b:
+			versions, _ := data.vector(1)
+			h.versions = versions.uint16s()
+		}
+	}
+	return h, nil
+}
@@ -0,0 +1,110 @@
+package task
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// Handshake message of a ClientHello with the given cipher suites and extensions
+func buildHello(ciphers []uint16, extensions [][2][]byte) []byte {
+	u16 := func(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+	body := append(u16(0x0303), make([]byte, 32)...) // Version, random
+	body = append(body, 0)                           // Session ID
+	body = append(body, u16(uint16(2*len(ciphers)))...)
+	for _, c := range ciphers {
+		body = append(body, u16(c)...)
+	}
+	body = append(body, 1, 0) // Compression methods
+	var exts []byte
+	for _, e := range extensions {
+		exts = append(append(append(exts, e[0]...), u16(uint16(len(e[1])))...), e[1]...)
+	}
+	body = append(append(body, u16(uint16(len(exts)))...), exts...)
+	return append([]byte{1, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+func TestFingerprintHello(t *testing.T) {
+	ext := func(t uint16, data ...byte) [2][]byte { return [2][]byte{binary.BigEndian.AppendUint16(nil, t), data} }
+	hello := buildHello([]uint16{0x1a1a, 0x1302, 0x1301, 0xc02b}, [][2][]byte{
+		ext(0x2a2a),
+		ext(0x0000, 0, 6, 0, 0, 3, 'a', '.', 'b'),       // SNI
+		ext(0x000a, 0, 6, 0x3a, 0x3a, 0, 0x1d, 0, 0x17), // Groups: GREASE, x25519, secp256r1
+		ext(0x000b, 1, 0),                         // Point formats: uncompressed
+		ext(0x000d, 0, 4, 0x04, 0x03, 0x08, 0x04), // Signature algorithms
+		ext(0x0010, 0, 3, 2, 'h', '2'),            // ALPN
+		ext(0x002b, 4, 0x4a, 0x4a, 0x03, 0x04),    // Supported versions: GREASE, TLS 1.3
+	})
+	f, err := fingerprintHello(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "771,4866-4865-49195,0-10-11-13-16-43,29-23,0"; f.ja3 != want {
+		t.Errorf("JA3 = %s, want %s", f.ja3, want)
+	}
+	if len(f.ja3Hash) != 32 {
+		t.Errorf("JA3 hash = %s", f.ja3Hash)
+	}
+	hash := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])[:12]
+	}
+	if want := "t13d0306h2_" + hash("1301,1302,c02b") + "_" + hash("000a,000b,000d,002b_0403,0804"); f.ja4 != want {
+		t.Errorf("JA4 = %s, want %s", f.ja4, want)
+	}
+
+	for _, raw := range [][]byte{nil, {1}, hello[:40], {2, 0, 0, 0}} {
+		if _, err := fingerprintHello(raw); err == nil {
+			t.Errorf("fingerprintHello(%x) accepted", raw)
+		}
+	}
+}
+
+func TestFingerprintHelloOfGoClient(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		_ = tls.Client(client, &tls.Config{ServerName: "example.com", NextProtos: []string{"h2", "http/1.1"}}).Handshake()
+	}()
+	defer client.Close()
+	defer server.Close()
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(server, header); err != nil {
+		t.Fatal(err)
+	}
+	record := make([]byte, int(header[3])<<8|int(header[4]))
+	if _, err := io.ReadFull(server, record); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fingerprintHello(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(f.ja3, "771,") || !strings.HasPrefix(f.ja4, "t13d") || !strings.Contains(f.ja4, "h2_") {
+		t.Errorf("fingerprints of a Go ClientHello = %s, %s", f.ja3, f.ja4)
+	}
+}
+
+func TestHelloAccepted(t *testing.T) {
+	old := JA3Only
+	t.Cleanup(func() { JA3Only = old })
+	ip := &net.IPAddr{IP: net.ParseIP("192.0.2.44")}
+	helloFingerprints.Store(ip.IP.String(), helloFingerprint{ja3: "771,4865,0,29,0", ja3Hash: "0123abcd", ja4: "t13d0101h2_aaaaaaaaaaaa_bbbbbbbbbbbb"})
+	t.Cleanup(func() { helloFingerprints.Delete(ip.IP.String()) })
+	other := &net.IPAddr{IP: net.ParseIP("192.0.2.45")}
+
+	for filter, want := range map[string]bool{"": true, "0123ABCD": true, "771,4865,0,29,0": true, "t13d0101h2_aaaaaaaaaaaa_bbbbbbbbbbbb": true, "ffff": false} {
+		JA3Only = filter
+		if got := helloAccepted(ip); got != want {
+			t.Errorf("helloAccepted() with %q = %v, want %v", filter, got, want)
+		}
+	}
+	JA3Only = "0123abcd"
+	if helloAccepted(other) {
+		t.Error("IP without a recorded ClientHello accepted")
+	}
+}
@@ -0,0 +1,76 @@
+package task
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const keepAliveTimeout = 5 * time.Second
+
+// KeepAliveRequests is the number of sequential requests sent over one connection per result, 0 disables
+var KeepAliveRequests = 0
+
+// KeepAlive measures how request latency develops when a connection is reused, one IP at a time
+func KeepAlive(data utils.DownloadSpeedSet) {
+	if KeepAliveRequests <= 0 || len(data) == 0 {
+		return
+	}
+	utils.Printf("Start keep-alive test (Number: %d, Requests per connection: %d)\n", len(data), KeepAliveRequests)
+	bar := utils.NewBar(len(data), "", "")
+	for i := range data {
+		data[i].KeepAlive, data[i].Reconnects = keepAliveHandler(data[i].IP)
+		bar.Grow(1, "")
+	}
+	bar.Done()
+}
+
+// Sends KeepAliveRequests HEAD requests over one connection, returning the latency of each and how often it had to reconnect
+func keepAliveHandler(ip *net.IPAddr) (latencies []time.Duration, reconnects int) {
+	var fragment FragmentMetrics
+	dial, dialTLS := getDialContext(ip, ProbeKeepAlive, &fragment), getDialTLSContext(ip, ProbeKeepAlive, &fragment)
+	var dials atomic.Int32
+	client := &http.Client{
+		Timeout: keepAliveTimeout,
+		Transport: &http.Transport{
+			MaxConnsPerHost: 1,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dials.Add(1)
+				return dial(ctx, network, addr)
+			},
+			DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dials.Add(1)
+				return dialTLS(ctx, network, addr)
+			},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	for i := 0; i < KeepAliveRequests; i++ {
+		req, err := http.NewRequest(http.MethodHead, URL, nil)
+		if err != nil {
+			break
+		}
+		req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
+		startTime, slept := time.Now(), fragment.Sleep()
+		resp, err := client.Do(req)
+		if err != nil {
+			break
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		latencies = append(latencies, max(time.Since(startTime)-(fragment.Sleep()-slept), 0))
+	}
+	if n := int(dials.Load()); n > 1 {
+		reconnects = n - 1
+	}
+	return
+}
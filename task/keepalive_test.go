@@ -0,0 +1,41 @@
+package task
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestKeepAliveHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		wantReconnects int
+	}{
+		{
+			name:    "reused",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+		},
+		{
+			name: "closed-after-each-request",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Connection", "close")
+			},
+			wantReconnects: 3,
+		},
+	}
+	KeepAliveRequests = 4
+	t.Cleanup(func() { KeepAliveRequests = 0 })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip := useTestServer(t, tt.handler)
+			latencies, reconnects := keepAliveHandler(ip)
+			if len(latencies) != KeepAliveRequests {
+				t.Fatalf("got %d latencies, want %d", len(latencies), KeepAliveRequests)
+			}
+			if reconnects != tt.wantReconnects {
+				t.Errorf("reconnects = %d, want %d", reconnects, tt.wantReconnects)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package task
+
+import "sync"
+
+const (
+	minAdaptiveRoutines = 8
+	aimdIncrease        = 10  // Threads added after a round without a failure spike
+	aimdSpikeMargin     = 0.1 // Failure rate above the moving average that counts as a spike
+)
+
+// AdaptiveRoutines tunes the latency test threads between minAdaptiveRoutines and maxRoutine, starting at Routines
+var AdaptiveRoutines = false
+
+// Concurrency limit of the latency test, adaptive limits grow additively and halve on failure spikes (AIMD)
+type limiter struct {
+	m        sync.Mutex
+	cond     *sync.Cond
+	active   int
+	limit    int
+	adaptive bool
+
+	// Current round, about one test per thread
+	done, attempts, failures int
+	// Moving average of the failure rate, negative before the first round
+	baseline float64
+}
+
+func newLimiter(limit int, adaptive bool) *limiter {
+	l := &limiter{limit: limit, adaptive: adaptive, baseline: -1}
+	l.cond = sync.NewCond(&l.m)
+	return l
+}
+
+func (l *limiter) acquire() {
+	l.m.Lock()
+	defer l.m.Unlock()
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+}
+
+// release frees a thread, reporting how many of its attempts failed
+func (l *limiter) release(failures, attempts int) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.active--
+	if l.adaptive {
+		l.observe(failures, attempts)
+	}
+	l.cond.Broadcast()
+}
+
+func (l *limiter) observe(failures, attempts int) {
+	l.done++
+	l.failures += failures
+	l.attempts += attempts
+	if l.done < l.limit || l.attempts == 0 {
+		return
+	}
+	rate := float64(l.failures) / float64(l.attempts)
+	switch {
+	case l.baseline < 0:
+		l.baseline = rate
+	case rate > l.baseline+aimdSpikeMargin:
+		l.limit = max(l.limit/2, minAdaptiveRoutines)
+	default:
+		l.limit = min(l.limit+aimdIncrease, maxRoutine)
+	}
+	// Steady losses (e.g. filtered ranges) become the new normal, only sudden changes count as spikes
+	l.baseline = l.baseline*0.8 + rate*0.2
+	l.done, l.attempts, l.failures = 0, 0, 0
+}
+
+// Current limit
+func (l *limiter) size() int {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.limit
+}
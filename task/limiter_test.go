@@ -0,0 +1,45 @@
+package task
+
+import "testing"
+
+// Completes one round of tests with the given failure rate
+func runRound(l *limiter, failureRate float64) {
+	n := l.size()
+	for i := 0; i < n; i++ {
+		l.acquire()
+		failures := 0
+		if float64(i) < failureRate*float64(n) {
+			failures = 4
+		}
+		l.release(failures, 4)
+	}
+}
+
+func TestLimiterAIMD(t *testing.T) {
+	l := newLimiter(100, true)
+	runRound(l, 0.3) // Sets the baseline
+	runRound(l, 0.3)
+	if got := l.size(); got != 100+aimdIncrease {
+		t.Fatalf("limit after a steady round = %d, want %d", got, 100+aimdIncrease)
+	}
+	runRound(l, 0.9)
+	if got := l.size(); got != (100+aimdIncrease)/2 {
+		t.Fatalf("limit after a spike = %d, want %d", got, (100+aimdIncrease)/2)
+	}
+	for i := 0; i < 20; i++ {
+		runRound(l, 1)
+		runRound(l, 0)
+	}
+	if got := l.size(); got < minAdaptiveRoutines || got > maxRoutine {
+		t.Errorf("limit %d out of bounds", got)
+	}
+}
+
+func TestLimiterFixed(t *testing.T) {
+	l := newLimiter(4, false)
+	runRound(l, 1)
+	runRound(l, 0)
+	if got := l.size(); got != 4 {
+		t.Errorf("fixed limit changed to %d", got)
+	}
+}
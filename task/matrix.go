@@ -0,0 +1,98 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+// MatrixCell is the outcome of a TLS handshake with one IP, SNI, port and ClientHello
+type MatrixCell struct {
+	IP    *net.IPAddr
+	SNI   string
+	Port  int
+	Hello string
+	Took  time.Duration // Of the handshake, when it succeeded
+	Err   error
+}
+
+// ParsePortList parses ports separated by commas, such as 443,2053,8443
+func ParsePortList(list string) ([]int, error) {
+	var ports []int
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		port, err := strconv.Atoi(s)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %q, use 1-65535", s)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// AllFingerprints returns the names accepted by [-fingerprint]
+func AllFingerprints() []string {
+	return append([]string(nil), clientHelloNames...)
+}
+
+// SweepMatrix tries a TLS handshake for every combination of the IPs, SNIs, ports and ClientHellos, threads at a time;
+// the cells come back in that nesting order
+func SweepMatrix(ips []*net.IPAddr, snis []string, ports []int, hellos []string, threads int) []MatrixCell {
+	cells := make([]MatrixCell, 0, len(ips)*len(snis)*len(ports)*len(hellos))
+	for _, ip := range ips {
+		for _, sni := range snis {
+			for _, port := range ports {
+				for _, hello := range hellos {
+					cells = append(cells, MatrixCell{IP: ip, SNI: sni, Port: port, Hello: hello})
+				}
+			}
+		}
+	}
+	utils.Printf("Start matrix sweep (IPs: %d, SNIs: %d, Ports: %d, Fingerprints: %d, Handshakes: %d)\n", len(ips), len(snis), len(ports), len(hellos), len(cells))
+	bar := utils.NewBar(len(cells), "Passed:", "")
+	var passed int
+	var m sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(threads, 1))
+	for i := range cells {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			cell := &cells[i]
+			cell.Took, cell.Err = matrixHandshake(cell)
+			m.Lock()
+			defer m.Unlock()
+			if cell.Err == nil {
+				passed++
+			}
+			bar.Grow(1, strconv.Itoa(passed))
+		}()
+	}
+	wg.Wait()
+	bar.Done()
+	return cells
+}
+
+func matrixHandshake(cell *MatrixCell) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+	addr := remoteAddr(cell.IP)
+	addr.Port = cell.Port
+	start := time.Now()
+	conn, err := dialTLS(ctx, newDialer(HandshakeTimeout), addr.String(), cell.SNI, getClientHelloId(cell.Hello), fragmentFor(ProbeSweep, true), nil)
+	if err != nil {
+		return 0, probeError(ProbeSweep, err)
+	}
+	took := time.Since(start)
+	_ = conn.Close()
+	return took, nil
+}
@@ -0,0 +1,42 @@
+package task
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+)
+
+func TestSweepMatrix(t *testing.T) {
+	server := testserver.New(testserver.Config{})
+	defer server.Close()
+	rootCAs = server.CertPool()
+	defer func() { rootCAs = nil }()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	ip := &net.IPAddr{IP: net.ParseIP("127.0.0.1")}
+	cells := SweepMatrix([]*net.IPAddr{ip}, []string{"127.0.0.1"}, []int{server.Port(), closedPort}, []string{"go"}, 2)
+	if len(cells) != 2 {
+		t.Fatalf("got %d cells, want 2", len(cells))
+	}
+	if cells[0].Port != server.Port() || cells[0].Err != nil {
+		t.Errorf("handshake with the edge: %+v", cells[0])
+	}
+	if cells[1].Port != closedPort || ErrorClass(cells[1].Err) != "connect-refused" {
+		t.Errorf("handshake with a closed port: %+v, want connect-refused", cells[1])
+	}
+}
+
+func TestParsePortList(t *testing.T) {
+	if ports, err := ParsePortList("443, 2053,8443"); err != nil || len(ports) != 3 || ports[1] != 2053 {
+		t.Errorf("ParsePortList = %v, %v", ports, err)
+	}
+	if _, err := ParsePortList("443,70000"); err == nil {
+		t.Error("port 70000 accepted")
+	}
+}
@@ -0,0 +1,54 @@
+package task
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+)
+
+// Hosts serving test files, any other download host is taken to be the user's own Cloudflare-proxied site
+var speedTestHosts = map[string]bool{
+	"speed.cloudflare.com": true,
+	"cf.xiu2.xyz":          true,
+}
+
+// CacheBust adds a random query parameter to every download: "auto" does so for the user's own site, "on" always, "off" never
+var CacheBust = "auto"
+
+func CheckCacheBust() error {
+	switch CacheBust {
+	case "auto", "on", "off":
+		return nil
+	}
+	return fmt.Errorf("invalid cache busting mode %q, use auto, on or off", CacheBust)
+}
+
+// IsOrigin reports whether the download URL is the user's own site, where every download test costs origin bandwidth
+func IsOrigin() bool {
+	u, err := url.Parse(URL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	// Proxied sites are reached by name, an IP literal is a local or test server
+	return host != "" && net.ParseIP(host) == nil && !speedTestHosts[host]
+}
+
+func cacheBusting() bool {
+	return CacheBust == "on" || CacheBust == "auto" && IsOrigin()
+}
+
+// Adds a random query parameter so the download misses the Cloudflare cache and reaches the origin
+func cacheBustURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	query := u.Query()
+	// The global source, a seeded one would repeat the parameters of the last run with the same [-seed]
+	query.Set("cfscan", strconv.FormatInt(rand.Int63(), 36))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,50 @@
+package task
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/cidr"
+)
+
+// IPs that are always tested and always kept in the results, by address
+var pinned = map[string]bool{}
+
+// LoadPins reads the IPs to pin from a file, one or more per line, text after # is a comment
+func LoadPins(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	prefixes, err := cidr.ParseList(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for _, p := range prefixes {
+		if !p.IsSingleIP() {
+			return fmt.Errorf("%s: %s is a range, pin single IPs", path, p)
+		}
+		pinned[p.Addr().String()] = true
+	}
+	return nil
+}
+
+func isPinned(ip *net.IPAddr) bool {
+	return pinned[ip.IP.String()]
+}
+
+// Adds the pinned IPs that are not already being tested
+func addPinned(ips []*net.IPAddr) []*net.IPAddr {
+	seen := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		seen[ip.IP.String()] = true
+	}
+	for ip := range pinned {
+		if !seen[ip] {
+			ips = append(ips, &net.IPAddr{IP: net.ParseIP(ip)})
+		}
+	}
+	return ips
+}
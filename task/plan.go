@@ -0,0 +1,123 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const (
+	planDownloadShare = 0.5             // Most of the budget and time the download test may take
+	planMinTimeout    = 2 * time.Second // Shortest download test still measuring a speed
+	planSpare         = 2               // Downloads planned per wanted result when the minimum speed may reject some
+)
+
+// Plan of a scan fitting a data budget and a time limit
+type Plan struct {
+	Sample    int           // IPs to latency-test
+	TestCount int           // Download tests
+	Timeout   time.Duration // Of each download test
+
+	PingBytes, DownloadBytes int64 // DownloadBytes including the [-sizes] and [-upload] tests of the results
+	PingTime, DownloadTime   time.Duration
+}
+
+// MakePlan sizes the tests of ipCount candidates to find want results within budget bytes and limit, 0 is unlimited;
+// the download test gets up to half of both and the latency test samples the IPs that fit in the rest
+func MakePlan(ipCount int, budget int64, limit time.Duration, want int) (Plan, error) {
+	checkPingDefault()
+	checkDownloadDefault()
+	if want <= 0 {
+		return Plan{}, errors.New("want must be at least 1")
+	}
+	plan := Plan{Sample: ipCount, TestCount: want, Timeout: Timeout}
+	if MinSpeed > 0 {
+		plan.TestCount = want * planSpare
+	}
+	if Disable {
+		plan.TestCount, plan.Timeout = want, 0
+	}
+	lineSpeed := float64(assumedLineSpeed)
+	if LineSpeed > 0 {
+		lineSpeed = LineSpeed
+	}
+	// The [-sizes] and [-upload] tests of the results come out of the download share of the budget
+	resultBytes := int64(want) * resultTestBytes()
+	if budget > 0 && float64(resultBytes) >= float64(budget)*planDownloadShare {
+		return plan, fmt.Errorf("the object size and upload tests of %d results take %d MB, more than half the budget", want, resultBytes>>20)
+	}
+
+	if !Disable {
+		if limit > 0 {
+			plan.Timeout = min(plan.Timeout, time.Duration(float64(limit)*planDownloadShare)/time.Duration(plan.TestCount))
+		}
+		if budget > 0 {
+			perTest := (float64(budget)*planDownloadShare - float64(resultBytes)) / float64(plan.TestCount)
+			plan.Timeout = min(plan.Timeout, time.Duration(perTest/lineSpeed*float64(time.Second)))
+		}
+		if plan.Timeout < planMinTimeout {
+			return plan, fmt.Errorf("%d download tests don't fit, raise the budget or the time, or want fewer results", plan.TestCount)
+		}
+		plan.Timeout = plan.Timeout.Truncate(time.Second)
+		perTest := min(downloadSize(), int64(plan.Timeout.Seconds()*lineSpeed))
+		plan.DownloadBytes = int64(plan.TestCount) * perTest
+		plan.DownloadTime = time.Duration(plan.TestCount) * plan.Timeout
+	}
+	plan.DownloadBytes += resultBytes
+
+	// Worst case of the latency test: every probe of every thread waits for the connect timeout
+	pingBytes, _ := EstimateDataUsage(1)
+	pingTime := time.Duration(PingTimes) * tcpConnectTimeout / time.Duration(Routines)
+	if limit > 0 {
+		plan.Sample = min(plan.Sample, int((limit-plan.DownloadTime)/pingTime))
+	}
+	if budget > 0 && pingBytes > 0 {
+		plan.Sample = min(plan.Sample, int((budget-plan.DownloadBytes)/pingBytes))
+	}
+	if plan.Sample < plan.TestCount {
+		return plan, fmt.Errorf("only %d IPs fit in the latency test, too few for %d download tests", max(plan.Sample, 0), plan.TestCount)
+	}
+	plan.PingBytes = int64(plan.Sample) * pingBytes
+	plan.PingTime = time.Duration(plan.Sample) * pingTime
+	return plan, nil
+}
+
+// Apply sets the download test options of the plan
+func (plan Plan) Apply() {
+	TestCount = plan.TestCount
+	if plan.Timeout > 0 {
+		Timeout = plan.Timeout
+	}
+}
+
+// Sample keeps n random IPs of the latency test, split by [-explore] between good and unexplored subnets when set
+// and by FamilyRatio between IPv4 and IPv6 otherwise; pinned IPs are always kept
+func (p *Ping) Sample(n int) {
+	if n >= len(p.ips) {
+		return
+	}
+	if Explore >= 0 && utils.Reputation != nil {
+		var pinned, rest []*net.IPAddr
+		for _, ip := range p.ips {
+			if isPinned(ip) {
+				pinned = append(pinned, ip)
+			} else {
+				rest = append(rest, ip)
+			}
+		}
+		p.ips = append(pinned, exploreSample(rest, max(n-len(pinned), 0), subnetReputations(), newRand())...)
+		return
+	}
+	newRand().Shuffle(len(p.ips), func(i, j int) { p.ips[i], p.ips[j] = p.ips[j], p.ips[i] })
+	p.ips = interleaveIPs(p.ips)
+	kept := make([]*net.IPAddr, 0, n)
+	for i, ip := range p.ips {
+		if i < n || isPinned(ip) {
+			kept = append(kept, ip)
+		}
+	}
+	p.ips = kept
+}
@@ -0,0 +1,56 @@
+package task
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMakePlan(t *testing.T) {
+	oldRoutines, oldTimes, oldTimeout, oldSpeed := Routines, PingTimes, Timeout, MinSpeed
+	t.Cleanup(func() { Routines, PingTimes, Timeout, MinSpeed = oldRoutines, oldTimes, oldTimeout, oldSpeed })
+	Routines, PingTimes, Timeout, MinSpeed = 200, 4, 10*time.Second, 0
+
+	// Half of 500 MB over 5 downloads at the assumed 10 MB/s
+	plan, err := MakePlan(6000, 500<<20, 20*time.Minute, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Sample != 6000 || plan.TestCount != 5 || plan.Timeout != 5*time.Second || plan.DownloadBytes != 250<<20 {
+		t.Errorf("plan = %+v", plan)
+	}
+
+	// 70 seconds left for the latency test, 20ms per IP with 200 threads
+	if plan, err = MakePlan(100000, 0, 2*time.Minute, 5); err != nil {
+		t.Fatal(err)
+	}
+	if plan.Timeout != 10*time.Second || plan.Sample != 3500 {
+		t.Errorf("plan = %+v", plan)
+	}
+
+	MinSpeed = 5
+	if plan, err = MakePlan(6000, 0, 0, 5); err != nil || plan.TestCount != 10 {
+		t.Errorf("plan = %+v, %v, want 10 downloads for 5 results above the minimum speed", plan, err)
+	}
+	if _, err = MakePlan(6000, 20<<20, 0, 5); err == nil {
+		t.Error("plan of 10 downloads in 20 MB accepted")
+	}
+}
+
+func TestPingSample(t *testing.T) {
+	old := pinned
+	t.Cleanup(func() { pinned = old })
+	pinned = map[string]bool{"1.1.1.1": true}
+	p := &Ping{}
+	for _, ip := range []string{"1.1.1.1", "1.1.1.2", "1.1.1.3", "1.1.1.4"} {
+		p.ips = append(p.ips, &net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	p.Sample(1)
+	found := false
+	for _, ip := range p.ips {
+		found = found || ip.IP.String() == "1.1.1.1"
+	}
+	if len(p.ips) > 2 || !found {
+		t.Errorf("sampled %v, want at most 2 IPs including the pinned one", p.ips)
+	}
+}
@@ -0,0 +1,167 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/cidr"
+)
+
+// Longest Retry-After honored, longer ones are taken as this
+const maxRetryAfter = 10 * time.Minute
+
+var (
+	// Polite caps the probes sent to each destination, honors Retry-After and refuses ranges outside the CDN
+	Polite = false
+	// PoliteRate is the number of connections per second polite mode opens to one destination IP
+	PoliteRate = 2.0
+)
+
+// Ranges Cloudflare publishes at cloudflare.com/ips, the built-in lists add the ranges other networks announce for it
+var cloudflareRanges = []string{
+	"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22", "141.101.64.0/18", "108.162.192.0/18",
+	"190.93.240.0/20", "188.114.96.0/20", "197.234.240.0/22", "198.41.128.0/17", "162.158.0.0/15", "104.16.0.0/13",
+	"104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+	"2400:cb00::/32", "2606:4700::/32", "2803:f800::/32", "2405:b500::/32", "2405:8100::/32", "2a06:98c0::/29", "2c0f:f248::/32",
+}
+
+// CheckPolite validates the polite mode rate
+func CheckPolite() error {
+	if Polite && PoliteRate <= 0 {
+		return fmt.Errorf("invalid polite rate %v, use a number of connections per second above 0", PoliteRate)
+	}
+	return nil
+}
+
+var (
+	cdnOnce     sync.Once
+	cdnPrefixes []netip.Prefix
+)
+
+// Reports whether ip is in a Cloudflare range or in the built-in IP lists
+func isCDNAddr(ip net.IP) bool {
+	cdnOnce.Do(func() {
+		for _, r := range cloudflareRanges {
+			cdnPrefixes = append(cdnPrefixes, netip.MustParsePrefix(r))
+		}
+		for _, list := range EmbeddedLists {
+			prefixes, _ := cidr.ParseList(bytes.NewReader(list))
+			cdnPrefixes = append(cdnPrefixes, prefixes...)
+		}
+	})
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range cdnPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns an error naming the first range with addresses outside the CDN, when in polite mode
+func checkCDNRanges(ranges []string) error {
+	if !Polite {
+		return nil
+	}
+	for _, r := range ranges {
+		p, err := cidr.Parse(strings.TrimSpace(r))
+		if err != nil {
+			continue // Reported when the range is parsed for testing
+		}
+		// A range is inside the CDN when both of its ends are; the lists are made of whole ranges
+		if !isCDNAddr(p.Addr().AsSlice()) || !isCDNAddr(lastAddr(p).AsSlice()) {
+			return fmt.Errorf("%s is not a Cloudflare range, polite mode only scans the CDN; use [-i-know-what-im-doing] to scan it anyway", r)
+		}
+	}
+	return nil
+}
+
+// Last address of a range
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+var (
+	politeMu sync.Mutex
+	// Earliest time of the next connection to each destination IP
+	politeNext = make(map[string]time.Time)
+)
+
+// Waits for the turn of the destination of address, failing with ErrThrottled when it lies beyond the deadline of ctx
+func politeWait(ctx context.Context, address string) error {
+	if !Polite {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	now := time.Now()
+	politeMu.Lock()
+	at := now
+	if next, ok := politeNext[host]; ok && next.After(now) {
+		at = next
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(at) {
+		politeMu.Unlock()
+		return fmt.Errorf("%w: polite mode holds %s back for %v", ErrThrottled, host, at.Sub(now).Round(time.Millisecond))
+	}
+	politeNext[host] = at.Add(time.Duration(float64(time.Second) / PoliteRate))
+	politeMu.Unlock()
+
+	if wait := at.Sub(now); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Holds the next connections to ip back for the Retry-After of a response, when in polite mode
+func politeBackOff(ip *net.IPAddr, retryAfter time.Duration) {
+	if !Polite || retryAfter <= 0 {
+		return
+	}
+	until := time.Now().Add(min(retryAfter, maxRetryAfter))
+	politeMu.Lock()
+	defer politeMu.Unlock()
+	if until.After(politeNext[ip.IP.String()]) {
+		politeNext[ip.IP.String()] = until
+	}
+}
+
+// Retry-After of a response in seconds or as an HTTP date, 0 without one
+func retryAfter(resp *http.Response) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
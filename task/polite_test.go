@@ -0,0 +1,49 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPoliteWait(t *testing.T) {
+	defer func(rate float64) { Polite, PoliteRate = false, rate }(PoliteRate)
+	Polite, PoliteRate = true, 20
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := politeWait(context.Background(), "192.0.2.1:443"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first connection goes at once, the next two 50ms apart
+	if took := time.Since(start); took < 90*time.Millisecond {
+		t.Errorf("3 connections at 20/s took %v, want at least 100ms", took)
+	}
+
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"30"}}}
+	recordFailure(&net.IPAddr{IP: net.ParseIP("192.0.2.2")}, statusError(ProbeHTTPing, resp))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := politeWait(ctx, "192.0.2.2:443"); !errors.Is(err, ErrThrottled) {
+		t.Errorf("connection within the Retry-After = %v, want %v", err, ErrThrottled)
+	}
+	if err := politeWait(ctx, "192.0.2.3:443"); err != nil {
+		t.Errorf("connection to another IP = %v, want none", err)
+	}
+}
+
+func TestCheckCDNRanges(t *testing.T) {
+	defer func() { Polite = false }()
+	Polite = true
+	if err := checkCDNRanges([]string{"104.16.0.0/24", "162.159.1.1", "2606:4700::/48"}); err != nil {
+		t.Errorf("Cloudflare ranges refused: %v", err)
+	}
+	for _, r := range []string{"8.8.8.8", "104.0.0.0/8", "2001:db8::/32"} {
+		if err := checkCDNRanges([]string{r}); err == nil {
+			t.Errorf("%s accepted, want it refused", r)
+		}
+	}
+}
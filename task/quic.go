@@ -0,0 +1,144 @@
+package task
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/fragmenter/udp"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const (
+	quicTimeout = 2 * time.Second
+	quicTries   = 2
+	// Smallest datagram a server answers with a Version Negotiation packet (RFC 9000, section 14.1)
+	quicMinDatagram = 1200
+	// Reserved version of the 0x?a?a?a?a pattern, never supported, so the server lists the versions it supports
+	quicGreaseVersion = 0x1a2a3a4a
+)
+
+var (
+	// QUIC probes every result for QUIC on UDP at the test port, since many networks treat TCP and UDP 443 differently
+	QUIC = false
+	// QUICPad shapes the datagrams of the QUIC probes ([-quic-pad]), nil sends plain Initials of quicMinDatagram
+	QUICPad *udp.Padding
+)
+
+// Names of the QUIC versions in the results, others are written in hex
+var quicVersions = map[uint32]string{0x00000001: "v1", 0x6b3343cf: "v2"}
+
+// ProbeQUIC records for every result whether it answers QUIC on UDP and the round trip of the answer, one IP at a time,
+// and downloads the test file over HTTP/3 from the ones answering unless the download test is disabled
+func ProbeQUIC(data utils.DownloadSpeedSet) {
+	if !QUIC || len(data) == 0 {
+		return
+	}
+	if viaClient != nil {
+		utils.Println("[Info] The SSH jump host only forwards TCP, skipping the QUIC test.")
+		return
+	}
+	utils.Printf("Start QUIC test (Number: %d, Port: UDP %d)\n", len(data), TCPPort)
+	bar := utils.NewBar(len(data), "", "")
+	r := newRand()
+	for i := range data {
+		if RunContext.Err() != nil { // Interrupted
+			break
+		}
+		versions, rtt, err := quicProbe(data[i].IP, r)
+		data[i].QUIC, data[i].QUICDelay = "no", 0
+		if err == nil {
+			data[i].QUIC, data[i].QUICDelay = strings.Join(versions, " "), rtt
+			if !Disable {
+				data[i].QUICSpeed, _ = quicDownload(data[i].IP, r)
+			}
+		}
+		bar.Grow(1, "")
+	}
+	bar.Done()
+}
+
+// Sends a QUIC Initial of an unsupported version, which a QUIC server answers with the versions it supports,
+// without a handshake: the answer shows UDP reaches a QUIC endpoint and its round trip; r shapes the datagrams
+func quicProbe(ip *net.IPAddr, r *rand.Rand) ([]string, time.Duration, error) {
+	var local *net.UDPAddr
+	if SourceAddr != nil {
+		local = &net.UDPAddr{IP: SourceAddr.IP, Zone: SourceAddr.Zone}
+	}
+	tcp := remoteAddr(ip)
+	conn, err := net.DialUDP("udp", local, &net.UDPAddr{IP: tcp.IP, Port: tcp.Port, Zone: tcp.Zone})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	if err := QUICPad.WriteNoise(r, conn.Write); err != nil {
+		return nil, 0, err
+	}
+	packet, dcid, scid := quicInitial(QUICPad.DatagramSize(r))
+	buffer := make([]byte, 1500)
+	for try := 0; try < quicTries; try++ {
+		start := time.Now()
+		if _, err := conn.Write(packet); err != nil {
+			return nil, 0, err
+		}
+		_ = conn.SetReadDeadline(start.Add(quicTimeout))
+		for {
+			n, err := conn.Read(buffer)
+			if err != nil {
+				break // Lost or filtered, tried again
+			}
+			if versions, ok := parseVersionNegotiation(buffer[:n], dcid, scid); ok {
+				return versions, time.Since(start), nil
+			}
+		}
+	}
+	return nil, 0, errors.New("no QUIC answer")
+}
+
+// A long header packet of the grease version with random connection IDs, padded to size (at least quicMinDatagram)
+func quicInitial(size int) (packet, dcid, scid []byte) {
+	dcid, scid = make([]byte, 8), make([]byte, 8)
+	_, _ = crand.Read(dcid)
+	_, _ = crand.Read(scid)
+	packet = make([]byte, max(size, quicMinDatagram))
+	packet[0] = 0xc0 // Long header, fixed bit, Initial
+	binary.BigEndian.PutUint32(packet[1:5], quicGreaseVersion)
+	packet[5] = byte(len(dcid))
+	copy(packet[6:], dcid)
+	packet[14] = byte(len(scid))
+	copy(packet[15:], scid)
+	return packet, dcid, scid
+}
+
+// Versions of a Version Negotiation packet answering ours: version 0, our connection IDs swapped (RFC 8999, section 6)
+func parseVersionNegotiation(packet, dcid, scid []byte) ([]string, bool) {
+	if len(packet) < 7 || packet[0]&0x80 == 0 || binary.BigEndian.Uint32(packet[1:5]) != 0 {
+		return nil, false
+	}
+	rest := packet[5:]
+	ids := [][]byte{scid, dcid}
+	for _, want := range ids {
+		if len(rest) < 1 || len(rest) < 1+int(rest[0]) || string(rest[1:1+int(rest[0])]) != string(want) {
+			return nil, false
+		}
+		rest = rest[1+int(rest[0]):]
+	}
+	var versions []string
+	for ; len(rest) >= 4; rest = rest[4:] {
+		v := binary.BigEndian.Uint32(rest)
+		if v&0x0f0f0f0f == 0x0a0a0a0a {
+			continue // Grease
+		}
+		name, ok := quicVersions[v]
+		if !ok {
+			name = fmt.Sprintf("0x%08x", v)
+		}
+		versions = append(versions, name)
+	}
+	return versions, len(versions) > 0
+}
@@ -0,0 +1,96 @@
+package task
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/fragmenter/udp"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestQUICProbe(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Answers like a QUIC server supporting v1, v2 and a grease version
+	go func() {
+		buffer := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			if n < quicMinDatagram {
+				continue
+			}
+			dcid := buffer[6 : 6+buffer[5]]
+			scid := buffer[15 : 15+buffer[14]]
+			answer := []byte{0x80, 0, 0, 0, 0, byte(len(scid))}
+			answer = append(answer, scid...)
+			answer = append(answer, byte(len(dcid)))
+			answer = append(answer, dcid...)
+			for _, v := range []uint32{0x1a2a3a4a, 1, 0x6b3343cf} {
+				answer = binary.BigEndian.AppendUint32(answer, v)
+			}
+			_, _ = conn.WriteToUDP(answer, addr)
+		}
+	}()
+	defer func(port int, pad *udp.Padding) { TCPPort, QUICPad = port, pad }(TCPPort, QUICPad)
+	TCPPort = conn.LocalAddr().(*net.UDPAddr).Port
+
+	versions, rtt, err := quicProbe(&net.IPAddr{IP: net.ParseIP("127.0.0.1")}, newRand())
+	if err != nil || !slices.Equal(versions, []string{"v1", "v2"}) || rtt <= 0 {
+		t.Errorf("quicProbe = %v, %v, %v, want v1 v2", versions, rtt, err)
+	}
+	// The server skips the junk ahead of the padded Initial
+	if QUICPad, err = udp.ParsePadding("size=1400,noise=2"); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _, err := quicProbe(&net.IPAddr{IP: net.ParseIP("127.0.0.1")}, newRand()); err != nil || len(versions) != 2 {
+		t.Errorf("padded quicProbe = %v, %v, want v1 v2", versions, err)
+	}
+}
+
+func TestQUICDownload(t *testing.T) {
+	body := strings.Repeat("x", 1<<20)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte(body)) })
+	// Only for its certificate, valid for example.com
+	certServer := httptest.NewTLSServer(handler)
+	defer certServer.Close()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http3.Server{Handler: handler, TLSConfig: &tls.Config{Certificates: certServer.TLS.Certificates}}
+	go func() { _ = server.Serve(conn) }()
+	defer server.Close()
+
+	defer func(u string, port int, timeout time.Duration, pad *udp.Padding) {
+		rootCAs, URL, TCPPort, Timeout, QUICPad = nil, u, port, timeout, pad
+	}(URL, TCPPort, Timeout, QUICPad)
+	rootCAs = x509.NewCertPool()
+	rootCAs.AddCert(certServer.Certificate())
+	URL, TCPPort, Timeout = "https://example.com/file", conn.LocalAddr().(*net.UDPAddr).Port, 2*time.Second
+	if QUICPad, err = udp.ParsePadding("size=1350,noise=2"); err != nil {
+		t.Fatal(err)
+	}
+
+	speed, err := quicDownload(&net.IPAddr{IP: net.ParseIP("127.0.0.1")}, newRand())
+	if err != nil || speed <= 0 {
+		t.Errorf("quicDownload = %v, %v, want a speed", speed, err)
+	}
+	URL = "http://example.com/file"
+	if _, err := quicDownload(&net.IPAddr{IP: net.ParseIP("127.0.0.1")}, newRand()); err == nil {
+		t.Error("quicDownload of an http:// address: want an error")
+	}
+}
@@ -0,0 +1,26 @@
+package task
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// Seed of the scan's random sources and the number of sources handed out
+	randSeed, randStreams atomic.Int64
+)
+
+// InitRandSeed seeds the random sources of the scan, 0 picks a random seed; a fixed seed picks the same IPs every run
+func InitRandSeed(seed int64) {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	randSeed.Store(seed)
+	randStreams.Store(0)
+}
+
+// newRand returns a random source for a single goroutine, a *rand.Rand isn't safe for concurrent use
+func newRand() *rand.Rand {
+	return rand.New(rand.NewSource(randSeed.Load() + randStreams.Add(1)))
+}
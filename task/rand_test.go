@@ -0,0 +1,51 @@
+package task
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+)
+
+func TestLoadIPRangesSeed(t *testing.T) {
+	oldIPText := IPText
+	t.Cleanup(func() { IPText = oldIPText })
+	IPText = "104.16.0.0/16, 2606:4700::/120"
+	pick := func(seed int64) []string {
+		InitRandSeed(seed)
+		var list []string
+		ips, err := loadIPRanges(globalConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ip := range ips {
+			list = append(list, ip.String())
+		}
+		return list
+	}
+	first := pick(42)
+	if second := pick(42); !slices.Equal(first, second) {
+		t.Error("the same seed picked different IPs")
+	}
+	if other := pick(43); slices.Equal(first, other) {
+		t.Error("another seed picked the same IPs")
+	}
+}
+
+// Meant for go test -race: many workers append to the same latency results
+func TestScanConcurrent(t *testing.T) {
+	server := useEdge(t, testserver.Config{})
+	oldRoutines := Routines
+	t.Cleanup(func() { Routines = oldRoutines })
+	Routines = 16
+	IPText = strings.Repeat(server.IP().String()+",", 64)
+	for _, httping := range []bool{false, true} {
+		Httping = httping
+		ping := NewPing()
+		ping.Sample(48)
+		if got := len(ping.Run()); got != 48 {
+			t.Errorf("httping %v: %d of 48 IPs passed the latency test", httping, got)
+		}
+	}
+}
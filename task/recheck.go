@@ -0,0 +1,75 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+// Time each IP has to pass the recheck
+const recheckBudget = 2 * time.Second
+
+// RecheckCount is the number of best results probed again right before they are exported, 0 exports them as tested
+var RecheckCount = 0
+
+// Recheck probes the best RecheckCount results once more before they are exported, as an IP can die during a long scan:
+// a TLS handshake as the scan made them, a TCP connection for plain URLs. IPs failing it move behind the others with the
+// class of the failure, the next ones filling in for them.
+func Recheck(data utils.DownloadSpeedSet) utils.DownloadSpeedSet {
+	if RecheckCount <= 0 || len(data) == 0 {
+		return data
+	}
+	mode := HealthTCP
+	if strings.HasPrefix(URL, "https://") {
+		mode = HealthTLS
+	}
+	ips := make([]*net.IPAddr, len(data))
+	for i := range data {
+		ips[i] = data[i].IP
+	}
+	utils.Printf("[Info] Rechecking the best %d IPs before exporting them\n", min(RecheckCount, len(data)))
+	order, errs := RecheckIPs(ips, RecheckCount, mode)
+	if errs[order[0]] != nil {
+		utils.Println("[Warning] None of the IPs passed the recheck, the network may be down; exporting them as tested.")
+	}
+	rechecked := make(utils.DownloadSpeedSet, 0, len(data))
+	for _, i := range order {
+		if errs[i] != nil {
+			data[i].Error = ErrorClass(errs[i])
+		}
+		rechecked = append(rechecked, data[i])
+	}
+	return rechecked
+}
+
+// RecheckIPs probes the IPs in order with a quick health check of mode until n have passed, and returns the order to use
+// them in, the passed ones first and then the rest as they were, failed ones last; errs holds the failure of each IP.
+func RecheckIPs(ips []*net.IPAddr, n int, mode string) (order []int, errs []error) {
+	errs = make([]error, len(ips))
+	var passed, failed, rest []int
+	for i, ip := range ips {
+		if len(passed) >= n {
+			rest = append(rest, i)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), recheckBudget)
+		_, err := HealthCheck(ctx, ip, mode)
+		cancel()
+		if err != nil {
+			utils.Printf("[Warning] %s failed the recheck, falling back to the next IP: %v\n", ip, err)
+			var probeErr *ProbeError
+			if errors.As(err, &probeErr) {
+				recordFailure(ip, probeErr)
+			}
+			errs[i] = err
+			failed = append(failed, i)
+			continue
+		}
+		passed = append(passed, i)
+	}
+	return append(append(passed, rest...), failed...), errs
+}
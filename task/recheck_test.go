@@ -0,0 +1,45 @@
+package task
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+func TestRecheck(t *testing.T) {
+	server := testserver.New(testserver.Config{})
+	defer server.Close()
+	rootCAs = server.CertPool()
+	defer func(u string, port, count int) { rootCAs, URL, TCPPort, RecheckCount = nil, u, port, count }(URL, TCPPort, RecheckCount)
+	URL, TCPPort = "https://127.0.0.1/", server.Port()
+
+	// 127.0.0.2 is loopback too, but nothing listens there
+	dead, alive := net.ParseIP("127.0.0.2"), net.ParseIP("127.0.0.1")
+	ips := []*net.IPAddr{{IP: dead}, {IP: alive}, {IP: alive}, {IP: dead}}
+	order, errs := RecheckIPs(ips, 1, HealthTCP)
+	if len(order) != 4 || order[0] != 1 || order[1] != 2 || order[2] != 3 || order[3] != 0 {
+		t.Errorf("order = %v, want the first live IP, the unprobed rest and then the dead one", order)
+	}
+	if errs[0] == nil || errs[1] != nil || errs[3] != nil {
+		t.Errorf("errs = %v, want only the probed dead IP failing", errs)
+	}
+
+	data := utils.DownloadSpeedSet{
+		{PingData: &utils.PingData{IP: &net.IPAddr{IP: dead}}, DownloadSpeed: 3},
+		{PingData: &utils.PingData{IP: &net.IPAddr{IP: alive}}, DownloadSpeed: 2},
+	}
+	RecheckCount = 0
+	if got := Recheck(data); got[0].DownloadSpeed != 3 {
+		t.Error("Recheck without -recheck changed the order")
+	}
+	RecheckCount = 2
+	got := Recheck(data)
+	if len(got) != 2 || !got[0].IP.IP.Equal(alive) || !got[1].IP.IP.Equal(dead) {
+		t.Fatalf("rechecked = %v, %v, want the dead IP moved last", got[0].IP, got[1].IP)
+	}
+	if got[1].Error != "connect-refused" || got[0].Error != "" {
+		t.Errorf("errors = %q, %q, want the class of the failed recheck", got[0].Error, got[1].Error)
+	}
+}
@@ -0,0 +1,170 @@
+package task
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+// Most source addresses listed one by one at the end of the latency test
+const rotateListMax = 16
+
+var (
+	// SourceRotate rotates the local IPv6 address of each probe, nil sends IPv6 probes from the address the system chooses
+	SourceRotate *SourceRotation
+
+	// Connection attempts and successes of each rotated source address
+	rotateStats   = make(map[string]*[2]int)
+	rotateStatsMu sync.Mutex
+)
+
+// SourceRotation hands out a different local IPv6 address to each probe, in turn among the addresses assigned to this host
+// or at random within a prefix routed to it
+type SourceRotation struct {
+	addrs  []*net.IPAddr // Assigned addresses, used in turn
+	prefix *net.IPNet    // Prefix to pick random addresses of, bound with IP_FREEBIND
+	next   atomic.Uint32
+}
+
+// ParseSourceRotate parses [-src-rotate]: auto for the global IPv6 addresses of this host (e.g. its temporary privacy addresses)
+// or a prefix such as 2001:db8:1:2::/64
+func ParseSourceRotate(s string) (*SourceRotation, error) {
+	switch s {
+	case "":
+		return nil, nil
+	case "auto":
+		addrs, err := globalIPv6Addrs()
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) < 2 {
+			return nil, fmt.Errorf("this host has %d global IPv6 addresses, at least 2 are needed to rotate", len(addrs))
+		}
+		return &SourceRotation{addrs: addrs}, nil
+	}
+	_, prefix, err := net.ParseCIDR(s)
+	if err != nil || prefix.IP.To4() != nil {
+		return nil, fmt.Errorf("invalid source prefix %q, use auto or an IPv6 prefix such as 2001:db8:1:2::/64", s)
+	}
+	if ones, _ := prefix.Mask.Size(); ones > 120 {
+		return nil, fmt.Errorf("source prefix %q is too small to rotate, use a /64 or similar", s)
+	}
+	if !freeBindSupported {
+		return nil, errors.New("rotating within a prefix is only supported on Linux, use auto with addresses assigned to this host")
+	}
+	return &SourceRotation{prefix: prefix}, nil
+}
+
+// CheckSourceRotate validates [-src-rotate] against the other source options
+func CheckSourceRotate() error {
+	if SourceRotate != nil && SourceAddr != nil {
+		return errors.New("-src-rotate and -src can't be used together")
+	}
+	return nil
+}
+
+func globalIPv6Addrs() ([]*net.IPAddr, error) {
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	var addrs []*net.IPAddr
+	for _, addr := range ifaceAddrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() == nil && ipNet.IP.IsGlobalUnicast() {
+			addrs = append(addrs, &net.IPAddr{IP: ipNet.IP})
+		}
+	}
+	return addrs, nil
+}
+
+// Source address of the next probe
+func (r *SourceRotation) nextAddr() net.IP {
+	if r.prefix == nil {
+		return r.addrs[int(r.next.Add(1)-1)%len(r.addrs)].IP
+	}
+	ip := make(net.IP, net.IPv6len)
+	_, _ = rand.Read(ip)
+	for i := range ip {
+		ip[i] = r.prefix.IP[i] | ip[i]&^r.prefix.Mask[i]
+	}
+	return ip
+}
+
+// Binds the dialer of an IPv6 probe to the next source address
+func (r *SourceRotation) bind(dialer *net.Dialer) {
+	local := &net.TCPAddr{IP: r.nextAddr()}
+	if bound, ok := dialer.LocalAddr.(*net.TCPAddr); ok {
+		local.Port = bound.Port
+	}
+	dialer.LocalAddr = local
+	if r.prefix == nil {
+		return
+	}
+	// The address isn't assigned to any interface, the prefix is routed to the host
+	control := dialer.Control
+	dialer.Control = func(network, address string, c syscall.RawConn) error {
+		if control != nil {
+			if err := control(network, address, c); err != nil {
+				return err
+			}
+		}
+		var err error
+		if cerr := c.Control(func(fd uintptr) { err = setFreeBind(fd) }); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+}
+
+// Counts a connection attempt from a rotated source address
+func recordRotation(local net.Addr, ok bool) {
+	addr, isTCP := local.(*net.TCPAddr)
+	if !isTCP {
+		return
+	}
+	rotateStatsMu.Lock()
+	defer rotateStatsMu.Unlock()
+	stats := rotateStats[addr.IP.String()]
+	if stats == nil {
+		stats = new([2]int)
+		rotateStats[addr.IP.String()] = stats
+	}
+	stats[0]++
+	if ok {
+		stats[1]++
+	}
+}
+
+// PrintSourceRotation logs the connections made from each rotated source address, to see whether results depend on it
+func PrintSourceRotation() {
+	rotateStatsMu.Lock()
+	defer rotateStatsMu.Unlock()
+	if SourceRotate == nil || len(rotateStats) == 0 {
+		return
+	}
+	var attempts, succeeded int
+	for _, stats := range rotateStats {
+		attempts += stats[0]
+		succeeded += stats[1]
+	}
+	utils.Printf("[Info] Rotated IPv6 probes over %d source addresses, %d of %d connections succeeded.\n", len(rotateStats), succeeded, attempts)
+	if len(rotateStats) > rotateListMax {
+		return
+	}
+	addrs := make([]string, 0, len(rotateStats))
+	for addr := range rotateStats {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		stats := rotateStats[addr]
+		utils.Printf("    %-40s %d/%d (%.0f%%)\n", addr, stats[1], stats[0], float64(stats[1])/float64(stats[0])*100)
+	}
+}
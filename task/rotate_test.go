@@ -0,0 +1,29 @@
+package task
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSourceRotation(t *testing.T) {
+	if _, err := ParseSourceRotate("10.0.0.0/8"); err == nil {
+		t.Error("an IPv4 prefix is accepted")
+	}
+	if _, err := ParseSourceRotate("2001:db8::/124"); err == nil {
+		t.Error("a /124 is accepted")
+	}
+	_, prefix, _ := net.ParseCIDR("2001:db8:1:2::/64")
+	r := &SourceRotation{prefix: prefix}
+	a, b := r.nextAddr(), r.nextAddr()
+	if !prefix.Contains(a) || !prefix.Contains(b) || a.Equal(b) {
+		t.Errorf("random addresses %s and %s, want two addresses of %s", a, b, prefix)
+	}
+
+	addrs := []*net.IPAddr{{IP: net.ParseIP("2001:db8::1")}, {IP: net.ParseIP("2001:db8::2")}}
+	r = &SourceRotation{addrs: addrs}
+	for i := 0; i < 4; i++ {
+		if got := r.nextAddr(); !got.Equal(addrs[i%2].IP) {
+			t.Errorf("address %d = %s, want %s", i, got, addrs[i%2].IP)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package task
+
+import (
+	"net"
+	"sync"
+)
+
+var (
+	// RecordRoute records the local address and interface the system chose for each IP
+	RecordRoute = false
+
+	// Local address of the last connection to each IP
+	routes sync.Map
+	// Interface name by local IP, read once
+	interfaceNames     map[string]string
+	interfaceNamesOnce sync.Once
+)
+
+type route struct {
+	source, iface string
+}
+
+func recordRoute(conn net.Conn) {
+	if !RecordRoute {
+		return
+	}
+	local, ok1 := conn.LocalAddr().(*net.TCPAddr)
+	remote, ok2 := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok1 || !ok2 {
+		return
+	}
+	iface := local.Zone
+	if iface == "" {
+		iface = interfaceOf(local.IP)
+	}
+	routes.Store(remote.IP.String(), route{source: local.IP.String(), iface: iface})
+}
+
+// Source IP and interface the last connection to an IP went out of
+func routeOf(ip *net.IPAddr) (source, iface string) {
+	if r, ok := routes.Load(ip.IP.String()); ok {
+		return r.(route).source, r.(route).iface
+	}
+	return "", ""
+}
+
+func interfaceOf(ip net.IP) string {
+	interfaceNamesOnce.Do(func() {
+		interfaceNames = make(map[string]string)
+		ifaces, err := net.Interfaces()
+		if err != nil {
+			return
+		}
+		for _, iface := range ifaces {
+			addrs, err := iface.Addrs()
+			if err != nil {
+				continue
+			}
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok {
+					interfaceNames[ipNet.IP.String()] = iface.Name
+				}
+			}
+		}
+	})
+	return interfaceNames[ip.String()]
+}
@@ -0,0 +1,218 @@
+package task
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+// Starts a local edge and points the whole scan pipeline at it
+func useEdge(t *testing.T, config testserver.Config) *testserver.Server {
+	t.Helper()
+	server := testserver.New(config)
+	t.Cleanup(server.Close)
+
+	oldIPText, oldPort, oldURL, oldRootCAs := IPText, TCPPort, URL, rootCAs
+	oldHttping, oldPingTimes, oldTimeout, oldTestCount := Httping, PingTimes, Timeout, TestCount
+	oldColo, oldColomap := HttpingCFColo, HttpingCFColomap
+	t.Cleanup(func() {
+		IPText, TCPPort, URL, rootCAs = oldIPText, oldPort, oldURL, oldRootCAs
+		Httping, PingTimes, Timeout, TestCount = oldHttping, oldPingTimes, oldTimeout, oldTestCount
+		HttpingCFColo, HttpingCFColomap = oldColo, oldColomap
+	})
+
+	IPText = server.IP().String()
+	TCPPort = server.Port()
+	URL = server.DownloadURL(4 << 20)
+	rootCAs = server.CertPool()
+	PingTimes = 2
+	Timeout = time.Second
+	TestCount = 1
+	return server
+}
+
+func runScan() utils.DownloadSpeedSet {
+	pingData := NewPing().Run().FilterDelay().FilterLossRate()
+	return TestDownloadSpeed(pingData)
+}
+
+func TestScanTCPing(t *testing.T) {
+	useEdge(t, testserver.Config{})
+	result := runScan()
+	if len(result) != 1 {
+		t.Fatalf("got %d results, want 1", len(result))
+	}
+	if result[0].Received != PingTimes {
+		t.Errorf("received %d of %d pings", result[0].Received, PingTimes)
+	}
+	if result[0].DownloadSpeed <= 0 {
+		t.Errorf("download speed = %v, want > 0", result[0].DownloadSpeed)
+	}
+}
+
+func TestScanHTTPing(t *testing.T) {
+	latency := 50 * time.Millisecond
+	useEdge(t, testserver.Config{Latency: latency})
+	Httping = true
+	result := runScan()
+	if len(result) != 1 {
+		t.Fatalf("got %d results, want 1", len(result))
+	}
+	if result[0].Delay < latency {
+		t.Errorf("delay = %v, want at least %v", result[0].Delay, latency)
+	}
+}
+
+func TestScanHTTPingColo(t *testing.T) {
+	tests := []struct {
+		colo string
+		want int
+	}{
+		{colo: "fra,ams", want: 1},
+		{colo: "LAX", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.colo, func(t *testing.T) {
+			useEdge(t, testserver.Config{Colo: "FRA"})
+			Httping = true
+			HttpingCFColo = tt.colo
+			HttpingCFColomap = MapColoMap()
+			if got := len(NewPing().Run()); got != tt.want {
+				t.Errorf("got %d IPs, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanHTTPingColoInline(t *testing.T) {
+	useEdge(t, testserver.Config{Colo: "NRT"})
+	Httping = true
+	ColoInline = true
+	t.Cleanup(func() { ColoInline = false })
+	result := NewPing().Run()
+	if len(result) != 1 || result[0].Colo != "NRT" {
+		t.Fatalf("got %+v, want one IP in NRT", result)
+	}
+}
+
+func TestScanBandwidth(t *testing.T) {
+	bandwidth := int64(1 << 20)
+	useEdge(t, testserver.Config{Bandwidth: bandwidth})
+	result := runScan()
+	if len(result) != 1 {
+		t.Fatalf("got %d results, want 1", len(result))
+	}
+	if speed := result[0].DownloadSpeed; speed < float64(bandwidth)/4 || speed > float64(bandwidth)*4 {
+		t.Errorf("download speed = %.0f B/s, want about %d B/s", speed, bandwidth)
+	}
+}
+
+func TestScanResetAfter(t *testing.T) {
+	useEdge(t, testserver.Config{ResetAfter: 64 * 1024, Bandwidth: 256 * 1024})
+	Timeout = 3 * time.Second
+	start := time.Now()
+	result := runScan()
+	// The reset must end the download instead of waiting for the window to run out
+	if elapsed := time.Since(start); elapsed >= Timeout {
+		t.Errorf("scan took %v after the connection was reset", elapsed)
+	}
+	if len(result) != 1 {
+		t.Fatalf("got %d results, want 1", len(result))
+	}
+}
+
+func TestScanFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults testserver.Faults
+		// Number of IPs expected to pass the latency test
+		want int
+	}{
+		{name: "handshake-reset", faults: testserver.Faults{HandshakeReset: 1}, want: 0},
+		{name: "stall", faults: testserver.Faults{Stall: 1}, want: 1},
+		{name: "truncate", faults: testserver.Faults{Truncate: 1, Seed: 1}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useEdge(t, testserver.Config{Faults: tt.faults})
+			Httping = true
+			start := time.Now()
+			result := runScan()
+			if elapsed := time.Since(start); elapsed > Timeout+HandshakeTimeout+2*time.Second {
+				t.Errorf("scan took %v", elapsed)
+			}
+			if len(result) != tt.want {
+				t.Errorf("got %d results, want %d", len(result), tt.want)
+			}
+		})
+	}
+}
+
+func TestScanPerColo(t *testing.T) {
+	server := useEdge(t, testserver.Config{Colo: "AMS"})
+	ip := server.IP().String()
+	IPText = ip + "," + ip + "," + ip
+	TestCount = 3
+	PerColo = 1
+	t.Cleanup(func() { PerColo = 0 })
+	result := runScan()
+	if len(result) != 1 {
+		t.Fatalf("got %d results, want 1", len(result))
+	}
+	if result[0].Colo != "AMS" {
+		t.Errorf("colo = %q, want AMS", result[0].Colo)
+	}
+}
+
+func TestScanDownloadThreads(t *testing.T) {
+	// Each download lasts the whole window
+	server := useEdge(t, testserver.Config{Bandwidth: 256 << 10})
+	ip := server.IP().String()
+	IPText = strings.Repeat(ip+",", 5) + ip
+	TestCount = 3
+	DownloadRoutines = 3
+	t.Cleanup(func() { DownloadRoutines = 1 })
+	start := time.Now()
+	result := runScan()
+	if len(result) != 3 {
+		t.Fatalf("got %d results, want 3", len(result))
+	}
+	for _, r := range result {
+		if r.DownloadSpeed <= 0 {
+			t.Errorf("download speed = %v, want > 0", r.DownloadSpeed)
+		}
+	}
+	if took := time.Since(start); took > 2*Timeout {
+		t.Errorf("3 downloads on 3 threads took %v, want about one window of %v", took, Timeout)
+	}
+}
+
+func TestSweepFingerprints(t *testing.T) {
+	server := useEdge(t, testserver.Config{})
+	old := FingerprintSweep
+	t.Cleanup(func() { FingerprintSweep = old })
+	var err error
+	if FingerprintSweep, err = ParseFingerprints("chrome, GO,chrome"); err != nil {
+		t.Fatal(err)
+	}
+	result := runScan()
+	if len(result) != 1 {
+		t.Fatalf("got %d results, want 1", len(result))
+	}
+	SweepFingerprints(result)
+	if want := "chrome:ok go:ok"; result[0].Fingerprints != want {
+		t.Errorf("Fingerprints = %q, want %q", result[0].Fingerprints, want)
+	}
+
+	server.Close()
+	SweepFingerprints(result)
+	if want := "chrome:fail go:fail"; result[0].Fingerprints != want {
+		t.Errorf("Fingerprints of a closed edge = %q, want %q", result[0].Fingerprints, want)
+	}
+	if _, err := ParseFingerprints("chrome,opera"); err == nil {
+		t.Error("ParseFingerprints accepted an unknown fingerprint")
+	}
+}
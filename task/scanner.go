@@ -0,0 +1,222 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+// Options of a Scanner, zero values keep the defaults of the command line
+type Options struct {
+	IPRanges    []string // IPs or ranges to test, nil reads IPFile
+	IPFile      string   // File of IP ranges, e.g. ip.txt, the built-in copy when missing
+	UseEmbedded bool     // Reads the built-in copy of IPFile (ip.txt when it has none) rather than the file
+
+	Routines  int  // Latency test threads
+	Port      int  // Test port
+	PingTimes int  // Latency tests per IP
+	Httping   bool // HTTP latency test instead of TCP
+
+	URL              string        // Download test address
+	Timeout          time.Duration // Of each download
+	HandshakeTimeout time.Duration // Of each download's TLS handshake
+	TestCount        int           // Results wanted from the download test
+	DownloadThreads  int           // Download tests at once
+	MinSpeed         float64       // In MB/s
+	DisableDownload  bool
+	ClientHello      string // Fingerprint of the TLS ClientHello, e.g. chrome or go
+
+	MaxDelay    time.Duration // Average delay upper limit
+	MinDelay    time.Duration // Average delay lower limit
+	MaxLossRate *float32      // 0~1, nil keeps every loss rate
+
+	Log      io.Writer             // Messages of the tests, nil prints them to stdout with progress bars
+	Progress func(done, total int) // Called from several goroutines as each test moves forward
+}
+
+// Scanner runs the scan pipeline (latency test, download test, sorting) from a Go program.
+// The probes of the pipeline take its options rather than the package settings, so Scanners may run at once; features
+// without an option (colo filters, fragmentation, the blocklist and so on) follow the package settings the command line sets.
+type Scanner struct {
+	Options Options
+}
+
+// NewScanner returns a Scanner with the options
+func NewScanner(options Options) *Scanner {
+	return &Scanner{Options: options}
+}
+
+// Average delay upper limit of the [-tl] default, which doesn't filter
+const noMaxDelay = 9999 * time.Millisecond
+
+// RunContext is the context of the command line scan, which main cancels on Ctrl-C or SIGTERM: the tests stop starting
+// new probes and abandon the ones under way, leaving the results so far to be written
+var RunContext = context.Background()
+
+// Run tests the IPs and returns the results sorted by download speed (by latency when the download test is disabled).
+// Canceling ctx stops the scan soon, returning the results so far with the error of ctx.
+func (s *Scanner) Run(ctx context.Context) (utils.DownloadSpeedSet, error) {
+	config, err := s.Options.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ping, err := newPing(config)
+	if err != nil {
+		return nil, err
+	}
+	pingData := ping.Run().FilterDelayRange(config.minDelay, config.maxDelay).FilterMaxLossRate(config.maxLossRate)
+	if err := ctx.Err(); err != nil {
+		return utils.DownloadSpeedSet(pingData), err
+	}
+	return testDownloadSpeed(config, pingData), ctx.Err()
+}
+
+// Settings of a scan read by the probes of the pipeline
+type scanConfig struct {
+	ctx context.Context
+
+	ipRanges    []string // nil reads ipFile
+	ipFile      string
+	useEmbedded bool
+
+	routines, port, pingTimes int
+	httping                   bool
+
+	url                        string
+	timeout, handshakeTimeout  time.Duration
+	testCount, downloadThreads int
+	minSpeed                   float64 // In MB/s
+	disable                    bool
+	hello                      string
+
+	minDelay, maxDelay time.Duration
+	maxLossRate        float32
+
+	log      io.Writer // nil prints with the package output, see utils.Log
+	progress func(done, total int)
+}
+
+// Settings of the command line scan, the package settings
+func globalConfig() *scanConfig {
+	config := &scanConfig{
+		ctx:         RunContext,
+		ipFile:      IPFile,
+		useEmbedded: UseEmbedded,
+
+		routines:  Routines,
+		port:      TCPPort,
+		pingTimes: PingTimes,
+		httping:   Httping,
+
+		url:              URL,
+		timeout:          Timeout,
+		handshakeTimeout: HandshakeTimeout,
+		testCount:        TestCount,
+		downloadThreads:  DownloadRoutines,
+		minSpeed:         MinSpeed,
+		disable:          Disable,
+		hello:            ClientHelloID,
+
+		minDelay:    utils.InputMinDelay,
+		maxDelay:    utils.InputMaxDelay,
+		maxLossRate: utils.InputMaxLossRate,
+	}
+	if IPText != "" {
+		config.ipRanges = splitRanges(IPText)
+	}
+	return config
+}
+
+// Settings of a Scanner run, the defaults of the command line where the options are zero
+func (o *Options) config(ctx context.Context) (*scanConfig, error) {
+	for _, r := range o.IPRanges {
+		if err := checkIPRange(r); err != nil {
+			return nil, err
+		}
+	}
+	if o.URL != "" {
+		if u, err := url.Parse(o.URL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid download test address %q", o.URL)
+		}
+	}
+	if o.Port < 0 || o.Port > 65535 {
+		return nil, fmt.Errorf("invalid test port %d, use 1-65535", o.Port)
+	}
+	if o.MaxLossRate != nil && (*o.MaxLossRate < 0 || *o.MaxLossRate > 1) {
+		return nil, errors.New("the maximum loss rate must be within 0~1")
+	}
+	config := &scanConfig{
+		ctx:         ctx,
+		ipRanges:    o.IPRanges,
+		ipFile:      orDefault(o.IPFile, defaultInputFile),
+		useEmbedded: o.UseEmbedded,
+
+		routines:  min(orDefault(o.Routines, defaultRoutines), maxRoutine),
+		port:      orDefault(o.Port, defaultPort),
+		pingTimes: orDefault(o.PingTimes, defaultPingTimes),
+		httping:   o.Httping,
+
+		url:              orDefault(o.URL, defaultURL),
+		timeout:          orDefault(o.Timeout, defaultTimeout),
+		handshakeTimeout: orDefault(o.HandshakeTimeout, defaultHandshakeTimeout),
+		testCount:        orDefault(o.TestCount, defaultTestNum),
+		downloadThreads:  max(o.DownloadThreads, 1),
+		minSpeed:         max(o.MinSpeed, defaultMinSpeed),
+		disable:          o.DisableDownload,
+		hello:            orDefault(o.ClientHello, defaultHelloID),
+
+		minDelay:    max(o.MinDelay, 0),
+		maxDelay:    orDefault(o.MaxDelay, noMaxDelay),
+		maxLossRate: 1,
+
+		log:      o.Log,
+		progress: o.Progress,
+	}
+	if o.MaxLossRate != nil {
+		config.maxLossRate = *o.MaxLossRate
+	}
+	if config.log == nil {
+		config.log = os.Stdout
+	}
+	return config, nil
+}
+
+// value unless it is the zero value or below, fallback otherwise
+func orDefault[T int | time.Duration | string](value, fallback T) T {
+	var zero T
+	if value <= zero {
+		return fallback
+	}
+	return value
+}
+
+// Prints a message of the tests
+func (c *scanConfig) printf(format string, a ...any) {
+	if c.log == nil {
+		utils.Printf(format, a...)
+		return
+	}
+	fmt.Fprintf(c.log, format, a...)
+}
+
+func (c *scanConfig) println(a ...any) {
+	if c.log == nil {
+		utils.Println(a...)
+		return
+	}
+	fmt.Fprintln(c.log, a...)
+}
+
+// Progress bar of a test of count items
+func (c *scanConfig) newBar(count int, start, end string) *utils.Bar {
+	if c.log == nil {
+		return utils.NewBar(count, start, end)
+	}
+	return utils.NewBarTo(c.log, c.progress, count, start, end)
+}
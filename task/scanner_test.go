@@ -0,0 +1,138 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+func TestScanner(t *testing.T) {
+	server := testserver.New(testserver.Config{})
+	defer server.Close()
+	rootCAs = server.CertPool()
+	defer func() { rootCAs = nil }()
+	oldURL, oldPort := URL, TCPPort
+
+	s := NewScanner(Options{
+		IPRanges:  []string{server.IP().String()},
+		Port:      server.Port(),
+		PingTimes: 2,
+		URL:       server.DownloadURL(1 << 20),
+		Timeout:   time.Second,
+		TestCount: 1,
+	})
+	result, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].DownloadSpeed <= 0 {
+		t.Fatalf("got %+v, want one downloaded result", result)
+	}
+	if URL != oldURL || TCPPort != oldPort {
+		t.Errorf("the package settings were left at %s:%d", URL, TCPPort)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled run = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestScannersAtOnce(t *testing.T) {
+	var servers [2]*testserver.Server
+	for i := range servers {
+		servers[i] = testserver.New(testserver.Config{})
+		defer servers[i].Close()
+	}
+	// The servers share their certificate authority
+	rootCAs = servers[0].CertPool()
+	defer func() { rootCAs = nil }()
+
+	var wg sync.WaitGroup
+	var results [2]utils.DownloadSpeedSet
+	var errs [2]error
+	for i, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = NewScanner(Options{
+				IPRanges:  []string{server.IP().String()},
+				Port:      server.Port(),
+				PingTimes: 2,
+				URL:       server.DownloadURL(1 << 20),
+				Timeout:   time.Second,
+				TestCount: 1,
+				Log:       io.Discard,
+			}).Run(context.Background())
+		}()
+	}
+	wg.Wait()
+	for i := range servers {
+		if errs[i] != nil || len(results[i]) != 1 || results[i][0].DownloadSpeed <= 0 {
+			t.Errorf("scanner %d = %+v, %v, want one downloaded result", i, results[i], errs[i])
+		}
+	}
+}
+
+func TestScannerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+	}{
+		{"invalid range", Options{IPRanges: []string{"1.1.1.1/99"}}},
+		{"missing IP file", Options{IPFile: filepath.Join(t.TempDir(), "missing.txt")}},
+		{"invalid URL", Options{IPRanges: []string{"1.1.1.1"}, URL: "cf.xiu2.xyz/url"}},
+		{"invalid port", Options{IPRanges: []string{"1.1.1.1"}, Port: 70000}},
+	}
+	for _, tc := range tests {
+		if _, err := NewScanner(tc.options).Run(context.Background()); err == nil {
+			t.Errorf("%s: want an error", tc.name)
+		}
+	}
+}
+
+func TestScannerLogProgress(t *testing.T) {
+	server := testserver.New(testserver.Config{})
+	defer server.Close()
+	rootCAs = server.CertPool()
+	defer func() { rootCAs = nil }()
+
+	var log bytes.Buffer
+	var mu sync.Mutex
+	var last [2]int
+	s := NewScanner(Options{
+		IPRanges:        []string{server.IP().String()},
+		Port:            server.Port(),
+		PingTimes:       2,
+		DisableDownload: true,
+		Log:             &log,
+		Progress: func(done, total int) {
+			mu.Lock()
+			last = [2]int{done, total}
+			mu.Unlock()
+		},
+	})
+	if _, err := s.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(log.String(), "Start latency test") {
+		t.Errorf("log = %q, want the start of the latency test", log.String())
+	}
+	if last != [2]int{1, 1} {
+		t.Errorf("last progress = %v, want [1 1]", last)
+	}
+	if utils.Log != os.Stdout || utils.OnProgress != nil {
+		t.Error("the log and progress callback were left set")
+	}
+}
@@ -0,0 +1,55 @@
+package task
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// Sessions kept per IP, one per SNI is enough
+const sessionCacheSize = 4
+
+var (
+	// SessionResume caches the TLS session tickets of each IP in the HTTPing latency test and resumes them in the download test
+	SessionResume = false
+
+	// Session cache of each IP
+	sessionCaches sync.Map
+	// Whether the download test resumed the session of each IP
+	resumptions sync.Map
+)
+
+type ipSessions struct {
+	cache      utls.ClientSessionCache
+	handshakes atomic.Int32 // Completed through the cache, so a ticket may be there
+}
+
+// Session cache of the IP for the probes that share sessions, nil for the others or when disabled
+func sessionsOf(ip *net.IPAddr, probe string) *ipSessions {
+	if !SessionResume || probe != ProbeHTTPing && probe != ProbeDownload {
+		return nil
+	}
+	s, _ := sessionCaches.LoadOrStore(ip.IP.String(), &ipSessions{cache: utls.NewLRUClientSessionCache(sessionCacheSize)})
+	return s.(*ipSessions)
+}
+
+// Records a handshake through the IP's cache; a download handshake after earlier ones tells whether resumption works
+func (s *ipSessions) record(ip *net.IPAddr, probe string, conn *utls.UConn) {
+	if s.handshakes.Add(1) > 1 && probe == ProbeDownload {
+		resumptions.LoadOrStore(ip.IP.String(), conn.ConnectionState().DidResume)
+	}
+}
+
+// Whether the first download handshake of an IP resumed a session of the latency test: yes, no or empty when not tried
+func resumptionOf(ip *net.IPAddr) string {
+	resumed, ok := resumptions.Load(ip.IP.String())
+	switch {
+	case !ok:
+		return ""
+	case resumed.(bool):
+		return "yes"
+	}
+	return "no"
+}
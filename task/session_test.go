@@ -0,0 +1,44 @@
+package task
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+)
+
+func TestSessionResume(t *testing.T) {
+	server := testserver.New(testserver.Config{})
+	defer server.Close()
+	rootCAs = server.CertPool()
+	defer func(resume bool, hello string, port int) {
+		rootCAs, SessionResume, ClientHelloID, TCPPort = nil, resume, hello, port
+	}(SessionResume, ClientHelloID, TCPPort)
+	SessionResume, ClientHelloID, TCPPort = true, "go", server.Port()
+	ip := &net.IPAddr{IP: net.ParseIP("127.0.0.1")}
+
+	get := func(probe string) {
+		client := http.Client{Transport: &http.Transport{DialTLSContext: getDialTLSContext(ip, probe, nil)}}
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "https://127.0.0.1/cdn-cgi/trace", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Reading the response takes in the TLS 1.3 tickets sent after the handshake
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		client.CloseIdleConnections()
+	}
+	get(ProbeDownload)
+	if got := resumptionOf(ip); got != "" {
+		t.Errorf("resumption without an earlier handshake = %q, want none", got)
+	}
+	get(ProbeHTTPing)
+	get(ProbeDownload)
+	if got := resumptionOf(ip); got != "yes" {
+		t.Errorf("resumption = %q, want yes", got)
+	}
+}
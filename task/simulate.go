@@ -0,0 +1,38 @@
+package task
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+)
+
+const defaultSimulateIPs = 20
+
+// Simulate points the scan at a local edge with injected faults, so new metrics can be checked
+// without a censored network. Every simulated IP is 127.0.0.1; the returned function stops the edge.
+func Simulate(opts string) (stop func(), err error) {
+	ips := defaultSimulateIPs
+	var serverOpts []string
+	for _, part := range strings.Split(opts, ",") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(part), "ips="); ok {
+			if ips, err = strconv.Atoi(value); err != nil || ips <= 0 {
+				return nil, fmt.Errorf("invalid ips: %s", value)
+			}
+			continue
+		}
+		serverOpts = append(serverOpts, part)
+	}
+	config, err := testserver.ParseConfig(strings.Join(serverOpts, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	server := testserver.New(config)
+	IPText = strings.TrimSuffix(strings.Repeat("127.0.0.1,", ips), ",")
+	TCPPort = server.Port()
+	URL = server.URL + "/__down"
+	rootCAs = server.CertPool()
+	return server.Close, nil
+}
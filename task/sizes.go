@@ -0,0 +1,128 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+// ObjectSizes are the payload sizes each result downloads once more, in bytes; empty disables
+var ObjectSizes []int64
+
+// ParseObjectSizes parses sizes separated by commas, such as 1MB,10MB,100MB
+func ParseObjectSizes(list string) ([]int64, error) {
+	var sizes []int64
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		size, err := utils.ParseSize(s)
+		if err != nil {
+			return nil, err
+		}
+		if size <= 0 {
+			return nil, fmt.Errorf("invalid size %q", s)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+// CheckObjectSizes validates that the test address takes the object size, in its bytes parameter like speed.cloudflare.com/__down
+func CheckObjectSizes() error {
+	if len(ObjectSizes) == 0 {
+		return nil
+	}
+	u, err := url.Parse(URL)
+	if err != nil || !u.Query().Has("bytes") {
+		return errors.New("-sizes needs a test address taking the size in its bytes parameter, such as https://speed.cloudflare.com/__down?bytes=1")
+	}
+	return nil
+}
+
+// Address of an object of size bytes
+func sizeURL(size int64) string {
+	u, err := url.Parse(URL)
+	if err != nil {
+		return URL
+	}
+	query := u.Query()
+	query.Set("bytes", strconv.FormatInt(size, 10))
+	u.RawQuery = query.Encode()
+	if cacheBusting() {
+		return cacheBustURL(u.String())
+	}
+	return u.String()
+}
+
+// TestObjectSizes downloads each of ObjectSizes from every result over a new connection, one IP at a time
+func TestObjectSizes(data utils.DownloadSpeedSet) {
+	if len(ObjectSizes) == 0 || len(data) == 0 {
+		return
+	}
+	utils.Printf("Start object size test (Number: %d, Sizes: %s)\n", len(data), formatSizes(ObjectSizes))
+	bar := utils.NewBar(len(data)*len(ObjectSizes), "", "")
+	for i := range data {
+		if RunContext.Err() != nil { // Interrupted
+			break
+		}
+		data[i].SizeSpeeds = make([]utils.SizeSpeed, len(ObjectSizes))
+		for j, size := range ObjectSizes {
+			data[i].SizeSpeeds[j] = utils.SizeSpeed{Size: size, Speed: objectSpeed(data[i].IP, size)}
+			bar.Grow(1, "")
+		}
+	}
+	bar.Done()
+}
+
+// Bytes per second from sending the request to the last byte of the object, as a browser fetching it sees it;
+// the connection is new, so small objects are dominated by the handshake and TCP slow start.
+// An object not complete within Timeout counts with the bytes received so far.
+func objectSpeed(ip *net.IPAddr, size int64) float64 {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext:        getDialContext(ip, ProbeDownload, nil),
+			DialTLSContext:     getDialTLSContext(ip, ProbeDownload, nil),
+			DisableCompression: true,
+		},
+	}
+	defer client.CloseIdleConnections()
+	ctx, cancel := context.WithTimeout(RunContext, HandshakeTimeout+Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sizeURL(size), nil)
+	if err != nil {
+		return 0
+	}
+	req.Header.Set("Accept-Encoding", "identity")
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		recordFailure(ip, probeError(ProbeDownload, err))
+		return 0
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		recordFailure(ip, statusError(ProbeDownload, resp))
+		return 0
+	}
+	n, _ := io.Copy(io.Discard, resp.Body)
+	return float64(n) / time.Since(start).Seconds()
+}
+
+// Sizes such as 1MB, 10MB, 512KB
+func formatSizes(sizes []int64) string {
+	labels := make([]string, len(sizes))
+	for i, size := range sizes {
+		labels[i] = utils.FormatSize(size)
+	}
+	return strings.Join(labels, ", ")
+}
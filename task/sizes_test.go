@@ -0,0 +1,45 @@
+package task
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+func TestSizeSpeeds(t *testing.T) {
+	if _, err := ParseObjectSizes("1MB,abc"); err == nil {
+		t.Error("invalid size accepted")
+	}
+	sizes, err := ParseObjectSizes("64KB, 1MB")
+	if err != nil || len(sizes) != 2 || sizes[0] != 64<<10 || sizes[1] != 1<<20 {
+		t.Fatalf("ParseObjectSizes = %v, %v", sizes, err)
+	}
+
+	server := testserver.New(testserver.Config{})
+	defer server.Close()
+	rootCAs = server.CertPool()
+	defer func(u string, port int, sizes []int64) {
+		rootCAs, URL, TCPPort, ObjectSizes = nil, u, port, sizes
+	}(URL, TCPPort, ObjectSizes)
+	URL, TCPPort, ObjectSizes = "https://127.0.0.1/__down?bytes=1", server.Port(), sizes
+	if err := CheckObjectSizes(); err != nil {
+		t.Fatal(err)
+	}
+	data := utils.DownloadSpeedSet{{PingData: &utils.PingData{IP: &net.IPAddr{IP: net.ParseIP("127.0.0.1")}}}}
+	TestObjectSizes(data)
+	if got := data[0].SizeSpeeds; len(got) != 2 || got[0].Size != 64<<10 || got[0].Speed <= 0 || got[1].Speed <= 0 {
+		t.Errorf("SizeSpeeds = %+v", got)
+	}
+
+	// A canceled run stops the test, as Ctrl-C does
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	defer func(ctx context.Context) { RunContext = ctx }(RunContext)
+	RunContext = ctx
+	if speed := objectSpeed(data[0].IP, 1<<20); speed != 0 {
+		t.Errorf("objectSpeed of a canceled run = %v, want 0", speed)
+	}
+}
@@ -0,0 +1,48 @@
+package task
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+)
+
+var (
+	// TOS is the IPv4 TOS / IPv6 traffic class byte of probe packets (DSCP << 2), -1 keeps the system default
+	TOS = -1
+	// TTL is the IPv4 TTL / IPv6 hop limit of probe packets, -1 keeps the system default
+	TTL = -1
+	// FwMark is the Linux SO_MARK of probe sockets for policy routing, 0 disables
+	FwMark = 0
+)
+
+// CheckSocketOptions validates the socket options
+func CheckSocketOptions() error {
+	if TOS < -1 || TOS > 255 {
+		return errors.New("TOS must be between 0 and 255")
+	}
+	if TTL == 0 || TTL < -1 || TTL > 255 {
+		return errors.New("TTL must be between 1 and 255")
+	}
+	if FwMark < 0 {
+		return errors.New("fwmark must not be negative")
+	}
+	if FwMark != 0 && !fwMarkSupported {
+		return errors.New("fwmark is only supported on Linux")
+	}
+	return nil
+}
+
+func socketOptionsSet() bool {
+	return TOS >= 0 || TTL > 0 || FwMark != 0
+}
+
+// Dialer control function applying the socket options before connecting
+func controlSocket(network, address string, c syscall.RawConn) error {
+	var err error
+	if cerr := c.Control(func(fd uintptr) {
+		err = setSocketOptions(fd, strings.HasSuffix(network, "6"))
+	}); cerr != nil {
+		return cerr
+	}
+	return err
+}
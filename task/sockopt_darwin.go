@@ -0,0 +1,38 @@
+package task
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	fwMarkSupported   = false
+	freeBindSupported = false
+)
+
+func setFreeBind(fd uintptr) error {
+	return errors.New("IP_FREEBIND is only supported on Linux")
+}
+
+func setSocketOptions(fd uintptr, ipv6 bool) error {
+	s := int(fd)
+	if TOS >= 0 {
+		if ipv6 {
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, TOS); err != nil {
+				return err
+			}
+		} else if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_TOS, TOS); err != nil {
+			return err
+		}
+	}
+	if TTL > 0 {
+		if ipv6 {
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, TTL); err != nil {
+				return err
+			}
+		} else if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_TTL, TTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
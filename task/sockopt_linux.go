@@ -0,0 +1,39 @@
+package task
+
+import "syscall"
+
+const (
+	fwMarkSupported   = true
+	freeBindSupported = true
+)
+
+// Allows binding to an address not assigned to any interface, of a prefix routed to the host
+func setFreeBind(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_FREEBIND, 1)
+}
+
+func setSocketOptions(fd uintptr, ipv6 bool) error {
+	s := int(fd)
+	if TOS >= 0 {
+		if ipv6 {
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, TOS); err != nil {
+				return err
+			}
+		} else if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_TOS, TOS); err != nil {
+			return err
+		}
+	}
+	if TTL > 0 {
+		if ipv6 {
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, TTL); err != nil {
+				return err
+			}
+		} else if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_TTL, TTL); err != nil {
+			return err
+		}
+	}
+	if FwMark != 0 {
+		return syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_MARK, FwMark)
+	}
+	return nil
+}
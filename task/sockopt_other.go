@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !windows
+
+package task
+
+import "errors"
+
+const (
+	fwMarkSupported   = false
+	freeBindSupported = false
+)
+
+func setFreeBind(fd uintptr) error {
+	return errors.New("IP_FREEBIND is only supported on Linux")
+}
+
+func setSocketOptions(fd uintptr, ipv6 bool) error {
+	return errors.New("socket options are not supported on this platform")
+}
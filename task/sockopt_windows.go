@@ -0,0 +1,37 @@
+package task
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	fwMarkSupported   = false
+	freeBindSupported = false
+	// IPV6_TCLASS from ws2ipdef.h, missing in package syscall
+	ipv6TrafficClass = 39
+)
+
+func setFreeBind(fd uintptr) error {
+	return errors.New("IP_FREEBIND is only supported on Linux")
+}
+
+func setSocketOptions(fd uintptr, ipv6 bool) error {
+	s := syscall.Handle(fd)
+	if TOS >= 0 {
+		if ipv6 {
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, ipv6TrafficClass, TOS); err != nil {
+				return err
+			}
+		} else if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_TOS, TOS); err != nil {
+			return err
+		}
+	}
+	if TTL > 0 {
+		if ipv6 {
+			return syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, TTL)
+		}
+		return syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_TTL, TTL)
+	}
+	return nil
+}
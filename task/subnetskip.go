@@ -0,0 +1,115 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Share of usable IPs below which a supernet isn't worth testing further
+const skipSubnetRate = 0.05
+
+// SkipSubnets is the confidence that a /16 (/32 for IPv6) whose first samples all failed has under 5% usable IPs,
+// its remaining IPs are skipped once reached; 0 disables
+var SkipSubnets = 0.0
+
+// CheckSkipSubnets validates [-skip-subnets]
+func CheckSkipSubnets() error {
+	if SkipSubnets < 0 || SkipSubnets >= 1 {
+		return errors.New("-skip-subnets must be between 0 and 1, e.g. 0.95")
+	}
+	return nil
+}
+
+// Number of samples that must all fail to reach the confidence: if a share r of a supernet's IPs were usable,
+// n samples would all fail with a probability of (1-r)^n
+func skipSamples(confidence float64) int {
+	return int(math.Ceil(math.Log(1-confidence) / math.Log(1-skipSubnetRate)))
+}
+
+// Outcome of the first samples of each supernet during the latency test, skipping those that failed throughout
+type subnetSkip struct {
+	samples int
+	m       sync.Mutex
+	bad     map[string]int // Failed samples of each supernet, -1 once one succeeded
+	skipped map[string]int // IPs skipped of each supernet
+}
+
+func newSubnetSkip(confidence float64) *subnetSkip {
+	return &subnetSkip{samples: skipSamples(confidence), bad: map[string]int{}, skipped: map[string]int{}}
+}
+
+// The /16 or /32 an IP belongs to
+func supernetOf(ip *net.IPAddr) string {
+	if v4 := ip.IP.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(16, 32)).String() + "/16"
+	}
+	return ip.IP.Mask(net.CIDRMask(32, 128)).String() + "/32"
+}
+
+// Reports whether the IP's supernet failed its first samples, counting the IP as skipped; pinned IPs are always tested
+func (s *subnetSkip) skip(ip *net.IPAddr) bool {
+	if isPinned(ip) {
+		return false
+	}
+	supernet := supernetOf(ip)
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.bad[supernet] < s.samples {
+		return false
+	}
+	s.skipped[supernet]++
+	return true
+}
+
+// Records the outcome of a sample, a single success keeps the supernet for good
+func (s *subnetSkip) observe(ip *net.IPAddr, good bool) {
+	supernet := supernetOf(ip)
+	s.m.Lock()
+	defer s.m.Unlock()
+	switch {
+	case good:
+		s.bad[supernet] = -1
+	case s.bad[supernet] >= 0:
+		s.bad[supernet]++
+	}
+}
+
+// Logs the skipped supernets, most IPs skipped first
+func (s *subnetSkip) print(config *scanConfig) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if len(s.skipped) == 0 {
+		return
+	}
+	supernets := make([]string, 0, len(s.skipped))
+	total := 0
+	for supernet, n := range s.skipped {
+		supernets = append(supernets, supernet)
+		total += n
+	}
+	sort.Slice(supernets, func(i, j int) bool {
+		a, b := supernets[i], supernets[j]
+		return s.skipped[a] > s.skipped[b] || s.skipped[a] == s.skipped[b] && a < b
+	})
+	shown := supernets[:min(len(supernets), 5)]
+	more := ""
+	if len(supernets) > len(shown) {
+		more = fmt.Sprintf(" and %d more", len(supernets)-len(shown))
+	}
+	config.printf("[Info] Skipped %d IPs of %d supernets whose first %d samples all failed: %s%s\n", total, len(supernets), s.samples, strings.Join(shown, ", "), more)
+}
+
+// A sample is good when the IP answered within the latency and loss limits of the results
+func (c *scanConfig) goodSample(recv int, totalDelay time.Duration) bool {
+	if recv == 0 {
+		return false
+	}
+	loss := float32(c.pingTimes-recv) / float32(c.pingTimes)
+	return totalDelay/time.Duration(recv) <= c.maxDelay && loss <= c.maxLossRate
+}
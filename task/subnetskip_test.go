@@ -0,0 +1,36 @@
+package task
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSkipSamples(t *testing.T) {
+	for confidence, want := range map[float64]int{0.9: 45, 0.95: 59, 0.99: 90} {
+		if got := skipSamples(confidence); got != want {
+			t.Errorf("skipSamples(%v) = %d, want %d", confidence, got, want)
+		}
+	}
+}
+
+func TestSubnetSkip(t *testing.T) {
+	s := newSubnetSkip(0.9)
+	bad := &net.IPAddr{IP: net.ParseIP("104.16.1.1")}
+	good := &net.IPAddr{IP: net.ParseIP("104.17.1.1")}
+	for i := 0; i < s.samples; i++ {
+		if s.skip(bad) {
+			t.Fatalf("skipped after %d of %d failed samples", i, s.samples)
+		}
+		s.observe(bad, false)
+		s.observe(good, i == 0)
+	}
+	if !s.skip(&net.IPAddr{IP: net.ParseIP("104.16.200.7")}) {
+		t.Error("the rest of a failed /16 isn't skipped")
+	}
+	if s.skip(good) {
+		t.Error("a /16 with a good sample is skipped")
+	}
+	if s.skip(&net.IPAddr{IP: net.ParseIP("104.18.1.1")}) {
+		t.Error("an untested /16 is skipped")
+	}
+}
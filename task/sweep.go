@@ -0,0 +1,68 @@
+package task
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+// Names accepted by [-fingerprint]
+var clientHelloNames = []string{"chrome", "firefox", "safari", "ios", "android", "qq", "edge", "360", "randomized", "go"}
+
+// FingerprintSweep lists the ClientHello fingerprints tried against every result, empty disables
+var FingerprintSweep []string
+
+// ParseFingerprints parses a list of [-fingerprint] names separated by commas
+func ParseFingerprints(list string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+			continue
+		}
+		if name == HelloSpecID && helloSpecData == nil {
+			return nil, fmt.Errorf("fingerprint %q needs [-hello-spec]", name)
+		}
+		if !slices.Contains(clientHelloNames, name) && name != HelloSpecID {
+			return nil, fmt.Errorf("unknown fingerprint %q, use %s or %s with [-hello-spec]", name, strings.Join(clientHelloNames, ", "), HelloSpecID)
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// SweepFingerprints tries a TLS handshake with each fingerprint of FingerprintSweep against every result, one IP at a time
+func SweepFingerprints(data utils.DownloadSpeedSet) {
+	if len(FingerprintSweep) == 0 || len(data) == 0 {
+		return
+	}
+	u, err := url.Parse(URL)
+	if err != nil {
+		return
+	}
+	utils.Printf("Start fingerprint sweep (Number: %d, Fingerprints: %s)\n", len(data), strings.Join(FingerprintSweep, ", "))
+	bar := utils.NewBar(len(data), "", "")
+	for i := range data {
+		data[i].Fingerprints = sweepIP(data[i].IP, u.Hostname())
+		bar.Grow(1, "")
+	}
+	bar.Done()
+}
+
+// Outcome of each fingerprint's handshake with an IP, e.g. "chrome:ok go:fail"
+func sweepIP(ip *net.IPAddr, serverName string) string {
+	results := make([]string, len(FingerprintSweep))
+	for i, name := range FingerprintSweep {
+		result := "ok"
+		if err := handshake(ip, serverName, getClientHelloId(name), fragmentFor(ProbeSweep, true)); err != nil {
+			result = "fail"
+		}
+		results[i] = name + ":" + result
+	}
+	return strings.Join(results, " ")
+}
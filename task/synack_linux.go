@@ -0,0 +1,141 @@
+package task
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// Longest wait of a fingerprint for the raw copy of its SYN-ACK
+	synAckWait = 20 * time.Millisecond
+	// SYN-ACKs kept unclaimed, e.g. of connections that timed out, before they are dropped
+	maxSynAcks = 4096
+)
+
+// Reads the TTL of the SYN-ACKs answering the latency test from raw sockets, as TCP sockets don't expose it;
+// the kernel hands raw sockets a copy of every TCP segment it receives
+type synAckSniffer struct {
+	port int
+	wg   sync.WaitGroup
+	v4   *ipv4.PacketConn
+	v6   *ipv6.PacketConn
+
+	m    sync.Mutex
+	ttls map[string]uint8 // By remote IP and local port
+}
+
+// Starts reading the SYN-ACKs from port, nil when raw sockets need privileges (CAP_NET_RAW) the scanner lacks
+func startSynAckSniffer(port int) *synAckSniffer {
+	s := &synAckSniffer{port: port, ttls: make(map[string]uint8)}
+	if c, err := net.ListenPacket("ip4:tcp", "0.0.0.0"); err == nil {
+		s.v4 = ipv4.NewPacketConn(c)
+		if s.v4.SetControlMessage(ipv4.FlagTTL, true) != nil {
+			_ = s.v4.Close()
+			s.v4 = nil
+		}
+	}
+	if c, err := net.ListenPacket("ip6:tcp", "::"); err == nil {
+		s.v6 = ipv6.NewPacketConn(c)
+		if s.v6.SetControlMessage(ipv6.FlagHopLimit, true) != nil {
+			_ = s.v6.Close()
+			s.v6 = nil
+		}
+	}
+	if s.v4 == nil && s.v6 == nil {
+		return nil
+	}
+	if s.v4 != nil {
+		s.wg.Add(1)
+		go s.read(func(b []byte) (int, int, net.Addr, error) {
+			n, cm, src, err := s.v4.ReadFrom(b)
+			if cm == nil {
+				return n, 0, src, err
+			}
+			return n, cm.TTL, src, err
+		})
+	}
+	if s.v6 != nil {
+		s.wg.Add(1)
+		go s.read(func(b []byte) (int, int, net.Addr, error) {
+			n, cm, src, err := s.v6.ReadFrom(b)
+			if cm == nil {
+				return n, 0, src, err
+			}
+			return n, cm.HopLimit, src, err
+		})
+	}
+	return s
+}
+
+// Records the SYN-ACKs read with readFrom, which returns the TCP segment, its TTL and its source, until it fails
+func (s *synAckSniffer) read(readFrom func([]byte) (n, ttl int, src net.Addr, err error)) {
+	defer s.wg.Done()
+	buffer := make([]byte, 1500)
+	for {
+		n, ttl, src, err := readFrom(buffer)
+		if err != nil {
+			return
+		}
+		addr, ok := src.(*net.IPAddr)
+		localPort, isSynAck := parseSynAck(buffer[:n], s.port)
+		if !ok || !isSynAck || ttl <= 0 {
+			continue
+		}
+		s.m.Lock()
+		if len(s.ttls) >= maxSynAcks {
+			clear(s.ttls)
+		}
+		s.ttls[synAckKey(addr.IP, localPort)] = uint8(ttl)
+		s.m.Unlock()
+	}
+}
+
+// Local port of a TCP segment that is a SYN-ACK from port, ok is false for any other segment
+func parseSynAck(segment []byte, port int) (localPort int, ok bool) {
+	if len(segment) < 20 || int(binary.BigEndian.Uint16(segment)) != port {
+		return 0, false
+	}
+	const syn, rst, ack = 0x02, 0x04, 0x10
+	if flags := segment[13]; flags&(syn|ack|rst) != syn|ack {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint16(segment[2:])), true
+}
+
+func synAckKey(ip net.IP, localPort int) string {
+	return net.JoinHostPort(ip.String(), strconv.Itoa(localPort))
+}
+
+// TTL of the SYN-ACK of the connection from localPort to ip, 0 when it wasn't seen
+func (s *synAckSniffer) ttl(ip net.IP, localPort int) uint8 {
+	key := synAckKey(ip, localPort)
+	for deadline := time.Now().Add(synAckWait); ; time.Sleep(time.Millisecond) {
+		s.m.Lock()
+		ttl, ok := s.ttls[key]
+		delete(s.ttls, key)
+		s.m.Unlock()
+		if ok || time.Now().After(deadline) {
+			return ttl
+		}
+	}
+}
+
+// Close stops reading
+func (s *synAckSniffer) Close() {
+	if s == nil {
+		return
+	}
+	if s.v4 != nil {
+		_ = s.v4.Close()
+	}
+	if s.v6 != nil {
+		_ = s.v6.Close()
+	}
+	s.wg.Wait()
+}
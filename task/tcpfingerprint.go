@@ -0,0 +1,145 @@
+package task
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+// TCP_INFO option flags
+const (
+	tcpiOptTimestamps = 1 << iota
+	tcpiOptSACK
+	tcpiOptWScale
+	tcpiOptECN
+)
+
+var (
+	// TCPFingerprint records the SYN-ACK parameters of each IP during TCPing (Linux only)
+	TCPFingerprint bool
+	// TCPSignature lists the expected edge fingerprints separated by ";", empty uses edgeSignatures
+	TCPSignature string
+)
+
+// SYN-ACKs of the Cloudflare edge: Linux hosts (initial TTL 64) answering with a 65535 byte window scaled by 13 and
+// SACK, with or without timestamps. The MSS is left out, the kernel reports it lowered to the path MTU.
+var edgeSignatures = []string{"ws=13,win=65535,ttl=64,ts,sack", "ws=13,win=65535,ttl=64,sack"}
+
+// SYN-ACK parameters of a connection
+type synAck struct {
+	mss     uint32
+	options uint8 // tcpiOpt flags
+	wscale  uint8
+	window  uint32 // 0 when the kernel doesn't report it
+	ttl     uint8  // 0 without a raw socket to read it
+}
+
+// Formats the peer's MSS, window scale, window, TTL and negotiated options, e.g. "mss=1460,ws=13,win=65535,ttl=57,ts,sack"
+func (s synAck) String() string {
+	parts := []string{fmt.Sprintf("mss=%d", s.mss)}
+	if s.options&tcpiOptWScale != 0 {
+		parts = append(parts, fmt.Sprintf("ws=%d", s.wscale))
+	}
+	if s.window != 0 {
+		parts = append(parts, fmt.Sprintf("win=%d", s.window))
+	}
+	if s.ttl != 0 {
+		parts = append(parts, fmt.Sprintf("ttl=%d", s.ttl))
+	}
+	if s.options&tcpiOptTimestamps != 0 {
+		parts = append(parts, "ts")
+	}
+	if s.options&tcpiOptSACK != 0 {
+		parts = append(parts, "sack")
+	}
+	if s.options&tcpiOptECN != 0 {
+		parts = append(parts, "ecn")
+	}
+	return strings.Join(parts, ",")
+}
+
+// Items of a fingerprint, the options with an empty value
+func parseFingerprint(fingerprint string) map[string]string {
+	items := make(map[string]string)
+	for _, item := range strings.Split(fingerprint, ",") {
+		if key, value, _ := strings.Cut(strings.TrimSpace(item), "="); key != "" {
+			items[key] = value
+		}
+	}
+	return items
+}
+
+// Initial TTL a TTL counted down from: 32, 64, 128 or 255
+func initialTTL(ttl string) int {
+	n, _ := strconv.Atoi(ttl)
+	for _, initial := range []int{32, 64, 128} {
+		if n <= initial {
+			return initial
+		}
+	}
+	return 255
+}
+
+// Reports whether fingerprint matches signature: the values the signature names, TTLs by the initial TTL they count
+// down from, the window and TTL only when they were measured, and the same TCP options
+func matchesSignature(fingerprint, signature string) bool {
+	got, want := parseFingerprint(fingerprint), parseFingerprint(signature)
+	for key, value := range want {
+		measured, ok := got[key]
+		switch {
+		case !ok && (key == "win" || key == "ttl"):
+			continue
+		case !ok:
+			return false
+		case key == "ttl":
+			if initialTTL(measured) != initialTTL(value) {
+				return false
+			}
+		case measured != value:
+			return false
+		}
+	}
+	for key, value := range got {
+		if _, ok := want[key]; !ok && value == "" { // An option the edge doesn't negotiate
+			return false
+		}
+	}
+	return true
+}
+
+// Signatures the fingerprints are compared with
+func signatures() []string {
+	if TCPSignature == "" {
+		return edgeSignatures
+	}
+	return strings.Split(TCPSignature, ";")
+}
+
+// Reports whether a fingerprint matches none of the edge signatures, hinting at a transparent proxy on the path
+func isMiddlebox(fingerprint string) bool {
+	if fingerprint == "" {
+		return false
+	}
+	for _, signature := range signatures() {
+		if matchesSignature(fingerprint, signature) {
+			return false
+		}
+	}
+	return true
+}
+
+// Flags IPs whose fingerprint matches none of the edge signatures
+func markMiddleboxes(data utils.PingDelaySet) {
+	mismatches := 0
+	for _, v := range data {
+		if isMiddlebox(v.TCPFingerprint) {
+			v.Middlebox = true
+			mismatches++
+		}
+	}
+	if mismatches > 0 {
+		utils.Printf("[Info] %d IPs have a SYN-ACK unlike the edge signatures [%s], possibly a middlebox on the path.\n", mismatches, strings.Join(signatures(), "] ["))
+	}
+}
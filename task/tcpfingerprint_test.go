@@ -0,0 +1,46 @@
+package task
+
+import "testing"
+
+func TestMatchesSignature(t *testing.T) {
+	tests := []struct {
+		fingerprint, signature string
+		want                   bool
+	}{
+		{"mss=1460,ws=13,win=65535,ttl=57,ts,sack", "ws=13,win=65535,ttl=64,ts,sack", true},
+		// Not measured without a raw socket or on old kernels
+		{"mss=1460,ws=13,ts,sack", "ws=13,win=65535,ttl=64,ts,sack", true},
+		// A Windows box answering in the edge's place
+		{"mss=1460,ws=13,win=65535,ttl=121,ts,sack", "ws=13,win=65535,ttl=64,ts,sack", false},
+		{"mss=1460,ws=8,win=65535,ttl=57,ts,sack", "ws=13,win=65535,ttl=64,ts,sack", false},
+		{"mss=1460,ws=13,win=29200,ttl=57,ts,sack", "ws=13,win=65535,ttl=64,ts,sack", false},
+		{"mss=1460,ws=13,win=65535,ttl=57,sack", "ws=13,win=65535,ttl=64,ts,sack", false},
+		{"mss=1460,ws=13,win=65535,ttl=57,ts,sack,ecn", "ws=13,win=65535,ttl=64,ts,sack", false},
+		{"mss=1400,ws=13,ts,sack", "mss=1460,ws=13,ts,sack", false},
+	}
+	for _, tc := range tests {
+		if got := matchesSignature(tc.fingerprint, tc.signature); got != tc.want {
+			t.Errorf("matchesSignature(%q, %q) = %v, want %v", tc.fingerprint, tc.signature, got, tc.want)
+		}
+	}
+
+	defer func(signature string) { TCPSignature = signature }(TCPSignature)
+	TCPSignature = ""
+	if isMiddlebox("mss=1460,ws=13,win=65535,ttl=52,sack") || !isMiddlebox("mss=1460,ws=7,win=64240,ttl=52,ts,sack") || isMiddlebox("") {
+		t.Error("isMiddlebox doesn't follow the edge signatures")
+	}
+	TCPSignature = "ws=7,ts,sack;ws=8,ts,sack"
+	if isMiddlebox("mss=1460,ws=8,ts,sack") || !isMiddlebox("mss=1460,ws=13,ts,sack") {
+		t.Error("isMiddlebox doesn't follow [-tcp-signature]")
+	}
+}
+
+func TestSynAckString(t *testing.T) {
+	s := synAck{mss: 1460, options: tcpiOptWScale | tcpiOptTimestamps | tcpiOptSACK, wscale: 13, window: 65535, ttl: 57}
+	if got := s.String(); got != "mss=1460,ws=13,win=65535,ttl=57,ts,sack" {
+		t.Errorf("String = %q", got)
+	}
+	if got := (synAck{mss: 1400}).String(); got != "mss=1400" {
+		t.Errorf("String = %q, want only the MSS", got)
+	}
+}
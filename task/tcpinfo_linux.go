@@ -0,0 +1,52 @@
+//go:build linux
+
+package task
+
+import (
+	"encoding/binary"
+	"net"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Offset in struct tcp_info of the byte holding the tcpi_snd_wscale and tcpi_rcv_wscale bitfields, which x/sys leaves
+// as padding
+const tcpInfoWScaleOffset = 6
+
+// Reads the SYN-ACK parameters the kernel kept for the connection, the TTL from synAcks when it is not nil
+func tcpFingerprint(conn net.Conn, synAcks *synAckSniffer) string {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return ""
+	}
+	raw, err := tcpConn.SyscallConn()
+	if err != nil {
+		return ""
+	}
+	var info *unix.TCPInfo
+	var infoErr error
+	err = raw.Control(func(fd uintptr) {
+		info, infoErr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	})
+	if err != nil || infoErr != nil {
+		return ""
+	}
+	s := synAck{mss: info.Snd_mss, options: info.Options, window: info.Snd_wnd}
+	// The kernel filled the padding byte as well. Its first bitfield, tcpi_snd_wscale (the peer's window scale), is the
+	// low nibble on little-endian machines and the high one on big-endian ones.
+	wscales := (*[tcpInfoWScaleOffset + 1]byte)(unsafe.Pointer(info))[tcpInfoWScaleOffset]
+	s.wscale = wscales & 0x0f
+	if !littleEndian() {
+		s.wscale = wscales >> 4
+	}
+	if synAcks != nil {
+		local := tcpConn.LocalAddr().(*net.TCPAddr)
+		s.ttl = synAcks.ttl(tcpConn.RemoteAddr().(*net.TCPAddr).IP, local.Port)
+	}
+	return s.String()
+}
+
+func littleEndian() bool {
+	return binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+}
@@ -0,0 +1,89 @@
+package task
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseSynAck(t *testing.T) {
+	segment := make([]byte, 20)
+	segment[0], segment[1] = 0x01, 0xbb // 443
+	segment[2], segment[3] = 0xc3, 0x50 // 50000
+	segment[13] = 0x12
+	if port, ok := parseSynAck(segment, 443); !ok || port != 50000 {
+		t.Errorf("parseSynAck = %d, %v, want 50000", port, ok)
+	}
+	if _, ok := parseSynAck(segment, 80); ok {
+		t.Error("parseSynAck took a segment of another port")
+	}
+	for _, flags := range []byte{0x10, 0x02, 0x16} { // ACK, SYN, SYN-ACK-RST
+		segment[13] = flags
+		if _, ok := parseSynAck(segment, 443); ok {
+			t.Errorf("parseSynAck took flags %#x", flags)
+		}
+	}
+	if _, ok := parseSynAck(segment[:10], 443); ok {
+		t.Error("parseSynAck took a short segment")
+	}
+}
+
+func TestTCPFingerprint(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+	sniffer := startSynAckSniffer(port)
+	defer sniffer.Close()
+
+	conn, err := net.Dial("tcp4", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fingerprint := tcpFingerprint(conn, sniffer)
+	items := parseFingerprint(fingerprint)
+	if items["mss"] == "" || items["win"] == "" {
+		t.Fatalf("fingerprint %q has no MSS or window", fingerprint)
+	}
+	if sniffer != nil && items["ttl"] != "64" {
+		t.Errorf("fingerprint %q, want the loopback TTL 64", fingerprint)
+	}
+
+	// The client's snd_wscale is the window scale the server announced, its rcv_wscale
+	var server net.Conn
+	select {
+	case server = <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("no connection accepted")
+	}
+	defer server.Close()
+	raw, _ := server.(*net.TCPConn).SyscallConn()
+	var info *unix.TCPInfo
+	_ = raw.Control(func(fd uintptr) { info, err = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	wscales := (*[tcpInfoWScaleOffset + 1]byte)(unsafe.Pointer(info))[tcpInfoWScaleOffset]
+	rcvWScale := wscales >> 4
+	if !littleEndian() {
+		rcvWScale = wscales & 0x0f
+	}
+	if want := fmt.Sprintf("ws=%d,", rcvWScale); !strings.Contains(fingerprint, want) {
+		t.Errorf("fingerprint %q, want %s", fingerprint, want)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package task
+
+import "net"
+
+// TCP_INFO is not available, fingerprints stay empty
+func tcpFingerprint(conn net.Conn, synAcks *synAckSniffer) string {
+	return ""
+}
+
+// Raw sockets are only read on Linux
+type synAckSniffer struct{}
+
+func startSynAckSniffer(port int) *synAckSniffer {
+	return nil
+}
+
+func (s *synAckSniffer) Close() {}
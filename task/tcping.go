@@ -1,7 +1,7 @@
 package task
 
 import (
-	"fmt"
+	"log"
 	"net"
 	"sort"
 	"strconv"
@@ -26,19 +26,22 @@ var (
 )
 
 type Ping struct {
+	config  *scanConfig
 	wg      *sync.WaitGroup
 	m       *sync.Mutex
 	ips     []*net.IPAddr
 	csv     utils.PingDelaySet
-	control chan bool
+	limiter *limiter
+	skip    *subnetSkip // nil unless [-skip-subnets]
 	bar     *utils.Bar
+	synAcks *synAckSniffer // TTLs of the SYN-ACKs for [-tcp-fingerprint], nil without raw sockets
 }
 
 func checkPingDefault() {
 	if Routines <= 0 {
 		Routines = defaultRoutines
 	}
-	if TCPPort <= 0 || TCPPort >= 65535 {
+	if TCPPort <= 0 || TCPPort > 65535 {
 		TCPPort = defaultPort
 	}
 	if PingTimes <= 0 {
@@ -46,73 +49,128 @@ func checkPingDefault() {
 	}
 }
 
+// NewPing prepares the latency test of the command line, which ends the program when the IPs can't be loaded
 func NewPing() *Ping {
 	checkPingDefault()
-	ips := loadIPRanges()
-	return &Ping{
+	p, err := newPing(globalConfig())
+	if err != nil {
+		log.Fatal(err)
+	}
+	return p
+}
+
+func newPing(config *scanConfig) (*Ping, error) {
+	ips, err := loadIPRanges(config)
+	if err != nil {
+		return nil, err
+	}
+	p := &Ping{
+		config:  config,
 		wg:      &sync.WaitGroup{},
 		m:       &sync.Mutex{},
 		ips:     ips,
 		csv:     make(utils.PingDelaySet, 0),
-		control: make(chan bool, Routines),
-		bar:     utils.NewBar(len(ips), "Available:", ""),
+		limiter: newLimiter(config.routines, AdaptiveRoutines),
 	}
+	if SkipSubnets > 0 {
+		p.skip = newSubnetSkip(SkipSubnets)
+	}
+	return p, nil
+}
+
+// Count returns the number of IPs to be tested
+func (p *Ping) Count() int {
+	return len(p.ips)
 }
 
 func (p *Ping) Run() utils.PingDelaySet {
 	if len(p.ips) == 0 {
 		return p.csv
 	}
-	if Httping {
-		fmt.Printf("Start latency test (Mode: HTTP, Port: %d, Range: %v ~ %v ms, Packet Loss: %.2f)\n", TCPPort, utils.InputMinDelay.Milliseconds(), utils.InputMaxDelay.Milliseconds(), utils.InputMaxLossRate)
+	c := p.config
+	if c.httping {
+		c.printf("Start latency test (Mode: HTTP, Port: %d, Range: %v ~ %v ms, Packet Loss: %.2f)\n", c.port, c.minDelay.Milliseconds(), c.maxDelay.Milliseconds(), c.maxLossRate)
 	} else {
-		fmt.Printf("Start latency test (Mode: TCP, Port: %d, Range: %v ~ %v ms, Packet Loss: %.2f)\n", TCPPort, utils.InputMinDelay.Milliseconds(), utils.InputMaxDelay.Milliseconds(), utils.InputMaxLossRate)
+		c.printf("Start latency test (Mode: TCP, Port: %d, Range: %v ~ %v ms, Packet Loss: %.2f)\n", c.port, c.minDelay.Milliseconds(), c.maxDelay.Milliseconds(), c.maxLossRate)
+	}
+	if p.skip != nil {
+		c.printf("[Info] Skipping the rest of a /16 once its first %d samples all failed (%.0f%% confident it has under %.0f%% usable IPs).\n", p.skip.samples, SkipSubnets*100, skipSubnetRate*100)
+	}
+	if TCPFingerprint && !c.httping {
+		if p.synAcks = startSynAckSniffer(c.port); p.synAcks == nil {
+			c.println("[Info] Raw sockets need root or CAP_NET_RAW, the TCP fingerprints leave out the TTL.")
+		}
+		defer p.synAcks.Close()
 	}
+	p.bar = c.newBar(len(p.ips), "Available:", "")
 	for _, ip := range p.ips {
+		if c.ctx.Err() != nil { // Canceled scan
+			break
+		}
+		if p.skip != nil && p.skip.skip(ip) {
+			p.bar.Grow(1, strconv.Itoa(p.found()))
+			continue
+		}
 		p.wg.Add(1)
-		p.control <- false
+		p.limiter.acquire()
 		go p.start(ip)
 	}
 	p.wg.Wait()
 	p.bar.Done()
+	if p.skip != nil {
+		p.skip.print(c)
+	}
+	if AdaptiveRoutines {
+		c.printf("[Info] Adaptive latency test threads ended at %d.\n", p.limiter.size())
+	}
+	if TCPFingerprint {
+		markMiddleboxes(p.csv)
+	}
 	sort.Sort(p.csv)
 	return p.csv
 }
 
 func (p *Ping) start(ip *net.IPAddr) {
 	defer p.wg.Done()
-	p.tcpingHandler(ip)
-	<-p.control
+	recv := p.tcpingHandler(ip)
+	p.limiter.release(p.config.pingTimes-recv, p.config.pingTimes)
 }
 
-// bool connectionSucceed float32 time
-func (p *Ping) tcping(ip *net.IPAddr) (bool, time.Duration) {
+// bool connectionSucceed float32 time string fingerprint
+func (p *Ping) tcping(ip *net.IPAddr) (bool, time.Duration, string) {
 	startTime := time.Now()
-	var fullAddress string
-	if isIPv4(ip.String()) {
-		fullAddress = fmt.Sprintf("%s:%d", ip.String(), TCPPort)
-	} else {
-		fullAddress = fmt.Sprintf("[%s]:%d", ip.String(), TCPPort)
-	}
-	conn, err := net.DialTimeout("tcp", fullAddress, tcpConnectTimeout)
+	conn, err := newDialer(tcpConnectTimeout).Dial("tcp", remoteAddrOn(ip, p.config.port).String())
 	if err != nil {
-		return false, 0
+		recordFailure(ip, probeError(probeTCPing, err))
+		return false, 0, ""
 	}
 	defer conn.Close()
+	recordRoute(conn)
 	duration := time.Since(startTime)
-	return true, duration
+	var fingerprint string
+	if TCPFingerprint {
+		fingerprint = tcpFingerprint(conn, p.synAcks)
+	}
+	return true, duration, fingerprint
 }
 
-// pingReceived pingTotalTime
-func (p *Ping) checkConnection(ip *net.IPAddr) (recv int, totalDelay time.Duration) {
-	if Httping {
-		recv, totalDelay = p.httping(ip)
+// pingReceived pingTotalTime fingerprint colo
+func (p *Ping) checkConnection(ip *net.IPAddr) (recv int, totalDelay time.Duration, fingerprint, colo string) {
+	if p.config.httping {
+		recv, totalDelay, colo = p.httping(ip)
 		return
 	}
-	for i := 0; i < PingTimes; i++ {
-		if ok, delay := p.tcping(ip); ok {
+	if remoteAgent != nil {
+		recv, totalDelay = agentCheck(ip)
+		return
+	}
+	for i := 0; i < p.config.pingTimes; i++ {
+		if ok, delay, fp := p.tcping(ip); ok {
 			recv++
 			totalDelay += delay
+			if fingerprint == "" {
+				fingerprint = fp
+			}
 		}
 	}
 	return
@@ -126,22 +184,49 @@ func (p *Ping) appendIPData(data *utils.PingData) {
 	})
 }
 
-// handle tcping
-func (p *Ping) tcpingHandler(ip *net.IPAddr) {
-	recv, totalDlay := p.checkConnection(ip)
-	nowAble := len(p.csv)
-	if recv != 0 {
+// Number of IPs kept so far, read while other workers append
+func (p *Ping) found() int {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return len(p.csv)
+}
+
+// handle tcping, returns the number of successful pings
+func (p *Ping) tcpingHandler(ip *net.IPAddr) int {
+	recv, totalDlay, fingerprint, colo := p.checkConnection(ip)
+	utils.Reputation.Observe(ip.String(), float64(recv)/float64(p.config.pingTimes))
+	// HTTPing with a ClientHello other than [-ja3-only] doesn't qualify the IP
+	accepted := recv != 0 && (!p.config.httping || helloAccepted(ip))
+	if p.skip != nil {
+		p.skip.observe(ip, accepted && p.config.goodSample(recv, totalDlay))
+	}
+	nowAble := p.found()
+	if accepted {
 		nowAble++
 	}
 	p.bar.Grow(1, strconv.Itoa(nowAble))
-	if recv == 0 {
-		return
+	pinned := isPinned(ip)
+	if !accepted && !pinned {
+		return recv
 	}
 	data := &utils.PingData{
 		IP:       ip,
-		Sended:   PingTimes,
+		Sended:   p.config.pingTimes,
 		Received: recv,
-		Delay:    totalDlay / time.Duration(recv),
+		Pinned:   pinned,
+
+		TCPFingerprint: fingerprint,
+		Colo:           colo,
+		Error:          ErrorClass(LastFailure(ip)),
+	}
+	if p.config.httping {
+		data.JA3, data.JA4 = helloFingerprintOf(ip)
+		data.ECH = echOf(ip)
+	}
+	if recv > 0 {
+		data.Delay = totalDlay / time.Duration(recv)
 	}
+	data.Source, data.Interface = routeOf(ip)
 	p.appendIPData(data)
+	return recv
 }
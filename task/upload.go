@@ -0,0 +1,111 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const uploadChunk = 64 << 10
+
+var (
+	// Upload POSTs UploadSize bytes to UploadURL from every result and records the upload speed
+	Upload = false
+	// UploadURL takes the upload test data, like speed.cloudflare.com/__up
+	UploadURL = "https://speed.cloudflare.com/__up"
+	// UploadSize is the data sent to each result, in bytes
+	UploadSize int64 = 10 << 20
+)
+
+// CheckUpload validates the upload test options
+func CheckUpload() error {
+	if Upload && UploadSize <= 0 {
+		return errors.New("the upload size must be positive")
+	}
+	return nil
+}
+
+// TestUpload uploads UploadSize bytes to every result over a new connection, one IP at a time
+func TestUpload(data utils.DownloadSpeedSet) {
+	if !Upload || len(data) == 0 {
+		return
+	}
+	utils.Printf("Start upload speed test (Number: %d, Size: %s)\n", len(data), utils.FormatSize(UploadSize))
+	bar := utils.NewBar(len(data), "", "")
+	for i := range data {
+		if RunContext.Err() != nil { // Interrupted
+			break
+		}
+		data[i].UploadSpeed = uploadSpeed(data[i].IP)
+		bar.Grow(1, "")
+	}
+	bar.Done()
+}
+
+// Bytes per second from sending the request to the response, which the server sends after taking the whole body.
+// An upload not complete within Timeout counts with the bytes sent so far.
+func uploadSpeed(ip *net.IPAddr) float64 {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext:    getDialContext(ip, ProbeUpload, nil),
+			DialTLSContext: getDialTLSContext(ip, ProbeUpload, nil),
+		},
+	}
+	defer client.CloseIdleConnections()
+	ctx, cancel := context.WithTimeout(RunContext, HandshakeTimeout+Timeout)
+	defer cancel()
+	body := &uploadBody{remaining: UploadSize}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, UploadURL, body)
+	if err != nil {
+		return 0
+	}
+	req.ContentLength = UploadSize
+	req.Header.Set("Content-Type", "application/octet-stream")
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && body.sent.Load() > 0 {
+			return float64(body.sent.Load()) / time.Since(start).Seconds()
+		}
+		recordFailure(ip, probeError(ProbeUpload, err))
+		return 0
+	}
+	defer resp.Body.Close()
+	elapsed := time.Since(start)
+	if resp.StatusCode != http.StatusOK {
+		recordFailure(ip, statusError(ProbeUpload, resp))
+		return 0
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return float64(body.sent.Load()) / elapsed.Seconds()
+}
+
+// Random bytes, so compressing middleboxes can't shrink the upload
+var uploadData = func() []byte {
+	b := make([]byte, uploadChunk)
+	rand.New(rand.NewSource(time.Now().UnixNano())).Read(b)
+	return b
+}()
+
+// Generates the upload data, counting the bytes the transport took
+type uploadBody struct {
+	remaining int64
+	sent      atomic.Int64
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.EOF
+	}
+	n := copy(p[:min(int64(len(p)), b.remaining)], uploadData)
+	b.remaining -= int64(n)
+	b.sent.Add(int64(n))
+	return n, nil
+}
@@ -0,0 +1,45 @@
+package task
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+func TestUploadSpeed(t *testing.T) {
+	server := testserver.New(testserver.Config{})
+	defer server.Close()
+	rootCAs = server.CertPool()
+	defer func(u string, port int, upload bool, size int64) {
+		rootCAs, UploadURL, TCPPort, Upload, UploadSize = nil, u, port, upload, size
+	}(UploadURL, TCPPort, Upload, UploadSize)
+	UploadURL, TCPPort, Upload, UploadSize = "https://127.0.0.1/__up", server.Port(), true, 1<<20
+	if err := CheckUpload(); err != nil {
+		t.Fatal(err)
+	}
+	data := utils.DownloadSpeedSet{{PingData: &utils.PingData{IP: &net.IPAddr{IP: net.ParseIP("127.0.0.1")}}}}
+	TestUpload(data)
+	if data[0].UploadSpeed <= 0 {
+		t.Errorf("UploadSpeed = %v", data[0].UploadSpeed)
+	}
+
+	// After Ctrl-C the test uploads nothing more
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	defer func(ctx context.Context) { RunContext = ctx }(RunContext)
+	RunContext = ctx
+	data[0].UploadSpeed = 0
+	TestUpload(data)
+	if data[0].UploadSpeed != 0 {
+		t.Errorf("UploadSpeed of an interrupted run = %v, want 0", data[0].UploadSpeed)
+	}
+	RunContext = context.Background()
+
+	server.Close()
+	if uploadSpeed(data[0].IP) != 0 {
+		t.Error("upload to a closed port: want 0")
+	}
+}
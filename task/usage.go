@@ -0,0 +1,64 @@
+package task
+
+import (
+	"net/url"
+	"strconv"
+)
+
+const (
+	tcpingProbeBytes  int64 = 300      // TCP handshake and teardown
+	httpingProbeBytes int64 = 8 * 1024 // TLS handshake plus HEAD request and response
+	assumedLineSpeed  int64 = 10 << 20 // Bytes per second assumed when the download size is unknown
+)
+
+// EstimateDataUsage returns the worst-case number of bytes transferred by the latency and download tests, the download
+// bytes including the [-sizes], [-upload] and HTTP/3 [-quic] tests of the results
+func EstimateDataUsage(ipCount int) (pingBytes, downloadBytes int64) {
+	checkPingDefault()
+	checkDownloadDefault()
+	if Httping { // The first request checks the status code and colo, the rest measure latency
+		pingBytes = int64(ipCount) * int64(PingTimes+1) * httpingProbeBytes
+	} else {
+		pingBytes = int64(ipCount) * int64(PingTimes) * tcpingProbeBytes
+	}
+	if Disable { // Every IP passing the latency test is a result
+		downloadBytes = int64(ipCount) * resultTestBytes()
+		return
+	}
+	testNum := TestCount
+	if MinSpeed > 0 || diversityEnabled() || testNum > ipCount { // With a minimum speed or diversity limits, every IP may end up in the download queue
+		testNum = ipCount
+	}
+	downloadBytes = int64(testNum)*downloadSize() + int64(min(TestCount, ipCount))*resultTestBytes()
+	return
+}
+
+// Bytes each result transfers after the download test: the objects of [-sizes], the data of [-upload] and the HTTP/3
+// download of [-quic]
+func resultTestBytes() int64 {
+	var n int64
+	for _, size := range ObjectSizes {
+		n += size
+	}
+	if Upload {
+		n += UploadSize
+	}
+	if QUIC && !Disable {
+		n += downloadSize()
+	}
+	return n
+}
+
+// Size of a single download test, taken from the "bytes" parameter of speed.cloudflare.com style URLs
+func downloadSize() int64 {
+	limit := int64(Timeout.Seconds()) * assumedLineSpeed
+	u, err := url.Parse(URL)
+	if err != nil {
+		return limit
+	}
+	size, err := strconv.ParseInt(u.Query().Get("bytes"), 10, 64)
+	if err != nil || size <= 0 {
+		return limit
+	}
+	return size
+}
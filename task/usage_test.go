@@ -0,0 +1,46 @@
+package task
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateDataUsage(t *testing.T) {
+	defer func(u string, count int, timeout time.Duration, speed float64, disable bool, sizes []int64, upload bool, size int64) {
+		URL, TestCount, Timeout, MinSpeed, Disable, ObjectSizes, Upload, UploadSize = u, count, timeout, speed, disable, sizes, upload, size
+	}(URL, TestCount, Timeout, MinSpeed, Disable, ObjectSizes, Upload, UploadSize)
+	URL, TestCount, Timeout, MinSpeed, Disable = "https://speed.cloudflare.com/__down?bytes=10000000", 5, 10*time.Second, 0, false
+	ObjectSizes, Upload = nil, false
+
+	_, downloads := EstimateDataUsage(100)
+	if downloads != 5*10000000 {
+		t.Errorf("download bytes = %d, want 5 tests of 10 MB", downloads)
+	}
+	// Every result downloads each object and uploads once more
+	ObjectSizes, Upload, UploadSize = []int64{1 << 20, 4 << 20}, true, 3<<20
+	if _, got := EstimateDataUsage(100); got != downloads+5*(8<<20) {
+		t.Errorf("download bytes with -sizes and -upload = %d, want %d", got, downloads+5*(8<<20))
+	}
+	// Fewer IPs than tests make fewer results
+	if _, got := EstimateDataUsage(2); got != 2*10000000+2*(8<<20) {
+		t.Errorf("download bytes of 2 IPs = %d", got)
+	}
+	// Without a download test every IP is a result
+	Disable = true
+	if _, got := EstimateDataUsage(100); got != 100*(8<<20) {
+		t.Errorf("download bytes with -dd = %d, want the tests of 100 results", got)
+	}
+
+	// The plan leaves them room in the budget
+	Disable = false
+	plan, err := MakePlan(6000, 500<<20, 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.DownloadBytes > 250<<20 || plan.DownloadBytes < 5*(8<<20) {
+		t.Errorf("plan download bytes = %d, want the result tests within half the budget", plan.DownloadBytes)
+	}
+	if _, err := MakePlan(6000, 60<<20, 0, 5); err == nil {
+		t.Error("plan accepted result tests of 40 MB in a 60 MB budget")
+	}
+}
@@ -0,0 +1,123 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const viaConnectTimeout = 15 * time.Second
+
+var (
+	// Via is an SSH jump host probes are sent through, e.g. ssh://user@vps:22, empty probes from this machine
+	Via string
+
+	viaURL    *url.URL
+	viaClient *ssh.Client
+)
+
+// CheckVia validates the jump host, probes leave from it so local source options don't apply
+func CheckVia() error {
+	if Via == "" {
+		return nil
+	}
+	u, err := url.Parse(Via)
+	if err != nil || u.Scheme != "ssh" || u.Hostname() == "" {
+		return fmt.Errorf("invalid jump host %q, use ssh://user@host[:port]", Via)
+	}
+	if SourceAddr != nil || LocalPorts != nil || socketOptionsSet() {
+		return errors.New("-via can't be combined with -src, -local-port, -tos, -ttl or -fwmark, probes leave from the jump host")
+	}
+	viaURL = u
+	return nil
+}
+
+// ConnectVia connects to the jump host, authenticating with the password of the URL, the SSH agent or the
+// unencrypted keys of ~/.ssh, and verifying it against ~/.ssh/known_hosts
+func ConnectVia() (close func(), err error) {
+	if viaURL == nil {
+		return func() {}, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("reading known_hosts failed, connect once with ssh to add the host: %v", err)
+	}
+	name := viaURL.User.Username()
+	if name == "" {
+		if current, err := user.Current(); err == nil {
+			name = current.Username
+		}
+	}
+	config := &ssh.ClientConfig{
+		User:            name,
+		Auth:            viaAuth(home),
+		HostKeyCallback: hostKeys,
+		Timeout:         viaConnectTimeout,
+	}
+	address := viaURL.Host
+	if viaURL.Port() == "" {
+		address = net.JoinHostPort(viaURL.Hostname(), "22")
+	}
+	client, err := ssh.Dial("tcp", address, config)
+	if err != nil {
+		return nil, err
+	}
+	viaClient = client
+	utils.Printf("[Info] Sending probes through %s\n", viaURL.Redacted())
+	return func() {
+		viaClient = nil
+		_ = client.Close()
+	}, nil
+}
+
+func viaAuth(home string) []ssh.AuthMethod {
+	var methods []ssh.AuthMethod
+	if password, ok := viaURL.User.Password(); ok {
+		methods = append(methods, ssh.Password(password))
+	}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		key, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		// Keys with a passphrase are left to the agent
+		if signer, err := ssh.ParsePrivateKey(key); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	return methods
+}
+
+// Dials through the jump host when connected, timing out after timeout when not 0
+func dialVia(ctx context.Context, timeout time.Duration, network, address string) (net.Conn, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return viaClient.DialContext(ctx, network, address)
+}
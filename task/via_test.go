@@ -0,0 +1,119 @@
+package task
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Connects viaClient to an in-process SSH server relaying direct-tcpip channels, returning the number relayed
+func useVia(t *testing.T) *atomic.Int32 {
+	t.Helper()
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	var relayed atomic.Int32
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		serverSide, err := l.Accept()
+		if err != nil {
+			return
+		}
+		_, channels, requests, err := ssh.NewServerConn(serverSide, config)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(requests)
+		for newChannel := range channels {
+			var target struct {
+				Host       string
+				Port       uint32
+				OriginHost string
+				OriginPort uint32
+			}
+			if newChannel.ChannelType() != "direct-tcpip" || ssh.Unmarshal(newChannel.ExtraData(), &target) != nil {
+				_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+				continue
+			}
+			conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+			if err != nil {
+				_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			channel, channelRequests, _ := newChannel.Accept()
+			go ssh.DiscardRequests(channelRequests)
+			relayed.Add(1)
+			go func() { _, _ = io.Copy(conn, channel); conn.Close() }()
+			go func() { _, _ = io.Copy(channel, conn); channel.Close() }()
+		}
+	}()
+	client, err := ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	viaClient = client
+	t.Cleanup(func() {
+		_ = client.Close()
+		viaClient = nil
+	})
+	return &relayed
+}
+
+func TestTCPingVia(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	relayed := useVia(t)
+	p := &Ping{config: &scanConfig{port: l.Addr().(*net.TCPAddr).Port}}
+	if ok, _, _ := p.tcping(&net.IPAddr{IP: net.ParseIP("127.0.0.1")}); !ok {
+		t.Fatal("tcping through the jump host failed")
+	}
+	if relayed.Load() != 1 {
+		t.Errorf("jump host relayed %d connections, want 1", relayed.Load())
+	}
+}
+
+func TestCheckVia(t *testing.T) {
+	oldVia, oldSource := Via, SourceAddr
+	t.Cleanup(func() { Via, SourceAddr, viaURL = oldVia, oldSource, nil })
+	for _, via := range []string{"user@host", "http://host", "ssh://"} {
+		Via = via
+		if err := CheckVia(); err == nil {
+			t.Errorf("CheckVia accepted %q", via)
+		}
+	}
+	Via = "ssh://user@host:2222"
+	if err := CheckVia(); err != nil {
+		t.Error(err)
+	}
+	SourceAddr, _ = ParseSourceAddr("127.0.0.1")
+	if err := CheckVia(); err == nil {
+		t.Error("CheckVia accepted -src")
+	}
+}
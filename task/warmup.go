@@ -0,0 +1,118 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+// Connections a stateful DPI usually lets through before it throttles the rest
+const warmUpFree = 2
+
+// WarmUpConns is the number of parallel connections opened to each result, like a proxy client filling its pool; 0 disables
+var WarmUpConns = 0
+
+type warmUpResult struct {
+	ok   bool
+	took time.Duration // Of the handshake
+}
+
+// WarmUp opens WarmUpConns connections to every result at once, recording how many handshakes succeed and whether the later ones are throttled
+func WarmUp(data utils.DownloadSpeedSet) {
+	if WarmUpConns <= 0 || len(data) == 0 {
+		return
+	}
+	u, err := url.Parse(URL)
+	if err != nil {
+		return
+	}
+	utils.Printf("Start warm-up test (Number: %d, Connections: %d)\n", len(data), WarmUpConns)
+	bar := utils.NewBar(len(data), "", "")
+	for i := range data {
+		results, total := warmUpIP(data[i].IP, u.Hostname())
+		data[i].WarmUpOK, data[i].WarmUpTotal, data[i].WarmUpTime = 0, len(results), total
+		for _, r := range results {
+			if r.ok {
+				data[i].WarmUpOK++
+			}
+		}
+		if data[i].Throttled = throttled(results); data[i].Throttled {
+			err := &ProbeError{Probe: ProbeWarmUp, Class: ErrThrottled, Err: errors.New("later connections failed or stalled")}
+			recordFailure(data[i].IP, err)
+			data[i].Error = ErrorClass(err)
+		}
+		bar.Grow(1, "")
+	}
+	bar.Done()
+}
+
+// Opens the connections one after another so their order is known, then runs all handshakes at once.
+// Returns the outcome of each in opening order and the time until all were done.
+func warmUpIP(ip *net.IPAddr, serverName string) ([]warmUpResult, time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), tcpConnectTimeout+HandshakeTimeout)
+	defer cancel()
+	start := time.Now()
+	remote := remoteAddr(ip).String()
+	dialer := newDialer(tcpConnectTimeout)
+	conns := make([]net.Conn, WarmUpConns)
+	for i := range conns {
+		if conn, err := dialer.DialContext(ctx, "tcp", remote); err == nil {
+			conns[i] = conn
+		}
+	}
+
+	results := make([]warmUpResult, len(conns))
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		if conn == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handshakeStart := time.Now()
+			tlsConn, err := handshakeTLS(ctx, conn, serverName, getClientHelloId(ClientHelloID), fragmentFor(ProbeWarmUp, true), nil)
+			if err != nil {
+				conns[i] = nil
+				return
+			}
+			results[i] = warmUpResult{ok: true, took: time.Since(handshakeStart)}
+			conns[i] = tlsConn
+		}()
+	}
+	wg.Wait()
+	total := time.Since(start)
+	// Held open until all handshakes are done, so every connection counts against the DPI's limit
+	for _, conn := range conns {
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}
+	return results, total
+}
+
+// A stateful DPI lets the first connections through and resets or stalls the later ones.
+// A later handshake counts as stalled when it took three times the slowest first one and at least 100ms more.
+func throttled(results []warmUpResult) bool {
+	if len(results) <= warmUpFree {
+		return false
+	}
+	var slowest time.Duration
+	for _, r := range results[:warmUpFree] {
+		if !r.ok {
+			return false // Not throttling, the IP is just unreliable
+		}
+		slowest = max(slowest, r.took)
+	}
+	for _, r := range results[warmUpFree:] {
+		if !r.ok || r.took > 3*slowest && r.took-slowest > 100*time.Millisecond {
+			return true
+		}
+	}
+	return false
+}
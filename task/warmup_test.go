@@ -0,0 +1,60 @@
+package task
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+)
+
+func TestThrottled(t *testing.T) {
+	ok := func(ms int) warmUpResult { return warmUpResult{ok: true, took: time.Duration(ms) * time.Millisecond} }
+	fail := warmUpResult{}
+	tests := []struct {
+		name    string
+		results []warmUpResult
+		want    bool
+	}{
+		{name: "all pass", results: []warmUpResult{ok(50), ok(60), ok(55), ok(70)}, want: false},
+		{name: "third reset", results: []warmUpResult{ok(50), ok(60), fail, ok(70)}, want: true},
+		{name: "fourth stalled", results: []warmUpResult{ok(50), ok(60), ok(55), ok(900)}, want: true},
+		{name: "slow but close", results: []warmUpResult{ok(10), ok(12), ok(80)}, want: false},
+		{name: "first failed", results: []warmUpResult{fail, ok(60), fail}, want: false},
+		{name: "too few", results: []warmUpResult{ok(50), fail}, want: false},
+	}
+	for _, tt := range tests {
+		if got := throttled(tt.results); got != tt.want {
+			t.Errorf("%s: throttled() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWarmUpIP(t *testing.T) {
+	old := WarmUpConns
+	t.Cleanup(func() { WarmUpConns = old })
+	WarmUpConns = 4
+
+	for _, tt := range []struct {
+		maxConns  int
+		wantOK    int
+		throttled bool
+	}{
+		{maxConns: 0, wantOK: 4},
+		{maxConns: 2, wantOK: 2, throttled: true},
+	} {
+		server := useEdge(t, testserver.Config{MaxConns: tt.maxConns})
+		u, _ := url.Parse(URL)
+		results, total := warmUpIP(server.IP(), u.Hostname())
+		got := 0
+		for _, r := range results {
+			if r.ok {
+				got++
+			}
+		}
+		if got != tt.wantOK || throttled(results) != tt.throttled || total <= 0 {
+			t.Errorf("max-conns %d: %d of %d handshakes passed in %v, throttled %v, want %d passed, throttled %v",
+				tt.maxConns, got, len(results), total, throttled(results), tt.wantOK, tt.throttled)
+		}
+	}
+}
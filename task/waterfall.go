@@ -0,0 +1,167 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+)
+
+const waterfallTimeout = 10 * time.Second
+
+// WaterfallURLs are the page and then its assets, fetched from every result over one connection; empty disables
+var WaterfallURLs []string
+
+// ParseWaterfall parses the page and asset addresses separated by commas, the assets must be on the host of the page
+func ParseWaterfall(list string) ([]string, error) {
+	var urls []string
+	var page *url.URL
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+			return nil, fmt.Errorf("invalid waterfall address %q", s)
+		}
+		if page == nil {
+			page = u
+		} else if u.Scheme != page.Scheme || u.Host != page.Host {
+			return nil, fmt.Errorf("waterfall address %q is not on %s://%s, the assets share the connection of the page", s, page.Scheme, page.Host)
+		}
+		urls = append(urls, u.String())
+	}
+	return urls, nil
+}
+
+// Waterfall loads the page of WaterfallURLs and its assets from every result the way a browser does, one IP at a time
+func Waterfall(data utils.DownloadSpeedSet) {
+	if len(WaterfallURLs) == 0 || len(data) == 0 {
+		return
+	}
+	utils.Printf("Start waterfall test (Number: %d, Assets: %d)\n", len(data), len(WaterfallURLs)-1)
+	bar := utils.NewBar(len(data), "", "")
+	for i := range data {
+		data[i].Waterfall, data[i].WaterfallProto = waterfallHandler(data[i].IP)
+		bar.Grow(1, "")
+	}
+	bar.Done()
+}
+
+// Fetches the page and then all assets at once over one connection: multiplexed when the IP negotiates HTTP/2,
+// queued behind each other over HTTP/1.1. Returns the time from dialing to the last byte of the last asset and
+// the protocol, 0 when a fetch failed.
+func waterfallHandler(ip *net.IPAddr) (time.Duration, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), waterfallTimeout)
+	defer cancel()
+	var fragment FragmentMetrics
+	start := time.Now()
+	rt, proto, err := waterfallConn(ctx, ip, &fragment)
+	if err != nil {
+		recordFailure(ip, probeError(ProbeWaterfall, err))
+		return 0, ""
+	}
+	defer rt.close()
+
+	if err := waterfallFetch(ctx, rt, WaterfallURLs[0]); err != nil {
+		recordFailure(ip, err)
+		return 0, proto
+	}
+	var wg sync.WaitGroup
+	var failed atomic.Pointer[ProbeError]
+	for _, asset := range WaterfallURLs[1:] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := waterfallFetch(ctx, rt, asset); err != nil {
+				failed.CompareAndSwap(nil, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := failed.Load(); err != nil {
+		recordFailure(ip, err)
+		return 0, proto
+	}
+	return max(time.Since(start)-fragment.Sleep(), 0), proto
+}
+
+// Round tripper over the one connection of a waterfall test
+type waterfallTransport struct {
+	http.RoundTripper
+	close func()
+}
+
+// Dials the page host at ip, offering HTTP/2 over TLS
+func waterfallConn(ctx context.Context, ip *net.IPAddr, metrics *FragmentMetrics) (*waterfallTransport, string, error) {
+	page, err := url.Parse(WaterfallURLs[0])
+	if err != nil {
+		return nil, "", err
+	}
+	var conn net.Conn
+	if page.Scheme == "https" {
+		config := &utls.Config{ServerName: page.Hostname(), RootCAs: rootCAs, NextProtos: []string{http2.NextProtoTLS, "http/1.1"}}
+		conn, err = dialTLSConfig(ctx, newDialer(HandshakeTimeout), remoteAddr(ip).String(), config, getClientHelloId(ClientHelloID), fragmentFor(ProbeWaterfall, true), metrics)
+	} else {
+		conn, err = getDialContext(ip, ProbeWaterfall, metrics)(ctx, "tcp", page.Host)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if uConn, ok := conn.(*utls.UConn); ok && uConn.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS {
+		cc, err := (&http2.Transport{}).NewClientConn(conn)
+		if err != nil {
+			_ = conn.Close()
+			return nil, "", err
+		}
+		return &waterfallTransport{RoundTripper: cc, close: func() { _ = cc.Close() }}, "h2", nil
+	}
+
+	// A browser would open more connections, the test keeps to the one it has
+	var dialed atomic.Bool
+	reuse := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if dialed.Swap(true) {
+			return nil, errors.New("connection closed by the server")
+		}
+		return conn, nil
+	}
+	transport := &http.Transport{MaxConnsPerHost: 1, DialContext: reuse, DialTLSContext: reuse}
+	return &waterfallTransport{RoundTripper: transport, close: func() {
+		transport.CloseIdleConnections()
+		if !dialed.Load() {
+			_ = conn.Close()
+		}
+	}}, "http/1.1", nil
+}
+
+// Fetches target to its last byte
+func waterfallFetch(ctx context.Context, rt http.RoundTripper, target string) *ProbeError {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return probeError(ProbeWaterfall, err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return probeError(ProbeWaterfall, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return statusError(ProbeWaterfall, resp)
+	}
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return probeError(ProbeWaterfall, err)
+	}
+	return nil
+}
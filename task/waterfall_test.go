@@ -0,0 +1,50 @@
+package task
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/testserver"
+)
+
+func TestWaterfallHandler(t *testing.T) {
+	for _, tt := range []struct {
+		http2 bool
+		want  string
+	}{{false, "http/1.1"}, {true, "h2"}} {
+		t.Run(tt.want, func(t *testing.T) {
+			server := testserver.New(testserver.Config{HTTP2: tt.http2})
+			defer server.Close()
+			rootCAs = server.CertPool()
+			defer func(urls []string, hello string, port int) {
+				rootCAs, WaterfallURLs, ClientHelloID, TCPPort = nil, urls, hello, port
+			}(WaterfallURLs, ClientHelloID, TCPPort)
+			ClientHelloID, TCPPort = "go", server.Port()
+			WaterfallURLs = []string{"https://127.0.0.1/cdn-cgi/trace"}
+			for _, size := range []int{1000, 20000, 50000} {
+				WaterfallURLs = append(WaterfallURLs, "https://127.0.0.1/__down?bytes="+strconv.Itoa(size))
+			}
+
+			took, proto := waterfallHandler(&net.IPAddr{IP: net.ParseIP("127.0.0.1")})
+			if took <= 0 {
+				t.Errorf("waterfall took %v, want > 0", took)
+			}
+			if proto != tt.want {
+				t.Errorf("protocol = %q, want %q", proto, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWaterfall(t *testing.T) {
+	urls, err := ParseWaterfall("https://example.com/, https://example.com/app.js")
+	if err != nil || len(urls) != 2 {
+		t.Fatalf("ParseWaterfall = %v, %v", urls, err)
+	}
+	for _, list := range []string{"example.com/", "https://example.com/,https://cdn.example.com/app.js", "https://example.com/,http://example.com/app.js"} {
+		if _, err := ParseWaterfall(list); err == nil {
+			t.Errorf("ParseWaterfall(%q) succeeded, want an error", list)
+		}
+	}
+}
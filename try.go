@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const tryDialTimeout = 10 * time.Second
+
+// Runs a local proxy sending one hostname to a chosen IP, so the IP can be tried in a browser before deploying it
+func tryCommand(args []string) error {
+	fs := flag.NewFlagSet("try", flag.ExitOnError)
+	host := fs.String("host", "", "Hostname to browse through the IP, e.g. example.com")
+	ipText := fs.String("ip", "", "IP to try, default the best IP of the result file")
+	file := fs.String("f", "result.csv", "Result file")
+	listen := fs.String("listen", "127.0.0.1:8080", "Proxy address")
+	_ = fs.Parse(args)
+	if *host == "" {
+		return errors.New("usage: try -host example.com [-ip 1.1.1.1] [-f result.csv] [-listen 127.0.0.1:8080]")
+	}
+	ip, err := tryIP(*ipText, *file)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	p := newTryProxy(*host, ip, l.Addr().String())
+	fmt.Printf("[Info] Open http://%s/ for the instructions, or set the automatic proxy configuration (PAC) URL of the browser to\n", p.self)
+	fmt.Printf("       http://%s/proxy.pac and browse https://%s/ through %s, other sites are not affected\n", p.self, p.host, ip)
+	return http.Serve(l, p)
+}
+
+func tryIP(ipText, file string) (netip.Addr, error) {
+	if ipText != "" {
+		return netip.ParseAddr(ipText)
+	}
+	ips, err := utils.ReadResultIPs(file)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if len(ips) == 0 {
+		return netip.Addr{}, fmt.Errorf("no IPs in %s", file)
+	}
+	return ips[0], nil
+}
+
+type tryProxy struct {
+	host  string
+	ip    netip.Addr
+	self  string                 // Address of the proxy, for the PAC file
+	proxy *httputil.ReverseProxy // Of plain HTTP, its connections are kept alive across requests
+}
+
+func newTryProxy(host string, ip netip.Addr, self string) *tryProxy {
+	p := &tryProxy{host: strings.ToLower(host), ip: ip, self: self}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(*httputil.ProxyRequest) {}, // Proxy requests carry the full URL already
+		Transport: &http.Transport{DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			target, ok := p.allowed(addr)
+			if !ok {
+				return nil, fmt.Errorf("only %s is proxied", p.host)
+			}
+			return (&net.Dialer{Timeout: tryDialTimeout}).DialContext(ctx, network, target)
+		}},
+	}
+	return p
+}
+
+func (p *tryProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodConnect:
+		p.tunnel(w, r)
+	case r.URL.Host != "":
+		p.forward(w, r)
+	case r.URL.Path == "/proxy.pac":
+		w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+		fmt.Fprintf(w, "function FindProxyForURL(url, host) {\n\tif (host == %q) return \"PROXY %s\";\n\treturn \"DIRECT\";\n}\n", p.host, p.self)
+	case r.URL.Path == "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<!doctype html><title>Try %[1]s</title>
+<p>Set the automatic proxy configuration URL of the browser to <code>http://%[3]s/proxy.pac</code>,
+then open <a href="https://%[2]s/">https://%[2]s/</a>: it is served through %[1]s, other sites are not affected.</p>
+<p>Remove the proxy setting when done.</p>
+`, html.EscapeString(p.ip.String()), html.EscapeString(p.host), html.EscapeString(p.self))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Only the tried host goes through, the proxy must not relay anything else
+func (p *tryProxy) allowed(hostport string) (string, bool) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, port = hostport, "80"
+	}
+	if !strings.EqualFold(host, p.host) {
+		return "", false
+	}
+	return net.JoinHostPort(p.ip.String(), port), true
+}
+
+// Tunnels HTTPS, the browser still verifies the site's own certificate
+func (p *tryProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	target, ok := p.allowed(r.Host)
+	if !ok {
+		http.Error(w, "only "+p.host+" is proxied", http.StatusForbidden)
+		return
+	}
+	upstream, err := net.DialTimeout("tcp", target, tryDialTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijacking unsupported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer client.Close()
+	_, _ = client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	go func() {
+		_, _ = io.Copy(upstream, buffered)
+		_ = upstream.Close()
+	}()
+	_, _ = io.Copy(client, upstream)
+}
+
+// Relays plain HTTP requests of the tried host
+func (p *tryProxy) forward(w http.ResponseWriter, r *http.Request) {
+	if _, ok := p.allowed(r.URL.Host); !ok {
+		http.Error(w, "only "+p.host+" is proxied", http.StatusForbidden)
+		return
+	}
+	p.proxy.ServeHTTP(w, r)
+}
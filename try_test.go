@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// Client browsing through the proxy of a try of example.com at 127.0.0.1
+func testTryProxy(t *testing.T) (*tryProxy, *http.Client) {
+	t.Helper()
+	var p *tryProxy
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { p.ServeHTTP(w, r) }))
+	t.Cleanup(server.Close)
+	p = newTryProxy("Example.com", netip.MustParseAddr("127.0.0.1"), server.Listener.Addr().String())
+	proxyURL, _ := url.Parse(server.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	t.Cleanup(client.CloseIdleConnections)
+	return p, client
+}
+
+func tryGet(t *testing.T, client *http.Client, url string) (int, string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestTryForward(t *testing.T) {
+	var conns atomic.Int32
+	site := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "site "+r.Host)
+	}))
+	site.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	site.Start()
+	defer site.Close()
+	_, port, _ := net.SplitHostPort(site.Listener.Addr().String())
+	_, client := testTryProxy(t)
+
+	for range 3 {
+		if code, body := tryGet(t, client, "http://example.com:"+port+"/"); code != http.StatusOK || body != "site example.com:"+port {
+			t.Fatalf("tried host = %d %q, want the site through the IP", code, body)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("%d connections to the site, want one kept alive", n)
+	}
+	// Other hosts, even on the same address, aren't relayed
+	for _, host := range []string{"other.com", "127.0.0.1", "example.com.evil.com"} {
+		if code, _ := tryGet(t, client, "http://"+host+":"+port+"/"); code != http.StatusForbidden {
+			t.Errorf("%s = %d, want 403", host, code)
+		}
+	}
+}
+
+func TestTryTunnel(t *testing.T) {
+	site := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure "+r.Host)
+	}))
+	defer site.Close()
+	_, port, _ := net.SplitHostPort(site.Listener.Addr().String())
+	_, client := testTryProxy(t)
+	// The browser checks the site's certificate through the tunnel
+	transport := client.Transport.(*http.Transport)
+	transport.TLSClientConfig = &tls.Config{RootCAs: site.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+
+	if code, body := tryGet(t, client, "https://example.com:"+port+"/"); code != http.StatusOK || body != "secure example.com:"+port {
+		t.Errorf("tunnel = %d %q, want the site through the IP", code, body)
+	}
+	if code, body := tryGet(t, client, "https://other.com:"+port+"/"); code != 0 || !strings.Contains(body, "Forbidden") {
+		t.Errorf("tunnel to another host = %d %q, want it refused", code, body)
+	}
+}
+
+func TestTryPAC(t *testing.T) {
+	p, _ := testTryProxy(t)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/proxy.pac", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ns-proxy-autoconfig" {
+		t.Errorf("PAC = %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	pac := w.Body.String()
+	if !strings.Contains(pac, `if (host == "example.com") return "PROXY `+p.self+`";`) || !strings.Contains(pac, `return "DIRECT";`) {
+		t.Errorf("PAC = %q, want only example.com through the proxy", pac)
+	}
+
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(w.Body.String(), "http://"+p.self+"/proxy.pac") {
+		t.Errorf("instructions = %q, want the PAC address", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/other", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("/other = %d, want 404", w.Code)
+	}
+}
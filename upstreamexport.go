@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/lbconf"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const (
+	upstreamExportUsage = "usage: upstream-export -format haproxy|nginx [-n 5] [-name cloudflare] [-port 443] [-recheck] [-o file [-reload command]] [result.csv]"
+	reloadTimeout       = time.Minute
+)
+
+// Writes the best results as the backend of a reverse proxy, e.g.
+// "upstream-export -format nginx -o /etc/nginx/stream.d/cf.conf -reload 'nginx -s reload'"
+func upstreamExportCommand(args []string) error {
+	fs := flag.NewFlagSet("upstream-export", flag.ExitOnError)
+	format := fs.String("format", "", "Proxy: haproxy (backend section) or nginx (upstream block of the stream module)")
+	count := fs.Int("n", 5, "Best results written")
+	name := fs.String("name", "cloudflare", "Name of the backend or upstream")
+	port := fs.Int("port", 443, "Port the proxy forwards to")
+	recheck := fs.Bool("recheck", false, "Connect to the IPs on -port first, replacing dead ones with the next results")
+	output := fs.String("o", "", "Output file, stdout by default")
+	reload := fs.String("reload", "", "Command run after writing the file, e.g. \"systemctl reload haproxy\"")
+	_ = fs.Parse(args)
+	if *format == "" || *count < 1 || fs.NArg() > 1 {
+		return errors.New(upstreamExportUsage)
+	}
+	if *reload != "" && (*output == "" || *output == "-") {
+		return errors.New("-reload needs the file to write, given with -o")
+	}
+	path := "result.csv"
+	if fs.NArg() == 1 {
+		path = fs.Arg(0)
+	}
+	results, err := utils.ReadResults(path)
+	if err != nil {
+		return err
+	}
+	if *recheck {
+		if results, err = recheckResults(results, *count, *port); err != nil {
+			return err
+		}
+	}
+	servers := make([]lbconf.Server, 0, min(*count, len(results)))
+	for _, r := range results[:min(*count, len(results))] {
+		servers = append(servers, lbconf.Server{IP: r.IP, Speed: r.Speed})
+	}
+	config, err := lbconf.Render(*format, *name, *port, servers)
+	if err != nil {
+		return err
+	}
+	if *output == "" || *output == "-" {
+		_, err = os.Stdout.Write(config)
+		return err
+	}
+	if err := os.WriteFile(*output, config, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("[Info] Wrote %d servers to %s.\n", len(servers), *output)
+	if command := strings.Fields(*reload); len(command) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), reloadTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("reload command failed: %v", err)
+		}
+	}
+	return nil
+}
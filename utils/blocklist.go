@@ -0,0 +1,276 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBanAfter = 3
+	defaultBanTime  = 24 * time.Hour
+	// Largest remote blocklist read
+	maxRemoteBlocklist = 16 << 20
+)
+
+// Blocklist is the store updated by the current scan, nil when disabled
+var Blocklist *BlocklistStore
+
+type blocklistEntry struct {
+	IP          string    `json:"ip"`
+	Failures    int       `json:"failures"` // Consecutive failed validations
+	BannedUntil time.Time `json:"banned_until"`
+}
+
+// Last copy of a remote blocklist, kept in the blocklist file so that later runs only fetch it when it is due
+type remoteBlocklist struct {
+	URL     string         `json:"url"`
+	Fetched time.Time      `json:"fetched"`
+	Ranges  []netip.Prefix `json:"ranges"`
+}
+
+// The blocklist file: the bans learned from the download test and the copy of the remote list.
+// Files of earlier versions hold only the array of bans.
+type blocklistFile struct {
+	Bans   []*blocklistEntry `json:"bans"`
+	Remote *remoteBlocklist  `json:"remote,omitempty"`
+}
+
+// BlocklistStore bans IPs that fail validation several times in a row, until the ban expires, and the IPs of a remote list
+type BlocklistStore struct {
+	m        sync.Mutex
+	path     string
+	banAfter int
+	banTime  time.Duration
+	entries  map[string]*blocklistEntry
+	remote   *remoteBlocklist
+	blocked  []addrRange // Of the remote blocklist, sorted and merged
+}
+
+// Addresses from and to, inclusive
+type addrRange struct {
+	from, to netip.Addr
+}
+
+// Sorted, non-overlapping address ranges of the prefixes, so large lists are searched rather than scanned
+func mergeRanges(prefixes []netip.Prefix) []addrRange {
+	ranges := make([]addrRange, 0, len(prefixes))
+	for _, p := range prefixes {
+		ranges = append(ranges, addrRange{p.Masked().Addr(), lastAddr(p)})
+	}
+	slices.SortFunc(ranges, func(a, b addrRange) int { return a.from.Compare(b.from) })
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && merged[n-1].from.BitLen() == r.from.BitLen() && r.from.Compare(merged[n-1].to) <= 0 {
+			if r.to.Compare(merged[n-1].to) > 0 {
+				merged[n-1].to = r.to
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// Last address of a prefix
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().As16()
+	offset := 0
+	if p.Addr().Is4() {
+		offset = 96
+	}
+	for bit := offset + p.Bits(); bit < 128; bit++ {
+		b[bit/8] |= 0x80 >> (bit % 8)
+	}
+	last := netip.AddrFrom16(b)
+	if p.Addr().Is4() {
+		return last.Unmap()
+	}
+	return last
+}
+
+// Whether addr is in one of the sorted, merged ranges
+func inRanges(ranges []addrRange, addr netip.Addr) bool {
+	// The first range starting after addr, addr can only be in the one before it
+	i, _ := slices.BinarySearchFunc(ranges, addr, func(r addrRange, addr netip.Addr) int {
+		if r.from.Compare(addr) <= 0 {
+			return -1
+		}
+		return 1
+	})
+	return i > 0 && ranges[i-1].to.Compare(addr) >= 0 && ranges[i-1].from.BitLen() == addr.BitLen()
+}
+
+// LoadBlocklist reads the blocklist at path, a missing file starts an empty blocklist; an empty path keeps it in memory
+func LoadBlocklist(path string, banAfter int, banTime time.Duration) (*BlocklistStore, error) {
+	if banAfter <= 0 {
+		banAfter = defaultBanAfter
+	}
+	if banTime <= 0 {
+		banTime = defaultBanTime
+	}
+	b := &BlocklistStore{
+		path:     path,
+		banAfter: banAfter,
+		banTime:  banTime,
+		entries:  make(map[string]*blocklistEntry),
+	}
+	var raw json.RawMessage
+	if err := loadJSON(path, &raw); err != nil {
+		return nil, err
+	}
+	var file blocklistFile
+	var err error
+	if raw = bytes.TrimSpace(raw); len(raw) > 0 && raw[0] == '[' {
+		err = json.Unmarshal(raw, &file.Bans)
+	} else if len(raw) > 0 {
+		err = json.Unmarshal(raw, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, e := range file.Bans {
+		b.entries[e.IP] = e
+	}
+	if b.remote = file.Remote; b.remote != nil {
+		b.blocked = mergeRanges(b.remote.Ranges)
+	}
+	return b, nil
+}
+
+// ParseBlocklist reads a list of IPs and CIDR ranges, one per line; blank lines and # comments are skipped
+func ParseBlocklist(r io.Reader) ([]netip.Prefix, error) {
+	var ranges []netip.Prefix
+	lines := bufio.NewScanner(r)
+	for n := 1; lines.Scan(); n++ {
+		line, _, _ := strings.Cut(lines.Text(), "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(line)
+		if err != nil {
+			ip, ipErr := netip.ParseAddr(line)
+			if ipErr != nil {
+				return nil, fmt.Errorf("line %d: %q is neither an IP nor a CIDR range", n, line)
+			}
+			prefix = netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen())
+		}
+		ranges = append(ranges, prefix.Masked())
+	}
+	return ranges, lines.Err()
+}
+
+// Refresh fetches the remote blocklist at url (IPs and CIDR ranges, one per line) unless the copy in the blocklist file
+// was fetched from it within every; when fetching fails the last copy stays in use. A copy of another url is dropped,
+// and so is any with an empty url.
+func (b *BlocklistStore) Refresh(url string, every time.Duration) error {
+	b.m.Lock()
+	if b.remote != nil && b.remote.URL != url {
+		b.remote, b.blocked = nil, nil
+	}
+	fresh := url == "" || b.remote != nil && time.Since(b.remote.Fetched) < every
+	b.m.Unlock()
+	if fresh {
+		return nil
+	}
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	ranges, err := ParseBlocklist(io.LimitReader(resp.Body, maxRemoteBlocklist))
+	if err != nil {
+		return fmt.Errorf("%s: %v", url, err)
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.remote = &remoteBlocklist{URL: url, Fetched: time.Now(), Ranges: ranges}
+	b.blocked = mergeRanges(ranges)
+	return nil
+}
+
+// RemoteRanges returns how many ranges the remote blocklist in use has
+func (b *BlocklistStore) RemoteRanges() int {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.remote == nil {
+		return 0
+	}
+	return len(b.remote.Ranges)
+}
+
+// Fail records a failed validation and bans the IP once it failed [-ban-after] times in a row
+func (b *BlocklistStore) Fail(ip string) {
+	if b == nil {
+		return
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	e, ok := b.entries[ip]
+	if !ok {
+		e = &blocklistEntry{IP: ip}
+		b.entries[ip] = e
+	}
+	e.Failures++
+	if e.Failures >= b.banAfter {
+		e.Failures = 0
+		e.BannedUntil = time.Now().Add(b.banTime)
+	}
+}
+
+// Pass records a successful validation, which resets the failure count
+func (b *BlocklistStore) Pass(ip string) {
+	if b == nil {
+		return
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	if e, ok := b.entries[ip]; ok {
+		e.Failures = 0
+	}
+}
+
+// Banned reports whether the IP is currently banned or on the remote blocklist
+func (b *BlocklistStore) Banned(ip string) bool {
+	if b == nil {
+		return false
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	if e, ok := b.entries[ip]; ok && time.Now().Before(e.BannedUntil) {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && inRanges(b.blocked, addr.Unmap())
+}
+
+// Save writes the blocklist, dropping expired bans without pending failures
+func (b *BlocklistStore) Save() error {
+	if b == nil || b.path == "" {
+		return nil
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	now := time.Now()
+	list := make([]*blocklistEntry, 0, len(b.entries))
+	for ip, e := range b.entries {
+		if e.Failures == 0 && now.After(e.BannedUntil) {
+			delete(b.entries, ip)
+			continue
+		}
+		list = append(list, e)
+	}
+	return saveJSON(b.path, blocklistFile{Bans: list, Remote: b.remote})
+}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseBlocklist(t *testing.T) {
+	ranges, err := ParseBlocklist(strings.NewReader("# Shared list\n1.1.1.1\n\n104.16.0.5/24  # masked\n2606:4700::/32\n::ffff:8.8.8.8\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("1.1.1.1/32"),
+		netip.MustParsePrefix("104.16.0.0/24"),
+		netip.MustParsePrefix("2606:4700::/32"),
+		netip.MustParsePrefix("8.8.8.8/32"),
+	}
+	if !slices.Equal(ranges, want) {
+		t.Errorf("ranges = %v, want %v", ranges, want)
+	}
+	if _, err := ParseBlocklist(strings.NewReader("1.1.1.1\nexample.com\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("invalid line: %v, want an error on line 2", err)
+	}
+}
+
+func TestBlocklistBanned(t *testing.T) {
+	b, err := LoadBlocklist("", 2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Banned after failing twice in a row
+	b.Fail("1.0.0.1")
+	b.Pass("1.0.0.1")
+	b.Fail("1.0.0.1")
+	if b.Banned("1.0.0.1") {
+		t.Error("banned after a pass reset the failures")
+	}
+	b.Fail("1.0.0.1")
+	if !b.Banned("1.0.0.1") {
+		t.Error("not banned after two failures in a row")
+	}
+
+	// The ranges of the remote list, overlapping ones merged
+	ranges, _ := ParseBlocklist(strings.NewReader("104.16.0.0/16\n104.16.4.0/24\n104.17.255.255\n2606:4700::/32\n172.64.0.0/13\n"))
+	b.blocked = mergeRanges(ranges)
+	if len(b.blocked) != 4 {
+		t.Errorf("merged ranges = %v, want 4", b.blocked)
+	}
+	tests := []struct {
+		ip     string
+		banned bool
+	}{
+		{"104.16.0.0", true},
+		{"104.16.255.255", true},
+		{"104.17.0.0", false},
+		{"104.17.255.255", true},
+		{"172.71.255.255", true},
+		{"172.72.0.0", false},
+		{"::ffff:104.16.4.1", true},
+		{"2606:4700:ffff::1", true},
+		{"2606:4701::", false},
+		{"::6810:1", false}, // 104.16.0.1 in the low bits of IPv6
+		{"1.1.1.1", false},
+		{"not an ip", false},
+	}
+	for _, tt := range tests {
+		if banned := b.Banned(tt.ip); banned != tt.banned {
+			t.Errorf("Banned(%s) = %v, want %v", tt.ip, banned, tt.banned)
+		}
+	}
+	var none *BlocklistStore
+	if none.Banned("1.1.1.1") {
+		t.Error("a disabled blocklist banned an IP")
+	}
+}
+
+func TestBlocklistRefresh(t *testing.T) {
+	var fetches atomic.Int32
+	list := "1.1.1.0/24\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if r.URL.Path != "/list.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(list))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "blocklist.json")
+	load := func() *BlocklistStore {
+		t.Helper()
+		b, err := LoadBlocklist(path, 3, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	b := load()
+	if err := b.Refresh(server.URL+"/list.txt", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	b.Fail("2.2.2.2")
+	if !b.Banned("1.1.1.7") || b.RemoteRanges() != 1 {
+		t.Errorf("remote list not in use: %d ranges", b.RemoteRanges())
+	}
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Later runs reuse the copy until it is due, along with the bans
+	list = "8.8.8.8\n"
+	b = load()
+	if err := b.Refresh(server.URL+"/list.txt", time.Hour); err != nil || fetches.Load() != 1 || !b.Banned("1.1.1.7") {
+		t.Errorf("refresh within the interval: %v, %d fetches, want the saved copy", err, fetches.Load())
+	}
+	b.Fail("2.2.2.2")
+	b.Fail("2.2.2.2")
+	if !b.Banned("2.2.2.2") {
+		t.Error("the failures of the earlier run were lost")
+	}
+	if err := b.Refresh(server.URL+"/list.txt", 0); err != nil || b.Banned("1.1.1.7") || !b.Banned("8.8.8.8") {
+		t.Errorf("due refresh: %v, want the new list", err)
+	}
+
+	// A failed fetch keeps the last copy, one of another list is dropped
+	if err := b.Refresh(server.URL+"/list.txt?v=2", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+	b = load()
+	if err := b.Refresh(server.URL+"/list.txt?v=2", 0); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	if err := b.Refresh(server.URL+"/list.txt?v=2", 0); err == nil || !b.Banned("8.8.8.8") {
+		t.Errorf("failed refresh: %v, want an error and the last copy", err)
+	}
+	if err := b.Refresh(server.URL+"/other.txt", 0); err == nil || b.Banned("8.8.8.8") {
+		t.Errorf("failed refresh of another list: %v, want an error and no list", err)
+	}
+	if err := b.Refresh("", 0); err != nil || b.RemoteRanges() != 0 {
+		t.Errorf("no remote list: %v, %d ranges", err, b.RemoteRanges())
+	}
+}
+
+func TestLoadBlocklistArray(t *testing.T) {
+	// The format of earlier versions, only the bans
+	path := filepath.Join(t.TempDir(), "blocklist.json")
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	if err := os.WriteFile(path, []byte(`[{"ip": "1.1.1.1", "failures": 0, "banned_until": "`+until+`"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := LoadBlocklist(path, 3, time.Hour)
+	if err != nil || !b.Banned("1.1.1.1") {
+		t.Errorf("LoadBlocklist = %v, want the ban of 1.1.1.1", err)
+	}
+	if err := os.WriteFile(path, []byte(`{"bans": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBlocklist(path, 3, time.Hour); err == nil {
+		t.Error("invalid file: want an error")
+	}
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// NoColor disables the colored result table, it is also off when NO_COLOR is set or the output is not a terminal
+var NoColor = false
+
+func useColor() bool {
+	if NoColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	return enableVirtualTerminal()
+}
+
+// Color of a result value: green is good, yellow fair and red poor, only loss rate, delay and speed are graded
+func cellColor(column int, value string) string {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return ""
+	}
+	switch column {
+	case 3: // Loss rate
+		return grade(v == 0, v <= 0.25)
+	case 4: // Average delay
+		delay := time.Duration(v * float64(delayUnits[DelayUnit]))
+		return grade(delay < 150*time.Millisecond, delay < 300*time.Millisecond)
+	case 5: // Download speed, 0 when the download test is disabled
+		if v == 0 {
+			return ""
+		}
+		speed := v * speedUnits[SpeedUnit]
+		return grade(speed >= 5*1024*1024, speed >= 1024*1024)
+	}
+	return ""
+}
+
+func grade(good, fair bool) string {
+	switch {
+	case good:
+		return colorGreen
+	case fair:
+		return colorYellow
+	}
+	return colorRed
+}
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result is a row of a result file written by ExportCsv
+type Result struct {
+	IP       netip.Addr
+	LossRate float64
+	Delay    time.Duration
+	Speed    float64 // Bytes per second
+}
+
+// ReadResults reads a result file, CSV taking the units of delays and speeds from its header, or JSON or JSON lines as
+// written by ExportResults
+func ReadResults(path string) ([]Result, error) {
+	records, err := readResultRecords(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseResults(path, records)
+}
+
+// ParseResults reads a result file from r, like ReadResults
+func ParseResults(r io.Reader) ([]Result, error) {
+	records, err := readRecords("results", r)
+	if err != nil {
+		return nil, err
+	}
+	return parseResults("results", records)
+}
+
+// Rows of a result file, the header first
+func readResultRecords(path string) ([][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readRecords(path, f)
+}
+
+// Rows of a result file read from r, named name in errors; JSON results, told by their first character whatever the
+// extension as [-json] writes them to any file, are turned into the rows of the CSV file
+func readRecords(name string, r io.Reader) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return jsonRecords(name, trimmed)
+	}
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if len(records) == 0 || len(records[0]) < 6 {
+		return nil, fmt.Errorf("%s: not a result file", name)
+	}
+	return records, nil
+}
+
+func parseResults(path string, records [][]string) ([]Result, error) {
+	delayUnit, speedUnit := headerUnit(records[0][4], "ms"), headerUnit(records[0][5], "MB/s")
+	if _, ok := delayUnits[delayUnit]; !ok {
+		return nil, fmt.Errorf("%s: unknown delay unit %q", path, delayUnit)
+	}
+	if _, ok := speedUnits[speedUnit]; !ok {
+		return nil, fmt.Errorf("%s: unknown speed unit %q", path, speedUnit)
+	}
+	var results []Result
+	for i, record := range records[1:] {
+		if len(record) < 6 {
+			return nil, fmt.Errorf("%s: line %d: %d columns, want at least 6", path, i+2, len(record))
+		}
+		ip, err1 := netip.ParseAddr(record[0])
+		loss, err2 := strconv.ParseFloat(record[3], 64)
+		delay, err3 := strconv.ParseFloat(record[4], 64)
+		speed, err4 := strconv.ParseFloat(record[5], 64)
+		if err := cmp.Or(err1, err2, err3, err4); err != nil {
+			return nil, fmt.Errorf("%s: line %d: %v", path, i+2, err)
+		}
+		results = append(results, Result{
+			IP:       ip.Unmap(),
+			LossRate: loss,
+			Delay:    time.Duration(delay * float64(delayUnits[delayUnit])),
+			Speed:    speed * speedUnits[speedUnit],
+		})
+	}
+	return results, nil
+}
+
+// Unit in the parentheses of a column name such as "Download Speed (KB/s)", def without one
+func headerUnit(name, def string) string {
+	_, unit, ok := strings.Cut(name, "(")
+	if !ok {
+		return def
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(unit), ")"))
+}
+
+// Vantage is the result file of one machine or agent
+type Vantage struct {
+	Name    string
+	Results []Result
+}
+
+// ConsensusResult is an IP ranked across all vantages
+type ConsensusResult struct {
+	IP         netip.Addr
+	Seen       int             // Vantages the IP passed the tests of
+	Delays     []time.Duration // Delay from each vantage, -1 where the IP didn't pass
+	WorstDelay time.Duration   // Highest delay of the vantages the IP passed
+	MeanDelay  time.Duration   // Mean delay of the vantages the IP passed
+	MeanLoss   float64         // Mean loss rate, 1 for the vantages the IP didn't pass
+	MinSpeed   float64         // Lowest download speed of the vantages the IP passed, bytes per second
+}
+
+// Consensus ranks the IPs of all vantages: IPs passing from more vantages first, then by their worst delay,
+// so an IP that is only good from one vantage ranks below one that is fair from all of them
+func Consensus(vantages []Vantage) []ConsensusResult {
+	index := make(map[netip.Addr]*ConsensusResult)
+	var order []netip.Addr
+	for v, vantage := range vantages {
+		for _, r := range vantage.Results {
+			c, ok := index[r.IP]
+			if !ok {
+				c = &ConsensusResult{IP: r.IP, Delays: slices.Repeat([]time.Duration{-1}, len(vantages)), MinSpeed: math.Inf(1)}
+				index[r.IP] = c
+				order = append(order, r.IP)
+			}
+			if c.Delays[v] >= 0 {
+				continue // Listed twice in one file
+			}
+			c.Seen++
+			c.Delays[v] = r.Delay
+			c.WorstDelay = max(c.WorstDelay, r.Delay)
+			c.MeanDelay += r.Delay
+			c.MeanLoss += r.LossRate
+			c.MinSpeed = min(c.MinSpeed, r.Speed)
+		}
+	}
+	results := make([]ConsensusResult, len(order))
+	for i, ip := range order {
+		c := index[ip]
+		c.MeanDelay /= time.Duration(c.Seen)
+		c.MeanLoss = (c.MeanLoss + float64(len(vantages)-c.Seen)) / float64(len(vantages))
+		results[i] = *c
+	}
+	slices.SortStableFunc(results, func(a, b ConsensusResult) int {
+		return cmp.Or(
+			cmp.Compare(b.Seen, a.Seen),
+			cmp.Compare(a.WorstDelay, b.WorstDelay),
+			cmp.Compare(a.MeanLoss, b.MeanLoss),
+			cmp.Compare(b.MinSpeed, a.MinSpeed),
+		)
+	})
+	return results
+}
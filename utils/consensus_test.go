@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadResults(t *testing.T) {
+	oldOutput, oldSpeed, oldDelay := Output, SpeedUnit, DelayUnit
+	t.Cleanup(func() { Output, SpeedUnit, DelayUnit = oldOutput, oldSpeed, oldDelay })
+	Output = filepath.Join(t.TempDir(), "result.csv")
+	SpeedUnit, DelayUnit = "KB/s", "us"
+	ExportCsv([]CloudflareIPData{{
+		PingData:      &PingData{IP: &net.IPAddr{IP: net.ParseIP("1.1.1.1")}, Sended: 4, Received: 3, Delay: 150 * time.Millisecond},
+		DownloadSpeed: 2 << 20,
+	}})
+	results, err := ReadResults(Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Result{IP: netip.MustParseAddr("1.1.1.1"), LossRate: 0.25, Delay: 150 * time.Millisecond, Speed: 2 << 20}
+	if len(results) != 1 || results[0] != want {
+		t.Errorf("ReadResults = %+v, want %+v", results, want)
+	}
+
+	if err := os.WriteFile(Output, []byte("IP Address\n1.1.1.1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadResults(Output); err == nil {
+		t.Error("ReadResults accepted a file without the result columns")
+	}
+}
+
+func TestReadResultsJSON(t *testing.T) {
+	oldOutput, oldJSON := Output, JSON
+	t.Cleanup(func() { Output, JSON = oldOutput, oldJSON })
+	data := []CloudflareIPData{{
+		PingData:      &PingData{IP: &net.IPAddr{IP: net.ParseIP("1.1.1.1")}, Sended: 4, Received: 3, Delay: 150 * time.Millisecond, Colo: "FRA"},
+		DownloadSpeed: 2 << 20,
+	}, {
+		PingData: &PingData{IP: &net.IPAddr{IP: net.ParseIP("2606:4700::1")}, Sended: 4, Received: 4, Delay: 90 * time.Millisecond, Colo: "AMS"},
+	}}
+	want := []Result{
+		{IP: netip.MustParseAddr("1.1.1.1"), LossRate: 0.25, Delay: 150 * time.Millisecond, Speed: 2 << 20},
+		{IP: netip.MustParseAddr("2606:4700::1"), Delay: 90 * time.Millisecond},
+	}
+	// -json writes JSON whatever the extension
+	for _, name := range []string{"result.json", "result.jsonl", "json.csv"} {
+		Output, JSON = filepath.Join(t.TempDir(), name), name == "json.csv"
+		ExportResults(data)
+		results, err := ReadResults(Output)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(results) != 2 || results[0] != want[0] || results[1] != want[1] {
+			t.Errorf("%s: ReadResults = %+v, want %+v", name, results, want)
+		}
+		filter, _ := ParseFilter("colo=ams")
+		if e, err := Explain(want[1].IP, Output, ExplainLimits{Filter: filter}, nil); err != nil || e.Position != 2 || len(e.Hidden) != 0 {
+			t.Errorf("%s: Explain = %+v, %v, want the second result shown", name, e, err)
+		}
+	}
+}
+
+func TestConsensus(t *testing.T) {
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	a, b, c := netip.MustParseAddr("1.1.1.1"), netip.MustParseAddr("1.0.0.1"), netip.MustParseAddr("1.1.1.2")
+	vantages := []Vantage{
+		{Name: "home", Results: []Result{{IP: a, Delay: ms(20)}, {IP: b, Delay: ms(60)}, {IP: c, Delay: ms(90)}}},
+		{Name: "office", Results: []Result{{IP: b, Delay: ms(70)}, {IP: c, Delay: ms(80)}}},
+	}
+	got := Consensus(vantages)
+	// a is the best from home but fails from the office, b is fair from both
+	want := []netip.Addr{b, c, a}
+	if len(got) != len(want) {
+		t.Fatalf("got %d IPs, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].IP != want[i] {
+			t.Errorf("rank %d = %v, want %v", i, got[i].IP, want[i])
+		}
+	}
+	if r := got[0]; r.Seen != 2 || r.WorstDelay != ms(70) || r.MeanDelay != ms(65) || r.Delays[0] != ms(60) {
+		t.Errorf("consensus of %v = %+v", b, r)
+	}
+	if r := got[2]; r.Seen != 1 || r.MeanLoss != 0.5 || r.Delays[1] != -1 {
+		t.Errorf("consensus of %v = %+v", a, r)
+	}
+}
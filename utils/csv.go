@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/netip"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -30,6 +32,44 @@ func NoPrintResult() bool {
 	return PrintNum == 0
 }
 
+// Prints the selected columns, each as wide as its longest value
+func printTable(rows [][]string) {
+	header := []string{"IP Address", "Sent", "Received", "Loss-Rate", delayHeader("-"), speedHeader("-")}
+	for _, c := range extraColumns {
+		header = append(header, c.Name)
+	}
+	columns := showColumns
+	if columns == nil {
+		columns = []int{0, 1, 2, 3, 4, 5}
+	}
+	widths := make([]int, len(columns))
+	for i, c := range columns {
+		widths[i] = len(header[c])
+		for _, row := range rows {
+			widths[i] = max(widths[i], len(row[c]))
+		}
+	}
+	color := useColor()
+	printRow := func(row []string, grade bool) {
+		var line strings.Builder
+		for i, c := range columns {
+			cell := row[c]
+			if i < len(columns)-1 {
+				cell = fmt.Sprintf("%-*s", widths[i]+2, cell)
+			}
+			if code := cellColor(c, row[c]); color && grade && code != "" {
+				cell = code + cell + colorReset
+			}
+			line.WriteString(cell)
+		}
+		fmt.Println(line.String())
+	}
+	printRow(header, false)
+	for _, row := range rows {
+		printRow(row, true)
+	}
+}
+
 // Check if to output to file
 func noOutput() bool {
 	return Output == "" || Output == " "
@@ -40,12 +80,63 @@ type PingData struct {
 	Sended   int
 	Received int
 	Delay    time.Duration
+
+	TCPFingerprint string // SYN-ACK parameters seen during TCPing
+	Middlebox      bool   // TCPFingerprint differs from the edge signature
+	Colo           string // Datacenter the IP terminates at
+	Source         string // Local address the system chose for the IP
+	Interface      string // Outgoing interface of Source
+	Pinned         bool   // Listed in [-pin], kept regardless of the conditions
+	JA3            string // JA3 hash of the ClientHello sent to the IP
+	JA4            string // JA4 of the ClientHello sent to the IP
+	ECH            string // Whether the IP accepted the encrypted ClientHello of [-ech]: accepted or rejected
+	Error          string // Class of the last failed probe, e.g. tls-reset
+}
+
+// SizeSpeed is the download speed of an object of one size
+type SizeSpeed struct {
+	Size  int64   `json:"size"`  // Bytes
+	Speed float64 `json:"speed"` // Bytes per second from the request to the last byte
 }
 
 type CloudflareIPData struct {
 	*PingData
 	lossRate      float32
 	DownloadSpeed float64
+
+	PTR   string // Reverse DNS name
+	CFRay string // CF-RAY header of the trace request
+	Cert  string // Leaf certificate summary
+	OCSP  string // Verdict on the stapled OCSP response
+	CT    string // Verdict on certificate transparency
+
+	KeepAlive  []time.Duration // Latency of each request sent over one connection
+	Reconnects int             // Connections dialed again during the keep-alive test
+
+	HookScore float64 // Score given by the hook, 0 when accepted without one
+
+	CacheStatus string // cf-cache-status of the download test
+	CacheAge    string // Age header of the download test
+
+	Resumption string // Whether the download test resumed the TLS session of the latency test: yes, no or empty when not tried
+
+	SizeSpeeds []SizeSpeed // Of each [-sizes] object
+
+	UploadSpeed float64 // Bytes per second of the [-upload] test
+
+	QUIC      string        // QUIC versions answered on UDP, e.g. "v1 v2", or "no"
+	QUICDelay time.Duration // Round trip of the QUIC answer
+	QUICSpeed float64       // Bytes per second of the HTTP/3 download
+
+	Waterfall      time.Duration // From dialing to the last byte of the last [-waterfall] asset, 0 when a fetch failed
+	WaterfallProto string        // Protocol the waterfall was loaded over: h2 or http/1.1
+
+	Fingerprints string // Outcome of each [-fingerprint-sweep] ClientHello, e.g. "chrome:ok go:fail"
+
+	WarmUpOK    int           // Handshakes that succeeded of the parallel warm-up connections
+	WarmUpTotal int           // Parallel warm-up connections opened
+	WarmUpTime  time.Duration // Until all warm-up handshakes were done
+	Throttled   bool          // The later warm-up connections failed or stalled while the first ones passed
 }
 
 // Calculate packet loss rate
@@ -57,14 +148,90 @@ func (cf *CloudflareIPData) getLossRate() float32 {
 	return cf.lossRate
 }
 
+// LossRate returns the share of the latency tests lost
+func (cf *CloudflareIPData) LossRate() float32 {
+	return cf.getLossRate()
+}
+
+// KeepAliveLatency lists the keep-alive request latencies in ms, e.g. 152.10/48.22/47.90
+func (cf *CloudflareIPData) KeepAliveLatency() string {
+	values := make([]string, len(cf.KeepAlive))
+	for i, d := range cf.KeepAlive {
+		values[i] = strconv.FormatFloat(d.Seconds()*1000, 'f', 2, 32)
+	}
+	return strings.Join(values, "/")
+}
+
+// KeepAliveDeltas lists how much each reused request was slower than the previous one in ms, e.g. -103.88/-0.32
+func (cf *CloudflareIPData) KeepAliveDeltas() string {
+	if len(cf.KeepAlive) < 2 {
+		return ""
+	}
+	values := make([]string, len(cf.KeepAlive)-1)
+	for i := 1; i < len(cf.KeepAlive); i++ {
+		values[i-1] = strconv.FormatFloat((cf.KeepAlive[i]-cf.KeepAlive[i-1]).Seconds()*1000, 'f', 2, 32)
+	}
+	return strings.Join(values, "/")
+}
+
+// SizeSpeedColumn returns the speed of the i-th [-sizes] object in the speed unit, empty when it wasn't tested
+func (cf *CloudflareIPData) SizeSpeedColumn(i int) string {
+	if i >= len(cf.SizeSpeeds) {
+		return ""
+	}
+	return formatSpeed(cf.SizeSpeeds[i].Speed)
+}
+
+// UploadSpeedColumn returns the [-upload] speed in the speed unit
+func (cf *CloudflareIPData) UploadSpeedColumn() string {
+	return formatSpeed(cf.UploadSpeed)
+}
+
+// QUICDelayColumn returns the round trip of the QUIC answer in the delay unit, empty without one
+func (cf *CloudflareIPData) QUICDelayColumn() string {
+	if cf.QUICDelay == 0 {
+		return ""
+	}
+	return formatDelay(cf.QUICDelay)
+}
+
+// QUICSpeedColumn returns the HTTP/3 download speed in the speed unit
+func (cf *CloudflareIPData) QUICSpeedColumn() string {
+	return formatSpeed(cf.QUICSpeed)
+}
+
+// WaterfallColumn returns the waterfall time in the delay unit, empty when it failed
+func (cf *CloudflareIPData) WaterfallColumn() string {
+	if cf.Waterfall == 0 {
+		return ""
+	}
+	return formatDelay(cf.Waterfall)
+}
+
+// Column is an optional result column, enabled by the features that fill it
+type Column struct {
+	Name  string
+	Value func(cf *CloudflareIPData) string
+}
+
+var extraColumns []Column
+
+// AddColumn appends an optional column to the result file
+func AddColumn(name string, value func(cf *CloudflareIPData) string) {
+	extraColumns = append(extraColumns, Column{Name: name, Value: value})
+}
+
 func (cf *CloudflareIPData) toString() []string {
-	result := make([]string, 6)
+	result := make([]string, 6, 6+len(extraColumns))
 	result[0] = cf.IP.String()
 	result[1] = strconv.Itoa(cf.Sended)
 	result[2] = strconv.Itoa(cf.Received)
 	result[3] = strconv.FormatFloat(float64(cf.getLossRate()), 'f', 2, 32)
-	result[4] = strconv.FormatFloat(cf.Delay.Seconds()*1000, 'f', 2, 32)
-	result[5] = strconv.FormatFloat(cf.DownloadSpeed/1024/1024, 'f', 2, 32)
+	result[4] = formatDelay(cf.Delay)
+	result[5] = formatSpeed(cf.DownloadSpeed)
+	for _, c := range extraColumns {
+		result = append(result, c.Value(cf))
+	}
 	return result
 }
 
@@ -79,11 +246,45 @@ func ExportCsv(data []CloudflareIPData) {
 	}
 	defer fp.Close()
 	w := csv.NewWriter(fp) // Create a new file writing stream
-	_ = w.Write([]string{"IP Address", "Sent", "Received", "Loss Rate", "Average Delay", "Download Speed (MB/s)"})
+	header := []string{"IP Address", "Sent", "Received", "Loss Rate", delayHeader(" "), speedHeader(" ")}
+	for _, c := range extraColumns {
+		header = append(header, c.Name)
+	}
+	_ = w.Write(header)
 	_ = w.WriteAll(convertToString(data))
 	w.Flush()
 }
 
+// ReadResultIPs returns the IPs of a result file written by ExportResults, best first
+func ReadResultIPs(path string) ([]netip.Addr, error) {
+	if resultFormat(path) != "csv" {
+		return readJSONResultIPs(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	var ips []netip.Addr
+	for i, record := range records {
+		if i == 0 || len(record) == 0 {
+			continue // Header
+		}
+		ip, err := netip.ParseAddr(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %v", path, i+1, err)
+		}
+		ips = append(ips, ip.Unmap())
+	}
+	return ips, nil
+}
+
 func convertToString(data []CloudflareIPData) [][]string {
 	result := make([][]string, 0)
 	for _, v := range data {
@@ -96,18 +297,27 @@ func convertToString(data []CloudflareIPData) [][]string {
 type PingDelaySet []CloudflareIPData
 
 // Delay condition filtering
-func (s PingDelaySet) FilterDelay() (data PingDelaySet) {
-	if InputMaxDelay > maxDelay || InputMinDelay < minDelay { // When the input delay condition is not within the default range, no filtering is performed
+func (s PingDelaySet) FilterDelay() PingDelaySet {
+	return s.FilterDelayRange(InputMinDelay, InputMaxDelay)
+}
+
+// FilterDelayRange keeps the IPs of an average delay within lower~upper and the pinned ones
+func (s PingDelaySet) FilterDelayRange(lower, upper time.Duration) (data PingDelaySet) {
+	if upper > maxDelay || lower < minDelay { // When the input delay condition is not within the default range, no filtering is performed
 		return s
 	}
-	if InputMaxDelay == maxDelay && InputMinDelay == minDelay { // When the input delay condition is the default value, no filtering is performed
+	if upper == maxDelay && lower == minDelay { // When the input delay condition is the default value, no filtering is performed
 		return s
 	}
-	for _, v := range s {
-		if v.Delay > InputMaxDelay { // Upper limit of average delay, when the delay is greater than the maximum value of the condition, no subsequent data meets the condition, directly exit the loop
-			break
+	for i, v := range s {
+		if v.Pinned {
+			data = append(data, v)
+			continue
+		}
+		if v.Delay > upper { // Upper limit of average delay, when the delay is greater than the maximum value of the condition, no subsequent data meets the condition, directly exit the loop
+			return append(data, s[i:].pinned()...)
 		}
-		if v.Delay < InputMinDelay { // Lower limit of average delay, when the delay is less than the minimum value of the condition, it does not meet the condition, skip
+		if v.Delay < lower { // Lower limit of average delay, when the delay is less than the minimum value of the condition, it does not meet the condition, skip
 			continue
 		}
 		data = append(data, v) // When the delay meets the condition, add it to the new array
@@ -116,19 +326,38 @@ func (s PingDelaySet) FilterDelay() (data PingDelaySet) {
 }
 
 // Packet loss condition filtering
-func (s PingDelaySet) FilterLossRate() (data PingDelaySet) {
-	if InputMaxLossRate >= maxLossRate { // When the input packet loss condition is the default value, no filtering is performed
+func (s PingDelaySet) FilterLossRate() PingDelaySet {
+	return s.FilterMaxLossRate(InputMaxLossRate)
+}
+
+// FilterMaxLossRate keeps the IPs of a loss rate up to limit (0~1) and the pinned ones
+func (s PingDelaySet) FilterMaxLossRate(limit float32) (data PingDelaySet) {
+	if limit >= maxLossRate { // When the input packet loss condition is the default value, no filtering is performed
 		return s
 	}
-	for _, v := range s {
-		if v.getLossRate() > InputMaxLossRate { // Upper limit of packet loss rate
-			break
+	for i, v := range s {
+		if v.Pinned {
+			data = append(data, v)
+			continue
+		}
+		if v.getLossRate() > limit { // Upper limit of packet loss rate
+			return append(data, s[i:].pinned()...)
 		}
 		data = append(data, v) // When the packet loss rate meets the condition, add it to the new array
 	}
 	return
 }
 
+// Pinned IPs, which every condition keeps
+func (s PingDelaySet) pinned() (data PingDelaySet) {
+	for _, v := range s {
+		if v.Pinned {
+			data = append(data, v)
+		}
+	}
+	return
+}
+
 func (s PingDelaySet) Len() int {
 	return len(s)
 }
@@ -164,22 +393,14 @@ func (s DownloadSpeedSet) Print() {
 		fmt.Println("\n[Info] The number of complete test results IP is 0, skipping output results.")
 		return
 	}
-	dateString := convertToString(s) // Convert to multi-dimensional array [][]string
-	if len(dateString) < PrintNum {  // If the length of the IP array (number of IPs) is less than the printing times, change the times to the number of IPs
-		PrintNum = len(dateString)
-	}
-	headFormat := "%-15s%-5s%-9s%-10s%-14s%-21s\n"
-	dataFormat := "%-17s%-7s%-7s%-13s%-15s%-15s\n"
-	for i := 0; i < PrintNum; i++ { // If the IPs to be output contain IPv6, adjust the spacing
-		if len(dateString[i][0]) > 15 {
-			headFormat = "%-40s%-5s%-9s%-10s%-14s%-21s\n"
-			dataFormat = "%-42s%-7s%-7s%-13s%-15s%-15s\n"
-			break
-		}
+	rows := filterRows(convertToString(s)) // Convert to multi-dimensional array [][]string
+	if len(rows) < PrintNum {              // If the number of IPs is less than the printing times, change the times to the number of IPs
+		PrintNum = len(rows)
 	}
-	fmt.Printf(headFormat, "IP Address", "Sent", "Received", "Loss-Rate", "Average-Delay", "Download-Speed (MB/s)")
-	for i := 0; i < PrintNum; i++ {
-		fmt.Printf(dataFormat, dateString[i][0], dateString[i][1], dateString[i][2], dateString[i][3], dateString[i][4], dateString[i][5])
+	if showFrom >= PrintNum {
+		fmt.Println("\n[Info] No test results match [-show] and [-show-filter], skipping output results.")
+	} else {
+		printTable(rows[showFrom:PrintNum])
 	}
 	if !noOutput() {
 		fmt.Printf("\nComplete test results have been written to %v file, which can be viewed using Notepad/Spreadsheet software.\n", Output)
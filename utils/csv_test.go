@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestFiltersKeepPinned(t *testing.T) {
+	defer func(maxDelay time.Duration, maxLoss float32) {
+		InputMaxDelay, InputMaxLossRate = maxDelay, maxLoss
+	}(InputMaxDelay, InputMaxLossRate)
+	InputMaxDelay, InputMaxLossRate = 100*time.Millisecond, 0.25
+
+	ip := func(s string, recv int, delay time.Duration, pinned bool) CloudflareIPData {
+		return CloudflareIPData{PingData: &PingData{IP: &net.IPAddr{IP: net.ParseIP(s)}, Sended: 4, Received: recv, Delay: delay, Pinned: pinned}}
+	}
+	set := PingDelaySet{
+		ip("1.1.1.1", 4, 50*time.Millisecond, false),
+		ip("1.1.1.2", 4, 300*time.Millisecond, false), // Too slow
+		ip("1.1.1.3", 4, 400*time.Millisecond, true),
+		ip("1.1.1.4", 1, 50*time.Millisecond, false), // Too lossy
+		ip("1.1.1.5", 0, 0, true),
+	}
+	sort.Sort(set)
+
+	var got []string
+	for _, v := range set.FilterDelay().FilterLossRate() {
+		got = append(got, v.IP.String())
+	}
+	sort.Strings(got)
+	if want := []string{"1.1.1.1", "1.1.1.3", "1.1.1.5"}; !slices.Equal(got, want) {
+		t.Errorf("filtered to %v, want %v", got, want)
+	}
+}
+
+func TestReadResultIPs(t *testing.T) {
+	old := Output
+	t.Cleanup(func() { Output = old })
+	var data []CloudflareIPData
+	for _, ip := range []string{"1.1.1.1", "2606:4700::1"} {
+		data = append(data, CloudflareIPData{PingData: &PingData{IP: &net.IPAddr{IP: net.ParseIP(ip)}, Sended: 4, Received: 4}})
+	}
+	data[0].UploadSpeed = 2048
+	for _, name := range []string{"result.csv", "result.json", "result.jsonl"} {
+		t.Run(name, func(t *testing.T) {
+			Output = filepath.Join(t.TempDir(), name)
+			ExportResults(data)
+			ips, err := ReadResultIPs(Output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ips) != 2 || ips[0].String() != "1.1.1.1" || ips[1].String() != "2606:4700::1" {
+				t.Errorf("got %v", ips)
+			}
+			if file, _ := os.ReadFile(Output); name != "result.csv" && !bytes.Contains(file, []byte(`"upload_speed":`)) {
+				t.Errorf("%s has no upload speed:\n%s", name, file)
+			}
+		})
+	}
+}
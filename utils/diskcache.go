@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const cacheDirTag = "Signature: 8a477f597d28d172789f06886806bc55\n# This directory is a cache of CloudflareScanner.\n"
+
+// Cache keeps network lookups on disk between runs, nil when disabled
+var Cache *DiskCache
+
+// DiskCache stores JSON values with an expiry time, one file per key under a directory per kind
+type DiskCache struct {
+	dir string
+}
+
+type cacheEntry struct {
+	Expires time.Time       `json:"expires"`
+	Value   json.RawMessage `json:"value"`
+}
+
+// DefaultCacheDir is the cache directory of the user, e.g. ~/.cache/CloudflareScanner
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "cfscanner-cache"
+	}
+	return filepath.Join(dir, "CloudflareScanner")
+}
+
+// OpenCache creates the cache directory if needed
+func OpenCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	// Marks the directory as a cache for backup tools, and for ClearCache
+	tag := filepath.Join(dir, "CACHEDIR.TAG")
+	if _, err := os.Stat(tag); errors.Is(err, os.ErrNotExist) {
+		if err := os.WriteFile(tag, []byte(cacheDirTag), 0o644); err != nil {
+			return nil, err
+		}
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// ClearCache removes the cache directory and everything in it, refusing directories not made by OpenCache
+func ClearCache(dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, "CACHEDIR.TAG")); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("%s is not a cache directory", dir)
+	}
+	return os.RemoveAll(dir)
+}
+
+func (c *DiskCache) path(kind, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, kind, hex.EncodeToString(sum[:16])+".json")
+}
+
+// Get decodes the unexpired value of key into v, false when there is none or the cache is disabled
+func (c *DiskCache) Get(kind, key string, v any) bool {
+	if c == nil {
+		return false
+	}
+	data, err := os.ReadFile(c.path(kind, key))
+	if err != nil {
+		return false
+	}
+	var entry cacheEntry
+	if json.Unmarshal(data, &entry) != nil || time.Now().After(entry.Expires) {
+		_ = os.Remove(c.path(kind, key))
+		return false
+	}
+	return json.Unmarshal(entry.Value, v) == nil
+}
+
+// Put stores v as the value of key for ttl, failures only cost a later lookup
+func (c *DiskCache) Put(kind, key string, v any, ttl time.Duration) {
+	if c == nil || ttl <= 0 {
+		return
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	path := c.path(kind, key)
+	if os.MkdirAll(filepath.Dir(path), 0o755) != nil {
+		return
+	}
+	_ = saveJSON(path, cacheEntry{Expires: time.Now().Add(ttl), Value: value})
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := OpenCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put("trace", "1.1.1.1", []string{"LAX"}, time.Hour)
+	c.Put("trace", "1.0.0.1", []string{"SJC"}, -time.Second)
+	var got []string
+	if !c.Get("trace", "1.1.1.1", &got) || len(got) != 1 || got[0] != "LAX" {
+		t.Errorf("got %v", got)
+	}
+	if c.Get("trace", "1.0.0.1", &got) || c.Get("dns", "1.1.1.1", &got) {
+		t.Error("got a value never stored")
+	}
+
+	// Reopened by a later run
+	if c, err = OpenCache(dir); err != nil || !c.Get("trace", "1.1.1.1", &got) {
+		t.Errorf("value lost on reopening: %v", err)
+	}
+	if err := ClearCache(dir); err != nil || c.Get("trace", "1.1.1.1", &got) {
+		t.Errorf("value kept after clearing: %v", err)
+	}
+	if err := ClearCache(t.TempDir()); err == nil {
+		t.Error("cleared a directory that isn't a cache")
+	}
+	var disabled *DiskCache
+	disabled.Put("trace", "1.1.1.1", got, time.Hour)
+	if disabled.Get("trace", "1.1.1.1", &got) {
+		t.Error("disabled cache returned a value")
+	}
+}
@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// ExplainLimits are the conditions of the scan an IP is explained against, zero values are the defaults that keep every IP
+type ExplainLimits struct {
+	MaxDelay      time.Duration // [-tl], 0 is unlimited
+	MinDelay      time.Duration // [-tll]
+	MaxLossRate   float64       // [-tlr], 0 or 1 keeps every loss rate
+	MinSpeed      float64       // [-sl] in bytes per second
+	MinReputation float64       // [-min-reputation]
+	HalfLife      time.Duration // Of the reputation history
+	Filter        []Condition   // [-show-filter], only hides results from the console
+}
+
+// Explanation is why an IP ranks where it does in a result file, or what keeps it out
+type Explanation struct {
+	IP       netip.Addr
+	Position int // 1-based rank in the result file, 0 when the IP is not in it
+	Total    int
+	Result   Result
+	Pinned   bool
+	// Measurements that set the rank, in the order they are compared
+	Keys []string
+	// How the IP compares with the results right above and below it
+	Above, Below string
+	// Reputation history of the IP, nil without one
+	Reputation *IPReputation
+	// Weight of the history now, after decaying since its last test
+	DecayedWeight float64
+	// Conditions the IP fails, each with the measurement and the limit
+	Rejected []string
+	// Show filter conditions hiding the IP from the console
+	Hidden []string
+}
+
+// Explain finds the IP in the result file at path and checks it against the limits and its reputation in store (may be nil)
+func Explain(ip netip.Addr, path string, limits ExplainLimits, store *ReputationStore) (*Explanation, error) {
+	records, err := readResultRecords(path)
+	if err != nil {
+		return nil, err
+	}
+	results, err := parseResults(path, records)
+	if err != nil {
+		return nil, err
+	}
+	e := &Explanation{IP: ip.Unmap(), Total: len(results)}
+	header := records[0]
+	hookColumn := columnOf(header, "hook-score")
+	byHook := hookColumn >= 0
+	bySpeed := false
+	for _, r := range results {
+		bySpeed = bySpeed || r.Speed > 0
+	}
+	switch {
+	case byHook:
+		e.Keys = []string{"hook score", "download speed"}
+	case bySpeed:
+		e.Keys = []string{"download speed"}
+	default:
+		e.Keys = []string{"loss rate", "average delay"}
+	}
+
+	for i, r := range results {
+		if r.IP != e.IP {
+			continue
+		}
+		e.Position, e.Result = i+1, r
+		row := records[i+1]
+		if c := columnOf(header, "pinned"); c >= 0 && c < len(row) {
+			e.Pinned = row[c] == "true"
+		}
+		score := func(j int) float64 {
+			if hookColumn < 0 || hookColumn >= len(records[j+1]) {
+				return 0
+			}
+			v, _ := strconv.ParseFloat(records[j+1][hookColumn], 64)
+			return v
+		}
+		compare := func(j int) string {
+			o := results[j]
+			switch {
+			case byHook && score(i) != score(j):
+				return fmt.Sprintf("%s (#%d): hook score %v against %v", o.IP, j+1, score(i), score(j))
+			case bySpeed || byHook:
+				return fmt.Sprintf("%s (#%d): download speed %s against %s %s", o.IP, j+1, formatSpeed(r.Speed), formatSpeed(o.Speed), SpeedUnit)
+			case r.LossRate != o.LossRate:
+				return fmt.Sprintf("%s (#%d): loss rate %.2f against %.2f", o.IP, j+1, r.LossRate, o.LossRate)
+			}
+			return fmt.Sprintf("%s (#%d): average delay %s against %s %s", o.IP, j+1, formatDelay(r.Delay), formatDelay(o.Delay), DelayUnit)
+		}
+		if i > 0 {
+			e.Above = compare(i - 1)
+		}
+		if i+1 < len(results) {
+			e.Below = compare(i + 1)
+		}
+		for _, c := range limits.Filter {
+			index := builtinColumn(c.Key)
+			if index < 0 {
+				index = columnOf(header, c.Key)
+			}
+			if index >= 0 && index < len(row) {
+				c.index = index
+				if !c.match(row) {
+					e.Hidden = append(e.Hidden, c.String())
+				}
+			}
+		}
+		break
+	}
+
+	if store != nil {
+		store.m.Lock()
+		if r, ok := store.entries[e.IP.String()]; ok {
+			copied := *r
+			e.Reputation = &copied
+			halfLife := limits.HalfLife
+			if halfLife <= 0 {
+				halfLife = store.halfLife
+			}
+			e.DecayedWeight = r.Weight * math.Pow(0.5, float64(time.Since(r.Updated))/float64(halfLife))
+		}
+		store.m.Unlock()
+	}
+	e.Rejected = limits.check(e)
+	return e, nil
+}
+
+// Conditions of the limits the IP fails, its measurements only count when it is in the result file
+func (l ExplainLimits) check(e *Explanation) (rejected []string) {
+	if e.Position > 0 {
+		r := e.Result
+		if l.MaxDelay > 0 && r.Delay > l.MaxDelay {
+			rejected = append(rejected, fmt.Sprintf("average delay %s %s is above [-tl %s]", formatDelay(r.Delay), DelayUnit, formatDelay(l.MaxDelay)))
+		}
+		if r.Delay < l.MinDelay {
+			rejected = append(rejected, fmt.Sprintf("average delay %s %s is below [-tll %s]", formatDelay(r.Delay), DelayUnit, formatDelay(l.MinDelay)))
+		}
+		if l.MaxLossRate > 0 && l.MaxLossRate < 1 && r.LossRate > l.MaxLossRate {
+			rejected = append(rejected, fmt.Sprintf("loss rate %.2f is above [-tlr %.2f]", r.LossRate, l.MaxLossRate))
+		}
+		if l.MinSpeed > 0 && r.Speed < l.MinSpeed {
+			rejected = append(rejected, fmt.Sprintf("download speed %s %s is below [-sl %s]", formatSpeed(r.Speed), SpeedUnit, formatSpeed(l.MinSpeed)))
+		}
+	}
+	if e.Reputation != nil && l.MinReputation > 0 && e.Reputation.Value() < l.MinReputation {
+		rejected = append(rejected, fmt.Sprintf("reputation %.2f is below [-min-reputation %.2f]", e.Reputation.Value(), l.MinReputation))
+	}
+	if e.Pinned && len(rejected) > 0 {
+		for i := range rejected {
+			rejected[i] += ", but the IP is pinned"
+		}
+	}
+	return
+}
+
+// Index of the column with key in the header of a result file, -1 without one
+func columnOf(header []string, key string) int {
+	for i, name := range header {
+		if columnKey(name) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Index of a built-in column by its key, whose header names differ, -1 for other keys
+func builtinColumn(key string) int {
+	for i, k := range builtinKeys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "result.csv")
+	data := `IP Address,Sent,Received,Loss Rate,Average Delay,Download Speed (MB/s),Colo
+1.1.1.1,4,4,0.00,120.00,8.00,FRA
+1.0.0.1,4,3,0.25,80.00,5.00,AMS
+1.1.1.2,4,4,0.00,300.00,2.00,FRA
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	filter, err := ParseFilter("colo=FRA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits := ExplainLimits{MaxDelay: 200 * time.Millisecond, MaxLossRate: 0.2, Filter: filter}
+
+	e, err := Explain(netip.MustParseAddr("1.0.0.1"), path, limits, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Position != 2 || e.Total != 3 || strings.Join(e.Keys, ",") != "download speed" {
+		t.Errorf("got #%d of %d by %v, want #2 of 3 by download speed", e.Position, e.Total, e.Keys)
+	}
+	if !strings.Contains(e.Above, "1.1.1.1 (#1)") || !strings.Contains(e.Below, "1.1.1.2 (#3)") {
+		t.Errorf("neighbours %q and %q", e.Above, e.Below)
+	}
+	if len(e.Rejected) != 1 || !strings.Contains(e.Rejected[0], "-tlr") {
+		t.Errorf("rejected by %v, want the loss rate", e.Rejected)
+	}
+	if len(e.Hidden) != 1 || e.Hidden[0] != "colo=FRA" {
+		t.Errorf("hidden by %v, want colo=FRA", e.Hidden)
+	}
+
+	e, err = Explain(netip.MustParseAddr("1.1.1.2"), path, limits, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Rejected) != 1 || !strings.Contains(e.Rejected[0], "-tl ") || len(e.Hidden) != 0 {
+		t.Errorf("rejected by %v and hidden by %v, want only the delay", e.Rejected, e.Hidden)
+	}
+
+	e, err = Explain(netip.MustParseAddr("9.9.9.9"), path, limits, nil)
+	if err != nil || e.Position != 0 || len(e.Rejected) != 0 {
+		t.Errorf("missing IP: %+v, %v", e, err)
+	}
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// HeartbeatStall is the longest time without progress before the heartbeat stops, above the slowest single download test;
+// supervisors restart the program when the file is older
+const HeartbeatStall = 2 * time.Minute
+
+var (
+	heartbeatInterval = 10 * time.Second
+
+	// Heartbeat is a file rewritten while the scan makes progress, so supervisors can restart a wedged scanner by its age
+	Heartbeat string
+
+	// OnProgress is called with the items done and total of the running test as it moves forward, from several goroutines
+	OnProgress func(done, total int)
+
+	lastProgress atomic.Int64
+	// Items done and total of the running test
+	progressDone, progressTotal atomic.Int64
+)
+
+// Progress marks that the scan moved forward by n items of the running test
+func Progress(n int) {
+	done := progressDone.Add(int64(n))
+	lastProgress.Store(time.Now().UnixNano())
+	if OnProgress != nil {
+		OnProgress(int(done), int(progressTotal.Load()))
+	}
+}
+
+func progressStart(total int) {
+	progressDone.Store(0)
+	progressTotal.Store(int64(total))
+	lastProgress.Store(time.Now().UnixNano())
+	if OnProgress != nil {
+		OnProgress(0, total)
+	}
+}
+
+// Items done of a test with its own progress callback
+type progressCount struct {
+	done       atomic.Int64
+	total      int
+	onProgress func(done, total int)
+}
+
+func newProgressCount(total int, onProgress func(done, total int)) *progressCount {
+	c := &progressCount{total: total, onProgress: onProgress}
+	if onProgress != nil {
+		onProgress(0, total)
+	}
+	return c
+}
+
+func (c *progressCount) add(n int) {
+	done := c.done.Add(int64(n))
+	if c.onProgress != nil {
+		c.onProgress(int(done), c.total)
+	}
+}
+
+// ProgressPercent returns how far the running test is
+func ProgressPercent() float64 {
+	total := progressTotal.Load()
+	if total <= 0 {
+		return 0
+	}
+	return min(float64(progressDone.Load())*100/float64(total), 100)
+}
+
+// StartHeartbeat writes the current time to Heartbeat every heartbeatInterval until stopped, skipping beats after HeartbeatStall without progress
+func StartHeartbeat() (stop func()) {
+	if Heartbeat == "" {
+		return func() {}
+	}
+	lastProgress.Store(time.Now().UnixNano())
+	return StartBeating(Heartbeat, func() (string, bool) {
+		return fmt.Sprintf("%.0f%%", ProgressPercent()), time.Since(time.Unix(0, lastProgress.Load())) < HeartbeatStall
+	})
+}
+
+// StartBeating writes the current time and the status returned by alive to path at once and every heartbeatInterval
+// until stopped, skipping the beats for which alive returns false; for programs with their own notion of progress
+func StartBeating(path string, alive func() (status string, ok bool)) (stop func()) {
+	if path == "" {
+		return func() {}
+	}
+	beat := func() {
+		if status, ok := alive(); ok {
+			_ = os.WriteFile(path, fmt.Appendf(nil, "%s %s\n", time.Now().Format(time.RFC3339), status), 0o644)
+		}
+	}
+	beat()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				beat()
+			}
+		}
+	}()
+	return func() { close(done) }
+}
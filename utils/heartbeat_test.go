@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStartBeating(t *testing.T) {
+	defer func(interval time.Duration) { heartbeatInterval = interval }(heartbeatInterval)
+	heartbeatInterval = 10 * time.Millisecond
+	path := filepath.Join(t.TempDir(), "heartbeat")
+
+	var alive atomic.Bool
+	alive.Store(true)
+	stop := StartBeating(path, func() (string, bool) { return "waiting", alive.Load() })
+	defer stop()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal("no beat at the start:", err)
+	}
+	if fields := strings.Fields(string(data)); len(fields) != 2 || fields[1] != "waiting" {
+		t.Errorf("heartbeat = %q, want the time and the status", data)
+	}
+
+	// Keeps beating on its own, whether or not anything else happens
+	written := func() time.Time {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.ModTime()
+	}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if !written().After(old) {
+		t.Error("the heartbeat wasn't rewritten")
+	}
+
+	// and skips the beats while not alive
+	alive.Store(false)
+	time.Sleep(20 * time.Millisecond)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if !written().Equal(old) {
+		t.Error("the heartbeat was rewritten while not alive")
+	}
+}
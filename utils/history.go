@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq" // Postgres history
+)
+
+// Longest wait of a scanner for another one writing the SQLite history
+const sqliteBusyTimeout = 30 * time.Second
+
+// HistoryBackend keeps the reputation history between runs, scanners of many sites may share one
+type HistoryBackend interface {
+	// Load returns every entry
+	Load() ([]*IPReputation, error)
+	// Update passes every entry to fold and writes the entries it returns, deleting the dropped IPs. Databases do it in one
+	// transaction holding off the other writers, so scanners sharing the history don't lose each other's updates.
+	Update(fold func(current []*IPReputation) (entries []*IPReputation, dropped []string)) error
+	Close() error
+}
+
+// OpenHistory opens the history named by target: a postgres:// URL, a path ending in .json for a JSON file, and an SQLite
+// database otherwise (sqlite:path forces it); builds without SQLite keep any other path as a JSON file
+func OpenHistory(target string) (HistoryBackend, error) {
+	switch {
+	case strings.HasPrefix(target, "postgres://") || strings.HasPrefix(target, "postgresql://"):
+		return openSQLHistory("postgres", target)
+	case strings.HasPrefix(target, "sqlite:"):
+		if !hasSQLite {
+			return nil, errors.New("this build has no SQLite, use a JSON file or Postgres for the history")
+		}
+		return openSQLite(strings.TrimPrefix(target, "sqlite:"))
+	case !hasSQLite || strings.EqualFold(filepath.Ext(target), ".json") || isJSONFile(target):
+		return fileHistory(target), nil
+	}
+	return openSQLite(target)
+}
+
+// Reports whether path holds a JSON history, as made of any path before SQLite was the default
+func isJSONFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 1)
+	_, err = io.ReadFull(f, head)
+	return err == nil && (head[0] == '[' || head[0] == 'n') // A list or null
+}
+
+// JSON file of the history, a missing file is an empty history
+type fileHistory string
+
+func (f fileHistory) Load() ([]*IPReputation, error) {
+	var list []*IPReputation
+	err := loadJSON(string(f), &list)
+	return list, err
+}
+
+// Update of a JSON file, which only one scanner at a time should write
+func (f fileHistory) Update(fold func(current []*IPReputation) ([]*IPReputation, []string)) error {
+	current, err := f.Load()
+	if err != nil {
+		return err
+	}
+	entries, _ := fold(current)
+	return saveJSON(string(f), entries)
+}
+
+func (f fileHistory) Close() error {
+	return nil
+}
+
+// History in an SQL database, one row per IP with the update time in Unix milliseconds
+type sqlHistory struct {
+	db       *sql.DB
+	postgres bool // Numbered placeholders instead of ?
+}
+
+// SQLite database at path, whose transactions take the write lock as they begin, waiting for other writers
+func openSQLite(path string) (*sqlHistory, error) {
+	dsn := "file:" + path + "?_txlock=immediate&_pragma=busy_timeout(" + strconv.FormatInt(sqliteBusyTimeout.Milliseconds(), 10) + ")"
+	return openSQLHistory("sqlite", dsn)
+}
+
+func openSQLHistory(driver, dsn string) (*sqlHistory, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	h := &sqlHistory{db: db, postgres: driver == "postgres"}
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS reputation (
+		ip TEXT PRIMARY KEY,
+		score DOUBLE PRECISION NOT NULL,
+		weight DOUBLE PRECISION NOT NULL,
+		tests INTEGER NOT NULL,
+		updated BIGINT NOT NULL
+	)`); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("%s history: %v", driver, err)
+	}
+	return h, nil
+}
+
+// Rewrites the ? placeholders of query for the database
+func (h *sqlHistory) query(query string) string {
+	if !h.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (h *sqlHistory) Load() ([]*IPReputation, error) {
+	return h.load(h.db)
+}
+
+// Rows of the history read through q, the database or a transaction
+func (h *sqlHistory) load(q interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}) ([]*IPReputation, error) {
+	rows, err := q.Query("SELECT ip, score, weight, tests, updated FROM reputation")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []*IPReputation
+	for rows.Next() {
+		r := &IPReputation{}
+		var updated int64
+		if err := rows.Scan(&r.IP, &r.Score, &r.Weight, &r.Tests, &updated); err != nil {
+			return nil, err
+		}
+		r.Updated = time.UnixMilli(updated)
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+func (h *sqlHistory) Update(fold func(current []*IPReputation) ([]*IPReputation, []string)) error {
+	tx, err := h.db.Begin() // SQLite takes the write lock here, see openSQLite
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if h.postgres {
+		// Other writers wait until the commit, readers don't
+		if _, err := tx.Exec("LOCK TABLE reputation IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+			return err
+		}
+	}
+	current, err := h.load(tx)
+	if err != nil {
+		return err
+	}
+	entries, dropped := fold(current)
+	upsert, err := tx.Prepare(h.query(`INSERT INTO reputation (ip, score, weight, tests, updated) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (ip) DO UPDATE SET score = excluded.score, weight = excluded.weight, tests = excluded.tests, updated = excluded.updated`))
+	if err != nil {
+		return err
+	}
+	defer upsert.Close()
+	for _, r := range entries {
+		if _, err := upsert.Exec(r.IP, r.Score, r.Weight, r.Tests, r.Updated.UnixMilli()); err != nil {
+			return err
+		}
+	}
+	for _, ip := range dropped {
+		if _, err := tx.Exec(h.query("DELETE FROM reputation WHERE ip = ?"), ip); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (h *sqlHistory) Close() error {
+	return h.db.Close()
+}
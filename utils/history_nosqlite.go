@@ -0,0 +1,6 @@
+//go:build js || mips64 || mips64le
+
+package utils
+
+// The SQLite driver doesn't build for WebAssembly and MIPS64, which keep the history in JSON files
+const hasSQLite = false
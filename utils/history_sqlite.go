@@ -0,0 +1,9 @@
+//go:build !js && !mips64 && !mips64le
+
+package utils
+
+// SQLite history, in pure Go so builds without cgo have it
+import _ "modernc.org/sqlite"
+
+// The build has the SQLite driver
+const hasSQLite = true
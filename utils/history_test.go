@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSharedHistory(t *testing.T) {
+	for _, name := range []string{"reputation.json", "reputation.db"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			// Two sites load the history before either saved
+			a, err := LoadReputation(path, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer a.Close()
+			b, err := LoadReputation(path, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			a.Observe("1.1.1.1", 1)
+			b.Observe("1.0.0.1", 0.5)
+			if err := a.Save(); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Save(); err != nil {
+				t.Fatal(err)
+			}
+
+			reloaded, err := LoadReputation(path, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reloaded.Close()
+			for ip, want := range map[string]float64{"1.1.1.1": 1, "1.0.0.1": 0.5} {
+				if got, ok := reloaded.Get(ip); !ok || got != want {
+					t.Errorf("reputation of %s = %v, %v, want %v", ip, got, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConcurrentSaves(t *testing.T) {
+	if !hasSQLite {
+		t.Skip("no SQLite in this build")
+	}
+	path := filepath.Join(t.TempDir(), "reputation.db")
+	const sites, saves = 4, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, sites)
+	for i := 0; i < sites; i++ {
+		s, err := LoadReputation(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < saves; j++ {
+				s.Observe("1.1.1.1", 1)
+				if err := s.Save(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	s, err := LoadReputation(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if top := s.Top(1); len(top) != 1 || top[0].Tests != sites*saves {
+		t.Errorf("history = %+v, want the %d tests of every site", top, sites*saves)
+	}
+}
+
+func TestOpenHistory(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "reputation")
+	if err := os.WriteFile(legacy, []byte("[]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{
+		filepath.Join(dir, "reputation.json"): "JSON",
+		filepath.Join(dir, "history"):         "SQLite",
+		filepath.Join(dir, "reputation.db"):   "SQLite",
+		legacy:                                "JSON",
+	} {
+		if !hasSQLite {
+			want = "JSON"
+		}
+		h, err := OpenHistory(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := "SQLite"
+		if _, ok := h.(fileHistory); ok {
+			got = "JSON"
+		}
+		if got != want {
+			t.Errorf("%s opened as %s, want %s", filepath.Base(path), got, want)
+		}
+		_ = h.Close()
+	}
+}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+const hookTimeout = time.Minute
+
+// Hook is a Starlark script qualifying the results: it defines hook(result), called with each result as a dict of its
+// JSON fields and returning "accept", "reject" or a score (higher is better)
+var Hook string
+
+// Result as seen by the hook
+type hookResult struct {
+	IP             string      `json:"ip"`
+	Sent           int         `json:"sent"`
+	Received       int         `json:"received"`
+	LossRate       float32     `json:"loss_rate"`
+	DelayMs        float64     `json:"delay_ms"`
+	DownloadSpeed  float64     `json:"download_speed"`         // Bytes per second
+	UploadSpeed    float64     `json:"upload_speed,omitempty"` // Bytes per second of [-upload]
+	Colo           string      `json:"colo,omitempty"`
+	PTR            string      `json:"ptr,omitempty"`
+	CFRay          string      `json:"cf_ray,omitempty"`
+	Source         string      `json:"source,omitempty"`
+	Middlebox      bool        `json:"middlebox,omitempty"`
+	Pinned         bool        `json:"pinned,omitempty"`
+	CacheStatus    string      `json:"cache_status,omitempty"`
+	JA3            string      `json:"ja3,omitempty"`
+	JA4            string      `json:"ja4,omitempty"`
+	ECH            string      `json:"ech,omitempty"`
+	Fingerprints   string      `json:"fingerprints,omitempty"`
+	Throttled      bool        `json:"throttled,omitempty"`
+	Resumption     string      `json:"resumption,omitempty"`
+	SizeSpeeds     []SizeSpeed `json:"size_speeds,omitempty"`
+	QUIC           string      `json:"quic,omitempty"`
+	QUICSpeed      float64     `json:"quic_speed,omitempty"` // Bytes per second of the HTTP/3 download
+	WaterfallMs    float64     `json:"waterfall_ms,omitempty"`
+	WaterfallProto string      `json:"waterfall_proto,omitempty"`
+	Error          string      `json:"error,omitempty"` // Class of the last failed probe
+}
+
+// FilterHook runs the results through the hook, dropping rejected ones unless pinned and ranking scored ones first
+func (s DownloadSpeedSet) FilterHook() (DownloadSpeedSet, error) {
+	if Hook == "" || len(s) == 0 {
+		return s, nil
+	}
+	thread := &starlark.Thread{
+		Name:  "hook",
+		Print: func(_ *starlark.Thread, msg string) { fmt.Fprintln(os.Stderr, msg) },
+	}
+	// A script looping forever is stopped rather than hanging the scan
+	timer := time.AfterFunc(hookTimeout, func() { thread.Cancel("hook timed out") })
+	defer timer.Stop()
+	globals, err := starlark.ExecFile(thread, Hook, nil, nil)
+	if err != nil {
+		return s, err
+	}
+	hook, ok := globals["hook"].(starlark.Callable)
+	if !ok {
+		return s, fmt.Errorf("%s defines no hook(result) function", Hook)
+	}
+
+	type scored struct {
+		data  CloudflareIPData
+		score float64
+	}
+	var accepted []scored
+	for i := range s {
+		result, err := hookValue(newHookResult(&s[i]))
+		if err != nil {
+			return s, err
+		}
+		answer, err := starlark.Call(thread, hook, starlark.Tuple{result}, nil)
+		if err != nil {
+			return s, err
+		}
+		switch answer {
+		case starlark.String("accept"):
+			accepted = append(accepted, scored{data: s[i]})
+		case starlark.String("reject"):
+			if s[i].Pinned {
+				accepted = append(accepted, scored{data: s[i]})
+			}
+		default:
+			score, ok := starlark.AsFloat(answer)
+			if !ok {
+				return s, fmt.Errorf("invalid hook answer %s, expected accept, reject or a score", answer)
+			}
+			s[i].HookScore = score
+			accepted = append(accepted, scored{data: s[i], score: score})
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].score > accepted[j].score })
+	data := make(DownloadSpeedSet, len(accepted))
+	for i := range accepted {
+		data[i] = accepted[i].data
+	}
+	return data, nil
+}
+
+// Result as the dict the hook gets, with the keys and values of its JSON
+func hookValue(r hookResult) (starlark.Value, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	var fields any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	return toStarlark(fields), nil
+}
+
+// Converts a decoded JSON value, numbers become floats
+func toStarlark(v any) starlark.Value {
+	switch v := v.(type) {
+	case bool:
+		return starlark.Bool(v)
+	case float64:
+		return starlark.Float(v)
+	case string:
+		return starlark.String(v)
+	case []any:
+		list := make([]starlark.Value, len(v))
+		for i := range v {
+			list[i] = toStarlark(v[i])
+		}
+		return starlark.NewList(list)
+	case map[string]any:
+		dict := starlark.NewDict(len(v))
+		for key, value := range v {
+			_ = dict.SetKey(starlark.String(key), toStarlark(value))
+		}
+		return dict
+	}
+	return starlark.None
+}
+
+func newHookResult(cf *CloudflareIPData) hookResult {
+	return hookResult{
+		IP:             cf.IP.String(),
+		Sent:           cf.Sended,
+		Received:       cf.Received,
+		LossRate:       cf.getLossRate(),
+		DelayMs:        cf.Delay.Seconds() * 1000,
+		DownloadSpeed:  cf.DownloadSpeed,
+		UploadSpeed:    cf.UploadSpeed,
+		Colo:           cf.Colo,
+		PTR:            cf.PTR,
+		CFRay:          cf.CFRay,
+		Source:         cf.Source,
+		Middlebox:      cf.Middlebox,
+		Pinned:         cf.Pinned,
+		CacheStatus:    cf.CacheStatus,
+		JA3:            cf.JA3,
+		JA4:            cf.JA4,
+		ECH:            cf.ECH,
+		Fingerprints:   cf.Fingerprints,
+		Throttled:      cf.Throttled,
+		Resumption:     cf.Resumption,
+		SizeSpeeds:     cf.SizeSpeeds,
+		QUIC:           cf.QUIC,
+		QUICSpeed:      cf.QUICSpeed,
+		WaterfallMs:    cf.Waterfall.Seconds() * 1000,
+		WaterfallProto: cf.WaterfallProto,
+		Error:          cf.Error,
+	}
+}
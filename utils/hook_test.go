@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Writes a hook script and sets Hook to it for the test
+func setHook(t *testing.T, script string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.star")
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	Hook = path
+	t.Cleanup(func() { Hook = "" })
+}
+
+func TestFilterHook(t *testing.T) {
+	setHook(t, `def hook(result):
+    if result["ip"] == "1.1.1.1":
+        return "reject"
+    if result["ip"] == "1.0.0.1" and result["sent"] == 4:
+        return 5
+    return "accept"
+`)
+	var data DownloadSpeedSet
+	for _, ip := range []string{"1.1.1.1", "1.1.1.2", "1.0.0.1"} {
+		data = append(data, CloudflareIPData{PingData: &PingData{IP: &net.IPAddr{IP: net.ParseIP(ip)}, Sended: 4, Received: 4}})
+	}
+	got, err := data.FilterHook()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].IP.String() != "1.0.0.1" || got[0].HookScore != 5 || got[1].IP.String() != "1.1.1.2" {
+		t.Errorf("unexpected results %v", got)
+	}
+
+	for script, want := range map[string]string{
+		"def hook(result):\n    return \"maybe\"\n": "maybe",
+		"x = 1\n": "no hook",
+		"def hook(result):\n    return result[\"missing\"]\n": "missing",
+		"def hook(result:\n": "got",
+	} {
+		setHook(t, script)
+		if _, err := data.FilterHook(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("hook %q: err = %v, want it to mention %q", script, err, want)
+		}
+	}
+}
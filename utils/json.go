@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSON writes the result file as JSON whatever its extension, set by [-json]
+var JSON bool
+
+// Result of a JSON result file, the fields of the hook and stream with the time of the scan
+type jsonResult struct {
+	hookResult
+	Time time.Time `json:"time"`
+}
+
+// Format of a result file by its extension: csv, json (an array of results) or jsonl (one result per line)
+func resultFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	case ".json":
+		return "json"
+	}
+	return "csv"
+}
+
+// ExportResults writes the results to Output as CSV, JSON or JSON lines by its extension and [-json]
+func ExportResults(data []CloudflareIPData) {
+	format := resultFormat(Output)
+	if format == "csv" && JSON {
+		format = "json"
+	}
+	if format == "csv" {
+		ExportCsv(data)
+		return
+	}
+	if noOutput() || len(data) == 0 {
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	results := make([]jsonResult, len(data))
+	for i := range data {
+		results[i] = jsonResult{hookResult: newHookResult(&data[i]), Time: now}
+	}
+	fp, err := os.Create(Output)
+	if err != nil {
+		log.Fatalf("Failed to create file [%s]: %v", Output, err)
+		return
+	}
+	defer fp.Close()
+	w := bufio.NewWriter(fp)
+	if format == "jsonl" {
+		enc := json.NewEncoder(w)
+		for _, r := range results {
+			_ = enc.Encode(r)
+		}
+	} else {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		_, _ = w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatalf("Failed to write file [%s]: %v", Output, err)
+	}
+}
+
+// IPs of a JSON or JSON lines result file, best first
+func readJSONResultIPs(path string) ([]netip.Addr, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var results []hookResult
+	if resultFormat(path) == "jsonl" {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for dec.More() {
+			var r hookResult
+			if err := dec.Decode(&r); err != nil {
+				return nil, fmt.Errorf("%s: result %d: %v", path, len(results)+1, err)
+			}
+			results = append(results, r)
+		}
+	} else if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	ips := make([]netip.Addr, len(results))
+	for i, r := range results {
+		if ips[i], err = netip.ParseAddr(r.IP); err != nil {
+			return nil, fmt.Errorf("%s: result %d: %v", path, i+1, err)
+		}
+		ips[i] = ips[i].Unmap()
+	}
+	return ips, nil
+}
+
+// Fields of the JSON results holding the built-in columns
+var jsonBuiltinKeys = []string{"ip", "sent", "received", "loss_rate", "delay_ms", "download_speed"}
+
+// Rows of JSON or JSON lines results in the shape of a CSV result file: the built-in columns in ms and MB/s, then the other
+// fields in the order of their keys, named by the key with dashes so that filters find them as in the CSV file
+func jsonRecords(name string, data []byte) ([][]string, error) {
+	var objects []map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if data[0] == '[' {
+		if err := dec.Decode(&objects); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	} else {
+		for dec.More() {
+			var object map[string]any
+			if err := dec.Decode(&object); err != nil {
+				return nil, fmt.Errorf("%s: result %d: %v", name, len(objects)+1, err)
+			}
+			objects = append(objects, object)
+		}
+	}
+	var extra []string
+	for _, object := range objects {
+		for key, value := range object {
+			if !slices.Contains(jsonBuiltinKeys, key) && !slices.Contains(extra, key) && jsonField(value) != "" {
+				extra = append(extra, key)
+			}
+		}
+	}
+	slices.Sort(extra)
+	header := []string{"IP Address", "Sent", "Received", "Loss Rate", "Average Delay (ms)", "Download Speed (MB/s)"}
+	for _, key := range extra {
+		header = append(header, strings.ReplaceAll(key, "_", "-"))
+	}
+	records := [][]string{header}
+	for i, object := range objects {
+		ip, ok := object["ip"].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: result %d: no ip", name, i+1)
+		}
+		number := func(key string) string {
+			if v, ok := object[key].(json.Number); ok {
+				return v.String()
+			}
+			return "0"
+		}
+		speed, _ := strconv.ParseFloat(number("download_speed"), 64)
+		row := []string{ip, number("sent"), number("received"), number("loss_rate"), number("delay_ms"),
+			strconv.FormatFloat(speed/speedUnits["MB/s"], 'f', -1, 64)}
+		for _, key := range extra {
+			row = append(row, jsonField(object[key]))
+		}
+		records = append(records, row)
+	}
+	return records, nil
+}
+
+// Text of a JSON value in a CSV cell, empty for nulls, arrays and objects
+func jsonField(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// Reads a JSON file into v, a missing file leaves v untouched
+func loadJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Writes v to a JSON file, replacing it atomically so an interrupted run keeps the old state
+func saveJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/mqtt"
+)
+
+const (
+	mqttStatusInterval = 10 * time.Second
+	mqttKeepAlive      = time.Minute
+)
+
+var (
+	// MQTT is a broker receiving the scan status and results, e.g. tcp://broker:1883
+	MQTT string
+	// MQTTTopic prefixes the topics published: <topic>/status, <topic>/best and <topic>/results
+	MQTTTopic = "cfscan"
+
+	mqttClient *mqtt.Client
+)
+
+// Retained on <topic>/status, "offline" is the will the broker publishes when the scanner dies
+type mqttStatus struct {
+	State    string    `json:"state"` // running, done or offline
+	Progress float64   `json:"progress"`
+	Time     time.Time `json:"time"`
+}
+
+// StartMQTT connects to the broker and publishes the status of the scan every mqttStatusInterval until stopped
+func StartMQTT() (stop func(), err error) {
+	if MQTT == "" {
+		return func() {}, nil
+	}
+	will, _ := json.Marshal(mqttStatus{State: "offline"})
+	id := make([]byte, 4)
+	_, _ = rand.Read(id)
+	client, err := mqtt.Dial(MQTT, mqtt.Options{
+		ClientID:  "cfscan-" + hex.EncodeToString(id),
+		KeepAlive: mqttKeepAlive,
+		Will:      &mqtt.Message{Topic: mqttTopic("status"), Payload: will, Retain: true},
+	})
+	if err != nil {
+		return func() {}, err
+	}
+	mqttClient = client
+	publishStatus(client, "running")
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(mqttStatusInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				publishStatus(client, "running")
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		publishStatus(client, "done")
+		_ = client.Close()
+		mqttClient = nil
+	}, nil
+}
+
+// PublishResults publishes the best result and the list of results, retained for subscribers coming later
+func PublishResults(data DownloadSpeedSet) {
+	if mqttClient == nil || len(data) == 0 {
+		return
+	}
+	results := make([]hookResult, len(data))
+	for i := range data {
+		results[i] = newHookResult(&data[i])
+	}
+	best, err := json.Marshal(results[0])
+	if err == nil {
+		err = mqttClient.Publish(mqtt.Message{Topic: mqttTopic("best"), Payload: best, Retain: true})
+	}
+	if list, jsonErr := json.Marshal(results); err == nil && jsonErr == nil {
+		err = mqttClient.Publish(mqtt.Message{Topic: mqttTopic("results"), Payload: list, Retain: true})
+	}
+	if err != nil {
+		fmt.Println("[!] Publishing the results over MQTT failed:", err)
+	}
+}
+
+func publishStatus(client *mqtt.Client, state string) {
+	status, _ := json.Marshal(mqttStatus{State: state, Progress: ProgressPercent(), Time: time.Now()})
+	_ = client.Publish(mqtt.Message{Topic: mqttTopic("status"), Payload: status, Retain: true})
+}
+
+// Topic under MQTTTopic, which may be given as a subscription filter such as cfscan/#
+func mqttTopic(name string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(MQTTTopic, "#"), "/") + "/" + name
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/Ptechgithub/CloudflareScanner/internal/mqtt"
+)
+
+func TestMQTT(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	topics := make(chan string, 8)
+	go func() {
+		defer close(topics)
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			kind, body, err := mqtt.ReadPacket(r)
+			if err != nil {
+				return
+			}
+			switch kind & 0xf0 {
+			case 0x10:
+				_, _ = conn.Write([]byte{0x20, 2, 0, 0})
+			case 0x30:
+				n := int(body[0])<<8 | int(body[1])
+				topics <- string(body[2:2+n]) + " " + string(bytes.SplitN(body[2+n:], []byte(","), 2)[0])
+			}
+		}
+	}()
+	MQTT, MQTTTopic = "tcp://"+l.Addr().String(), "home/cfscan/#"
+	t.Cleanup(func() { MQTT, MQTTTopic = "", "cfscan" })
+
+	stop, err := StartMQTT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	PublishResults(DownloadSpeedSet{{PingData: &PingData{IP: &net.IPAddr{IP: net.ParseIP("1.1.1.1")}, Sended: 4, Received: 4}}})
+	stop()
+	want := []string{
+		`home/cfscan/status {"state":"running"`,
+		`home/cfscan/best {"ip":"1.1.1.1"`,
+		`home/cfscan/results [{"ip":"1.1.1.1"`,
+		`home/cfscan/status {"state":"done"`,
+	}
+	for _, w := range want {
+		if got := <-topics; got != w {
+			t.Errorf("published %q, want %q", got, w)
+		}
+	}
+}
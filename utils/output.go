@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Log receives the messages of the tests, stdout unless a program embedding the scanner takes them.
+// Progress bars are only drawn while it is stdout.
+var Log io.Writer = os.Stdout
+
+// Printf prints a message of the tests to Log
+func Printf(format string, a ...any) {
+	fmt.Fprintf(Log, format, a...)
+}
+
+// Println prints a message of the tests to Log
+func Println(a ...any) {
+	fmt.Fprintln(Log, a...)
+}
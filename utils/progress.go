@@ -1,24 +1,51 @@
+//go:build !js
+
 package utils
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"time"
 
 	"github.com/cheggaaa/pb/v3"
 )
 
 type Bar struct {
-	pb *pb.ProgressBar
+	pb    *pb.ProgressBar
+	count *progressCount // nil reports to the package progress
 }
 
+// NewBar draws a progress bar of count items while Log is stdout, moving the heartbeat and OnProgress
 func NewBar(count int, MyStrStart, MyStrEnd string) *Bar {
+	b := &Bar{pb: startBar(Log, count, MyStrStart, MyStrEnd)}
+	progressStart(count)
+	return b
+}
+
+// NewBarTo draws a progress bar of count items while w is stdout, calling onProgress (when not nil) instead of moving the
+// package progress, for the scans of a Go program
+func NewBarTo(w io.Writer, onProgress func(done, total int), count int, MyStrStart, MyStrEnd string) *Bar {
+	return &Bar{pb: startBar(w, count, MyStrStart, MyStrEnd), count: newProgressCount(count, onProgress)}
+}
+
+func startBar(w io.Writer, count int, MyStrStart, MyStrEnd string) *pb.ProgressBar {
 	tmpl := fmt.Sprintf(`{{counters . }} {{ bar . "[" "-" (cycle . "↖" "↗" "↘" "↙" ) "_" "]"}} %s {{string . "MyStr" | green}} %s {{rtime . | blue}}`, MyStrStart, MyStrEnd)
-	bar := pb.ProgressBarTemplate(tmpl).Start(count)
-	return &Bar{pb: bar}
+	bar := pb.ProgressBarTemplate(tmpl).New(count)
+	if w != os.Stdout {
+		bar.SetWriter(io.Discard)
+	}
+	bar.Start()
+	return bar
 }
 
 func (b *Bar) Grow(num int, MyStrVal string) {
 	b.pb.Set("MyStr", MyStrVal).Add(num)
+	if b.count != nil {
+		b.count.add(num)
+		return
+	}
+	Progress(num)
 }
 
 func (b *Bar) Done() {
@@ -0,0 +1,30 @@
+//go:build js
+
+package utils
+
+import "io"
+
+// Bar only counts the progress in the browser, which has no terminal to draw it in
+type Bar struct {
+	count *progressCount // nil reports to the package progress
+}
+
+func NewBar(count int, MyStrStart, MyStrEnd string) *Bar {
+	progressStart(count)
+	return &Bar{}
+}
+
+// NewBarTo counts the progress of count items with onProgress (when not nil) instead of the package progress
+func NewBarTo(w io.Writer, onProgress func(done, total int), count int, MyStrStart, MyStrEnd string) *Bar {
+	return &Bar{count: newProgressCount(count, onProgress)}
+}
+
+func (b *Bar) Grow(num int, MyStrVal string) {
+	if b.count != nil {
+		b.count.add(num)
+		return
+	}
+	Progress(num)
+}
+
+func (b *Bar) Done() {}
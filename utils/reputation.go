@@ -0,0 +1,236 @@
+package utils
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultHalfLife = 7 * 24 * time.Hour
+
+var (
+	// Reputation is the store updated by the current scan, nil when disabled
+	Reputation         *ReputationStore
+	InputMinReputation float64
+
+	// HistoryKeep drops IPs not tested for this long when the store is saved, 0 keeps them forever
+	HistoryKeep time.Duration
+	// HistoryMaxRows keeps only the most recently tested IPs when the store is saved, 0 is unlimited
+	HistoryMaxRows int
+)
+
+// IPReputation is the decay-weighted success ratio of an IP across runs
+type IPReputation struct {
+	IP      string    `json:"ip"`
+	Score   float64   `json:"score"`  // Decayed sum of observations (0~1 each)
+	Weight  float64   `json:"weight"` // Decayed number of observations
+	Tests   int       `json:"tests"`
+	Updated time.Time `json:"updated"`
+}
+
+// Value returns the reputation in the range 0~1
+func (r *IPReputation) Value() float64 {
+	if r.Weight == 0 {
+		return 0
+	}
+	return r.Score / r.Weight
+}
+
+type ReputationStore struct {
+	m        sync.Mutex
+	path     string // Of the history, see OpenHistory
+	backend  HistoryBackend
+	halfLife time.Duration
+	entries  map[string]*IPReputation
+	pending  map[string]float64
+}
+
+// LoadReputation reads the store from the history at path (see OpenHistory), a missing file starts an empty store
+func LoadReputation(path string, halfLife time.Duration) (*ReputationStore, error) {
+	if halfLife <= 0 {
+		halfLife = defaultHalfLife
+	}
+	backend, err := OpenHistory(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &ReputationStore{
+		path:     path,
+		backend:  backend,
+		halfLife: halfLife,
+		entries:  make(map[string]*IPReputation),
+		pending:  make(map[string]float64),
+	}
+	if err := s.reload(); err != nil {
+		_ = backend.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Takes in the entries of the history, which other scanners sharing it may have changed
+func (s *ReputationStore) reload() error {
+	list, err := s.backend.Load()
+	if err != nil {
+		return err
+	}
+	for _, r := range list {
+		s.entries[r.IP] = r
+	}
+	return nil
+}
+
+// Close closes the history
+func (s *ReputationStore) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.backend.Close()
+}
+
+// Observe records how well an IP did in this run (0 failed ~ 1 perfect), the worst observation of a run counts
+func (s *ReputationStore) Observe(ip string, value float64) {
+	if s == nil {
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if old, ok := s.pending[ip]; ok && old < value {
+		return
+	}
+	s.pending[ip] = value
+}
+
+// Save folds this run's observations into the decayed history and writes the store, taking in the entries other
+// scanners sharing the history saved meanwhile
+func (s *ReputationStore) Save() error {
+	if s == nil {
+		return nil
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	now := time.Now()
+	saved := maps.Clone(s.entries) // Restored when the update fails, which leaves pending for the next Save
+	err := s.backend.Update(func(current []*IPReputation) ([]*IPReputation, []string) {
+		for _, r := range current {
+			s.entries[r.IP] = r
+		}
+		for ip, value := range s.pending {
+			r := &IPReputation{IP: ip}
+			if old, ok := s.entries[ip]; ok {
+				*r = *old
+			}
+			s.entries[ip] = r
+			decay := math.Pow(0.5, float64(now.Sub(r.Updated))/float64(s.halfLife))
+			r.Score = r.Score*decay + value
+			r.Weight = r.Weight*decay + 1
+			r.Tests++
+			r.Updated = now
+		}
+		dropped := s.compact(now)
+		return s.list(), dropped
+	})
+	if err != nil {
+		s.entries = saved
+		return err
+	}
+	s.pending = make(map[string]float64)
+	return nil
+}
+
+// Applies the retention settings, so a long-running scanner's store doesn't grow without bound; returns the dropped IPs
+func (s *ReputationStore) compact(now time.Time) (dropped []string) {
+	if HistoryKeep > 0 {
+		for ip, r := range s.entries {
+			if now.Sub(r.Updated) > HistoryKeep {
+				delete(s.entries, ip)
+				dropped = append(dropped, ip)
+			}
+		}
+	}
+	if HistoryMaxRows <= 0 || len(s.entries) <= HistoryMaxRows {
+		return
+	}
+	list := s.list()
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Updated.After(list[j].Updated) })
+	for _, r := range list[HistoryMaxRows:] {
+		delete(s.entries, r.IP)
+		dropped = append(dropped, r.IP)
+	}
+	return
+}
+
+// Get returns the reputation of an IP and whether it has any history
+func (s *ReputationStore) Get(ip string) (float64, bool) {
+	if s == nil {
+		return 0, false
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	r, ok := s.entries[ip]
+	if !ok {
+		return 0, false
+	}
+	return r.Value(), true
+}
+
+// Top returns up to n IPs with the best reputation, n <= 0 returns all
+func (s *ReputationStore) Top(n int) []*IPReputation {
+	s.m.Lock()
+	defer s.m.Unlock()
+	list := s.list()
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Value() != list[j].Value() {
+			return list[i].Value() > list[j].Value()
+		}
+		return list[i].Tests > list[j].Tests
+	})
+	if n > 0 && len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+func (s *ReputationStore) list() []*IPReputation {
+	list := make([]*IPReputation, 0, len(s.entries))
+	for _, r := range s.entries {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].IP < list[j].IP })
+	return list
+}
+
+// ParseAge reads a duration that may also be given in days, such as 30d or 12h
+func ParseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n * 24 * float64(time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// Reputation condition filtering, IPs without history and pinned IPs are kept
+func (s DownloadSpeedSet) FilterReputation() (data DownloadSpeedSet) {
+	if Reputation == nil || InputMinReputation <= 0 {
+		return s
+	}
+	for _, v := range s {
+		if value, ok := Reputation.Get(v.IP.String()); ok && value < InputMinReputation && !v.Pinned {
+			continue
+		}
+		data = append(data, v)
+	}
+	return
+}
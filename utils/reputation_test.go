@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{in: "30d", want: 30 * 24 * time.Hour},
+		{in: "0.5d", want: 12 * time.Hour},
+		{in: "90m", want: 90 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got, err := ParseAge(tt.in); err != nil || got != tt.want {
+			t.Errorf("ParseAge(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "d", "-1d", "30", "x"} {
+		if _, err := ParseAge(in); err == nil {
+			t.Errorf("ParseAge(%q) accepted", in)
+		}
+	}
+}
+
+func TestReputationRetention(t *testing.T) {
+	defer func(keep time.Duration, rows int) { HistoryKeep, HistoryMaxRows = keep, rows }(HistoryKeep, HistoryMaxRows)
+	HistoryKeep, HistoryMaxRows = 30*24*time.Hour, 2
+
+	s, err := LoadReputation(filepath.Join(t.TempDir(), "reputation.json"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for ip, age := range map[string]time.Duration{
+		"1.1.1.1": 40 * 24 * time.Hour, // Expired
+		"1.1.1.2": 3 * time.Hour,
+		"1.1.1.3": 2 * time.Hour,
+		"1.1.1.4": 10 * 24 * time.Hour, // Beyond the row limit
+	} {
+		s.entries[ip] = &IPReputation{IP: ip, Score: 1, Weight: 1, Updated: now.Add(-age)}
+	}
+	s.Observe("1.1.1.5", 1)
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadReputation(s.path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range []string{"1.1.1.5", "1.1.1.3"} {
+		if _, ok := reloaded.Get(ip); !ok {
+			t.Errorf("%s was dropped", ip)
+		}
+	}
+	if n := len(reloaded.entries); n != 2 {
+		t.Errorf("kept %d IPs, want 2", n)
+	}
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// RankLimits are what Rerank keeps the results of a result file by, zero values keep every result
+type RankLimits struct {
+	MaxDelay    time.Duration
+	MinDelay    time.Duration
+	MaxLossRate *float64 // 0~1 as [-tlr], 0 keeps only results without loss, nil keeps every loss rate
+	MinSpeed    float64  // Bytes per second
+	Filter      []Condition
+	ByDelay     bool // Rank by loss rate and delay, as without a download test, instead of download speed
+}
+
+// Rerank ranks the results of a result file read from r again under limits without testing them, and writes the kept rows
+// to w with every column, as CSV or as JSON objects keyed by column (format "json"). It returns the number of rows kept.
+func Rerank(r io.Reader, w io.Writer, format string, limits RankLimits) (int, error) {
+	records, err := readRecords("results", r)
+	if err != nil {
+		return 0, err
+	}
+	results, err := parseResults("results", records)
+	if err != nil {
+		return 0, err
+	}
+	header := records[0]
+	filter := make([]Condition, len(limits.Filter))
+	for i, c := range limits.Filter {
+		if c.index = builtinColumn(c.Key); c.index < 0 {
+			c.index = columnOf(header, c.Key)
+		}
+		if c.index < 0 {
+			return 0, fmt.Errorf("unknown column %q", c.Key)
+		}
+		filter[i] = c
+	}
+
+	var kept []int
+	for i, result := range results {
+		if limits.keeps(result, records[i+1], filter) {
+			kept = append(kept, i)
+		}
+	}
+	sort.SliceStable(kept, func(a, b int) bool {
+		x, y := results[kept[a]], results[kept[b]]
+		if !limits.ByDelay {
+			return x.Speed > y.Speed
+		}
+		if x.LossRate != y.LossRate {
+			return x.LossRate < y.LossRate
+		}
+		return x.Delay < y.Delay
+	})
+
+	if format == "json" {
+		keys := make([]string, len(header))
+		for i, name := range header {
+			if keys[i] = columnKey(name); i < len(builtinKeys) {
+				keys[i] = builtinKeys[i]
+			}
+		}
+		rows := make([]map[string]any, len(kept))
+		for j, i := range kept {
+			rows[j] = make(map[string]any, len(header))
+			for c, value := range records[i+1] {
+				if c >= len(keys) {
+					break
+				}
+				if n, err := strconv.ParseFloat(value, 64); err == nil && c > 0 {
+					rows[j][keys[c]] = n
+				} else {
+					rows[j][keys[c]] = value
+				}
+			}
+		}
+		return len(kept), json.NewEncoder(w).Encode(rows)
+	}
+	cw := csv.NewWriter(w)
+	_ = cw.Write(header)
+	for _, i := range kept {
+		_ = cw.Write(records[i+1])
+	}
+	cw.Flush()
+	return len(kept), cw.Error()
+}
+
+// Whether a result and its row pass the limits
+func (l RankLimits) keeps(r Result, row []string, filter []Condition) bool {
+	if l.MaxDelay > 0 && r.Delay > l.MaxDelay || r.Delay < l.MinDelay {
+		return false
+	}
+	if l.MaxLossRate != nil && r.LossRate > *l.MaxLossRate || r.Speed < l.MinSpeed {
+		return false
+	}
+	for _, c := range filter {
+		if c.index >= len(row) || !c.match(row) {
+			return false
+		}
+	}
+	return true
+}
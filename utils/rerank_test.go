@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const rerankResults = `IP Address,Sent,Received,Loss Rate,Average Delay,Download Speed (MB/s),Colo
+1.0.0.1,4,4,0.00,120.00,3.00,FRA
+1.0.0.2,4,4,0.00,90.00,8.00,AMS
+1.0.0.3,4,3,0.25,60.00,5.00,FRA
+`
+
+func TestRerank(t *testing.T) {
+	filter, _ := ParseFilter("colo=fra")
+	noLoss, someLoss := 0.0, 0.1
+	tests := []struct {
+		name   string
+		format string
+		limits RankLimits
+		want   string
+	}{
+		{"speed", "", RankLimits{}, "1.0.0.2 1.0.0.3 1.0.0.1"},
+		{"delay", "", RankLimits{ByDelay: true}, "1.0.0.2 1.0.0.1 1.0.0.3"},
+		{"limits", "", RankLimits{MaxDelay: 100 * time.Millisecond, MaxLossRate: &someLoss}, "1.0.0.2"},
+		{"no loss", "", RankLimits{MaxLossRate: &noLoss}, "1.0.0.2 1.0.0.1"},
+		{"min speed", "", RankLimits{MinSpeed: 4 << 20}, "1.0.0.2 1.0.0.3"},
+		{"filter", "", RankLimits{Filter: filter}, "1.0.0.3 1.0.0.1"},
+	}
+	for _, tc := range tests {
+		var out bytes.Buffer
+		n, err := Rerank(strings.NewReader(rerankResults), &out, tc.format, tc.limits)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		var ips []string
+		for _, line := range lines[1:] {
+			ips = append(ips, strings.Split(line, ",")[0])
+		}
+		if got := strings.Join(ips, " "); got != tc.want || n != len(ips) || !strings.HasPrefix(lines[0], "IP Address,") {
+			t.Errorf("%s: got %d rows %q, want %q", tc.name, n, got, tc.want)
+		}
+	}
+
+	var out bytes.Buffer
+	if _, err := Rerank(strings.NewReader(rerankResults), &out, "json", RankLimits{MinSpeed: 6 << 20}); err != nil {
+		t.Fatal(err)
+	}
+	if want := `[{"colo":"AMS","delay":90,"ip":"1.0.0.2","loss":0,"received":4,"sent":4,"speed":8}]`; strings.TrimSpace(out.String()) != want {
+		t.Errorf("json = %s, want %s", out.String(), want)
+	}
+
+	// JSON lines results, as written by -o result.jsonl
+	jsonl := `{"ip":"1.0.0.1","sent":4,"received":4,"loss_rate":0,"delay_ms":120,"download_speed":3145728,"colo":"FRA"}
+{"ip":"1.0.0.3","sent":4,"received":3,"loss_rate":0.25,"delay_ms":60,"download_speed":5242880,"colo":"FRA"}
+`
+	out.Reset()
+	if _, err := Rerank(strings.NewReader(jsonl), &out, "", RankLimits{Filter: filter}); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[1], "1.0.0.3,") {
+		t.Errorf("rerank of JSON lines = %q, want 1.0.0.3 first", out.String())
+	}
+
+	unknown, _ := ParseFilter("asn=13335")
+	if _, err := Rerank(strings.NewReader(rerankResults), &out, "", RankLimits{Filter: unknown}); err == nil {
+		t.Error("unknown column: want an error")
+	}
+}
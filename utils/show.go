@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Console output selection, the result file always gets every result and column
+var (
+	showFrom    int   // Index of the first printed result
+	showColumns []int // Printed columns, nil prints the default columns
+	showFilter  []Condition
+)
+
+var (
+	builtinKeys = []string{"ip", "sent", "received", "loss", "delay", "speed"}
+	// Comparison operators, longest first so that >= is not read as >
+	filterOps = []string{">=", "<=", "!=", ">", "<", "="}
+)
+
+// Condition compares a result column with a value, e.g. speed>5
+type Condition struct {
+	Key   string
+	Op    string
+	Value string
+	index int
+}
+
+func (c Condition) String() string {
+	return c.Key + c.Op + c.Value
+}
+
+// ParseFilter parses comma separated conditions that all have to match, e.g. "speed>5,delay<=200,colo=FRA"
+func ParseFilter(s string) ([]Condition, error) {
+	var conditions []Condition
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		c, err := parseCondition(part)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions, nil
+}
+
+func parseCondition(s string) (Condition, error) {
+	i := strings.IndexAny(s, "<>=!")
+	if i <= 0 {
+		return Condition{}, fmt.Errorf("invalid condition %q, expected column, operator and value, e.g. speed>5", s)
+	}
+	for _, op := range filterOps {
+		if !strings.HasPrefix(s[i:], op) {
+			continue
+		}
+		c := Condition{
+			Key:   strings.ToLower(strings.TrimSpace(s[:i])),
+			Op:    op,
+			Value: strings.TrimSpace(s[i+len(op):]),
+		}
+		if c.Value == "" || strings.ContainsAny(c.Value, "<>=!") {
+			return Condition{}, fmt.Errorf("invalid value in condition %q", s)
+		}
+		if _, err := strconv.ParseFloat(c.Value, 64); err != nil && op != "=" && op != "!=" {
+			return Condition{}, fmt.Errorf("operator %s in condition %q needs a number", op, s)
+		}
+		return c, nil
+	}
+	return Condition{}, fmt.Errorf("invalid operator in condition %q", s)
+}
+
+// Numbers are compared numerically, anything else case-insensitively
+func (c Condition) match(row []string) bool {
+	value := row[c.index]
+	x, errX := strconv.ParseFloat(value, 64)
+	y, errY := strconv.ParseFloat(c.Value, 64)
+	numeric := errX == nil && errY == nil
+	switch c.Op {
+	case "=":
+		return numeric && x == y || !numeric && strings.EqualFold(value, c.Value)
+	case "!=":
+		return numeric && x != y || !numeric && !strings.EqualFold(value, c.Value)
+	}
+	if !numeric {
+		return false
+	}
+	switch c.Op {
+	case ">":
+		return x > y
+	case ">=":
+		return x >= y
+	case "<":
+		return x < y
+	case "<=":
+		return x <= y
+	}
+	return false
+}
+
+// Key of a result column, optional columns drop their unit, e.g. "Keep-Alive Latency (ms)" is keep-alive-latency
+func columnKey(name string) string {
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		name = name[:i]
+	}
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "-")
+}
+
+func columnIndex(key string) (int, error) {
+	keys := append([]string{}, builtinKeys...)
+	for _, c := range extraColumns {
+		keys = append(keys, columnKey(c.Name))
+	}
+	for i, k := range keys {
+		if k == key {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown column %q (available: %s)", key, strings.Join(keys, ","))
+}
+
+// SetShow configures the console output, show is a count (20) or a range of results (21-40),
+// columns and filter refer to columns by key, call it once all optional columns are added
+func SetShow(show, columns, filter string) error {
+	from, to := 0, PrintNum
+	if show != "" {
+		var err error
+		if from, to, err = parseShowRange(show); err != nil {
+			return err
+		}
+	}
+	var selected []int
+	if columns != "" {
+		for _, key := range strings.Split(columns, ",") {
+			i, err := columnIndex(strings.ToLower(strings.TrimSpace(key)))
+			if err != nil {
+				return err
+			}
+			selected = append(selected, i)
+		}
+	}
+	conditions, err := ParseFilter(filter)
+	if err != nil {
+		return err
+	}
+	for i := range conditions {
+		if conditions[i].index, err = columnIndex(conditions[i].Key); err != nil {
+			return err
+		}
+	}
+	showFrom, PrintNum = from, to
+	showColumns, showFilter = selected, conditions
+	return nil
+}
+
+// Returns the 0-based start and exclusive end of a count or 1-based range
+func parseShowRange(show string) (from, to int, err error) {
+	first, last, isRange := strings.Cut(show, "-")
+	if !isRange {
+		to, err = strconv.Atoi(show)
+		if err != nil || to < 0 {
+			return 0, 0, fmt.Errorf("invalid result count %q", show)
+		}
+		return 0, to, nil
+	}
+	from, errFrom := strconv.Atoi(first)
+	to, errTo := strconv.Atoi(last)
+	if errFrom != nil || errTo != nil || from < 1 || to < from {
+		return 0, 0, fmt.Errorf("invalid result range %q, e.g. 21-40", show)
+	}
+	return from - 1, to, nil
+}
+
+func filterRows(rows [][]string) [][]string {
+	if len(showFilter) == 0 {
+		return rows
+	}
+	matched := rows[:0]
+next:
+	for _, row := range rows {
+		for _, c := range showFilter {
+			if !c.match(row) {
+				continue next
+			}
+		}
+		matched = append(matched, row)
+	}
+	return matched
+}
@@ -0,0 +1,73 @@
+package utils
+
+import "testing"
+
+func TestFilterRows(t *testing.T) {
+	rows := [][]string{
+		{"1.1.1.1", "4", "4", "0.00", "120.50", "6.20", "FRA"},
+		{"1.0.0.1", "4", "3", "0.25", "80.00", "2.10", "AMS"},
+		{"1.1.1.2", "4", "4", "0.00", "250.00", "9.00", "fra"},
+	}
+	extraColumns = []Column{{Name: "Colo"}}
+	t.Cleanup(func() { extraColumns, showFilter = nil, nil })
+
+	tests := []struct {
+		filter string
+		want   int
+	}{
+		{filter: "", want: 3},
+		{filter: "speed>5", want: 2},
+		{filter: "speed>5,delay<200", want: 1},
+		{filter: "loss=0", want: 2},
+		{filter: "colo=FRA", want: 2},
+		{filter: "colo!=fra", want: 1},
+		{filter: "received>=4, speed <= 6.2", want: 1},
+	}
+	for _, tt := range tests {
+		if err := SetShow("", "", tt.filter); err != nil {
+			t.Fatalf("SetShow(%q): %v", tt.filter, err)
+		}
+		in := append([][]string{}, rows...)
+		if got := len(filterRows(in)); got != tt.want {
+			t.Errorf("filter %q matched %d rows, want %d", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestSetShowErrors(t *testing.T) {
+	t.Cleanup(func() { showFrom, showColumns, showFilter, PrintNum = 0, nil, nil, 10 })
+	for _, args := range [][3]string{
+		{"x", "", ""},
+		{"40-21", "", ""},
+		{"", "ip,nope", ""},
+		{"", "", "speed>fast"},
+		{"", "", "nope>1"},
+		{"", "", "speed"},
+	} {
+		if err := SetShow(args[0], args[1], args[2]); err == nil {
+			t.Errorf("SetShow(%q, %q, %q) accepted", args[0], args[1], args[2])
+		}
+	}
+	if err := SetShow("21-40", "ip,speed", ""); err != nil || showFrom != 20 || PrintNum != 40 || len(showColumns) != 2 {
+		t.Errorf("SetShow range: err %v, from %d, to %d, columns %v", err, showFrom, PrintNum, showColumns)
+	}
+}
+
+func FuzzParseFilter(f *testing.F) {
+	for _, seed := range []string{"speed>5", "delay<=200,colo=FRA", "loss!=0.5", " a = b ,", ">=1", "x<"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		conditions, err := ParseFilter(s)
+		if err != nil {
+			return
+		}
+		// Accepted filters survive a round trip through their string form
+		for _, c := range conditions {
+			again, err := ParseFilter(c.String())
+			if err != nil || len(again) != 1 || again[0] != c {
+				t.Fatalf("condition %q parsed from %q does not round trip: %v %v", c, s, again, err)
+			}
+		}
+	})
+}
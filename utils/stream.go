@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+const streamSocketPrefix = "unix://"
+
+var (
+	// Stream receives one JSON result per line as soon as an IP qualifies, before the scan concludes:
+	// a file, a named pipe or a unix socket such as unix:///run/cfscan.sock
+	Stream string
+
+	streamM      sync.Mutex
+	streamOut    io.WriteCloser
+	streamOpened bool // The file was truncated already, reopening appends
+)
+
+// StreamResult writes a qualified result to Stream, failures only lose the early copy of the result
+func StreamResult(cf *CloudflareIPData) {
+	if Stream == "" {
+		return
+	}
+	line, err := json.Marshal(newHookResult(cf))
+	if err != nil {
+		return
+	}
+	streamM.Lock()
+	defer streamM.Unlock()
+	if streamOut == nil {
+		// A pipe without a reader or a socket without a listener is retried with the next result
+		if streamOut, err = openStream(); err != nil {
+			streamOut = nil
+			return
+		}
+		streamOpened = true
+	}
+	// A single write per line, so readers never see half a result
+	if _, err := streamOut.Write(append(line, '\n')); err != nil {
+		_ = streamOut.Close()
+		streamOut = nil
+	}
+}
+
+func openStream() (io.WriteCloser, error) {
+	if path, ok := strings.CutPrefix(Stream, streamSocketPrefix); ok {
+		return net.Dial("unix", path)
+	}
+	if info, err := os.Stat(Stream); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		return os.OpenFile(Stream, fifoFlags, 0)
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if streamOpened {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	return os.OpenFile(Stream, flags, 0o644)
+}
+
+// IsStreamTarget reports whether an output names a unix socket rather than a file
+func IsStreamTarget(output string) bool {
+	return strings.HasPrefix(output, streamSocketPrefix)
+}
+
+// CloseStream closes the stream at the end of the scan
+func CloseStream() {
+	streamM.Lock()
+	defer streamM.Unlock()
+	if streamOut != nil {
+		_ = streamOut.Close()
+		streamOut = nil
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package utils
+
+import "os"
+
+const fifoFlags = os.O_WRONLY
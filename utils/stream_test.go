@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestStreamSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cfscan.sock")
+	Stream = streamSocketPrefix + path
+	t.Cleanup(func() { CloseStream(); Stream = "" })
+	cf := &CloudflareIPData{PingData: &PingData{IP: &net.IPAddr{IP: net.ParseIP("1.1.1.1")}, Sended: 4, Received: 4}}
+
+	// Without a listener the result is dropped
+	StreamResult(cf)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip("no unix sockets:", err)
+	}
+	defer l.Close()
+	StreamResult(cf)
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var got hookResult
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil || json.Unmarshal(line, &got) != nil || got.IP != "1.1.1.1" {
+		t.Errorf("streamed %q, %v", line, err)
+	}
+}
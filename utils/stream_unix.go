@@ -0,0 +1,11 @@
+//go:build unix
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// Opening a named pipe without a reader fails instead of blocking the scan
+const fifoFlags = os.O_WRONLY | syscall.O_NONBLOCK
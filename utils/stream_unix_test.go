@@ -0,0 +1,37 @@
+//go:build unix
+
+package utils
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestStreamFIFO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cfscan.fifo")
+	if err := syscall.Mkfifo(path, 0o600); err != nil {
+		t.Skip("no named pipes:", err)
+	}
+	Stream = path
+	t.Cleanup(func() { CloseStream(); Stream = "" })
+	cf := &CloudflareIPData{PingData: &PingData{IP: &net.IPAddr{IP: net.ParseIP("1.1.1.1")}, Sended: 4, Received: 4}}
+
+	// Without a reader the scan goes on and the result is dropped
+	StreamResult(cf)
+	reader, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	cf.IP.IP = net.ParseIP("1.0.0.1")
+	StreamResult(cf)
+	line, err := bufio.NewReader(reader).ReadString('\n')
+	if err != nil || !strings.Contains(line, `"ip":"1.0.0.1"`) {
+		t.Errorf("read %q, %v", line, err)
+	}
+}
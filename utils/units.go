@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// SpeedUnit is the unit download speeds are written in: MB/s, KB/s or Mbps
+	SpeedUnit = "MB/s"
+	// DelayUnit is the unit delays are written in: ms, us or ns (whole nanoseconds)
+	DelayUnit = "ms"
+	// Precision is the number of decimals of speeds and delays
+	Precision = 2
+)
+
+// Bytes per second of each speed unit
+var speedUnits = map[string]float64{
+	"MB/s": 1024 * 1024,
+	"KB/s": 1024,
+	"Mbps": 1e6 / 8,
+}
+
+// Duration of each delay unit
+var delayUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+// SetUnits validates and sets the units and precision of speeds and delays, units are case-insensitive
+func SetUnits(speedUnit, delayUnit string, precision int) error {
+	speed, ok := findUnit(speedUnit, speedUnits)
+	if !ok {
+		return fmt.Errorf("unknown speed unit %q (available: MB/s, KB/s, Mbps)", speedUnit)
+	}
+	delay, ok := findUnit(delayUnit, delayUnits)
+	if !ok {
+		return fmt.Errorf("unknown delay unit %q (available: ms, us, ns)", delayUnit)
+	}
+	if precision < 0 || precision > 9 {
+		return fmt.Errorf("precision must be between 0 and 9")
+	}
+	SpeedUnit, DelayUnit, Precision = speed, delay, precision
+	return nil
+}
+
+// Bytes of each size unit, a size without one is in MB
+var sizeUnits = map[string]int64{
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+}
+
+// ParseSize parses a data size such as 500MB, 1.5GB or 500 (MB)
+func ParseSize(s string) (int64, error) {
+	number, unit := s, int64(1<<20)
+	for name, bytes := range sizeUnits {
+		if n, ok := strings.CutSuffix(strings.ToUpper(s), name); ok {
+			number, unit = n, bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// FormatSize writes a data size in the largest unit it is a whole number of, such as 10MB or 512KB
+func FormatSize(bytes int64) string {
+	for _, unit := range []string{"GB", "MB", "KB"} {
+		if bytes >= sizeUnits[unit] && bytes%sizeUnits[unit] == 0 {
+			return strconv.FormatInt(bytes/sizeUnits[unit], 10) + unit
+		}
+	}
+	return strconv.FormatInt(bytes, 10) + "B"
+}
+
+func findUnit[T any](name string, units map[string]T) (string, bool) {
+	for unit := range units {
+		if strings.EqualFold(unit, name) {
+			return unit, true
+		}
+	}
+	return "", false
+}
+
+func formatSpeed(bytesPerSecond float64) string {
+	return strconv.FormatFloat(bytesPerSecond/speedUnits[SpeedUnit], 'f', Precision, 64)
+}
+
+func formatDelay(d time.Duration) string {
+	if DelayUnit == "ns" {
+		return strconv.FormatInt(int64(d), 10)
+	}
+	return strconv.FormatFloat(float64(d)/float64(delayUnits[DelayUnit]), 'f', Precision, 64)
+}
+
+// Speed and delay column names with their units
+func speedHeader(sep string) string {
+	return "Download" + sep + "Speed (" + SpeedUnit + ")"
+}
+
+func delayHeader(sep string) string {
+	if DelayUnit == "ms" {
+		return "Average" + sep + "Delay" // Unit-less since the first versions
+	}
+	return "Average" + sep + "Delay (" + DelayUnit + ")"
+}
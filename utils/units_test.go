@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUnits(t *testing.T) {
+	t.Cleanup(func() { _ = SetUnits("MB/s", "ms", 2) })
+	tests := []struct {
+		speedUnit, delayUnit string
+		precision            int
+		speed, delay         string
+	}{
+		{speedUnit: "MB/s", delayUnit: "ms", precision: 2, speed: "10.00", delay: "123.46"},
+		{speedUnit: "mbps", delayUnit: "us", precision: 1, speed: "83.9", delay: "123456.8"},
+		{speedUnit: "KB/s", delayUnit: "ns", precision: 0, speed: "10240", delay: "123456789"},
+	}
+	for _, tt := range tests {
+		if err := SetUnits(tt.speedUnit, tt.delayUnit, tt.precision); err != nil {
+			t.Fatal(err)
+		}
+		if got := formatSpeed(10 * 1024 * 1024); got != tt.speed {
+			t.Errorf("%s speed = %s, want %s", tt.speedUnit, got, tt.speed)
+		}
+		if got := formatDelay(123456789 * time.Nanosecond); got != tt.delay {
+			t.Errorf("%s delay = %s, want %s", tt.delayUnit, got, tt.delay)
+		}
+	}
+	if err := SetUnits("GB/s", "ms", 2); err == nil {
+		t.Error("unknown speed unit accepted")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{"500": 500 << 20, "500MB": 500 << 20, "1.5gb": 3 << 29, "200KB": 200 << 10}
+	for in, want := range tests {
+		if got, err := ParseSize(in); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	if _, err := ParseSize("-1MB"); err == nil {
+		t.Error("negative size accepted")
+	}
+}
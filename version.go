@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/task"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+const (
+	contentsAPI     = "https://api.github.com/repos/Ptechgithub/CloudflareScanner/contents/task/"
+	ipListCacheKind = "iplist"
+	ipListCacheTTL  = 6 * time.Hour
+)
+
+// Link to a newer IP list than the one in use, set by checkIPListUpdate
+var ipListNew string
+
+func versionCommand(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	check := fs.Bool("check-update", false, "Check for a newer version and IP list")
+	ipFile := fs.String("f", "ip.txt", "IP range data file compared with the latest IP list")
+	_ = fs.Parse(args)
+
+	fmt.Print(buildInfo())
+	if !*check {
+		return nil
+	}
+	fmt.Println("Checking for updates...")
+	task.IPFile = *ipFile
+	if err := checkUpdate(); err != nil {
+		return fmt.Errorf("checking for updates failed: %v", err)
+	}
+	if err := checkIPListUpdate(); err != nil {
+		return fmt.Errorf("checking the IP list failed: %v", err)
+	}
+	if versionNew == "" && ipListNew == "" {
+		fmt.Println("Current version and IP list are the latest!")
+	}
+	printUpdates()
+	return nil
+}
+
+// Version, toolchain and the VCS state the binary was built from
+func buildInfo() string {
+	s := fmt.Sprintf("CloudflareScanner %s\n", currentVersion())
+	s += fmt.Sprintf("  go:       %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return s
+	}
+	settings := make(map[string]string)
+	for _, setting := range info.Settings {
+		settings[setting.Key] = setting.Value
+	}
+	if revision := settings["vcs.revision"]; revision != "" {
+		if settings["vcs.modified"] == "true" {
+			revision += " (modified)"
+		}
+		s += fmt.Sprintf("  commit:   %s\n", revision)
+	}
+	if built := settings["vcs.time"]; built != "" {
+		s += fmt.Sprintf("  built:    %s\n", built)
+	}
+	return s
+}
+
+// Version set at build time, falling back to the module version for go install builds
+func currentVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// Checks the version and the IP list in the background, the returned channel is closed when done
+func startUpdateCheck() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = checkUpdate()
+		_ = checkIPListUpdate()
+	}()
+	return done
+}
+
+func printUpdates() {
+	if versionNew != "" {
+		fmt.Printf("\n*** Found New Version [%s]! Please go to [https://github.com/Ptechgithub/CloudflareScanner] to update! ***\n", versionNew)
+	}
+	if ipListNew != "" {
+		fmt.Printf("\n*** Found newer IP list for [%s]! Download it from [%s] ***\n", task.IPFile, ipListNew)
+	}
+}
+
+// Compares the IP list in use (ip.txt or ipv6.txt, on disk or built in) with the latest one in the repository
+func checkIPListUpdate() error {
+	if task.IPText != "" {
+		return nil
+	}
+	local, embedded, err := task.ReadIPList()
+	if err != nil {
+		return nil
+	}
+	name := filepath.Base(task.IPFile)
+	if embedded && task.UseEmbedded {
+		if _, ok := task.EmbeddedLists[name]; !ok {
+			name = "ip.txt"
+		}
+	}
+	if name != "ip.txt" && name != "ipv6.txt" {
+		return nil // Custom lists have no upstream version
+	}
+	var content struct {
+		SHA     string `json:"sha"`
+		HTMLURL string `json:"html_url"`
+	}
+	if !utils.Cache.Get(ipListCacheKind, name, &content) {
+		client := http.Client{Timeout: 10 * time.Second}
+		res, err := client.Get(contentsAPI + name)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if err := json.NewDecoder(res.Body).Decode(&content); err != nil {
+			return err
+		}
+		if content.SHA == "" {
+			return fmt.Errorf("unexpected response: %s", res.Status)
+		}
+		utils.Cache.Put(ipListCacheKind, name, content, ipListCacheTTL)
+	}
+	if content.SHA != gitBlobSHA(local) {
+		ipListNew = content.HTMLURL
+	}
+	return nil
+}
+
+// Git object id of a file, as reported by the GitHub contents API
+func gitBlobSHA(data []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,124 @@
+//go:build js && wasm
+
+// Command wasm gives web dashboards the candidate generation and the result parsing, ranking and export of the scanner,
+// to re-rank and re-export collected results in the browser; the probes need raw sockets and aren't part of it.
+//
+//	GOOS=js GOARCH=wasm go build -o cfscan.wasm ./wasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+//
+// Once run, it sets the global cfscan object:
+//
+//	cfscan.candidates("1.1.1.0/24,2606:4700::/48")  // IPs a scan tests, in order: ["1.1.1.7", "2606:4700::1a2b", ...]
+//	cfscan.parse(csv)                                 // [{ip, lossRate, delay, speed}], delay in ms and speed in MB/s
+//	cfscan.rerank(csv, {maxDelay: 200, minDelay: 0, maxLossRate: 0.2, minSpeed: 5, filter: "colo=FRA", byDelay: false, format: "json"})
+//
+// rerank returns the kept rows as CSV, or as JSON text with format "json". Its limits are the scan options: maxLossRate is
+// [-tlr], so 0 keeps only results without loss and leaving it out keeps every loss rate. Failures return an Error instead
+// of the value.
+package main
+
+import (
+	"bytes"
+	"strings"
+	"syscall/js"
+	"time"
+
+	"github.com/Ptechgithub/CloudflareScanner/task"
+	"github.com/Ptechgithub/CloudflareScanner/utils"
+)
+
+func main() {
+	js.Global().Set("cfscan", js.ValueOf(map[string]any{
+		"candidates": js.FuncOf(candidates),
+		"parse":      js.FuncOf(parse),
+		"rerank":     js.FuncOf(rerank),
+	}))
+	select {} // Keep the functions callable
+}
+
+func candidates(this js.Value, args []js.Value) any {
+	ips, err := task.Candidates(strings.FieldsFunc(stringArg(args, 0), func(r rune) bool { return r == ',' || r == '\n' }))
+	if err != nil {
+		return jsError(err)
+	}
+	list := make([]any, len(ips))
+	for i, ip := range ips {
+		list[i] = ip.String()
+	}
+	return list
+}
+
+func parse(this js.Value, args []js.Value) any {
+	results, err := utils.ParseResults(strings.NewReader(stringArg(args, 0)))
+	if err != nil {
+		return jsError(err)
+	}
+	list := make([]any, len(results))
+	for i, r := range results {
+		list[i] = map[string]any{
+			"ip":       r.IP.String(),
+			"lossRate": r.LossRate,
+			"delay":    float64(r.Delay) / float64(time.Millisecond),
+			"speed":    r.Speed / 1024 / 1024,
+		}
+	}
+	return list
+}
+
+func rerank(this js.Value, args []js.Value) any {
+	options := js.Undefined()
+	if len(args) > 1 {
+		options = args[1]
+	}
+	number := func(key string) float64 {
+		if v := option(options, key); v.Type() == js.TypeNumber {
+			return v.Float()
+		}
+		return 0
+	}
+	limits := utils.RankLimits{
+		MaxDelay: time.Duration(number("maxDelay") * float64(time.Millisecond)),
+		MinDelay: time.Duration(number("minDelay") * float64(time.Millisecond)),
+		MinSpeed: number("minSpeed") * 1024 * 1024,
+		ByDelay:  option(options, "byDelay").Truthy(),
+	}
+	if v := option(options, "maxLossRate"); v.Type() == js.TypeNumber {
+		rate := v.Float() // As [-tlr], 0 keeps only results without loss
+		limits.MaxLossRate = &rate
+	}
+	if v := option(options, "filter"); v.Type() == js.TypeString {
+		filter, err := utils.ParseFilter(v.String())
+		if err != nil {
+			return jsError(err)
+		}
+		limits.Filter = filter
+	}
+	format := ""
+	if v := option(options, "format"); v.Type() == js.TypeString {
+		format = v.String()
+	}
+	var out bytes.Buffer
+	if _, err := utils.Rerank(strings.NewReader(stringArg(args, 0)), &out, format, limits); err != nil {
+		return jsError(err)
+	}
+	return out.String()
+}
+
+func stringArg(args []js.Value, i int) string {
+	if i < len(args) && args[i].Type() == js.TypeString {
+		return args[i].String()
+	}
+	return ""
+}
+
+// Field key of an options object, undefined without one
+func option(options js.Value, key string) js.Value {
+	if options.Type() != js.TypeObject {
+		return js.Undefined()
+	}
+	return options.Get(key)
+}
+
+func jsError(err error) js.Value {
+	return js.Global().Get("Error").New(err.Error())
+}